@@ -0,0 +1,448 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// 阿里云百炼(DashScope)的实时语音合成及识别,使用websocket双工流式接口
+
+const AliWsUrl = "wss://dashscope.aliyuncs.com/api-ws/v1/inference/"
+
+const (
+	aliActionRunTask      = "run-task"
+	aliActionContinueTask = "continue-task"
+	aliActionFinishTask   = "finish-task"
+
+	aliEventTaskStarted     = "task-started"
+	aliEventResultGenerated = "result-generated"
+	aliEventTaskFinished    = "task-finished"
+	aliEventTaskFailed      = "task-failed"
+)
+
+type Header struct {
+	Action       string                 `json:"action,omitempty"`
+	TaskID       string                 `json:"task_id"`
+	Streaming    string                 `json:"streaming,omitempty"`
+	Event        string                 `json:"event,omitempty"`
+	ErrorCode    string                 `json:"error_code,omitempty"`
+	ErrorMessage string                 `json:"error_message,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type Sentence struct {
+	BeginTime   int64  `json:"begin_time"`
+	EndTime     *int64 `json:"end_time"` //句子没有结束时为null
+	Text        string `json:"text"`
+	SentenceEnd bool   `json:"sentence_end"`
+}
+
+type Output struct {
+	Sentence *Sentence `json:"sentence,omitempty"`
+}
+
+type Payload struct {
+	TaskGroup  string  `json:"task_group,omitempty"`
+	Task       string  `json:"task,omitempty"`
+	Function   string  `json:"function,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Parameters *Params `json:"parameters,omitempty"`
+	Input      Input   `json:"input"`
+	Output     *Output `json:"output,omitempty"`
+	Usage      any     `json:"usage,omitempty"`
+}
+
+type Params struct {
+	Format                   string   `json:"format,omitempty"`
+	SampleRate               int      `json:"sample_rate,omitempty"`
+	VocabularyID             string   `json:"vocabulary_id,omitempty"`
+	DisfluencyRemovalEnabled bool     `json:"disfluency_removal_enabled,omitempty"`
+	LanguageHints            []string `json:"language_hints,omitempty"`
+	TextType                 string   `json:"text_type,omitempty"`
+	Voice                    string   `json:"voice,omitempty"`
+	Volume                   int      `json:"volume,omitempty"`
+	Rate                     float64  `json:"rate,omitempty"`
+	Pitch                    float64  `json:"pitch,omitempty"`
+}
+
+type Input struct {
+	Text string `json:"text,omitempty"`
+}
+
+type Event struct {
+	Header  Header  `json:"header"`
+	Payload Payload `json:"payload"`
+}
+
+// AliTaskError 任务失败的错误,可以通过errors.As从返回的错误中获取
+type AliTaskError struct {
+	TaskID  string
+	Code    string
+	Message string
+}
+
+func (e *AliTaskError) Error() string {
+	return fmt.Sprintf("dashscope task:%s failed code:%s message:%s", e.TaskID, e.Code, e.Message)
+}
+
+type AliOption struct {
+	Url          string        //默认为AliWsUrl
+	MaxIdle      int           //保留的空闲连接数,默认2
+	MaxRetry     int           //建立连接失败时的重试次数,默认2
+	StartTimeout time.Duration //等待任务开始的超时时间,默认10秒
+}
+
+// Ali 管理到DashScope的连接,可以并发创建多个会话
+// 注意:不支持在一个连接上并发执行多个会话。DashScope的二进制音频帧不带task_id,无法按任务分发,
+// 协议上一个连接同时只能执行一个任务;并发的会话各自占用一个连接,任务结束后连接回到空闲池复用,
+// 并发数较高时需要相应调整MaxIdle
+type Ali struct {
+	apiKey string
+	opt    AliOption
+	dialer *websocket.Dialer
+	mutex  sync.Mutex
+	idle   []*aliConn
+}
+
+func NewAli(apiKey string, opts ...AliOption) *Ali {
+	var opt AliOption
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Url == "" {
+		opt.Url = AliWsUrl
+	}
+	if opt.MaxIdle <= 0 {
+		opt.MaxIdle = 2
+	}
+	if opt.MaxRetry <= 0 {
+		opt.MaxRetry = 2
+	}
+	if opt.StartTimeout <= 0 {
+		opt.StartTimeout = 10 * time.Second
+	}
+	return &Ali{apiKey: apiKey, opt: opt, dialer: websocket.DefaultDialer}
+}
+
+// Close 关闭空闲的连接,进行中的会话不受影响
+func (a *Ali) Close() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, c := range a.idle {
+		c.ws.Close()
+	}
+	a.idle = nil
+}
+
+// 获取空闲的连接,没有时新建,reused表示是否复用的连接
+func (a *Ali) acquire(ctx context.Context) (conn *aliConn, reused bool, err error) {
+	a.mutex.Lock()
+	for len(a.idle) > 0 {
+		c := a.idle[len(a.idle)-1]
+		a.idle = a.idle[:len(a.idle)-1]
+		if c.alive() {
+			a.mutex.Unlock()
+			return c, true, nil
+		}
+		c.ws.Close()
+	}
+	a.mutex.Unlock()
+	header := make(http.Header)
+	header.Add("X-DashScope-DataInspection", "enable")
+	header.Add("Authorization", "bearer "+a.apiKey)
+	for attempt := 0; ; attempt++ {
+		ws, _, err := a.dialer.DialContext(ctx, a.opt.Url, header)
+		if err == nil {
+			conn = &aliConn{ws: ws}
+			utils.Go(context.Background(), conn.readLoop)
+			return conn, false, nil
+		}
+		if attempt >= a.opt.MaxRetry || ctx.Err() != nil {
+			return nil, false, errors.System.AddDetail(err)
+		}
+		logx.WithContext(ctx).Infof("dashscope dial retry attempt:%d err:%v", attempt+1, err)
+		select {
+		case <-time.After(200 * time.Millisecond << attempt):
+		case <-ctx.Done():
+			return nil, false, errors.Fmt(ctx.Err())
+		}
+	}
+}
+
+func (a *Ali) release(c *aliConn) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if c.alive() && len(a.idle) < a.opt.MaxIdle {
+		a.idle = append(a.idle, c)
+		return
+	}
+	c.ws.Close()
+}
+
+// start 发送run-task并等待task-started,复用的连接已经断开时重新建立连接
+func (a *Ali) start(ctx context.Context, payload Payload) (*aliSession, error) {
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := a.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s := newAliSession(a, conn, uuid.NewString())
+		conn.setSession(s)
+		err = conn.writeJson(&Event{
+			Header:  Header{Action: aliActionRunTask, TaskID: s.taskID, Streaming: "duplex"},
+			Payload: payload,
+		})
+		if err == nil {
+			err = s.waitStarted(ctx, a.opt.StartTimeout)
+			if err == nil {
+				s.watch(ctx)
+				return s, nil
+			}
+		}
+		s.abort(err)
+		var taskErr *AliTaskError
+		if !reused || attempt > 0 || errors.As(err, &taskErr) || ctx.Err() != nil {
+			return nil, err
+		}
+		logx.WithContext(ctx).Infof("dashscope idle connection is broken, reconnect err:%v", err)
+	}
+}
+
+type aliConn struct {
+	ws         *websocket.Conn
+	writeMutex sync.Mutex
+	mutex      sync.Mutex
+	cur        *aliSession
+	err        error //连接断开的原因,不为nil时不能再使用
+}
+
+func (c *aliConn) alive() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err == nil
+}
+
+func (c *aliConn) setSession(s *aliSession) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cur = s
+}
+
+func (c *aliConn) writeJson(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	return c.write(websocket.TextMessage, data)
+}
+
+func (c *aliConn) write(messageType int, data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if err := c.ws.WriteMessage(messageType, data); err != nil {
+		c.mutex.Lock()
+		c.err = err
+		c.mutex.Unlock()
+		return errors.System.AddDetail(err)
+	}
+	return nil
+}
+
+// readLoop 将消息分发给当前的会话,连接断开后退出
+func (c *aliConn) readLoop() {
+	for {
+		messageType, data, err := c.ws.ReadMessage()
+		c.mutex.Lock()
+		s := c.cur
+		if err != nil {
+			c.err = err
+		}
+		c.mutex.Unlock()
+		if err != nil {
+			if s != nil {
+				s.deliver(aliMsg{err: errors.System.AddDetail(err)})
+			}
+			return
+		}
+		if s == nil { //没有任务时的消息忽略
+			continue
+		}
+		if messageType == websocket.BinaryMessage {
+			s.deliver(aliMsg{audio: data})
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			logx.Errorf("dashscope event:%s err:%v", data, err)
+			continue
+		}
+		if event.Header.TaskID == s.taskID {
+			s.deliver(aliMsg{event: &event})
+		}
+	}
+}
+
+type aliMsg struct {
+	audio []byte
+	event *Event
+	err   error //连接断开
+}
+
+// aliSession 一个任务,TTSSession和ASRSession共用
+type aliSession struct {
+	ali    *Ali
+	conn   *aliConn
+	taskID string
+	msgs   chan aliMsg
+	done   chan struct{} //会话结束后关闭,不再接收消息
+	once   sync.Once
+	mutex  sync.Mutex
+	endErr error       //结束的原因,正常结束为io.EOF
+	stop   func() bool //取消watch注册的回调,和endErr一样由mutex保护
+}
+
+func newAliSession(a *Ali, conn *aliConn, taskID string) *aliSession {
+	return &aliSession{ali: a, conn: conn, taskID: taskID, msgs: make(chan aliMsg, 64), done: make(chan struct{})}
+}
+
+func (s *aliSession) deliver(m aliMsg) {
+	select {
+	case s.msgs <- m:
+	case <-s.done:
+	}
+}
+
+func (s *aliSession) waitStarted(ctx context.Context, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-s.msgs:
+			if m.err != nil {
+				return m.err
+			}
+			if m.event == nil {
+				continue
+			}
+			switch m.event.Header.Event {
+			case aliEventTaskStarted:
+				return nil
+			case aliEventTaskFailed:
+				return taskError(m.event)
+			}
+		case <-timer.C:
+			return errors.TimeOut.AddDetail("wait dashscope task-started timeout")
+		case <-ctx.Done():
+			return errors.Fmt(ctx.Err())
+		}
+	}
+}
+
+// watch ctx结束后中止会话
+func (s *aliSession) watch(ctx context.Context) {
+	stop := context.AfterFunc(ctx, func() {
+		s.abort(errors.Fmt(ctx.Err()))
+	})
+	s.mutex.Lock()
+	ended := s.endErr != nil
+	s.stop = stop
+	s.mutex.Unlock()
+	if ended { //注册前会话已经结束
+		stop()
+	}
+}
+
+// next 返回下一条音频或者result-generated事件,任务结束后返回io.EOF
+func (s *aliSession) next() (aliMsg, error) {
+	if err := s.ended(); err != nil {
+		return aliMsg{}, err
+	}
+	select {
+	case m := <-s.msgs:
+		if m.err != nil {
+			s.abort(m.err)
+			return m, m.err
+		}
+		if m.event != nil {
+			switch m.event.Header.Event {
+			case aliEventTaskFinished:
+				s.end(io.EOF, true)
+				return m, io.EOF
+			case aliEventTaskFailed:
+				err := taskError(m.event)
+				s.abort(err)
+				return m, err
+			}
+		}
+		return m, nil
+	case <-s.done:
+		return aliMsg{}, s.ended()
+	}
+}
+
+func (s *aliSession) ended() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.endErr
+}
+
+func (s *aliSession) send(action string, text string) error {
+	if err := s.ended(); err != nil {
+		return err
+	}
+	return s.conn.writeJson(&Event{
+		Header:  Header{Action: action, TaskID: s.taskID, Streaming: "duplex"},
+		Payload: Payload{Input: Input{Text: text}},
+	})
+}
+
+func (s *aliSession) sendAudio(data []byte) error {
+	if err := s.ended(); err != nil {
+		return err
+	}
+	return s.conn.write(websocket.BinaryMessage, data)
+}
+
+// abort 异常结束,连接状态未知,直接关闭
+func (s *aliSession) abort(err error) {
+	s.end(err, false)
+}
+
+// end 结束会话,reuse为true时连接回到空闲池
+func (s *aliSession) end(err error, reuse bool) {
+	s.once.Do(func() {
+		s.mutex.Lock()
+		s.endErr = err
+		stop := s.stop
+		s.mutex.Unlock()
+		if stop != nil {
+			stop()
+		}
+		s.conn.setSession(nil)
+		close(s.done)
+		if reuse {
+			s.ali.release(s.conn)
+		} else {
+			s.conn.ws.Close()
+		}
+	})
+}
+
+func (s *aliSession) close() {
+	s.abort(errors.System.AddDetail("dashscope session closed"))
+}
+
+func taskError(e *Event) error {
+	return errors.Wrap(&AliTaskError{TaskID: e.Header.TaskID, Code: e.Header.ErrorCode, Message: e.Header.ErrorMessage}, errors.System)
+}
@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTTS(t *testing.T, s *TTSSession) string {
+	var ret []byte
+	for {
+		data, err := s.Recv()
+		if err == io.EOF {
+			return string(ret)
+		}
+		require.NoError(t, err)
+		ret = append(ret, data...)
+	}
+}
+
+func TestAliTTS(t *testing.T) {
+	srv := newFakeAliServer(t)
+	cli := NewAli("key", AliOption{Url: srv.url()})
+	defer cli.Close()
+	ctx := context.Background()
+
+	//并发的会话使用不同的连接
+	var wg sync.WaitGroup
+	for _, text := range []string{"床前明月光", "疑是地上霜"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := cli.StartTTS(ctx, TTSOptions{})
+			require.NoError(t, err)
+			require.NoError(t, s.SendText(text))
+			require.NoError(t, s.SendText("。"))
+			require.NoError(t, s.Finish())
+			assert.Equal(t, text+"。", readTTS(t, s))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), srv.conns.Load())
+
+	//结束的任务的连接被复用
+	s, err := cli.StartTTS(ctx, TTSOptions{Voice: "longwan"})
+	require.NoError(t, err)
+	require.NoError(t, s.Finish())
+	assert.Equal(t, "", readTTS(t, s))
+	assert.Equal(t, int32(2), srv.conns.Load())
+
+	//任务失败返回AliTaskError
+	_, err = cli.StartTTS(ctx, TTSOptions{Model: "bad"})
+	var taskErr *AliTaskError
+	require.True(t, errors.As(err, &taskErr))
+	assert.Equal(t, "InvalidParameter", taskErr.Code)
+
+	//连接断开后返回错误,之后的会话重新建立连接
+	s, err = cli.StartTTS(ctx, TTSOptions{})
+	require.NoError(t, err)
+	require.NoError(t, s.SendText("drop"))
+	_, err = s.Recv()
+	require.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+	s, err = cli.StartTTS(ctx, TTSOptions{})
+	require.NoError(t, err)
+	require.NoError(t, s.SendText("ok"))
+	require.NoError(t, s.Finish())
+	assert.Equal(t, "ok", readTTS(t, s))
+}
+
+func TestAliASR(t *testing.T) {
+	srv := newFakeAliServer(t)
+	cli := NewAli("key", AliOption{Url: srv.url()})
+	defer cli.Close()
+
+	s, err := cli.StartASR(context.Background(), ASROptions{LanguageHints: []string{"zh"}})
+	require.NoError(t, err)
+	require.NoError(t, s.SendAudio([]byte("你好")))
+	ret, err := s.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, &Transcript{Text: "你好"}, ret)
+	require.NoError(t, s.SendAudio([]byte("世界")))
+	require.NoError(t, s.Finish())
+	var final *Transcript
+	for {
+		ret, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		final = ret
+	}
+	assert.Equal(t, &Transcript{Text: "你好世界。", EndTime: 1000, SentenceEnd: true}, final)
+	assert.Error(t, s.SendAudio([]byte("x")), "结束后不能再发送")
+
+	//ctx结束后中止会话
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err = cli.StartASR(ctx, ASROptions{})
+	require.NoError(t, err)
+	cancel()
+	done := make(chan error)
+	go func() {
+		_, err := s.Recv()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Recv没有在ctx结束后返回")
+	}
+
+	_, err = NewAli("wrong", AliOption{Url: srv.url(), MaxRetry: 1}).StartASR(context.Background(), ASROptions{})
+	assert.Error(t, err)
+}
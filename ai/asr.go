@@ -1,74 +1,99 @@
 package ai
 
 import (
-	"encoding/json"
-	"github.com/gorilla/websocket"
-	"os"
+	"context"
 )
 
-const (
-	outputFile = "output.mp3" // 输出文件路径
-)
+type ASROptions struct {
+	Model                    string   //默认paraformer-realtime-v2
+	Format                   string   //pcm,wav,opus,mp3等,默认pcm
+	SampleRate               int      //默认16000
+	LanguageHints            []string //如zh,en
+	VocabularyID             string   //热词
+	DisfluencyRemovalEnabled bool     //过滤语气词
+}
 
-// 发送待合成文本
-func sendContinueTaskCmd(conn *websocket.Conn, taskID string) error {
-	texts := []string{"床前明月光", "疑是地上霜", "举头望明月", "低头思故乡"}
+type Transcript struct {
+	Text        string
+	BeginTime   int64 //毫秒
+	EndTime     int64
+	SentenceEnd bool //为false时是中间结果,后续会更新同一句话
+}
 
-	for _, text := range texts {
-		runTaskCmd, err := generateContinueTaskCmd(text, taskID)
-		if err != nil {
-			return err
-		}
+// ASRSession 实时语音识别,SendAudio发送音频,Recv接收识别结果
+type ASRSession struct {
+	s *aliSession
+}
 
-		err = conn.WriteMessage(websocket.TextMessage, []byte(runTaskCmd))
-		if err != nil {
-			return err
-		}
+// StartASR 开始语音识别任务,ctx结束后任务中止;每个会话独占一个连接,见Ali的说明
+func (a *Ali) StartASR(ctx context.Context, opt ASROptions) (*ASRSession, error) {
+	params := &Params{
+		Format:                   opt.Format,
+		SampleRate:               opt.SampleRate,
+		LanguageHints:            opt.LanguageHints,
+		VocabularyID:             opt.VocabularyID,
+		DisfluencyRemovalEnabled: opt.DisfluencyRemovalEnabled,
+	}
+	if opt.Model == "" {
+		opt.Model = "paraformer-realtime-v2"
+	}
+	if params.Format == "" {
+		params.Format = "pcm"
+	}
+	if params.SampleRate == 0 {
+		params.SampleRate = 16000
 	}
+	s, err := a.start(ctx, Payload{
+		TaskGroup:  "audio",
+		Task:       "asr",
+		Function:   "recognition",
+		Model:      opt.Model,
+		Parameters: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ASRSession{s: s}, nil
+}
 
-	return nil
+func (t *ASRSession) TaskID() string {
+	return t.s.taskID
 }
 
-// 生成continue-task指令
-func generateContinueTaskCmd(text string, taskID string) (string, error) {
-	runTaskCmd := Event{
-		Header: Header{
-			Action:    "continue-task",
-			TaskID:    taskID,
-			Streaming: "duplex",
-		},
-		Payload: Payload{
-			Input: Input{
-				Text: text,
-			},
-		},
-	}
-	runTaskCmdJSON, err := json.Marshal(runTaskCmd)
-	return string(runTaskCmdJSON), err
+// SendAudio 发送一段音频,建议每100毫秒发送一次
+func (t *ASRSession) SendAudio(data []byte) error {
+	return t.s.sendAudio(data)
 }
 
-// 写入二进制数据到文件
-func writeBinaryDataToFile(data []byte, filePath string) error {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+// Finish 音频发送完毕,剩余的结果返回后Recv返回io.EOF
+func (t *ASRSession) Finish() error {
+	return t.s.send(aliActionFinishTask, "")
+}
 
-	_, err = file.Write(data)
-	if err != nil {
-		return err
+// Recv 接收识别结果,任务正常结束返回io.EOF,失败返回的错误中包含AliTaskError
+func (t *ASRSession) Recv() (*Transcript, error) {
+	for {
+		m, err := t.s.next()
+		if err != nil {
+			return nil, err
+		}
+		if m.event == nil || m.event.Header.Event != aliEventResultGenerated || m.event.Payload.Output == nil {
+			continue
+		}
+		sentence := m.event.Payload.Output.Sentence
+		if sentence == nil {
+			continue
+		}
+		ret := &Transcript{Text: sentence.Text, BeginTime: sentence.BeginTime, SentenceEnd: sentence.SentenceEnd}
+		if sentence.EndTime != nil {
+			ret.EndTime = *sentence.EndTime
+			ret.SentenceEnd = true
+		}
+		return ret, nil
 	}
-
-	return nil
 }
 
-// 清空输出文件
-func clearOutputFile(filePath string) error {
-	file, err := os.OpenFile(filePath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	file.Close()
-	return nil
+// Close 中止任务,任务没有正常结束时会关闭连接
+func (t *ASRSession) Close() {
+	t.s.close()
 }
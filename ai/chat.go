@@ -0,0 +1,161 @@
+package ai
+
+import (
+	"context"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool" //工具调用的结果
+)
+
+const (
+	FinishStop      = "stop"
+	FinishLength    = "length"
+	FinishToolCalls = "tool_calls"
+)
+
+type ChatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`  //assistant要求调用的工具
+	ToolCallID string     `json:"toolCallID,omitempty"` //role为tool时对应的调用ID
+}
+
+// Tool 可以提供给模型调用的函数
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"` //参数的json schema
+}
+
+type ToolCall struct {
+	Index     int    `json:"index"` //流式应答中同一个调用的增量Index相同
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` //json格式的参数
+}
+
+type ChatRequest struct {
+	Model          string         `json:"model"` //为空时使用配置的模型
+	Messages       []ChatMessage  `json:"messages"`
+	Tools          []Tool         `json:"tools,omitempty"`
+	Temperature    *float64       `json:"temperature,omitempty"`
+	MaxTokens      int            `json:"maxTokens,omitempty"`
+	User           string         `json:"user,omitempty"`
+	ConversationID string         `json:"conversationID,omitempty"` //服务端保存会话的提供方(dify)使用
+	Inputs         map[string]any `json:"inputs,omitempty"`         //dify应用的变量
+}
+
+type Usage struct {
+	PromptTokens     int64 `json:"promptTokens"`
+	CompletionTokens int64 `json:"completionTokens"`
+	TotalTokens      int64 `json:"totalTokens"`
+}
+
+type ChatResponse struct {
+	ID             string      `json:"id"`
+	Message        ChatMessage `json:"message"`
+	FinishReason   string      `json:"finishReason"`
+	Usage          Usage       `json:"usage"`
+	ConversationID string      `json:"conversationID,omitempty"`
+}
+
+// ChatDelta 流式应答的增量,Err不为nil时流结束
+type ChatDelta struct {
+	ID             string     `json:"id"`
+	Content        string     `json:"content"`
+	ToolCalls      []ToolCall `json:"toolCalls,omitempty"` //Name及Arguments为增量
+	FinishReason   string     `json:"finishReason,omitempty"`
+	Usage          *Usage     `json:"usage,omitempty"` //一般只在最后返回
+	ConversationID string     `json:"conversationID,omitempty"`
+	Err            error      `json:"-"`
+}
+
+type Chat interface {
+	// Chat 等待完整的应答
+	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+	// ChatStream 返回的通道在应答结束,出错或者ctx结束后关闭
+	ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatDelta, error)
+}
+
+// NewChat 按配置创建对话的实现
+func NewChat(c conf.LlmConf) (Chat, error) {
+	var (
+		cli Chat
+		err error
+	)
+	switch c.Mode {
+	case conf.LlmOpenai:
+		cli, err = NewOpenaiChat(c)
+	case conf.LlmDify:
+		cli, err = NewDifyChat(c)
+	case conf.LlmFake:
+		cli = NewFakeChat()
+	default:
+		err = errors.Parameter.AddMsgf("不支持的大模型类型:%s", c.Mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// CollectStream 将流式的增量合并成完整的应答,出错时返回已经合并的部分
+func CollectStream(c <-chan *ChatDelta) (*ChatResponse, error) {
+	ret := &ChatResponse{Message: ChatMessage{Role: RoleAssistant}}
+	var content []byte
+	for d := range c {
+		if d.Err != nil {
+			ret.Message.Content = string(content)
+			return ret, d.Err
+		}
+		if d.ID != "" {
+			ret.ID = d.ID
+		}
+		if d.ConversationID != "" {
+			ret.ConversationID = d.ConversationID
+		}
+		content = append(content, d.Content...)
+		for _, tc := range d.ToolCalls {
+			ret.Message.ToolCalls = mergeToolCall(ret.Message.ToolCalls, tc)
+		}
+		if d.FinishReason != "" {
+			ret.FinishReason = d.FinishReason
+		}
+		if d.Usage != nil {
+			ret.Usage = *d.Usage
+		}
+	}
+	ret.Message.Content = string(content)
+	return ret, nil
+}
+
+func mergeToolCall(calls []ToolCall, delta ToolCall) []ToolCall {
+	for i := range calls {
+		if calls[i].Index == delta.Index {
+			if delta.ID != "" {
+				calls[i].ID = delta.ID
+			}
+			calls[i].Name += delta.Name
+			calls[i].Arguments += delta.Arguments
+			return calls
+		}
+	}
+	return append(calls, delta)
+}
+
+// 流式应答写入通道,ctx结束时返回false
+func sendDelta(ctx context.Context, c chan<- *ChatDelta, d *ChatDelta) bool {
+	select {
+	case c <- d:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
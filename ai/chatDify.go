@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+
+	"gitee.com/unitedrhino/share/ai/dify"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+)
+
+// DifyChat 使用dify的对话型应用,提示词及工具在dify中配置,会话保存在dify中(通过ConversationID继续)
+// 只发送最后一条用户消息,不支持Tools
+type DifyChat struct {
+	cli *dify.DifyClient
+}
+
+func NewDifyChat(c conf.LlmConf) (*DifyChat, error) {
+	cli, err := dify.NewDifyClient(dify.DifyClientConfig{
+		Key:      c.Key,
+		Host:     c.Host,
+		Timeout:  int(c.Timeout),
+		User:     c.User,
+		MaxRetry: c.MaxRetry,
+	})
+	if err != nil {
+		return nil, errors.Parameter.AddDetail(err)
+	}
+	return &DifyChat{cli: cli}, nil
+}
+
+func (d *DifyChat) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	ctx, query, inputs, err := d.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := d.cli.ChatMessages(ctx, inputs, query, req.ConversationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatResponse{
+		ID:             ret.MessageID,
+		Message:        ChatMessage{Role: RoleAssistant, Content: ret.Answer},
+		FinishReason:   FinishStop,
+		Usage:          difyUsage(ret.Metadata),
+		ConversationID: ret.ConversationID,
+	}, nil
+}
+
+func (d *DifyChat) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatDelta, error) {
+	ctx, query, inputs, err := d.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	events, err := d.cli.ChatMessagesStreaming(ctx, inputs, query, req.ConversationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *ChatDelta, 10)
+	utils.Go(ctx, func() {
+		defer close(c)
+		for e := range events {
+			delta := &ChatDelta{ID: e.MessageID, ConversationID: e.ConversationID}
+			switch e.Event {
+			case "message", "agent_message":
+				delta.Content = e.Answer
+			case "message_end":
+				usage := difyUsage(e.Metadata)
+				delta.Usage = &usage
+				delta.FinishReason = FinishStop
+			case dify.EVENT_ERROR:
+				delta.Err = errors.Wrap(&dify.Error{Status: e.Status, Code: e.Code, Message: e.Message}, errors.System)
+			default: //ping,tts等事件忽略
+				continue
+			}
+			if !sendDelta(ctx, c, delta) || delta.Err != nil {
+				return
+			}
+		}
+	})
+	return c, nil
+}
+
+func (d *DifyChat) prepare(ctx context.Context, req *ChatRequest) (context.Context, string, map[string]any, error) {
+	if len(req.Tools) > 0 {
+		return ctx, "", nil, errors.NotRealize.AddDetail("dify chat does not support tools")
+	}
+	query := lastUserContent(req)
+	if query == "" {
+		return ctx, "", nil, errors.Parameter.AddDetail("user message is required")
+	}
+	if req.User != "" {
+		ctx = dify.WithUser(ctx, req.User)
+	}
+	inputs := req.Inputs
+	if inputs == nil { //dify要求inputs为对象
+		inputs = map[string]any{}
+	}
+	return ctx, query, inputs, nil
+}
+
+// dify的用量在metadata.usage中
+func difyUsage(metadata any) Usage {
+	var ret struct {
+		Usage struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+			TotalTokens      int64 `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	data, _ := json.Marshal(metadata)
+	_ = json.Unmarshal(data, &ret)
+	return Usage{PromptTokens: ret.Usage.PromptTokens, CompletionTokens: ret.Usage.CompletionTokens, TotalTokens: ret.Usage.TotalTokens}
+}
@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"unicode/utf8"
+
+	"gitee.com/unitedrhino/share/utils"
+)
+
+// FakeChat 用于测试的确定性实现,按顺序返回设置的应答,用完后回显最后一条用户消息
+// 用量按字符数计算,流式应答每个增量最多fakeChunkSize个字符
+type FakeChat struct {
+	mutex    sync.Mutex
+	replies  []*ChatResponse
+	requests []*ChatRequest
+}
+
+const fakeChunkSize = 4
+
+func NewFakeChat(replies ...*ChatResponse) *FakeChat {
+	return &FakeChat{replies: replies}
+}
+
+// Reply 追加应答
+func (f *FakeChat) Reply(replies ...*ChatResponse) *FakeChat {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.replies = append(f.replies, replies...)
+	return f
+}
+
+// Requests 返回收到的请求
+func (f *FakeChat) Requests() []*ChatRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]*ChatRequest(nil), f.requests...)
+}
+
+func (f *FakeChat) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests = append(f.requests, req)
+	var ret ChatResponse
+	if len(f.replies) > 0 {
+		ret = *f.replies[0]
+		f.replies = f.replies[1:]
+	} else {
+		ret.Message.Content = "echo:" + lastUserContent(req)
+	}
+	if ret.Message.Role == "" {
+		ret.Message.Role = RoleAssistant
+	}
+	if ret.FinishReason == "" {
+		ret.FinishReason = FinishStop
+		if len(ret.Message.ToolCalls) > 0 {
+			ret.FinishReason = FinishToolCalls
+		}
+	}
+	if ret.Usage == (Usage{}) {
+		var prompt int64
+		for _, m := range req.Messages {
+			prompt += int64(utf8.RuneCountInString(m.Content))
+		}
+		completion := int64(utf8.RuneCountInString(ret.Message.Content))
+		ret.Usage = Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	}
+	return &ret, nil
+}
+
+func (f *FakeChat) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatDelta, error) {
+	ret, err := f.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *ChatDelta, 10)
+	utils.Go(ctx, func() {
+		defer close(c)
+		content := []rune(ret.Message.Content)
+		for len(content) > 0 {
+			n := min(len(content), fakeChunkSize)
+			if !sendDelta(ctx, c, &ChatDelta{ID: ret.ID, Content: string(content[:n])}) {
+				return
+			}
+			content = content[n:]
+		}
+		for i, tc := range ret.Message.ToolCalls {
+			tc.Index = i
+			if !sendDelta(ctx, c, &ChatDelta{ID: ret.ID, ToolCalls: []ToolCall{tc}}) {
+				return
+			}
+		}
+		sendDelta(ctx, c, &ChatDelta{ID: ret.ID, FinishReason: ret.FinishReason, Usage: &ret.Usage, ConversationID: ret.ConversationID})
+	})
+	return c, nil
+}
+
+func lastUserContent(req *ChatRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,280 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+)
+
+const openaiRetryWait = 500 * time.Millisecond
+
+// OpenaiChat openai兼容的/chat/completions接口,vLLM,Ollama等本地部署的服务都支持
+type OpenaiChat struct {
+	host     string
+	key      string
+	model    string
+	maxRetry int
+	client   *http.Client //非流式请求使用,带超时
+	stream   *http.Client //流式请求的超时由ctx控制
+}
+
+// OpenaiError 接口返回的错误,可以通过errors.As从返回的错误中获取
+type OpenaiError struct {
+	Status  int    `json:"-"`
+	Type    string `json:"type"`
+	Code    any    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *OpenaiError) Error() string {
+	return fmt.Sprintf("openai status:%d type:%s code:%v message:%s", e.Status, e.Type, e.Code, e.Message)
+}
+
+func NewOpenaiChat(c conf.LlmConf) (*OpenaiChat, error) {
+	host := strings.TrimRight(strings.TrimSpace(c.Host), "/")
+	if host == "" {
+		return nil, errors.Parameter.AddDetail("llm host is required")
+	}
+	timeout := time.Duration(c.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &OpenaiChat{
+		host:     host,
+		key:      c.Key,
+		model:    c.Model,
+		maxRetry: max(c.MaxRetry, 0),
+		client:   &http.Client{Timeout: timeout},
+		stream:   &http.Client{},
+	}, nil
+}
+
+type openaiFunction struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Arguments   string `json:"arguments,omitempty"`
+}
+
+type openaiToolCall struct {
+	Index    *int           `json:"index,omitempty"`
+	ID       string         `json:"id,omitempty"`
+	Type     string         `json:"type,omitempty"`
+	Function openaiFunction `json:"function"`
+}
+
+type openaiMessage struct {
+	Role       string           `json:"role,omitempty"`
+	Content    string           `json:"content"`
+	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openaiTool struct {
+	Type     string         `json:"type"`
+	Function openaiFunction `json:"function"`
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openaiRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openaiMessage      `json:"messages"`
+	Tools         []openaiTool         `json:"tools,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	User          string               `json:"user,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openaiStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openaiUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+type openaiResponse struct {
+	ID      string `json:"id"`
+	Choices []struct {
+		Message      openaiMessage `json:"message"`
+		Delta        openaiMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openaiUsage `json:"usage"`
+}
+
+func (o *OpenaiChat) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	resp, err := o.do(ctx, o.client, o.toRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ret openaiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	if len(ret.Choices) == 0 {
+		return nil, errors.System.AddDetail("llm response without choices")
+	}
+	choice := ret.Choices[0]
+	return &ChatResponse{
+		ID:           ret.ID,
+		Message:      fromOpenaiMessage(choice.Message),
+		FinishReason: choice.FinishReason,
+		Usage:        fromOpenaiUsage(ret.Usage),
+	}, nil
+}
+
+func (o *OpenaiChat) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatDelta, error) {
+	resp, err := o.do(ctx, o.stream, o.toRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *ChatDelta, 10)
+	utils.Go(ctx, func() {
+		defer resp.Body.Close()
+		defer close(c)
+		reader := utils.NewSseReader(resp.Body)
+		for {
+			event, err := reader.Next()
+			if err == io.EOF { //部分服务不发送[DONE]
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					sendDelta(ctx, c, &ChatDelta{Err: errors.System.AddDetail(err)})
+				}
+				return
+			}
+			if event.Data == "[DONE]" {
+				return
+			}
+			var chunk openaiResponse
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				sendDelta(ctx, c, &ChatDelta{Err: errors.System.AddDetailf("llm stream chunk:%s err:%v", event.Data, err)})
+				return
+			}
+			d := &ChatDelta{ID: chunk.ID}
+			if chunk.Usage != nil {
+				usage := fromOpenaiUsage(chunk.Usage)
+				d.Usage = &usage
+			}
+			if len(chunk.Choices) > 0 {
+				choice := chunk.Choices[0]
+				d.Content = choice.Delta.Content
+				d.ToolCalls = fromOpenaiToolCalls(choice.Delta.ToolCalls)
+				d.FinishReason = choice.FinishReason
+			}
+			if !sendDelta(ctx, c, d) {
+				return
+			}
+		}
+	})
+	return c, nil
+}
+
+func (o *OpenaiChat) toRequest(req *ChatRequest, stream bool) *openaiRequest {
+	ret := &openaiRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		User:        req.User,
+		Stream:      stream,
+	}
+	if ret.Model == "" {
+		ret.Model = o.model
+	}
+	if stream {
+		ret.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
+	}
+	for _, m := range req.Messages {
+		om := openaiMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, tc := range m.ToolCalls {
+			om.ToolCalls = append(om.ToolCalls, openaiToolCall{
+				ID:       tc.ID,
+				Type:     "function",
+				Function: openaiFunction{Name: tc.Name, Arguments: tc.Arguments},
+			})
+		}
+		ret.Messages = append(ret.Messages, om)
+	}
+	for _, t := range req.Tools {
+		ret.Tools = append(ret.Tools, openaiTool{
+			Type:     "function",
+			Function: openaiFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters},
+		})
+	}
+	return ret
+}
+
+func fromOpenaiMessage(m openaiMessage) ChatMessage {
+	return ChatMessage{
+		Role:       m.Role,
+		Content:    m.Content,
+		ToolCalls:  fromOpenaiToolCalls(m.ToolCalls),
+		ToolCallID: m.ToolCallID,
+	}
+}
+
+func fromOpenaiToolCalls(calls []openaiToolCall) []ToolCall {
+	var ret []ToolCall
+	for i, tc := range calls {
+		index := i
+		if tc.Index != nil {
+			index = *tc.Index
+		}
+		ret = append(ret, ToolCall{Index: index, ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+	}
+	return ret
+}
+
+func fromOpenaiUsage(u *openaiUsage) Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// do 发送请求,按utils.HttpRetry的策略重试,非2xx的应答返回OpenaiError
+func (o *OpenaiChat) do(ctx context.Context, client *http.Client, payload *openaiRequest) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Parameter.AddDetail(err)
+	}
+	retry := utils.HttpRetry{MaxRetry: o.maxRetry, Wait: openaiRetryWait}
+	return retry.Do(ctx, client, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.host+"/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if o.key != "" {
+			req.Header.Set("Authorization", "Bearer "+o.key)
+		}
+		return req, nil
+	}, parseOpenaiError)
+}
+
+func parseOpenaiError(status int, body []byte) error {
+	var ret struct {
+		Error *OpenaiError `json:"error"`
+	}
+	e := &OpenaiError{Message: string(body)}
+	if err := json.Unmarshal(body, &ret); err == nil && ret.Error != nil {
+		e = ret.Error
+	}
+	e.Status = status
+	return errors.Wrap(e, utils.HttpStatusErr(status))
+}
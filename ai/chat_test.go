@@ -0,0 +1,99 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOpenaiServer(t *testing.T) *OpenaiChat {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"invalid key","type":"auth"}}`)
+			return
+		}
+		var req openaiRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "qwen", req.Model)
+		if !req.Stream {
+			require.Len(t, req.Tools, 1)
+			assert.Equal(t, "function", req.Tools[0].Type)
+			fmt.Fprint(w, `{"id":"c1","choices":[{"message":{"role":"assistant","content":"","tool_calls":[{"id":"t1","type":"function","function":{"name":"light","arguments":"{\"on\":true}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+			return
+		}
+		assert.True(t, req.StreamOptions.IncludeUsage)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"id":"c2","choices":[{"delta":{"role":"assistant","content":"你"}}]}`,
+			`{"id":"c2","choices":[{"delta":{"content":"好"}}]}`,
+			`{"id":"c2","choices":[{"delta":{"tool_calls":[{"index":0,"id":"t1","function":{"name":"light","arguments":"{\"on\""}}]}}]}`,
+			`{"id":"c2","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":":false}"}}]},"finish_reason":"tool_calls"}]}`,
+			`{"id":"c2","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	cli, err := NewOpenaiChat(conf.LlmConf{Host: srv.URL + "/", Key: "sk", Model: "qwen"})
+	require.NoError(t, err)
+	return cli
+}
+
+func TestOpenaiChat(t *testing.T) {
+	cli := newOpenaiServer(t)
+	req := &ChatRequest{
+		Messages: []ChatMessage{{Role: RoleUser, Content: "开灯"}},
+		Tools:    []Tool{{Name: "light", Parameters: map[string]any{"type": "object"}}},
+	}
+	ret, err := cli.Chat(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, FinishToolCalls, ret.FinishReason)
+	assert.Equal(t, ToolCall{ID: "t1", Name: "light", Arguments: `{"on":true}`}, ret.Message.ToolCalls[0])
+	assert.Equal(t, int64(15), ret.Usage.TotalTokens)
+
+	c, err := cli.ChatStream(context.Background(), &ChatRequest{Messages: req.Messages})
+	require.NoError(t, err)
+	ret, err = CollectStream(c)
+	require.NoError(t, err)
+	assert.Equal(t, "你好", ret.Message.Content)
+	assert.Equal(t, `{"on":false}`, ret.Message.ToolCalls[0].Arguments)
+	assert.Equal(t, int64(5), ret.Usage.TotalTokens)
+
+	cli.key = "bad"
+	_, err = cli.Chat(context.Background(), req)
+	var e *OpenaiError
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "invalid key", e.Message)
+	assert.Equal(t, errors.Permissions.Code, errors.Fmt(err).Code)
+}
+
+func TestFakeChat(t *testing.T) {
+	cli, err := NewChat(conf.LlmConf{Mode: conf.LlmFake})
+	require.NoError(t, err)
+	req := &ChatRequest{Messages: []ChatMessage{{Role: RoleUser, Content: "hello world"}}}
+	c, err := cli.ChatStream(context.Background(), req)
+	require.NoError(t, err)
+	ret, err := CollectStream(c)
+	require.NoError(t, err)
+	assert.Equal(t, "echo:hello world", ret.Message.Content)
+	assert.Equal(t, Usage{PromptTokens: 11, CompletionTokens: 16, TotalTokens: 27}, ret.Usage)
+
+	fake := NewFakeChat(&ChatResponse{Message: ChatMessage{ToolCalls: []ToolCall{{ID: "1", Name: "f"}}}})
+	ret, err = fake.Chat(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, FinishToolCalls, ret.FinishReason)
+	assert.Len(t, fake.Requests(), 1)
+
+	_, err = NewChat(conf.LlmConf{Mode: "x"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package devctl
+
+import (
+	"strings"
+
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// CheckControl 检查用户是否可以控制设备,需要设备所在项目的管理权限或者所在区域的读写权限
+func CheckControl(uc *ctxs.UserCtx, dev *Device) error {
+	if uc == nil {
+		return errors.NotLogin
+	}
+	if uc.IsAdmin || uc.IsAllData || (uc.AllProject && uc.AllArea) {
+		return nil
+	}
+	if !uc.AllProject && uc.ProjectID != 0 && uc.ProjectID != dev.ProjectID {
+		return errors.Permissions.AddDetailf("device %s/%s is not in project %d", dev.ProductID, dev.DeviceName, uc.ProjectID)
+	}
+	pa := uc.ProjectAuth[dev.ProjectID]
+	if pa == nil {
+		return errors.Permissions.AddDetailf("no auth of project %d", dev.ProjectID)
+	}
+	if pa.AuthType == def.AuthAdmin {
+		return nil
+	}
+	if uc.AllArea { //不限制区域时只看项目的权限,未设置的权限不能控制
+		return canWrite(pa.AuthType, dev)
+	}
+	authType, ok := pa.Area[dev.AreaID]
+	if !ok { //按区域路径继承上级区域的权限,取最近的上级
+		var matched string
+		for path, t := range pa.AreaPath {
+			if dev.AreaIDPath != "" && strings.HasPrefix(dev.AreaIDPath, path) && len(path) > len(matched) {
+				matched, authType, ok = path, t, true
+			}
+		}
+	}
+	if !ok {
+		return errors.Permissions.AddDetailf("no auth of area %d", dev.AreaID)
+	}
+	return canWrite(authType, dev)
+}
+
+func canWrite(authType def.AuthType, dev *Device) error {
+	if authType == def.AuthAdmin || authType == def.AuthReadWrite {
+		return nil
+	}
+	return errors.Permissions.AddDetailf("device %s/%s is read only", dev.ProductID, dev.DeviceName)
+}
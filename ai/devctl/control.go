@@ -0,0 +1,430 @@
+package devctl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitee.com/unitedrhino/share/ai"
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/events/topics"
+	"github.com/google/uuid"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	MethodControl = "control" //设置属性
+	MethodAction  = "action"  //调用行为
+
+	defaultMaxRounds = 3
+)
+
+type Device struct {
+	ProductID   string `json:"productID"`
+	ProductName string `json:"productName"`
+	DeviceName  string `json:"deviceName"`
+	DeviceAlias string `json:"deviceAlias"`
+	ProjectID   int64  `json:"projectID,string"`
+	AreaID      int64  `json:"areaID,string"`
+	AreaIDPath  string `json:"areaIDPath"` //1-2-3-的格式
+	AreaName    string `json:"areaName"`
+}
+
+func (d *Device) Title() string {
+	name := d.DeviceAlias
+	if name == "" {
+		name = d.DeviceName
+	}
+	if d.AreaName != "" {
+		return d.AreaName + "/" + name
+	}
+	return name
+}
+
+// DeviceRepo 由业务提供设备及物模型的查询
+type DeviceRepo interface {
+	// ListDevices 返回ctx中用户可以看到的设备,不需要过滤控制权限
+	ListDevices(ctx context.Context) ([]*Device, error)
+	// GetModel 获取产品的物模型
+	GetModel(ctx context.Context, productID string) (*Model, error)
+}
+
+// Publisher 发布下行消息,clients.NatsClient实现了该接口
+type Publisher interface {
+	Publish(ctx context.Context, subj string, data []byte) error
+}
+
+// ThingReq 发布到topics.DeviceDownThing的物模型请求
+type ThingReq struct {
+	Method    string         `json:"method"`
+	MsgToken  string         `json:"msgToken"`
+	Timestamp int64          `json:"timestamp"`
+	ActionID  string         `json:"actionID,omitempty"`
+	Params    map[string]any `json:"params"`
+}
+
+type CommandResult struct {
+	Device   *Device        `json:"device"`
+	Method   string         `json:"method"`
+	ActionID string         `json:"actionID,omitempty"`
+	Params   map[string]any `json:"params,omitempty"`
+	Text     string         `json:"text"` //可读的操作描述
+	Err      error          `json:"-"`
+}
+
+type Result struct {
+	Reply    string           //大模型最后的回复
+	Summary  string           //按执行结果生成的摘要
+	Commands []*CommandResult //下发的指令,包含失败的
+	Usage    ai.Usage
+}
+
+// Controller 将用户的自然语言转换成物模型的属性设置和行为调用
+type Controller struct {
+	chat      ai.Chat
+	repo      DeviceRepo
+	pub       Publisher
+	MaxRounds int    //和大模型交互的最大轮数
+	Model     string //为空时使用配置的模型
+}
+
+func NewController(chat ai.Chat, repo DeviceRepo, pub Publisher) *Controller {
+	return &Controller{chat: chat, repo: repo, pub: pub, MaxRounds: defaultMaxRounds}
+}
+
+// 一个工具对应一个产品的属性设置或者一个行为
+type toolTarget struct {
+	productID string
+	model     *Model
+	action    *Action //为nil时为属性设置
+	devices   map[string]*Device
+}
+
+// Control 处理一句控制指令,只有用户有控制权限的设备会提供给大模型
+func (c *Controller) Control(ctx context.Context, text string) (*Result, error) {
+	uc := ctxs.GetUserCtx(ctx)
+	if uc == nil {
+		return nil, errors.NotLogin
+	}
+	tools, targets, devices, err := c.tools(ctx, uc)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) == 0 {
+		return nil, errors.NotFind.AddDetail("no controllable device")
+	}
+	messages := []ai.ChatMessage{
+		{Role: ai.RoleSystem, Content: systemPrompt(devices)},
+		{Role: ai.RoleUser, Content: text},
+	}
+	ret := &Result{}
+	for round := 0; round < max(c.MaxRounds, 1); round++ {
+		resp, err := c.chat.Chat(ctx, &ai.ChatRequest{Model: c.Model, Messages: messages, Tools: tools, User: fmt.Sprint(uc.UserID)})
+		if err != nil {
+			return nil, err
+		}
+		ret.Usage.PromptTokens += resp.Usage.PromptTokens
+		ret.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		ret.Usage.TotalTokens += resp.Usage.TotalTokens
+		ret.Reply = resp.Message.Content
+		if len(resp.Message.ToolCalls) == 0 {
+			break
+		}
+		messages = append(messages, resp.Message)
+		for _, call := range resp.Message.ToolCalls {
+			cmds, content := c.call(ctx, uc, targets[call.Name], call)
+			ret.Commands = append(ret.Commands, cmds...)
+			messages = append(messages, ai.ChatMessage{Role: ai.RoleTool, ToolCallID: call.ID, Content: content})
+		}
+	}
+	ret.Summary = summary(ret.Commands, uc.AcceptLanguage)
+	if ret.Reply == "" {
+		ret.Reply = ret.Summary
+	}
+	return ret, nil
+}
+
+var toolNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+const toolNameMaxLen = 64
+
+// 工具名只能包含字母数字下划线且不超过64个字符,超长或替换字符后和已有的工具重名时加上原名的hash后缀
+func toolName(used map[string]*toolTarget, parts ...string) string {
+	raw := strings.Join(parts, "_")
+	name := toolNameReplacer.ReplaceAllString(raw, "_")
+	if _, ok := used[name]; !ok && len(name) <= toolNameMaxLen {
+		return name
+	}
+	for i := 0; ; i++ {
+		sum := sha1.Sum([]byte(raw + strconv.Itoa(i)))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		ret := name[:min(len(name), toolNameMaxLen-len(suffix))] + suffix
+		if _, ok := used[ret]; !ok {
+			return ret
+		}
+	}
+}
+
+func (c *Controller) tools(ctx context.Context, uc *ctxs.UserCtx) ([]ai.Tool, map[string]*toolTarget, []*Device, error) {
+	all, err := c.repo.ListDevices(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	products := map[string]map[string]*Device{}
+	var devices []*Device
+	for _, d := range all {
+		if CheckControl(uc, d) != nil {
+			continue
+		}
+		if products[d.ProductID] == nil {
+			products[d.ProductID] = map[string]*Device{}
+		}
+		products[d.ProductID][d.DeviceName] = d
+		devices = append(devices, d)
+	}
+	productIDs := make([]string, 0, len(products))
+	for id := range products {
+		productIDs = append(productIDs, id)
+	}
+	sort.Strings(productIDs)
+	var tools []ai.Tool
+	targets := map[string]*toolTarget{}
+	for _, productID := range productIDs {
+		model, err := c.repo.GetModel(ctx, productID)
+		if err != nil {
+			logx.WithContext(ctx).Errorf("devctl get model productID:%s err:%v", productID, err)
+			continue
+		}
+		names := make([]string, 0, len(products[productID]))
+		for name := range products[productID] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		deviceSchema := map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string", "enum": names},
+			"description": "要控制的设备的deviceName",
+		}
+		props := map[string]any{}
+		for _, p := range model.Properties {
+			if p.Mode == PropertyModeRW {
+				props[p.Identifier] = p.Define.Schema(p.Name)
+			}
+		}
+		if len(props) > 0 {
+			name := toolName(targets, "set", productID)
+			targets[name] = &toolTarget{productID: productID, model: model, devices: products[productID]}
+			tools = append(tools, ai.Tool{
+				Name:        name,
+				Description: fmt.Sprintf("设置产品%s的设备属性", productID),
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"devices":    deviceSchema,
+						"properties": map[string]any{"type": "object", "properties": props, "additionalProperties": false},
+					},
+					"required": []string{"devices", "properties"},
+				},
+			})
+		}
+		for _, a := range model.Actions {
+			params := map[string]any{}
+			for _, p := range a.Input {
+				params[p.Identifier] = p.Define.Schema(p.Name)
+			}
+			name := toolName(targets, "action", productID, a.Identifier)
+			targets[name] = &toolTarget{productID: productID, model: model, action: a, devices: products[productID]}
+			tools = append(tools, ai.Tool{
+				Name:        name,
+				Description: strings.TrimSpace(fmt.Sprintf("调用产品%s的行为:%s %s", productID, a.Name, a.Desc)),
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"devices": deviceSchema,
+						"params":  map[string]any{"type": "object", "properties": params, "additionalProperties": false},
+					},
+					"required": []string{"devices"},
+				},
+			})
+		}
+	}
+	return tools, targets, devices, nil
+}
+
+func systemPrompt(devices []*Device) string {
+	var b strings.Builder
+	b.WriteString("你是智能家居和楼宇的设备控制助手,根据用户的指令调用工具控制设备,只能控制下面列出的设备,不确定时向用户确认。执行后用一句话告诉用户结果。\n设备列表(productID/deviceName 名称 区域):\n")
+	for _, d := range devices {
+		fmt.Fprintf(&b, "%s/%s %s %s\n", d.ProductID, d.DeviceName, d.DeviceAlias, d.AreaName)
+	}
+	return b.String()
+}
+
+type toolArgs struct {
+	Devices    []string       `json:"devices"`
+	Properties map[string]any `json:"properties"`
+	Params     map[string]any `json:"params"`
+}
+
+// call 执行一个工具调用,返回下发的指令及给大模型的结果
+func (c *Controller) call(ctx context.Context, uc *ctxs.UserCtx, target *toolTarget, call ai.ToolCall) ([]*CommandResult, string) {
+	if target == nil {
+		return nil, toolResult(nil, errors.NotFind.AddDetailf("unknown tool %s", call.Name))
+	}
+	var args toolArgs
+	dec := json.NewDecoder(bytes.NewReader([]byte(call.Arguments)))
+	dec.UseNumber()
+	if err := dec.Decode(&args); err != nil {
+		return nil, toolResult(nil, errors.Parameter.AddDetailf("invalid arguments: %v", err))
+	}
+	if len(args.Devices) == 0 {
+		return nil, toolResult(nil, errors.Parameter.AddDetail("devices is required"))
+	}
+	req, text, err := buildReq(target, &args)
+	if err != nil {
+		return nil, toolResult(nil, err)
+	}
+	var cmds []*CommandResult
+	for _, name := range args.Devices {
+		dev := target.devices[name]
+		cmd := &CommandResult{Device: dev, Method: req.Method, ActionID: req.ActionID, Params: req.Params, Text: text}
+		switch {
+		case dev == nil:
+			cmd.Device = &Device{ProductID: target.productID, DeviceName: name}
+			cmd.Err = errors.NotFind.AddDetailf("device %s not found", name)
+		default:
+			if err := CheckControl(uc, dev); err != nil {
+				cmd.Err = err
+			} else {
+				cmd.Err = c.publish(ctx, dev, req)
+			}
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, toolResult(cmds, nil)
+}
+
+func buildReq(target *toolTarget, args *toolArgs) (*ThingReq, string, error) {
+	req := &ThingReq{Method: MethodControl, Params: map[string]any{}}
+	var texts []string
+	if target.action != nil {
+		req.Method = MethodAction
+		req.ActionID = target.action.Identifier
+		texts = append(texts, target.action.Name)
+		for _, p := range target.action.Input {
+			v, ok := args.Params[p.Identifier]
+			if !ok {
+				continue
+			}
+			checked, err := p.Define.Validate(v)
+			if err != nil {
+				return nil, "", errors.Parameter.AddDetailf("%s: %v", p.Identifier, err)
+			}
+			req.Params[p.Identifier] = checked
+			texts = append(texts, p.Name+"="+p.Define.Text(checked))
+		}
+		for k := range args.Params {
+			if _, ok := req.Params[k]; !ok {
+				return nil, "", errors.Parameter.AddDetailf("unknown param %s", k)
+			}
+		}
+		return req, strings.Join(texts, " "), nil
+	}
+	if len(args.Properties) == 0 {
+		return nil, "", errors.Parameter.AddDetail("properties is required")
+	}
+	keys := make([]string, 0, len(args.Properties))
+	for k := range args.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := target.model.Property(k)
+		if p == nil {
+			return nil, "", errors.Parameter.AddDetailf("unknown property %s", k)
+		}
+		if p.Mode != PropertyModeRW {
+			return nil, "", errors.Parameter.AddDetailf("property %s is read only", k)
+		}
+		checked, err := p.Define.Validate(args.Properties[k])
+		if err != nil {
+			return nil, "", errors.Parameter.AddDetailf("%s: %v", k, err)
+		}
+		req.Params[k] = checked
+		texts = append(texts, p.Name+"="+p.Define.Text(checked))
+	}
+	return req, "设置" + strings.Join(texts, ","), nil
+}
+
+func (c *Controller) publish(ctx context.Context, dev *Device, req *ThingReq) error {
+	msg := *req
+	msg.MsgToken = uuid.NewString()
+	msg.Timestamp = time.Now().UnixMilli()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	err = c.pub.Publish(ctx, fmt.Sprintf(topics.DeviceDownThing, dev.ProductID, dev.DeviceName), data)
+	if err != nil {
+		logx.WithContext(ctx).Errorf("devctl publish device:%s/%s err:%v", dev.ProductID, dev.DeviceName, err)
+		return errors.System.AddDetail(err)
+	}
+	return nil
+}
+
+// 返回给大模型的工具执行结果
+func toolResult(cmds []*CommandResult, err error) string {
+	type item struct {
+		Device string `json:"device"`
+		Error  string `json:"error,omitempty"`
+	}
+	ret := struct {
+		Error   string `json:"error,omitempty"`
+		Success []item `json:"success,omitempty"`
+		Failed  []item `json:"failed,omitempty"`
+	}{}
+	if err != nil {
+		ret.Error = err.Error()
+	}
+	for _, cmd := range cmds {
+		if cmd.Err != nil {
+			ret.Failed = append(ret.Failed, item{Device: cmd.Device.Title(), Error: errors.Fmt(cmd.Err).GetMsg()})
+		} else {
+			ret.Success = append(ret.Success, item{Device: cmd.Device.Title()})
+		}
+	}
+	data, _ := json.Marshal(ret)
+	return string(data)
+}
+
+// 按执行结果生成的摘要,按用户的语言翻译
+func summary(cmds []*CommandResult, lang string) string {
+	if len(cmds) == 0 {
+		return errors.OK.WithMsg("没有下发指令").GetI18nMsg(lang)
+	}
+	var ok, failed []string
+	for _, cmd := range cmds {
+		if cmd.Err != nil {
+			failed = append(failed, cmd.Device.Title()+":"+errors.Fmt(cmd.Err).GetI18nMsg(lang))
+		} else {
+			ok = append(ok, cmd.Device.Title()+" "+cmd.Text)
+		}
+	}
+	var parts []string
+	if len(ok) > 0 {
+		parts = append(parts, errors.OK.WithMsgf("已向%d个设备下发指令:%s", len(ok), strings.Join(ok, ";")).GetI18nMsg(lang))
+	}
+	if len(failed) > 0 {
+		parts = append(parts, errors.OK.WithMsgf("%d个设备失败:%s", len(failed), strings.Join(failed, ";")).GetI18nMsg(lang))
+	}
+	return strings.Join(parts, "\n")
+}
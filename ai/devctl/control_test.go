@@ -0,0 +1,168 @@
+package devctl
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitee.com/unitedrhino/share/ai"
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lightModel = &Model{
+	Properties: []*Property{
+		{Identifier: "power", Name: "开关", Mode: PropertyModeRW, Define: Define{Type: DataTypeBool, Mapping: map[string]string{"0": "关", "1": "开"}}},
+		{Identifier: "brightness", Name: "亮度", Mode: PropertyModeRW, Define: Define{Type: DataTypeInt, Min: "0", Max: "100", Unit: "%"}},
+		{Identifier: "temp", Name: "温度", Mode: PropertyModeR, Define: Define{Type: DataTypeFloat}},
+	},
+	Actions: []*Action{
+		{Identifier: "blink", Name: "闪烁", Input: []*Param{{Identifier: "times", Name: "次数", Define: Define{Type: DataTypeInt, Min: "1", Max: "5"}}}},
+	},
+}
+
+type fakeRepo struct{}
+
+func (fakeRepo) ListDevices(ctx context.Context) ([]*Device, error) {
+	return []*Device{
+		{ProductID: "light", DeviceName: "l1", DeviceAlias: "吊灯", ProjectID: 1, AreaID: 2, AreaIDPath: "1-2-", AreaName: "会议室2"},
+		{ProductID: "light", DeviceName: "l2", DeviceAlias: "筒灯", ProjectID: 1, AreaID: 2, AreaIDPath: "1-2-", AreaName: "会议室2"},
+		{ProductID: "light", DeviceName: "l3", DeviceAlias: "吊灯", ProjectID: 1, AreaID: 3, AreaIDPath: "1-3-", AreaName: "会议室3"},
+	}, nil
+}
+
+func (fakeRepo) GetModel(ctx context.Context, productID string) (*Model, error) {
+	return lightModel, nil
+}
+
+type fakePub struct {
+	mutex sync.Mutex
+	msgs  map[string]*ThingReq
+}
+
+func (p *fakePub) Publish(ctx context.Context, subj string, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var req ThingReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	p.msgs[subj] = &req
+	return nil
+}
+
+func userCtx() context.Context {
+	return ctxs.SetUserCtx(context.Background(), &ctxs.UserCtx{
+		ProjectID: 1,
+		ProjectAuth: map[int64]*ctxs.ProjectAuth{1: {
+			AuthType: def.AuthReadWrite,
+			AreaPath: map[string]def.AuthType{"1-2-": def.AuthReadWrite, "1-3-": def.AuthRead},
+		}},
+	})
+}
+
+func toolCall(name string, args string) *ai.ChatResponse {
+	return &ai.ChatResponse{Message: ai.ChatMessage{ToolCalls: []ai.ToolCall{{ID: "c1", Name: name, Arguments: args}}}}
+}
+
+func TestControl(t *testing.T) {
+	chat := ai.NewFakeChat(
+		toolCall("set_light", `{"devices":["l1","l2","l3"],"properties":{"power":0}}`),
+		&ai.ChatResponse{Message: ai.ChatMessage{Content: "已关闭会议室2的灯"}},
+	)
+	pub := &fakePub{msgs: map[string]*ThingReq{}}
+	ret, err := NewController(chat, fakeRepo{}, pub).Control(userCtx(), "关掉会议室2的所有灯")
+	require.NoError(t, err)
+	assert.Equal(t, "已关闭会议室2的灯", ret.Reply)
+	require.Len(t, pub.msgs, 2)
+	req := pub.msgs["device.down.thing.light.l1"]
+	require.NotNil(t, req)
+	assert.Equal(t, MethodControl, req.Method)
+	assert.Equal(t, map[string]any{"power": false}, req.Params)
+	require.Len(t, ret.Commands, 3)
+	assert.Equal(t, errors.NotFind.Code, errors.Fmt(ret.Commands[2].Err).Code, "只读区域的设备不提供给大模型")
+	assert.Contains(t, ret.Summary, "会议室2/吊灯 设置开关=关")
+
+	reqs := chat.Requests()
+	require.Len(t, reqs, 2)
+	require.Len(t, reqs[0].Tools, 2)
+	assert.NotContains(t, reqs[0].Messages[0].Content, "l3")
+	assert.Equal(t, ai.RoleTool, reqs[1].Messages[3].Role)
+	assert.Contains(t, reqs[1].Messages[3].Content, `"failed"`)
+}
+
+func TestControlValidate(t *testing.T) {
+	chat := ai.NewFakeChat(
+		toolCall("set_light", `{"devices":["l1"],"properties":{"brightness":120}}`),
+		toolCall("set_light", `{"devices":["l1"],"properties":{"temp":20}}`),
+		toolCall("action_light_blink", `{"devices":["l2"],"params":{"times":3}}`),
+	)
+	pub := &fakePub{msgs: map[string]*ThingReq{}}
+	ret, err := NewController(chat, fakeRepo{}, pub).Control(userCtx(), "把灯调亮")
+	require.NoError(t, err)
+	reqs := chat.Requests()
+	require.Len(t, reqs, 3)
+	assert.Contains(t, reqs[1].Messages[3].Content, "greater than 100")
+	assert.Contains(t, reqs[2].Messages[5].Content, "read only")
+	require.Len(t, pub.msgs, 1)
+	req := pub.msgs["device.down.thing.light.l2"]
+	assert.Equal(t, MethodAction, req.Method)
+	assert.Equal(t, "blink", req.ActionID)
+	assert.Equal(t, float64(3), req.Params["times"])
+	assert.Equal(t, "会议室2/筒灯 闪烁 次数=3", ret.Reply[len("已向1个设备下发指令:"):])
+}
+
+func TestCheckControl(t *testing.T) {
+	dev := &Device{ProductID: "p", DeviceName: "d", ProjectID: 1, AreaID: 5, AreaIDPath: "1-2-5-"}
+	assert.Equal(t, errors.NotLogin, CheckControl(nil, dev))
+	assert.NoError(t, CheckControl(&ctxs.UserCtx{IsAdmin: true}, dev))
+	uc := &ctxs.UserCtx{ProjectID: 2, ProjectAuth: map[int64]*ctxs.ProjectAuth{1: {AuthType: def.AuthAdmin}}}
+	assert.Error(t, CheckControl(uc, dev), "不是当前项目")
+	uc.ProjectID = 1
+	assert.NoError(t, CheckControl(uc, dev))
+	uc.ProjectAuth[1] = &ctxs.ProjectAuth{AuthType: def.AuthRead, AreaPath: map[string]def.AuthType{"1-": def.AuthRead, "1-2-": def.AuthReadWrite}}
+	assert.NoError(t, CheckControl(uc, dev), "继承最近的上级区域的权限")
+	uc.ProjectAuth[1].Area = map[int64]def.AuthType{5: def.AuthRead}
+	assert.Error(t, CheckControl(uc, dev))
+
+	uc.AllArea = true
+	uc.ProjectAuth[1] = &ctxs.ProjectAuth{}
+	assert.True(t, errors.Cmp(CheckControl(uc, dev), errors.Permissions), "不限制区域时未设置项目权限不能控制")
+	uc.ProjectAuth[1].AuthType = def.AuthRead
+	assert.Error(t, CheckControl(uc, dev))
+	uc.ProjectAuth[1].AuthType = def.AuthReadWrite
+	assert.NoError(t, CheckControl(uc, dev))
+}
+
+func TestToolName(t *testing.T) {
+	targets := map[string]*toolTarget{}
+	assert.Equal(t, "set_light", toolName(targets, "set", "light"))
+	prefix := strings.Repeat("p", 70)
+	a := toolName(targets, "set", prefix+"a")
+	targets[a] = &toolTarget{productID: prefix + "a"}
+	b := toolName(targets, "set", prefix+"b")
+	assert.NotEqual(t, a, b, "前缀相同的超长产品不能重名")
+	assert.LessOrEqual(t, len(a), toolNameMaxLen)
+	assert.LessOrEqual(t, len(b), toolNameMaxLen)
+	assert.Equal(t, a, toolName(map[string]*toolTarget{}, "set", prefix+"a"), "同样的产品每次生成的名字相同")
+
+	targets["set_a_b"] = &toolTarget{productID: "a_b"}
+	c := toolName(targets, "set", "a.b")
+	assert.NotEqual(t, "set_a_b", c, "替换字符后重名")
+	assert.Regexp(t, `^set_a_b_[0-9a-f]{8}$`, c)
+}
+
+func TestSummary(t *testing.T) {
+	dev := &Device{ProductID: "light", DeviceName: "l1", DeviceAlias: "吊灯", AreaName: "会议室2"}
+	cmds := []*CommandResult{{Device: dev, Text: "on"}, {Device: dev, Err: errors.NotOnline}}
+	assert.Equal(t, "no command was sent", summary(nil, "en"))
+	s := summary(cmds, "en")
+	assert.Contains(t, s, "sent commands to 1 devices: 会议室2/吊灯 on")
+	assert.Contains(t, s, "failed on 1 devices")
+	assert.Contains(t, summary(cmds, "zh"), "已向1个设备下发指令")
+}
@@ -0,0 +1,318 @@
+package devctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// 物模型中控制需要的部分,json和things的物模型定义兼容
+
+type DataType = string
+
+const (
+	DataTypeBool      DataType = "bool"
+	DataTypeInt       DataType = "int"
+	DataTypeFloat     DataType = "float"
+	DataTypeString    DataType = "string"
+	DataTypeEnum      DataType = "enum"
+	DataTypeTimestamp DataType = "timestamp"
+	DataTypeStruct    DataType = "struct"
+	DataTypeArray     DataType = "array"
+)
+
+type PropertyMode = string
+
+const (
+	PropertyModeR  PropertyMode = "r"  //只读
+	PropertyModeRW PropertyMode = "rw" //读写
+)
+
+type Model struct {
+	Properties []*Property `json:"properties"`
+	Actions    []*Action   `json:"actions"`
+}
+
+type Property struct {
+	Identifier string       `json:"identifier"`
+	Name       string       `json:"name"`
+	Desc       string       `json:"desc,omitempty"`
+	Mode       PropertyMode `json:"mode"`
+	Define     Define       `json:"define"`
+}
+
+type Action struct {
+	Identifier string   `json:"identifier"`
+	Name       string   `json:"name"`
+	Desc       string   `json:"desc,omitempty"`
+	Input      []*Param `json:"input"`
+}
+
+type Param struct {
+	Identifier string `json:"identifier"`
+	Name       string `json:"name"`
+	Define     Define `json:"define"`
+}
+
+type Define struct {
+	Type      DataType          `json:"type"`
+	Mapping   map[string]string `json:"mapping,omitempty"` //bool和enum的值及描述
+	Min       string            `json:"min,omitempty"`     //数值的最小值
+	Max       string            `json:"max,omitempty"`     //数值的最大值,字符串的最大长度
+	Step      string            `json:"step,omitempty"`
+	Unit      string            `json:"unit,omitempty"`
+	Specs     []*Spec           `json:"specs,omitempty"`     //结构体的成员
+	ArrayInfo *Define           `json:"arrayInfo,omitempty"` //数组的元素
+}
+
+type Spec struct {
+	Identifier string `json:"identifier"`
+	Name       string `json:"name"`
+	DataType   Define `json:"dataType"`
+}
+
+// Property 返回标识符对应的属性
+func (m *Model) Property(identifier string) *Property {
+	for _, p := range m.Properties {
+		if p.Identifier == identifier {
+			return p
+		}
+	}
+	return nil
+}
+
+// Action 返回标识符对应的行为
+func (m *Model) Action(identifier string) *Action {
+	for _, a := range m.Actions {
+		if a.Identifier == identifier {
+			return a
+		}
+	}
+	return nil
+}
+
+// Schema 生成提供给大模型的json schema
+func (d *Define) Schema(desc string) map[string]any {
+	ret := map[string]any{}
+	switch d.Type {
+	case DataTypeBool:
+		ret["type"] = "boolean"
+	case DataTypeInt, DataTypeTimestamp:
+		ret["type"] = "integer"
+		d.setRange(ret)
+	case DataTypeFloat:
+		ret["type"] = "number"
+		d.setRange(ret)
+	case DataTypeEnum:
+		ret["type"] = "integer"
+		var keys []int64
+		for k := range d.Mapping {
+			if v, err := strconv.ParseInt(k, 10, 64); err == nil {
+				keys = append(keys, v)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		ret["enum"] = keys
+	case DataTypeString:
+		ret["type"] = "string"
+		if max, err := strconv.Atoi(d.Max); err == nil && max > 0 {
+			ret["maxLength"] = max
+		}
+	case DataTypeStruct:
+		props := map[string]any{}
+		for _, s := range d.Specs {
+			props[s.Identifier] = s.DataType.Schema(s.Name)
+		}
+		ret["type"] = "object"
+		ret["properties"] = props
+		ret["additionalProperties"] = false
+	case DataTypeArray:
+		ret["type"] = "array"
+		if d.ArrayInfo != nil {
+			ret["items"] = d.ArrayInfo.Schema("")
+		}
+	}
+	if mapping := d.mappingDesc(); mapping != "" {
+		desc += " (" + mapping + ")"
+	}
+	if d.Unit != "" {
+		desc += " 单位:" + d.Unit
+	}
+	if desc != "" {
+		ret["description"] = desc
+	}
+	return ret
+}
+
+func (d *Define) setRange(ret map[string]any) {
+	if v, err := strconv.ParseFloat(d.Min, 64); err == nil {
+		ret["minimum"] = v
+	}
+	if v, err := strconv.ParseFloat(d.Max, 64); err == nil {
+		ret["maximum"] = v
+	}
+}
+
+func (d *Define) mappingDesc() string {
+	if len(d.Mapping) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(d.Mapping))
+	for k := range d.Mapping {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ret string
+	for i, k := range keys {
+		if i > 0 {
+			ret += ","
+		}
+		ret += k + ":" + d.Mapping[k]
+	}
+	return ret
+}
+
+// Validate 校验大模型给出的参数并转换成下发的值,v为json解析后的值
+func (d *Define) Validate(v any) (any, error) {
+	switch d.Type {
+	case DataTypeBool:
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		default:
+			num, err := toFloat(v)
+			if err == nil && (num == 0 || num == 1) {
+				return num == 1, nil
+			}
+			return nil, errors.Parameter.AddDetailf("%v is not a bool", v)
+		}
+	case DataTypeInt, DataTypeTimestamp:
+		num, err := toFloat(v)
+		if err != nil || num != math.Trunc(num) {
+			return nil, errors.Parameter.AddDetailf("%v is not an integer", v)
+		}
+		if err := d.checkRange(num); err != nil {
+			return nil, err
+		}
+		return int64(num), nil
+	case DataTypeFloat:
+		num, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.checkRange(num); err != nil {
+			return nil, err
+		}
+		return num, nil
+	case DataTypeEnum:
+		num, err := toFloat(v)
+		if err != nil || num != math.Trunc(num) {
+			return nil, errors.Parameter.AddDetailf("%v is not an enum value", v)
+		}
+		if _, ok := d.Mapping[strconv.FormatInt(int64(num), 10)]; !ok {
+			return nil, errors.Parameter.AddDetailf("%v is not one of %s", v, d.mappingDesc())
+		}
+		return int64(num), nil
+	case DataTypeString:
+		val, ok := v.(string)
+		if !ok {
+			return nil, errors.Parameter.AddDetailf("%v is not a string", v)
+		}
+		if max, err := strconv.Atoi(d.Max); err == nil && max > 0 && utf8.RuneCountInString(val) > max {
+			return nil, errors.Parameter.AddDetailf("string is longer than %d", max)
+		}
+		return val, nil
+	case DataTypeStruct:
+		val, ok := v.(map[string]any)
+		if !ok {
+			return nil, errors.Parameter.AddDetailf("%v is not an object", v)
+		}
+		ret := make(map[string]any, len(val))
+		for k, item := range val {
+			var spec *Spec
+			for _, s := range d.Specs {
+				if s.Identifier == k {
+					spec = s
+					break
+				}
+			}
+			if spec == nil {
+				return nil, errors.Parameter.AddDetailf("unknown field %s", k)
+			}
+			checked, err := spec.DataType.Validate(item)
+			if err != nil {
+				return nil, errors.Parameter.AddDetailf("%s: %v", k, err)
+			}
+			ret[k] = checked
+		}
+		return ret, nil
+	case DataTypeArray:
+		val, ok := v.([]any)
+		if !ok {
+			return nil, errors.Parameter.AddDetailf("%v is not an array", v)
+		}
+		if d.ArrayInfo == nil {
+			return val, nil
+		}
+		ret := make([]any, 0, len(val))
+		for i, item := range val {
+			checked, err := d.ArrayInfo.Validate(item)
+			if err != nil {
+				return nil, errors.Parameter.AddDetailf("[%d]: %v", i, err)
+			}
+			ret = append(ret, checked)
+		}
+		return ret, nil
+	}
+	return nil, errors.Parameter.AddDetailf("unsupported type %s", d.Type)
+}
+
+func (d *Define) checkRange(num float64) error {
+	if min, err := strconv.ParseFloat(d.Min, 64); err == nil && num < min {
+		return errors.OutRange.AddDetailf("%v is less than %s", num, d.Min)
+	}
+	if max, err := strconv.ParseFloat(d.Max, 64); err == nil && num > max {
+		return errors.OutRange.AddDetailf("%v is greater than %s", num, d.Max)
+	}
+	return nil
+}
+
+// Text 值的可读描述,bool和enum使用映射的描述
+func (d *Define) Text(v any) string {
+	if len(d.Mapping) > 0 {
+		key := fmt.Sprint(v)
+		if b, ok := v.(bool); ok {
+			key = "0"
+			if b {
+				key = "1"
+			}
+		}
+		if text, ok := d.Mapping[key]; ok {
+			return text
+		}
+	}
+	if _, ok := v.(map[string]any); ok {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v) + d.Unit
+}
+
+func toFloat(v any) (float64, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case json.Number:
+		return val.Float64()
+	case int64:
+		return float64(val), nil
+	case int:
+		return float64(val), nil
+	}
+	return 0, errors.Parameter.AddDetailf("%v is not a number", v)
+}
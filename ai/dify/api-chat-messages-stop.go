@@ -1,6 +1,7 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -9,19 +10,19 @@ type ChatMessagesStopResponse struct {
 	Result string `json:"result"`
 }
 
-func (dc *DifyClient) ChatMessagesStop(task_id string) (result ChatMessagesStopResponse, err error) {
+func (dc *DifyClient) ChatMessagesStop(ctx context.Context, task_id string) (result ChatMessagesStopResponse, err error) {
 	if task_id == "" {
 		return result, fmt.Errorf("task_id is required")
 	}
 
 	payload := map[string]string{
-		"user": dc.User,
+		"user": dc.GetUser(ctx),
 	}
 
 	api := dc.GetAPI(API_CHAT_MESSAGES_STOP)
 	api = UpdateAPIParam(api, API_PARAM_TASK_ID, task_id)
 
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
+	code, body, err := SendPostRequestToAPI(ctx, dc, api, payload)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
@@ -128,6 +128,14 @@ type ChatMessagesSseResponse struct {
 	Tool           string   `json:"tool"`
 	ToolInput      string   `json:"tool_input"`
 	MessageFiles   []string `json:"message_files"`
+	Status         int      `json:"status"`
+	Code           string   `json:"code"`
+	Message        string   `json:"message"`
+}
+
+func (r *ChatMessagesSseResponse) setStreamErr(err error) {
+	r.Event = EVENT_ERROR
+	r.Status, r.Code, r.Message = streamErr(err)
 }
 
 func PrepareChatPayload(payload map[string]interface{}) (string, error) {
@@ -138,14 +146,14 @@ func PrepareChatPayload(payload map[string]interface{}) (string, error) {
 	return string(jsonData), nil
 }
 
-func (dc *DifyClient) ChatMessages(inputs map[string]interface{}, query string, conversation_id string, files []any) (result ChatMessagesResponse, err error) {
+func (dc *DifyClient) ChatMessages(ctx context.Context, inputs map[string]interface{}, query string, conversation_id string, files []any) (result ChatMessagesResponse, err error) {
 	var payload ChatMessagesPayload
 
 	payload.Inputs = inputs
 	payload.Query = query
 
 	payload.ResponseMode = RESPONSE_MODE_BLOCKING
-	payload.User = dc.User
+	payload.User = dc.GetUser(ctx)
 
 	if conversation_id != "" {
 		payload.ConversationID = conversation_id
@@ -158,7 +166,7 @@ func (dc *DifyClient) ChatMessages(inputs map[string]interface{}, query string,
 
 	api := dc.GetAPI(API_CHAT_MESSAGES)
 
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
+	code, body, err := SendPostRequestToAPI(ctx, dc, api, payload)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
@@ -179,7 +187,7 @@ func (dc *DifyClient) ChatMessagesStreaming(ctx context.Context, inputs map[stri
 	payload.Query = query
 
 	payload.ResponseMode = RESPONSE_MODE_STREAMING
-	payload.User = dc.User
+	payload.User = dc.GetUser(ctx)
 
 	if conversation_id != "" {
 		payload.ConversationID = conversation_id
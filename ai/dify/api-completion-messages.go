@@ -1,8 +1,10 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 )
 
 type CompletionMessagesPayload struct {
@@ -31,22 +33,19 @@ func PrepareCompletionPayload(payload map[string]interface{}) (string, error) {
 	return string(jsonData), nil
 }
 
-func (dc *DifyClient) CompletionMessages(inputs string, conversation_id string, files []any) (result CompletionMessagesResponse, err error) {
-	var payload CompletionMessagesPayload
-
+func (dc *DifyClient) completionPayload(ctx context.Context, inputs string, conversation_id string, files []any, responseMode string) (payload CompletionMessagesPayload, err error) {
 	if len(inputs) == 0 {
-		return result, fmt.Errorf("inputs is required")
-	} else {
-		var tryDecode map[string]interface{}
-		err := json.Unmarshal([]byte(inputs), &tryDecode)
-		if err != nil {
-			return result, fmt.Errorf("inputs should be a valid JSON string")
-		}
-		payload.Inputs = tryDecode
+		return payload, fmt.Errorf("inputs is required")
+	}
+	var tryDecode map[string]interface{}
+	err = json.Unmarshal([]byte(inputs), &tryDecode)
+	if err != nil {
+		return payload, fmt.Errorf("inputs should be a valid JSON string")
 	}
+	payload.Inputs = tryDecode
 
-	payload.ResponseMode = RESPONSE_MODE_STREAMING
-	payload.User = dc.User
+	payload.ResponseMode = responseMode
+	payload.User = dc.GetUser(ctx)
 
 	if conversation_id != "" {
 		payload.ConversationID = conversation_id
@@ -54,61 +53,30 @@ func (dc *DifyClient) CompletionMessages(inputs string, conversation_id string,
 
 	if len(files) > 0 {
 		// TODO TBD
-		return result, fmt.Errorf("files are not supported")
+		return payload, fmt.Errorf("files are not supported")
 	}
+	return payload, nil
+}
 
-	api := dc.GetAPI(API_COMPLETION_MESSAGES)
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
-
-	err = CommonRiskForSendRequest(code, err)
+func (dc *DifyClient) CompletionMessages(ctx context.Context, inputs string, conversation_id string, files []any) (result CompletionMessagesResponse, err error) {
+	payload, err := dc.completionPayload(ctx, inputs, conversation_id, files, RESPONSE_MODE_BLOCKING)
 	if err != nil {
 		return result, err
 	}
 
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return result, fmt.Errorf("failed to unmarshal the response: %v", err)
-	}
-	return result, nil
-}
-
-func (dc *DifyClient) CompletionMessagesStreaming(inputs string, conversation_id string, files []any) (result string, err error) {
-	var payload CompletionMessagesPayload
-
-	if len(inputs) == 0 {
-		return "", fmt.Errorf("inputs is required")
-	} else {
-		var tryDecode map[string]interface{}
-		err := json.Unmarshal([]byte(inputs), &tryDecode)
-		if err != nil {
-			return "", fmt.Errorf("inputs should be a valid JSON string")
-		}
-		payload.Inputs = tryDecode
-	}
-
-	payload.ResponseMode = RESPONSE_MODE_STREAMING
-	payload.User = dc.User
-
-	if conversation_id != "" {
-		payload.ConversationID = conversation_id
-	}
-
-	if len(files) > 0 {
-		// TODO TBD
-		return "", fmt.Errorf("files are not supported")
-	}
-
 	api := dc.GetAPI(API_COMPLETION_MESSAGES)
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
+	err = dc.requestJson(ctx, authAPI, http.MethodPost, api, payload, &result)
+	return result, err
+}
 
-	err = CommonRiskForSendRequest(code, err)
+// CompletionMessagesStreaming 事件和ChatMessagesStreaming相同,ctx结束后停止接收
+func (dc *DifyClient) CompletionMessagesStreaming(ctx context.Context, inputs string, conversation_id string, files []any) (result chan ChatMessagesSseResponse, err error) {
+	payload, err := dc.completionPayload(ctx, inputs, conversation_id, files, RESPONSE_MODE_STREAMING)
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
-	// if !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
-	// 	return "", fmt.Errorf("response is not a streaming response")
-	// }
-
-	return string(body), nil
+	api := dc.GetAPI(API_COMPLETION_MESSAGES)
+	_, result, err = SendPostSseRequestToAPI[ChatMessagesSseResponse](ctx, dc, api, payload)
+	return result, err
 }
@@ -1,11 +1,11 @@
 package dify
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
 type ConversationsResponse struct {
@@ -23,114 +23,67 @@ type ConversationsResponse struct {
 	} `json:"data"`
 }
 
-func (dc *DifyClient) Conversations(last_id string, limit int) (result ConversationsResponse, err error) {
-	payloadLimit := ""
+func (dc *DifyClient) Conversations(ctx context.Context, last_id string, limit int) (result ConversationsResponse, err error) {
 	if limit <= 0 {
 		limit = 20
 	}
-	payloadLimit = fmt.Sprintf("%d", limit)
 
-	payloadBody := map[string]string{
-		"user":    dc.User,
-		"last_id": last_id,
-		"limit":   payloadLimit,
+	query := url.Values{}
+	query.Set("user", dc.GetUser(ctx))
+	query.Set("limit", strconv.Itoa(limit))
+	if last_id != "" {
+		query.Set("last_id", last_id)
 	}
 
-	api := dc.GetAPI(API_CONVERSATIONS)
+	api := dc.GetAPI(API_CONVERSATIONS) + "?" + query.Encode()
 
-	code, body, err := SendPostRequestToAPI(dc, api, payloadBody)
-
-	err = CommonRiskForSendRequest(code, err)
-	if err != nil {
-		return result, err
-	}
-
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return result, fmt.Errorf("failed to unmarshal the response: %v", err)
-	}
-	return result, nil
+	err = dc.requestJson(ctx, authAPI, http.MethodGet, api, nil, &result)
+	return result, err
 }
 
 type DeleteConversationsResponse struct {
 	Result string `json:"result"`
 }
 
-func (dc *DifyClient) DeleteConversation(conversation_id string) (result DeleteConversationsResponse, err error) {
+func (dc *DifyClient) DeleteConversation(ctx context.Context, conversation_id string) (result DeleteConversationsResponse, err error) {
 	if conversation_id == "" {
 		return result, fmt.Errorf("conversation_id is required")
 	}
 
-	payloadBody := map[string]string{
-		"user": dc.User,
+	payload := map[string]string{
+		"user": dc.GetUser(ctx),
 	}
 
 	api := dc.GetAPI(API_CONVERSATIONS_DELETE)
 	api = UpdateAPIParam(api, API_PARAM_CONVERSATION_ID, conversation_id)
 
-	buf, err := json.Marshal(payloadBody)
-	if err != nil {
-		return result, err
-	}
-	req, err := http.NewRequest("DELETE", api, bytes.NewBuffer(buf))
-	if err != nil {
-		return result, fmt.Errorf("could not create a new request: %v", err)
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", dc.Key))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := dc.Client.Do(req)
-	if err != nil {
-		return result, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		bodyText, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return result, fmt.Errorf("status code: %d, could not read the body", resp.StatusCode)
-		}
-		return result, fmt.Errorf("status code: %d, %s", resp.StatusCode, bodyText)
-	}
-
-	bodyText, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return result, err
-	}
-
-	err = json.Unmarshal(bodyText, &result)
-	if err != nil {
-		return result, fmt.Errorf("failed to unmarshal the response: %v", err)
-	}
-	return result, nil
+	err = dc.requestJson(ctx, authAPI, http.MethodDelete, api, payload, &result)
+	return result, err
 }
 
 type RenameConversationsResponse struct {
-	Result string `json:"result"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	CreatedAt int    `json:"created_at"`
+	UpdatedAt int    `json:"updated_at"`
 }
 
-func (dc *DifyClient) RenameConversation(conversation_id string) (result RenameConversationsResponse, err error) {
+// RenameConversation name为空时由dify自动生成会话名称
+func (dc *DifyClient) RenameConversation(ctx context.Context, conversation_id string, name string) (result RenameConversationsResponse, err error) {
 	if conversation_id == "" {
 		return result, fmt.Errorf("conversation_id is required")
 	}
 
-	payload := map[string]string{
-		"user": dc.User,
+	payload := map[string]any{
+		"user":          dc.GetUser(ctx),
+		"name":          name,
+		"auto_generate": name == "",
 	}
 
 	api := dc.GetAPI(API_CONVERSATIONS_RENAME)
 	api = UpdateAPIParam(api, API_PARAM_CONVERSATION_ID, conversation_id)
 
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
-
-	err = CommonRiskForSendRequest(code, err)
-	if err != nil {
-		return result, err
-	}
-
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return result, fmt.Errorf("failed to unmarshal the response: %v", err)
-	}
-	return result, nil
+	err = dc.requestJson(ctx, authAPI, http.MethodPost, api, payload, &result)
+	return result, err
 }
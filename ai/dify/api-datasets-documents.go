@@ -0,0 +1,179 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+)
+
+type DocumentProcessRule struct {
+	Mode  string `json:"mode"`            //automatic, custom
+	Rules any    `json:"rules,omitempty"` //custom时的分段规则
+}
+
+type DocumentCreatePayload struct {
+	Name              string               `json:"name,omitempty"`
+	Text              string               `json:"text,omitempty"`
+	IndexingTechnique string               `json:"indexing_technique,omitempty"` //high_quality, economy
+	DocForm           string               `json:"doc_form,omitempty"`           //text_model, hierarchical_model, qa_model
+	DocLanguage       string               `json:"doc_language,omitempty"`
+	ProcessRule       *DocumentProcessRule `json:"process_rule,omitempty"` //为空时使用自动分段
+}
+
+type Document struct {
+	ID             string `json:"id"`
+	Position       int    `json:"position"`
+	DataSourceType string `json:"data_source_type"`
+	DataSourceInfo any    `json:"data_source_info"`
+	Name           string `json:"name"`
+	CreatedFrom    string `json:"created_from"`
+	CreatedBy      string `json:"created_by"`
+	CreatedAt      int64  `json:"created_at"`
+	Tokens         int    `json:"tokens"`
+	IndexingStatus string `json:"indexing_status"`
+	Error          any    `json:"error"`
+	Enabled        bool   `json:"enabled"`
+	Archived       bool   `json:"archived"`
+	DisplayStatus  string `json:"display_status"`
+	WordCount      int    `json:"word_count"`
+	HitCount       int    `json:"hit_count"`
+	DocForm        string `json:"doc_form"`
+}
+
+type DocumentResponse struct {
+	Document Document `json:"document"`
+	Batch    string   `json:"batch"` //用于查询索引进度
+}
+
+type DocumentListResponse struct {
+	Page    int        `json:"page"`
+	Limit   int        `json:"limit"`
+	Total   int        `json:"total"`
+	HasMore bool       `json:"has_more"`
+	Data    []Document `json:"data"`
+}
+
+func documentProcess(payload DocumentCreatePayload) DocumentCreatePayload {
+	if payload.ProcessRule == nil {
+		payload.ProcessRule = &DocumentProcessRule{Mode: "automatic"}
+	}
+	if payload.IndexingTechnique == "" {
+		payload.IndexingTechnique = "high_quality"
+	}
+	return payload
+}
+
+func (dc *DifyClient) DocumentCreateByText(ctx context.Context, dataset_id string, payload DocumentCreatePayload) (result DocumentResponse, err error) {
+	if dataset_id == "" {
+		return result, fmt.Errorf("dataset_id is required")
+	}
+	if payload.Name == "" || payload.Text == "" {
+		return result, fmt.Errorf("name and text are required")
+	}
+
+	api := dc.GetAPI(API_DOCUMENTS_CREATE_BY_TEXT)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+
+	err = dc.requestJson(ctx, authDataset, http.MethodPost, api, documentProcess(payload), &result)
+	return result, err
+}
+
+// DocumentCreateByFile 上传文件创建文档,payload中的Name和Text不生效
+func (dc *DifyClient) DocumentCreateByFile(ctx context.Context, dataset_id string, filePath string, payload DocumentCreatePayload) (result DocumentResponse, err error) {
+	if dataset_id == "" {
+		return result, fmt.Errorf("dataset_id is required")
+	}
+	file, err := openFile(filePath)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+
+	payload.Name, payload.Text = "", ""
+	data, err := json.Marshal(documentProcess(payload))
+	if err != nil {
+		return result, err
+	}
+
+	api := dc.GetAPI(API_DOCUMENTS_CREATE_BY_FILE)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+
+	fields := map[string]string{
+		"data": string(data),
+	}
+	err = dc.requestForm(ctx, authDataset, api, fields, filepath.Base(filePath), file, &result)
+	return result, err
+}
+
+// DocumentUpdateByText name和text为空时不修改
+func (dc *DifyClient) DocumentUpdateByText(ctx context.Context, dataset_id string, document_id string, name string, text string) (result DocumentResponse, err error) {
+	if dataset_id == "" || document_id == "" {
+		return result, fmt.Errorf("dataset_id and document_id are required")
+	}
+
+	payload := map[string]string{}
+	if name != "" {
+		payload["name"] = name
+	}
+	if text != "" {
+		payload["text"] = text
+	}
+
+	api := dc.GetAPI(API_DOCUMENTS_UPDATE_BY_TEXT)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+	api = UpdateAPIParam(api, API_PARAM_DOCUMENT_ID, document_id)
+
+	err = dc.requestJson(ctx, authDataset, http.MethodPost, api, payload, &result)
+	return result, err
+}
+
+// DocumentIndexingStatus batch为创建或更新文档时返回的Batch
+func (dc *DifyClient) DocumentIndexingStatus(ctx context.Context, dataset_id string, batch string) (result InitDatasetsIndexingStatusResponse, err error) {
+	if dataset_id == "" || batch == "" {
+		return result, fmt.Errorf("dataset_id and batch are required")
+	}
+
+	api := dc.GetAPI(API_DOCUMENTS_INDEXING_STATUS)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+	api = UpdateAPIParam(api, API_PARAM_BATCH, batch)
+
+	err = dc.requestJson(ctx, authDataset, http.MethodGet, api, nil, &result)
+	return result, err
+}
+
+func (dc *DifyClient) DocumentList(ctx context.Context, dataset_id string, keyword string, page int, limit int) (result DocumentListResponse, err error) {
+	if dataset_id == "" {
+		return result, fmt.Errorf("dataset_id is required")
+	}
+
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(max(page, 1)))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if keyword != "" {
+		query.Set("keyword", keyword)
+	}
+
+	api := dc.GetAPI(API_DOCUMENTS)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id) + "?" + query.Encode()
+
+	err = dc.requestJson(ctx, authDataset, http.MethodGet, api, nil, &result)
+	return result, err
+}
+
+func (dc *DifyClient) DocumentDelete(ctx context.Context, dataset_id string, document_id string) error {
+	if dataset_id == "" || document_id == "" {
+		return fmt.Errorf("dataset_id and document_id are required")
+	}
+
+	api := dc.GetAPI(API_DOCUMENTS_DELETE)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+	api = UpdateAPIParam(api, API_PARAM_DOCUMENT_ID, document_id)
+
+	return dc.requestJson(ctx, authDataset, http.MethodDelete, api, nil, nil)
+}
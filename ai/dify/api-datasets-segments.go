@@ -0,0 +1,122 @@
+package dify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type SegmentPayload struct {
+	Content  string   `json:"content"`
+	Answer   string   `json:"answer,omitempty"` //qa_model时必填
+	Keywords []string `json:"keywords,omitempty"`
+	Enabled  *bool    `json:"enabled,omitempty"` //只在更新时生效
+}
+
+type Segment struct {
+	ID            string   `json:"id"`
+	Position      int      `json:"position"`
+	DocumentID    string   `json:"document_id"`
+	Content       string   `json:"content"`
+	Answer        string   `json:"answer"`
+	WordCount     int      `json:"word_count"`
+	Tokens        int      `json:"tokens"`
+	Keywords      []string `json:"keywords"`
+	IndexNodeID   string   `json:"index_node_id"`
+	IndexNodeHash string   `json:"index_node_hash"`
+	HitCount      int      `json:"hit_count"`
+	Enabled       bool     `json:"enabled"`
+	Status        string   `json:"status"`
+	CreatedBy     string   `json:"created_by"`
+	CreatedAt     int64    `json:"created_at"`
+	IndexingAt    int64    `json:"indexing_at"`
+	CompletedAt   int64    `json:"completed_at"`
+	Error         any      `json:"error"`
+}
+
+type SegmentListResponse struct {
+	Data    []Segment `json:"data"`
+	DocForm string    `json:"doc_form"`
+}
+
+type SegmentResponse struct {
+	Data    Segment `json:"data"`
+	DocForm string  `json:"doc_form"`
+}
+
+func segmentAPI(api string, dataset_id string, document_id string) (string, error) {
+	if dataset_id == "" || document_id == "" {
+		return "", fmt.Errorf("dataset_id and document_id are required")
+	}
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+	return UpdateAPIParam(api, API_PARAM_DOCUMENT_ID, document_id), nil
+}
+
+func (dc *DifyClient) SegmentCreate(ctx context.Context, dataset_id string, document_id string, segments []SegmentPayload) (result SegmentListResponse, err error) {
+	api, err := segmentAPI(dc.GetAPI(API_SEGMENTS), dataset_id, document_id)
+	if err != nil {
+		return result, err
+	}
+	if len(segments) == 0 {
+		return result, fmt.Errorf("segments is required")
+	}
+
+	payload := map[string]any{
+		"segments": segments,
+	}
+	err = dc.requestJson(ctx, authDataset, http.MethodPost, api, payload, &result)
+	return result, err
+}
+
+// SegmentList keyword和status为空时不过滤
+func (dc *DifyClient) SegmentList(ctx context.Context, dataset_id string, document_id string, keyword string, status string) (result SegmentListResponse, err error) {
+	api, err := segmentAPI(dc.GetAPI(API_SEGMENTS), dataset_id, document_id)
+	if err != nil {
+		return result, err
+	}
+
+	query := url.Values{}
+	if keyword != "" {
+		query.Set("keyword", keyword)
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if len(query) > 0 {
+		api += "?" + query.Encode()
+	}
+
+	err = dc.requestJson(ctx, authDataset, http.MethodGet, api, nil, &result)
+	return result, err
+}
+
+func (dc *DifyClient) SegmentUpdate(ctx context.Context, dataset_id string, document_id string, segment_id string, segment SegmentPayload) (result SegmentResponse, err error) {
+	api, err := segmentAPI(dc.GetAPI(API_SEGMENTS_DETAIL), dataset_id, document_id)
+	if err != nil {
+		return result, err
+	}
+	if segment_id == "" {
+		return result, fmt.Errorf("segment_id is required")
+	}
+	api = UpdateAPIParam(api, API_PARAM_SEGMENT_ID, segment_id)
+
+	payload := map[string]any{
+		"segment": segment,
+	}
+	err = dc.requestJson(ctx, authDataset, http.MethodPost, api, payload, &result)
+	return result, err
+}
+
+func (dc *DifyClient) SegmentDelete(ctx context.Context, dataset_id string, document_id string, segment_id string) error {
+	api, err := segmentAPI(dc.GetAPI(API_SEGMENTS_DETAIL), dataset_id, document_id)
+	if err != nil {
+		return err
+	}
+	if segment_id == "" {
+		return fmt.Errorf("segment_id is required")
+	}
+	api = UpdateAPIParam(api, API_PARAM_SEGMENT_ID, segment_id)
+
+	return dc.requestJson(ctx, authDataset, http.MethodDelete, api, nil, nil)
+}
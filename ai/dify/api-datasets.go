@@ -0,0 +1,74 @@
+package dify
+
+// 知识库的服务API,使用DatasetKey鉴权,不需要登录控制台
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type DatasetCreatePayload struct {
+	Name              string `json:"name"`
+	Description       string `json:"description,omitempty"`
+	IndexingTechnique string `json:"indexing_technique,omitempty"` //high_quality, economy
+	Permission        string `json:"permission,omitempty"`         //only_me, all_team_members, partial_members
+}
+
+type Dataset struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	Provider          string `json:"provider"`
+	Permission        string `json:"permission"`
+	DataSourceType    string `json:"data_source_type"`
+	IndexingTechnique string `json:"indexing_technique"`
+	AppCount          int    `json:"app_count"`
+	DocumentCount     int    `json:"document_count"`
+	WordCount         int    `json:"word_count"`
+	CreatedBy         string `json:"created_by"`
+	CreatedAt         int64  `json:"created_at"`
+	UpdatedBy         string `json:"updated_by"`
+	UpdatedAt         int64  `json:"updated_at"`
+}
+
+type DatasetListResponse struct {
+	Page    int       `json:"page"`
+	Limit   int       `json:"limit"`
+	Total   int       `json:"total"`
+	HasMore bool      `json:"has_more"`
+	Data    []Dataset `json:"data"`
+}
+
+func (dc *DifyClient) DatasetCreate(ctx context.Context, payload DatasetCreatePayload) (result Dataset, err error) {
+	if payload.Name == "" {
+		return result, fmt.Errorf("name is required")
+	}
+	err = dc.requestJson(ctx, authDataset, http.MethodPost, dc.GetAPI(API_DATASETS), payload, &result)
+	return result, err
+}
+
+func (dc *DifyClient) DatasetList(ctx context.Context, page int, limit int) (result DatasetListResponse, err error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(max(page, 1)))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	api := dc.GetAPI(API_DATASETS) + "?" + query.Encode()
+
+	err = dc.requestJson(ctx, authDataset, http.MethodGet, api, nil, &result)
+	return result, err
+}
+
+func (dc *DifyClient) DatasetDelete(ctx context.Context, dataset_id string) error {
+	if dataset_id == "" {
+		return fmt.Errorf("dataset_id is required")
+	}
+
+	api := dc.GetAPI(API_DATASETS_DELETE)
+	api = UpdateAPIParam(api, API_PARAM_DATASET_ID, dataset_id)
+
+	return dc.requestJson(ctx, authDataset, http.MethodDelete, api, nil, nil)
+}
@@ -1,6 +1,7 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -9,20 +10,20 @@ type MessagesFeedbacksResponse struct {
 	Result string `json:"result"`
 }
 
-func (dc *DifyClient) MessagesFeedbacks(message_id string, rating string) (result MessagesFeedbacksResponse, err error) {
+func (dc *DifyClient) MessagesFeedbacks(ctx context.Context, message_id string, rating string) (result MessagesFeedbacksResponse, err error) {
 	if message_id == "" {
 		return result, fmt.Errorf("message_id is required")
 	}
 
 	payload := map[string]string{
-		"user":   dc.User,
+		"user":   dc.GetUser(ctx),
 		"rating": rating,
 	}
 
 	api := dc.GetAPI(API_MESSAGES_FEEDBACKS)
 	api = UpdateAPIParam(api, API_PARAM_MESSAGE_ID, message_id)
 
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
+	code, body, err := SendPostRequestToAPI(ctx, dc, api, payload)
 
 	err = CommonRiskForSendRequest(code, err)
 
@@ -1,8 +1,10 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 )
 
 type MessagesSuggestedResponse struct {
@@ -10,19 +12,16 @@ type MessagesSuggestedResponse struct {
 	Data   []string `json:"data"`
 }
 
-func (dc *DifyClient) MessagesSuggested(message_id string) (result MessagesSuggestedResponse, err error) {
+func (dc *DifyClient) MessagesSuggested(ctx context.Context, message_id string) (result MessagesSuggestedResponse, err error) {
 	if message_id == "" {
 		return result, fmt.Errorf("message_id is required")
 	}
 
-	payload := map[string]string{
-		"user": dc.User,
-	}
-
 	api := dc.GetAPI(API_MESSAGES_SUGGESTED)
 	api = UpdateAPIParam(api, API_PARAM_MESSAGE_ID, message_id)
+	api += "?user=" + url.QueryEscape(dc.GetUser(ctx))
 
-	code, body, err := SendPostRequestToAPI(dc, api, payload)
+	code, body, err := SendGetRequestToAPI(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
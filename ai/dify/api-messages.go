@@ -1,8 +1,11 @@
 package dify
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
 )
 
 type MessagesResponse struct {
@@ -33,28 +36,24 @@ type MessagesResponse struct {
 	} `json:"data"`
 }
 
-func (dc *DifyClient) Messages(conversation_id string) (result MessagesResponse, err error) {
+func (dc *DifyClient) Messages(ctx context.Context, conversation_id string, first_id string, limit int) (result MessagesResponse, err error) {
 	if conversation_id == "" {
 		return result, fmt.Errorf("conversation_id is required")
 	}
-
-	payloadBody := map[string]string{
-		"user":            dc.User,
-		"conversation_id": conversation_id,
+	if limit <= 0 {
+		limit = 20
 	}
 
-	api := dc.GetAPI(API_MESSAGES)
-
-	code, body, err := SendPostRequestToAPI(dc, api, payloadBody)
-
-	err = CommonRiskForSendRequest(code, err)
-	if err != nil {
-		return result, err
+	query := url.Values{}
+	query.Set("user", dc.GetUser(ctx))
+	query.Set("conversation_id", conversation_id)
+	query.Set("limit", strconv.Itoa(limit))
+	if first_id != "" {
+		query.Set("first_id", first_id)
 	}
 
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return result, fmt.Errorf("failed to unmarshal the response: %v", err)
-	}
-	return result, nil
+	api := dc.GetAPI(API_MESSAGES) + "?" + query.Encode()
+
+	err = dc.requestJson(ctx, authAPI, http.MethodGet, api, nil, &result)
+	return result, err
 }
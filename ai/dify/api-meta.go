@@ -1,6 +1,7 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -15,9 +16,9 @@ type GetMetaResponse struct {
 	} `json:"tool_icons"`
 }
 
-func (dc *DifyClient) GetMeta() (result GetMetaResponse, err error) {
+func (dc *DifyClient) GetMeta(ctx context.Context) (result GetMetaResponse, err error) {
 	api := dc.GetAPI(API_META)
-	code, body, err := SendGetRequestToAPI(dc, api)
+	code, body, err := SendGetRequestToAPI(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
@@ -1,6 +1,7 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -114,9 +115,9 @@ type GetParametersResponse struct {
 	} `json:"system_parameters"`
 }
 
-func (dc *DifyClient) GetParameters() (result GetParametersResponse, err error) {
+func (dc *DifyClient) GetParameters(ctx context.Context) (result GetParametersResponse, err error) {
 	api := dc.GetAPI(API_PARAMETERS)
-	code, body, err := SendGetRequestToAPI(dc, api)
+	code, body, err := SendGetRequestToAPI(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
@@ -1,81 +1,43 @@
 package dify
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"io"
-	"mime/multipart"
 	"net/http"
-)
-
-func (dc *DifyClient) TextToAudio(text string) (result any, err error) {
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("text", text)
-	_ = writer.WriteField("user", dc.User)
-	_ = writer.WriteField("streaming", "false")
-	err = writer.Close()
-	if err != nil {
-		return result, fmt.Errorf("error closing writer: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", dc.GetAPI(API_TEXT_TO_AUDIO), payload)
-	if err != nil {
-		return result, fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", dc.Key))
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := dc.Client.Do(req)
-	if err != nil {
-		return result, fmt.Errorf("error sending request: %v", err)
-	}
-	defer resp.Body.Close()
+	"gitee.com/unitedrhino/share/errors"
+)
 
-	if resp.StatusCode != 200 {
-		return result, fmt.Errorf("status code: %d", resp.StatusCode)
-	}
+// TextToAudio 返回mp3格式的音频
+func (dc *DifyClient) TextToAudio(ctx context.Context, text string) (result []byte, err error) {
+	return dc.textToAudio(ctx, text, false)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return result, fmt.Errorf("could not read the body: %v", err)
-	}
-	return body, nil
+func (dc *DifyClient) TextToAudioStreaming(ctx context.Context, text string) (result []byte, err error) {
+	return dc.textToAudio(ctx, text, true)
 }
 
-func (dc *DifyClient) TextToAudioStreaming(text string) (result any, err error) {
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
-	_ = writer.WriteField("text", text)
-	_ = writer.WriteField("user", dc.User)
-	_ = writer.WriteField("streaming", "true")
-	err = writer.Close()
-	if err != nil {
-		return result, fmt.Errorf("error closing writer: %v", err)
+func (dc *DifyClient) textToAudio(ctx context.Context, text string, streaming bool) (result []byte, err error) {
+	fields := map[string]string{
+		"text":      text,
+		"user":      dc.GetUser(ctx),
+		"streaming": "false",
 	}
-
-	req, err := http.NewRequest("POST", dc.GetAPI(API_TEXT_TO_AUDIO), payload)
+	if streaming {
+		fields["streaming"] = "true"
+	}
+	contentType, body, err := multipartBody(fields, "", nil)
 	if err != nil {
-		return result, fmt.Errorf("error creating request: %v", err)
+		return nil, err
 	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", dc.Key))
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	resp, err := dc.Client.Do(req)
+	resp, err := dc.do(ctx, authAPI, http.MethodPost, dc.GetAPI(API_TEXT_TO_AUDIO), contentType, body)
 	if err != nil {
-		return result, fmt.Errorf("error sending request: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return result, fmt.Errorf("status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
+	result, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return result, fmt.Errorf("could not read the body: %v", err)
+		return nil, errors.System.AddDetail(err)
 	}
-	return body, nil
+	return result, nil
 }
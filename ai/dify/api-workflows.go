@@ -0,0 +1,198 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type WorkflowRunPayload struct {
+	Inputs       any                       `json:"inputs"`
+	ResponseMode string                    `json:"response_mode"`
+	User         string                    `json:"user"`
+	Files        []ChatMessagesPayloadFile `json:"files,omitempty"`
+}
+
+type WorkflowRunData struct {
+	ID          string         `json:"id"`
+	WorkflowID  string         `json:"workflow_id"`
+	Status      string         `json:"status"` //running, succeeded, failed, stopped
+	Outputs     map[string]any `json:"outputs"`
+	Error       string         `json:"error"`
+	ElapsedTime float64        `json:"elapsed_time"`
+	TotalTokens int            `json:"total_tokens"`
+	TotalSteps  int            `json:"total_steps"`
+	CreatedAt   int64          `json:"created_at"`
+	FinishedAt  int64          `json:"finished_at"`
+}
+
+type WorkflowRunResponse struct {
+	WorkflowRunID string          `json:"workflow_run_id"`
+	TaskID        string          `json:"task_id"`
+	Data          WorkflowRunData `json:"data"`
+}
+
+/*
+event: workflow_started workflow 开始执行
+event: node_started 节点开始执行
+event: node_finished 节点执行结束,成功失败同一事件中不同状态
+event: workflow_finished workflow 执行结束,成功失败同一事件中不同状态
+event: tts_message TTS 音频流事件
+event: error 流式输出过程中出现的异常
+event: ping 每 10s 一次的 ping 事件,保持连接存活
+*/
+type WorkflowSseResponse struct {
+	Event         string          `json:"event"`
+	TaskID        string          `json:"task_id"`
+	WorkflowRunID string          `json:"workflow_run_id"`
+	MessageID     string          `json:"message_id"`
+	Audio         string          `json:"audio"`
+	CreatedAt     int64           `json:"created_at"`
+	Data          json.RawMessage `json:"data"` //不同事件的数据不同,workflow_finished可以解析成WorkflowRunData
+	Status        int             `json:"status"`
+	Code          string          `json:"code"`
+	Message       string          `json:"message"`
+}
+
+func (r *WorkflowSseResponse) setStreamErr(err error) {
+	r.Event = EVENT_ERROR
+	r.Status, r.Code, r.Message = streamErr(err)
+}
+
+func (dc *DifyClient) WorkflowRun(ctx context.Context, inputs map[string]any, files []ChatMessagesPayloadFile) (result WorkflowRunResponse, err error) {
+	payload := WorkflowRunPayload{
+		Inputs:       inputs,
+		ResponseMode: RESPONSE_MODE_BLOCKING,
+		User:         dc.GetUser(ctx),
+		Files:        files,
+	}
+	err = dc.requestJson(ctx, authAPI, http.MethodPost, dc.GetAPI(API_WORKFLOWS_RUN), payload, &result)
+	return result, err
+}
+
+// WorkflowRunStreaming ctx结束后停止接收,运行中出现的错误以error事件返回
+func (dc *DifyClient) WorkflowRunStreaming(ctx context.Context, inputs map[string]any, files []ChatMessagesPayloadFile) (result chan WorkflowSseResponse, err error) {
+	payload := WorkflowRunPayload{
+		Inputs:       inputs,
+		ResponseMode: RESPONSE_MODE_STREAMING,
+		User:         dc.GetUser(ctx),
+		Files:        files,
+	}
+	_, result, err = SendPostSseRequestToAPI[WorkflowSseResponse](ctx, dc, dc.GetAPI(API_WORKFLOWS_RUN), payload)
+	return result, err
+}
+
+type WorkflowRunDetailResponse struct {
+	ID          string  `json:"id"`
+	WorkflowID  string  `json:"workflow_id"`
+	Status      string  `json:"status"`
+	Inputs      string  `json:"inputs"`
+	Outputs     any     `json:"outputs"`
+	Error       string  `json:"error"`
+	TotalSteps  int     `json:"total_steps"`
+	TotalTokens int     `json:"total_tokens"`
+	CreatedAt   int64   `json:"created_at"`
+	FinishedAt  int64   `json:"finished_at"`
+	ElapsedTime float64 `json:"elapsed_time"`
+}
+
+// WorkflowRunDetail 获取workflow的执行状态
+func (dc *DifyClient) WorkflowRunDetail(ctx context.Context, workflow_run_id string) (result WorkflowRunDetailResponse, err error) {
+	if workflow_run_id == "" {
+		return result, fmt.Errorf("workflow_run_id is required")
+	}
+
+	api := dc.GetAPI(API_WORKFLOWS_RUN_DETAIL)
+	api = UpdateAPIParam(api, API_PARAM_WORKFLOW_RUN_ID, workflow_run_id)
+
+	err = dc.requestJson(ctx, authAPI, http.MethodGet, api, nil, &result)
+	return result, err
+}
+
+type WorkflowStopResponse struct {
+	Result string `json:"result"`
+}
+
+// WorkflowStop 只支持流式模式
+func (dc *DifyClient) WorkflowStop(ctx context.Context, task_id string) (result WorkflowStopResponse, err error) {
+	if task_id == "" {
+		return result, fmt.Errorf("task_id is required")
+	}
+
+	payload := map[string]string{
+		"user": dc.GetUser(ctx),
+	}
+
+	api := dc.GetAPI(API_WORKFLOWS_STOP)
+	api = UpdateAPIParam(api, API_PARAM_TASK_ID, task_id)
+
+	err = dc.requestJson(ctx, authAPI, http.MethodPost, api, payload, &result)
+	return result, err
+}
+
+type WorkflowLogsRequest struct {
+	Keyword string //关键字
+	Status  string //succeeded, failed, stopped
+	Page    int    //默认1
+	Limit   int    //默认20
+}
+
+type WorkflowLogsResponse struct {
+	Page    int               `json:"page"`
+	Limit   int               `json:"limit"`
+	Total   int               `json:"total"`
+	HasMore bool              `json:"has_more"`
+	Data    []WorkflowLogItem `json:"data"`
+}
+
+type WorkflowLogItem struct {
+	ID          string `json:"id"`
+	WorkflowRun struct {
+		ID          string  `json:"id"`
+		Version     string  `json:"version"`
+		Status      string  `json:"status"`
+		Error       string  `json:"error"`
+		ElapsedTime float64 `json:"elapsed_time"`
+		TotalTokens int     `json:"total_tokens"`
+		TotalSteps  int     `json:"total_steps"`
+		CreatedAt   int64   `json:"created_at"`
+		FinishedAt  int64   `json:"finished_at"`
+	} `json:"workflow_run"`
+	CreatedFrom      string `json:"created_from"`
+	CreatedByRole    string `json:"created_by_role"`
+	CreatedByAccount any    `json:"created_by_account"`
+	CreatedByEndUser struct {
+		ID          string `json:"id"`
+		Type        string `json:"type"`
+		IsAnonymous bool   `json:"is_anonymous"`
+		SessionID   string `json:"session_id"`
+	} `json:"created_by_end_user"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (dc *DifyClient) WorkflowLogs(ctx context.Context, req WorkflowLogsRequest) (result WorkflowLogsResponse, err error) {
+	query := url.Values{}
+	if req.Keyword != "" {
+		query.Set("keyword", req.Keyword)
+	}
+	if req.Status != "" {
+		query.Set("status", req.Status)
+	}
+	if req.Page > 0 {
+		query.Set("page", strconv.Itoa(req.Page))
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+
+	api := dc.GetAPI(API_WORKFLOWS_LOGS)
+	if len(query) > 0 {
+		api += "?" + query.Encode()
+	}
+
+	err = dc.requestJson(ctx, authAPI, http.MethodGet, api, nil, &result)
+	return result, err
+}
@@ -24,9 +24,30 @@ const (
 	API_AUDIO_TO_TEXT = "/audio-to-text"
 	API_TEXT_TO_AUDIO = "/text-to-audio"
 
+	API_WORKFLOWS_RUN        = "/workflows/run"
+	API_WORKFLOWS_RUN_DETAIL = "/workflows/run/:workflow_run_id"
+	API_WORKFLOWS_STOP       = "/workflows/tasks/:task_id/stop"
+	API_WORKFLOWS_LOGS       = "/workflows/logs"
+
+	API_DATASETS                  = "/datasets"
+	API_DATASETS_DELETE           = "/datasets/:dataset_id"
+	API_DOCUMENTS                 = "/datasets/:dataset_id/documents"
+	API_DOCUMENTS_CREATE_BY_TEXT  = "/datasets/:dataset_id/document/create-by-text"
+	API_DOCUMENTS_CREATE_BY_FILE  = "/datasets/:dataset_id/document/create-by-file"
+	API_DOCUMENTS_UPDATE_BY_TEXT  = "/datasets/:dataset_id/documents/:document_id/update-by-text"
+	API_DOCUMENTS_DELETE          = "/datasets/:dataset_id/documents/:document_id"
+	API_DOCUMENTS_INDEXING_STATUS = "/datasets/:dataset_id/documents/:batch/indexing-status"
+	API_SEGMENTS                  = "/datasets/:dataset_id/documents/:document_id/segments"
+	API_SEGMENTS_DETAIL           = "/datasets/:dataset_id/documents/:document_id/segments/:segment_id"
+
 	API_PARAM_TASK_ID         = ":task_id"
 	API_PARAM_MESSAGE_ID      = ":message_id"
 	API_PARAM_CONVERSATION_ID = ":conversation_id"
+	API_PARAM_WORKFLOW_RUN_ID = ":workflow_run_id"
+	API_PARAM_DATASET_ID      = ":dataset_id"
+	API_PARAM_DOCUMENT_ID     = ":document_id"
+	API_PARAM_SEGMENT_ID      = ":segment_id"
+	API_PARAM_BATCH           = ":batch"
 
 	CONSOLE_API_FILE_UPLOAD = "/files/upload?source=datasets"
 	CONSOLE_API_LOGIN       = "/login"
@@ -1,8 +1,10 @@
 package dify
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"github.com/zeromicro/go-zero/core/logx"
 	"net/http"
 	"strings"
 	"time"
@@ -12,9 +14,12 @@ type DifyClientConfig struct {
 	Key         string
 	Host        string
 	ConsoleHost string
-	Timeout     int
+	DatasetKey  string //知识库的API Key,为空时使用Key
+	Timeout     int    //非流式请求的超时时间,单位秒
 	SkipTLS     bool
 	User        string
+	MaxRetry    int //网络错误及限流等错误的重试次数
+	RetryWait   int //第一次重试的等待时间,之后每次翻倍,单位毫秒,默认500
 }
 
 type DifyClient struct {
@@ -22,10 +27,13 @@ type DifyClient struct {
 	Host         string
 	ConsoleHost  string
 	ConsoleToken string
+	DatasetKey   string
 	Timeout      time.Duration
 	SkipTLS      bool
 	Client       *http.Client
 	User         string
+	MaxRetry     int
+	RetryWait    time.Duration
 }
 
 func NewDifyClient(config DifyClientConfig) (*DifyClient, error) {
@@ -42,13 +50,13 @@ func NewDifyClient(config DifyClientConfig) (*DifyClient, error) {
 	consoleURL := strings.TrimSpace(config.ConsoleHost)
 	if consoleURL == "" {
 		consoleURL = strings.ReplaceAll(host, "/v1", "/console/api")
-		fmt.Println("Console URL is not provided, use default value", consoleURL)
+		logx.Infof("dify console URL is not provided, use default value:%s", consoleURL)
 	}
 
-	timeout := 0 * time.Second
+	timeout := time.Duration(config.Timeout) * time.Second
 	if config.Timeout <= 0 {
 		if config.Timeout < 0 {
-			fmt.Println("Timeout should be a positive number, reset to default value: 10s")
+			logx.Errorf("dify timeout should be a positive number, reset to default value: %ds", DEFAULT_TIMEOUT)
 		}
 		timeout = DEFAULT_TIMEOUT * time.Second
 	}
@@ -63,6 +71,11 @@ func NewDifyClient(config DifyClientConfig) (*DifyClient, error) {
 		config.User = DEFAULT_USER
 	}
 
+	retryWait := time.Duration(config.RetryWait) * time.Millisecond
+	if retryWait <= 0 {
+		retryWait = DEFAULT_RETRY_WAIT * time.Millisecond
+	}
+
 	var client *http.Client
 
 	if skipTLS {
@@ -81,9 +94,27 @@ func NewDifyClient(config DifyClientConfig) (*DifyClient, error) {
 		Key:         key,
 		Host:        host,
 		ConsoleHost: consoleURL,
+		DatasetKey:  strings.TrimSpace(config.DatasetKey),
 		Timeout:     timeout,
 		SkipTLS:     skipTLS,
 		Client:      client,
 		User:        config.User,
+		MaxRetry:    max(config.MaxRetry, 0),
+		RetryWait:   retryWait,
 	}, nil
 }
+
+type userKey struct{}
+
+// WithUser 设置单次调用使用的dify用户,不设置时使用配置的User
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// GetUser 获取本次调用使用的dify用户
+func (dc *DifyClient) GetUser(ctx context.Context) string {
+	if user, ok := ctx.Value(userKey{}).(string); ok && user != "" {
+		return user
+	}
+	return dc.User
+}
@@ -0,0 +1,129 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *DifyClient {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	dc, err := NewDifyClient(DifyClientConfig{Key: "app-key", DatasetKey: "dataset-key", Host: srv.URL + "/v1", MaxRetry: 2, RetryWait: 1})
+	require.NoError(t, err)
+	return dc
+}
+
+func TestRetryAndError(t *testing.T) {
+	var calls atomic.Int32
+	dc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "Bearer app-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "bob", r.URL.Query().Get("user"))
+		fmt.Fprint(w, `{"limit":20,"has_more":false,"data":[{"id":"c1"}]}`)
+	})
+	ret, err := dc.Conversations(WithUser(context.Background(), "bob"), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, "c1", ret.Data[0].ID)
+
+	dc = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"status":400,"code":"invalid_param","message":"query is required"}`)
+	})
+	calls.Store(0)
+	_, err = dc.ChatMessages(context.Background(), nil, "", "", nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "参数错误不重试")
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "invalid_param", e.Code)
+	assert.Equal(t, errors.Parameter.Code, errors.Fmt(err).Code)
+
+	dc = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	calls.Store(0)
+	_, err = dc.ChatMessages(context.Background(), nil, "", "hi", nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "POST请求可能已经执行,网关错误不重试")
+
+	dc = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"answer":"ok"}`)
+	})
+	calls.Store(0)
+	_, err = dc.ChatMessages(context.Background(), nil, "", "hi", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load(), "限流的请求没有执行,可以重试")
+}
+
+func TestWorkflowRun(t *testing.T) {
+	dc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var payload WorkflowRunPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, "/v1"+API_WORKFLOWS_RUN, r.URL.Path)
+		assert.Equal(t, DEFAULT_USER, payload.User)
+		if payload.ResponseMode == RESPONSE_MODE_BLOCKING {
+			fmt.Fprint(w, `{"workflow_run_id":"r1","task_id":"t1","data":{"status":"succeeded","outputs":{"text":"ok"}}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"event\":\"workflow_started\",\"task_id\":\"t1\"}\n\n")
+		fmt.Fprint(w, "event: ping\n\n")
+		fmt.Fprint(w, "data: {\"event\":\"workflow_finished\",\"data\":{\"status\":\"succeeded\"}}\n\n")
+		fmt.Fprint(w, "data: not json\n\n")
+	})
+	ret, err := dc.WorkflowRun(context.Background(), map[string]any{"q": "hi"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", ret.Data.Outputs["text"])
+
+	c, err := dc.WorkflowRunStreaming(context.Background(), map[string]any{"q": "hi"}, nil)
+	require.NoError(t, err)
+	var events []WorkflowSseResponse
+	for e := range c {
+		events = append(events, e)
+	}
+	require.Len(t, events, 3)
+	assert.Equal(t, "t1", events[0].TaskID)
+	var data WorkflowRunData
+	require.NoError(t, json.Unmarshal(events[1].Data, &data))
+	assert.Equal(t, "succeeded", data.Status)
+	assert.Equal(t, EVENT_ERROR, events[2].Event, "解析失败以错误事件返回")
+}
+
+func TestDataset(t *testing.T) {
+	dc := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer dataset-key", r.Header.Get("Authorization"))
+		switch r.Method {
+		case http.MethodDelete:
+			assert.Equal(t, "/v1/datasets/d1/documents/doc1/segments/s1", r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(t, `{"name":"a.txt","text":"hello","indexing_technique":"high_quality","process_rule":{"mode":"automatic"}}`, string(body))
+			fmt.Fprint(w, `{"document":{"id":"doc1","indexing_status":"waiting"},"batch":"b1"}`)
+		}
+	})
+	ret, err := dc.DocumentCreateByText(context.Background(), "d1", DocumentCreatePayload{Name: "a.txt", Text: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "b1", ret.Batch)
+	require.NoError(t, dc.SegmentDelete(context.Background(), "d1", "doc1", "s1"))
+}
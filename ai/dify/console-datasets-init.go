@@ -1,6 +1,7 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -90,7 +91,7 @@ type InitDatasetsResponseDatasetDocument struct {
 	DocForm              string `json:"doc_form"`
 }
 
-func (dc *DifyClient) InitDatasetsByUploadFile(datasets_ids []string) (result InitDatasetsResponse, err error) {
+func (dc *DifyClient) InitDatasetsByUploadFile(ctx context.Context, datasets_ids []string) (result InitDatasetsResponse, err error) {
 	payload := &InitDatasetsPayload{
 		DocForm:           "text_model",
 		DocLanguage:       "Chinese",
@@ -122,11 +123,10 @@ func (dc *DifyClient) InitDatasetsByUploadFile(datasets_ids []string) (result In
 
 	api := dc.GetConsoleAPI(CONSOLE_API_DATASETS_INIT)
 
-	code, body, err := SendPostRequestToConsole(dc, api, payload)
+	code, body, err := SendPostRequestToConsole(ctx, dc, api, payload)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
-		fmt.Println("error: ", string(body))
 		return result, err
 	}
 
@@ -156,11 +156,11 @@ type InitDatasetsIndexingStatusData struct {
 	TotalSegments        int    `json:"total_segments"`
 }
 
-func (dc *DifyClient) InitDatasetsIndexingStatus(datasets_id string) (result InitDatasetsIndexingStatusResponse, err error) {
+func (dc *DifyClient) InitDatasetsIndexingStatus(ctx context.Context, datasets_id string) (result InitDatasetsIndexingStatusResponse, err error) {
 	api := dc.GetConsoleAPI(CONSOLE_API_DATASETS_INIT_STATUS)
 	api = UpdateAPIParam(api, CONSOLE_API_PARAM_DATASETS_ID, datasets_id)
 
-	code, body, err := SendGetRequestToConsole(dc, api)
+	code, body, err := SendGetRequestToConsole(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
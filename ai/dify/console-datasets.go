@@ -1,13 +1,13 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 )
 
-func (dc *DifyClient) DeleteDatasets(datasets_id string) (ok bool, err error) {
+func (dc *DifyClient) DeleteDatasets(ctx context.Context, datasets_id string) (ok bool, err error) {
 	if datasets_id == "" {
 		return false, fmt.Errorf("datasets_id is required")
 	}
@@ -15,27 +15,10 @@ func (dc *DifyClient) DeleteDatasets(datasets_id string) (ok bool, err error) {
 	api := dc.GetConsoleAPI(CONSOLE_API_DATASETS_DELETE)
 	api = UpdateAPIParam(api, CONSOLE_API_PARAM_DATASETS_ID, datasets_id)
 
-	req, err := http.NewRequest("DELETE", api, nil)
-	if err != nil {
-		return false, fmt.Errorf("could not create a new request: %v", err)
-	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", dc.ConsoleToken))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := dc.Client.Do(req)
+	err = dc.requestJson(ctx, authConsole, http.MethodDelete, api, nil, nil)
 	if err != nil {
 		return false, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 204 {
-		bodyText, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return false, fmt.Errorf("status code: %d, could not read the body", resp.StatusCode)
-		}
-		return false, fmt.Errorf("status code: %d, %s", resp.StatusCode, bodyText)
-	}
-
 	return true, nil
 }
 
@@ -75,14 +58,14 @@ type CreateDatasetsResponse struct {
 	Tags []any `json:"tags"`
 }
 
-func (dc *DifyClient) CreateDatasets(datasets_name string) (result CreateDatasetsResponse, err error) {
+func (dc *DifyClient) CreateDatasets(ctx context.Context, datasets_name string) (result CreateDatasetsResponse, err error) {
 	payload := &CreateDatasetsPayload{
 		Name: datasets_name,
 	}
 
 	api := dc.GetConsoleAPI(CONSOLE_API_DATASETS_CREATE)
 
-	code, body, err := SendPostRequestToConsole(dc, api, payload)
+	code, body, err := SendPostRequestToConsole(ctx, dc, api, payload)
 
 	err = CommonRiskForSendRequestWithCode(code, err, http.StatusCreated)
 	if err != nil {
@@ -129,7 +112,7 @@ type ListDatasetsModelConfigDetail struct {
 	} `json:"completion_params"`
 }
 
-func (dc *DifyClient) ListDatasets(page int, limit int) (result ListDatasetsResponse, err error) {
+func (dc *DifyClient) ListDatasets(ctx context.Context, page int, limit int) (result ListDatasetsResponse, err error) {
 	if page < 1 {
 		return result, fmt.Errorf("page should be greater than 0")
 	}
@@ -140,7 +123,7 @@ func (dc *DifyClient) ListDatasets(page int, limit int) (result ListDatasetsResp
 	api := dc.GetConsoleAPI(CONSOLE_API_DATASETS_LIST)
 	api = fmt.Sprintf("%s?page=%d&limit=%d", api, page, limit)
 
-	code, body, err := SendGetRequestToConsole(dc, api)
+	code, body, err := SendGetRequestToConsole(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
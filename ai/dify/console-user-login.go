@@ -1,6 +1,7 @@
 package dify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -16,7 +17,7 @@ type UserLoginResponse struct {
 	Data   string `json:"data"`
 }
 
-func (dc *DifyClient) UserLogin(email string, password string) (result UserLoginResponse, err error) {
+func (dc *DifyClient) UserLogin(ctx context.Context, email string, password string) (result UserLoginResponse, err error) {
 	var payload = UserLoginParams{
 		Email:      email,
 		Password:   password,
@@ -25,7 +26,7 @@ func (dc *DifyClient) UserLogin(email string, password string) (result UserLogin
 
 	api := dc.GetConsoleAPI(CONSOLE_API_LOGIN)
 
-	code, body, err := SendPostRequestToConsole(dc, api, payload)
+	code, body, err := SendPostRequestToConsole(ctx, dc, api, payload)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
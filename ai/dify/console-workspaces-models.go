@@ -3,6 +3,7 @@ package dify
 // https://dify.lab.io/console/api/workspaces/current/models/model-types/rerank
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -45,10 +46,10 @@ type ListWorkspacesRerankModel struct {
 	Status     string `json:"status"`
 }
 
-func (dc *DifyClient) ListWorkspacesRerankModels() (result ListWorkspacesRerankModelsResponse, err error) {
+func (dc *DifyClient) ListWorkspacesRerankModels(ctx context.Context) (result ListWorkspacesRerankModelsResponse, err error) {
 	api := dc.GetConsoleAPI(CONSOLE_API_WORKSPACES_RERANK_MODEL)
 
-	code, body, err := SendGetRequestToConsole(dc, api)
+	code, body, err := SendGetRequestToConsole(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
@@ -66,10 +67,10 @@ type GetCurrentWorkspaceRerankDefaultModelResponse struct {
 	Data any `json:"data"`
 }
 
-func (dc *DifyClient) GetCurrentWorkspaceRerankDefaultModel() (result GetCurrentWorkspaceRerankDefaultModelResponse, err error) {
+func (dc *DifyClient) GetCurrentWorkspaceRerankDefaultModel(ctx context.Context) (result GetCurrentWorkspaceRerankDefaultModelResponse, err error) {
 	api := dc.GetConsoleAPI(CONSOLE_API_CURRENT_WORKSPACE_RERANK_MODEL)
 
-	code, body, err := SendGetRequestToConsole(dc, api)
+	code, body, err := SendGetRequestToConsole(ctx, dc, api)
 
 	err = CommonRiskForSendRequest(code, err)
 	if err != nil {
@@ -4,6 +4,10 @@ const (
 	DEFAULT_TIMEOUT = 10
 	DEFAULT_USER    = "ur"
 
+	DEFAULT_RETRY_WAIT = 500
+
 	RESPONSE_MODE_STREAMING = "streaming"
 	RESPONSE_MODE_BLOCKING  = "blocking"
+
+	EVENT_ERROR = "error"
 )
@@ -1,19 +1,13 @@
 package dify
 
 import (
-	"fmt"
-	"net/http"
+	"context"
 )
 
-func setConsoleAuthorization(dc *DifyClient, req *http.Request) {
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", dc.ConsoleToken))
-	req.Header.Set("Content-Type", "application/json")
+func SendGetRequestToConsole(ctx context.Context, dc *DifyClient, api string) (httpCode int, bodyText []byte, err error) {
+	return SendGetRequest(ctx, true, dc, api)
 }
 
-func SendGetRequestToConsole(dc *DifyClient, api string) (httpCode int, bodyText []byte, err error) {
-	return SendGetRequest(true, dc, api)
-}
-
-func SendPostRequestToConsole(dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText []byte, err error) {
-	return SendPostRequest(true, dc, api, postBody)
+func SendPostRequestToConsole(ctx context.Context, dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText []byte, err error) {
+	return SendPostRequest(ctx, true, dc, api, postBody)
 }
@@ -1,7 +1,7 @@
 package dify
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,134 +9,285 @@ import (
 	"gitee.com/unitedrhino/share/utils"
 	"github.com/zeromicro/go-zero/core/logx"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"strings"
+	"os"
+	"time"
 )
 
-func SendGetRequest(forConsole bool, dc *DifyClient, api string) (httpCode int, bodyText []byte, err error) {
-	req, err := http.NewRequest("GET", api, nil)
-	if err != nil {
-		return -1, nil, err
+type authType int
+
+const (
+	authAPI     authType = iota //应用的API Key
+	authConsole                 //控制台登录的token
+	authDataset                 //知识库的API Key
+)
+
+const maxRetryWait = 30 * time.Second
+
+// Error dify接口返回的错误,可以通过errors.As从返回的错误中获取
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dify status:%d code:%s message:%s", e.Status, e.Code, e.Message)
+}
+
+// 非2xx的应答解析成Error,并按http状态码转换成对应的错误码
+func parseError(status int, body []byte) error {
+	e := &Error{}
+	if err := json.Unmarshal(body, e); err != nil || (e.Code == "" && e.Message == "") {
+		e = &Error{Message: string(body)}
 	}
+	e.Status = status
+	return errors.Wrap(e, utils.HttpStatusErr(status))
+}
 
-	if forConsole {
-		setConsoleAuthorization(dc, req)
-	} else {
-		setAPIAuthorization(dc, req)
+func (dc *DifyClient) setAuthorization(req *http.Request, auth authType) {
+	var key string
+	switch auth {
+	case authConsole:
+		key = dc.ConsoleToken
+	case authDataset:
+		key = dc.DatasetKey
+		if key == "" {
+			key = dc.Key
+		}
+	default:
+		key = dc.Key
 	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+}
 
-	resp, err := dc.Client.Do(req)
+// do 发送请求,按utils.HttpRetry的策略重试,非2xx的应答返回Error
+func (dc *DifyClient) do(ctx context.Context, auth authType, method string, api string, contentType string, body []byte) (*http.Response, error) {
+	retry := utils.HttpRetry{MaxRetry: dc.MaxRetry, Wait: dc.RetryWait, MaxWait: maxRetryWait}
+	return retry.Do(ctx, dc.Client, func(ctx context.Context) (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, api, reader)
+		if err != nil {
+			return nil, err
+		}
+		dc.setAuthorization(req, auth)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	}, parseError)
+}
+
+// requestJson 以json发送payload(为nil时没有请求体),并将应答解析到result中
+func (dc *DifyClient) requestJson(ctx context.Context, auth authType, method string, api string, payload any, result any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return errors.Parameter.AddDetail(err)
+		}
+	}
+	resp, err := dc.do(ctx, auth, method, api, "application/json", body)
 	if err != nil {
-		return -1, nil, err
+		return err
 	}
 	defer resp.Body.Close()
+	return decodeResponse(resp, result)
+}
 
-	bodyText, err = io.ReadAll(resp.Body)
-	return resp.StatusCode, bodyText, err
+func decodeResponse(resp *http.Response, result any) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return errors.System.AddDetailf("failed to unmarshal the response: %v body:%s", err, data)
+	}
+	return nil
 }
 
-func SendPostRequest(forConsole bool, dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText []byte, err error) {
-	var payload *strings.Reader
-	if postBody != nil {
-		buf, err := json.Marshal(postBody)
+// multipartBody 生成multipart/form-data的请求体,file为nil时不带文件
+func multipartBody(fields map[string]string, fileName string, file io.Reader) (contentType string, body []byte, err error) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	if file != nil {
+		part, err := writer.CreateFormFile("file", fileName)
 		if err != nil {
-			return -1, nil, err
+			return "", nil, errors.System.AddDetail(err)
+		}
+		if _, err = io.Copy(part, file); err != nil {
+			return "", nil, errors.System.AddDetail(err)
 		}
-		payload = strings.NewReader(string(buf))
-	} else {
-		payload = nil
 	}
+	for k, v := range fields {
+		if err = writer.WriteField(k, v); err != nil {
+			return "", nil, errors.System.AddDetail(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return "", nil, errors.System.AddDetail(err)
+	}
+	return writer.FormDataContentType(), buf.Bytes(), nil
+}
 
-	req, err := http.NewRequest("POST", api, payload)
+// requestForm 以multipart/form-data上传文件,并将应答解析到result中
+func (dc *DifyClient) requestForm(ctx context.Context, auth authType, api string, fields map[string]string, fileName string, file io.Reader, result any) error {
+	contentType, body, err := multipartBody(fields, fileName, file)
 	if err != nil {
-		return -1, nil, err
+		return err
 	}
-
-	if forConsole {
-		setConsoleAuthorization(dc, req)
-	} else {
-		setAPIAuthorization(dc, req)
+	resp, err := dc.do(ctx, auth, http.MethodPost, api, contentType, body)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, result)
+}
 
-	resp, err := dc.Client.Do(req)
+// openFile 打开本地文件,调用方需要关闭
+func openFile(filePath string) (*os.File, error) {
+	fd, err := os.Open(filePath)
 	if err != nil {
-		return -1, nil, err
+		return nil, errors.Parameter.AddDetail(err)
 	}
-	defer resp.Body.Close()
+	return fd, nil
+}
 
-	bodyText, err = io.ReadAll(resp.Body)
-	return resp.StatusCode, bodyText, err
+func SendGetRequest(ctx context.Context, forConsole bool, dc *DifyClient, api string) (httpCode int, bodyText []byte, err error) {
+	return sendRequest(ctx, forConsole, dc, http.MethodGet, api, nil)
 }
 
-func SendPostRequestSse[rsp any](ctx context.Context, forConsole bool, dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText chan rsp, err error) {
-	var payload *strings.Reader
+func SendPostRequest(ctx context.Context, forConsole bool, dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText []byte, err error) {
+	return sendRequest(ctx, forConsole, dc, http.MethodPost, api, postBody)
+}
+
+func sendRequest(ctx context.Context, forConsole bool, dc *DifyClient, method string, api string, postBody interface{}) (httpCode int, bodyText []byte, err error) {
+	var body []byte
 	if postBody != nil {
-		buf, err := json.Marshal(postBody)
+		body, err = json.Marshal(postBody)
 		if err != nil {
 			return -1, nil, err
 		}
-		payload = strings.NewReader(string(buf))
-	} else {
-		payload = nil
 	}
-
-	req, err := http.NewRequest("POST", api, payload)
+	auth := authAPI
+	if forConsole {
+		auth = authConsole
+	}
+	resp, err := dc.do(ctx, auth, method, api, "application/json", body)
 	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			return e.Status, []byte(e.Message), err
+		}
 		return -1, nil, err
 	}
+	defer resp.Body.Close()
+	bodyText, err = io.ReadAll(resp.Body)
+	return resp.StatusCode, bodyText, err
+}
+
+// 流式应答中出现的错误以error事件发送给调用方
+type streamErrSetter interface {
+	setStreamErr(err error)
+}
+
+// streamErr 流式应答中的错误转换成dify错误事件的字段
+func streamErr(err error) (status int, code string, message string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status, e.Code, e.Message
+	}
+	return http.StatusInternalServerError, "internal_server_error", err.Error()
+}
 
+func SendPostRequestSse[rsp any](ctx context.Context, forConsole bool, dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText chan rsp, err error) {
+	auth := authAPI
 	if forConsole {
-		setConsoleAuthorization(dc, req)
-	} else {
-		setAPIAuthorization(dc, req)
+		auth = authConsole
 	}
+	return sendRequestSse[rsp](ctx, auth, dc, api, postBody)
+}
 
-	resp, err := dc.Client.Do(req)
+func sendRequestSse[rsp any](ctx context.Context, auth authType, dc *DifyClient, api string, postBody interface{}) (httpCode int, bodyText chan rsp, err error) {
+	var body []byte
+	if postBody != nil {
+		body, err = json.Marshal(postBody)
+		if err != nil {
+			return -1, nil, errors.Parameter.AddDetail(err)
+		}
+	}
+	resp, err := dc.doStream(ctx, auth, api, body)
 	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			return e.Status, nil, err
+		}
 		return -1, nil, err
 	}
-	if resp.StatusCode != 200 {
-		return resp.StatusCode, nil, errors.System
-	}
 	c := make(chan rsp, 10)
+	send := func(ret rsp) bool {
+		select {
+		case c <- ret:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	sendErr := func(err error) {
+		logx.WithContext(ctx).Errorf("dify sse api:%s err:%v", api, err)
+		var ret rsp
+		if s, ok := any(&ret).(streamErrSetter); ok {
+			s.setStreamErr(err)
+			send(ret)
+		}
+	}
 	utils.Go(ctx, func() {
 		defer resp.Body.Close()
 		defer close(c)
-		// 创建一个缓冲读取器来逐行读取响应
-		reader := bufio.NewReader(resp.Body)
+		reader := utils.NewSseReader(resp.Body)
 		for {
-			// 读取一行数据
-			line, err := reader.ReadString('\n')
+			event, err := reader.Next()
 			if err != nil {
-				if err == io.EOF {
-					break
+				if err != io.EOF && ctx.Err() == nil {
+					sendErr(errors.System.AddDetail(err))
 				}
-				logx.WithContext(ctx).Errorf("读取数据时出错: %v", err)
 				return
 			}
-
-			// 去除行尾的换行符
-			line = strings.TrimSpace(line)
-			// 忽略空行
-			if line == "" {
+			if err := event.Err(); err != nil {
+				sendErr(err)
+				return
+			}
+			var ret rsp
+			if err := json.Unmarshal([]byte(event.Data), &ret); err != nil {
+				sendErr(errors.System.AddDetailf("解析事件数据失败:%s err:%v", event.Data, err))
 				continue
 			}
-
-			// 解析 SSE 事件
-			if strings.HasPrefix(line, "data:") {
-				// 提取事件数据
-				data := strings.TrimPrefix(line, "data:")
-				data = strings.TrimSpace(data)
-				var ret rsp
-				err = json.Unmarshal([]byte(data), &ret)
-				c <- ret
-				logx.WithContext(ctx).Debugf("接收到事件数据: %s", data)
+			logx.WithContext(ctx).Debugf("接收到事件数据: %s", event.Data)
+			if !send(ret) {
+				return
 			}
 		}
 	})
 	return resp.StatusCode, c, nil
 }
 
+// 流式请求不使用http.Client的超时,超时由ctx控制
+func (dc *DifyClient) doStream(ctx context.Context, auth authType, api string, body []byte) (*http.Response, error) {
+	sc := *dc
+	client := *dc.Client
+	client.Timeout = 0
+	sc.Client = &client
+	return sc.do(ctx, auth, http.MethodPost, api, "application/json", body)
+}
+
 func CommonRiskForSendRequest(code int, err error) error {
 	if err != nil {
 		return err
@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// 模拟DashScope的websocket服务
+// tts: continue-task的文本原样作为音频返回,文本为drop时断开连接
+// asr: 每段音频返回一个中间结果,finish-task时返回整句
+// model为bad时返回task-failed
+type fakeAliServer struct {
+	*httptest.Server
+	conns atomic.Int32 //建立过的连接数
+}
+
+func newFakeAliServer(t *testing.T) *fakeAliServer {
+	f := &fakeAliServer{}
+	upgrader := websocket.Upgrader{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.conns.Add(1)
+		go f.serve(ws)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAliServer) url() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+func (f *fakeAliServer) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	var (
+		taskID string
+		task   string
+		heard  []string
+	)
+	send := func(event string, output *Output) {
+		e := Event{Header: Header{TaskID: taskID, Event: event}, Payload: Payload{Output: output}}
+		if event == aliEventTaskFailed {
+			e.Header.ErrorCode = "InvalidParameter"
+			e.Header.ErrorMessage = "bad model"
+		}
+		data, _ := json.Marshal(e)
+		ws.WriteMessage(websocket.TextMessage, data)
+	}
+	for {
+		messageType, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == websocket.BinaryMessage {
+			heard = append(heard, string(data))
+			send(aliEventResultGenerated, &Output{Sentence: &Sentence{Text: strings.Join(heard, "")}})
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			return
+		}
+		switch e.Header.Action {
+		case aliActionRunTask:
+			taskID, task, heard = e.Header.TaskID, e.Payload.Task, nil
+			if e.Payload.Model == "bad" {
+				send(aliEventTaskFailed, nil)
+				continue
+			}
+			send(aliEventTaskStarted, nil)
+		case aliActionContinueTask:
+			if e.Payload.Input.Text == "drop" {
+				return
+			}
+			ws.WriteMessage(websocket.BinaryMessage, []byte(e.Payload.Input.Text))
+			send(aliEventResultGenerated, &Output{})
+		case aliActionFinishTask:
+			if task == "asr" {
+				end := int64(1000)
+				send(aliEventResultGenerated, &Output{Sentence: &Sentence{Text: strings.Join(heard, "") + "。", EndTime: &end, SentenceEnd: true}})
+			}
+			send(aliEventTaskFinished, nil)
+		}
+	}
+}
@@ -1,56 +1,291 @@
 package clients
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
 	"github.com/hibiken/asynq"
+	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"math"
+	"math/rand"
+	"strings"
 	"sync"
 	"time"
 )
 
+// NewTaskQueueConf 兼容使用缓存配置的旧用法,cluster类型会使用所有节点的地址
+func NewTaskQueueConf(c cache.ClusterConf) conf.TaskQueueConf {
+	var ret conf.TaskQueueConf
+	if len(c) == 0 {
+		return fillTaskQueueConf(ret)
+	}
+	ret.Redis = conf.TaskRedisConf{
+		Type: conf.TaskRedisNode,
+		User: c[0].User,
+		Pass: c[0].Pass,
+		Tls:  c[0].Tls,
+	}
+	for _, node := range c {
+		for _, host := range strings.Split(node.Host, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				ret.Redis.Hosts = append(ret.Redis.Hosts, host)
+			}
+		}
+		if node.Type == redis.ClusterType {
+			ret.Redis.Type = conf.TaskRedisCluster
+		}
+	}
+	return fillTaskQueueConf(ret)
+}
+
+// 不是通过conf.Load加载的配置没有默认值,这里补上
+func fillTaskQueueConf(c conf.TaskQueueConf) conf.TaskQueueConf {
+	if c.Redis.Type == "" {
+		c.Redis.Type = conf.TaskRedisNode
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 20
+	}
+	if len(c.Queues) == 0 {
+		c.Queues = map[string]int{}
+		for weight, queue := range def.TimerPriority {
+			c.Queues[queue] = int(weight)
+		}
+		c.StrictPriority = true
+	}
+	if c.MaxRetry <= 0 {
+		c.MaxRetry = 25
+	}
+	if c.RetryBaseDelay <= 0 {
+		c.RetryBaseDelay = 1
+	}
+	if c.RetryMaxDelay <= 0 {
+		c.RetryMaxDelay = 3600
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = 8
+	}
+	if c.TimeZone == "" {
+		c.TimeZone = "Asia/Shanghai"
+	}
+	return c
+}
+
+// NewAsynqRedisOpt 根据配置生成单节点,集群或哨兵模式的redis连接
+func NewAsynqRedisOpt(c conf.TaskRedisConf) (asynq.RedisConnOpt, error) {
+	if len(c.Hosts) == 0 {
+		return nil, errors.Parameter.AddMsg("任务队列需要配置redis地址")
+	}
+	var tlsConf *tls.Config
+	if c.Tls {
+		tlsConf = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	switch c.Type {
+	case conf.TaskRedisCluster:
+		return asynq.RedisClusterClientOpt{
+			Addrs:     c.Hosts,
+			Username:  c.User,
+			Password:  c.Pass,
+			TLSConfig: tlsConf,
+		}, nil
+	case conf.TaskRedisSentinel:
+		if c.MasterName == "" {
+			return nil, errors.Parameter.AddMsg("哨兵模式需要配置MasterName")
+		}
+		return asynq.RedisFailoverClientOpt{
+			MasterName:       c.MasterName,
+			SentinelAddrs:    c.Hosts,
+			SentinelPassword: c.SentinelPass,
+			Username:         c.User,
+			Password:         c.Pass,
+			DB:               c.DB,
+			TLSConfig:        tlsConf,
+		}, nil
+	case conf.TaskRedisNode, "":
+		if len(c.Hosts) > 1 {
+			logx.Errorf("NewAsynqRedisOpt node mode only use the first host:%v", c.Hosts[0])
+		}
+		return asynq.RedisClientOpt{
+			Addr:      c.Hosts[0],
+			Username:  c.User,
+			Password:  c.Pass,
+			DB:        c.DB,
+			TLSConfig: tlsConf,
+		}, nil
+	default:
+		return nil, errors.Parameter.AddMsgf("不支持的redis类型:%v", c.Type)
+	}
+}
+
+// TaskOptions 任务的默认选项:最大重试次数及超时时间
+func TaskOptions(c conf.TaskQueueConf) []asynq.Option {
+	c = fillTaskQueueConf(c)
+	opts := []asynq.Option{asynq.MaxRetry(c.MaxRetry)}
+	if c.TaskTimeout > 0 {
+		opts = append(opts, asynq.Timeout(time.Duration(c.TaskTimeout)*time.Second))
+	}
+	return opts
+}
+
 func NewAsynqInspector(c cache.ClusterConf) *asynq.Inspector {
-	return asynq.NewInspector(asynq.RedisClientOpt{Addr: c[0].Host, Password: c[0].Pass})
+	ret, err := NewAsynqInspectorWithConf(NewTaskQueueConf(c))
+	logx.Must(err)
+	return ret
+}
+
+func NewAsynqInspectorWithConf(c conf.TaskQueueConf) (*asynq.Inspector, error) {
+	opt, err := NewAsynqRedisOpt(c.Redis)
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewInspector(opt), nil
 }
 
 func NewAsynqClient(c cache.ClusterConf) *asynq.Client {
-	return asynq.NewClient(asynq.RedisClientOpt{Addr: c[0].Host, Password: c[0].Pass})
+	ret, err := NewAsynqClientWithConf(NewTaskQueueConf(c))
+	logx.Must(err)
+	return ret
+}
+
+func NewAsynqClientWithConf(c conf.TaskQueueConf) (*asynq.Client, error) {
+	opt, err := NewAsynqRedisOpt(c.Redis)
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewClient(opt), nil
 }
 
 func NewAsynqServer(c cache.ClusterConf) *asynq.Server {
-	return asynq.NewServer(
-		asynq.RedisClientOpt{Addr: c[0].Host, Password: c[0].Pass},
-		asynq.Config{
-			IsFailure: func(err error) bool {
-				fmt.Printf("asynq server exec task IsFailure ======== >>>>>>>>>>>  err : %+v \n", err)
-				return true
-			},
-			Concurrency: 20, //max concurrent process job task num
-			Queues: map[string]int{
-				"critical": 3,
-				"default":  2,
-				"low":      1,
-			},
-			StrictPriority: true,
-		},
-	)
+	ret, err := NewAsynqServerWithConf(NewTaskQueueConf(c))
+	logx.Must(err)
+	return ret
+}
+
+func NewAsynqServerWithConf(c conf.TaskQueueConf) (*asynq.Server, error) {
+	c = fillTaskQueueConf(c)
+	opt, err := NewAsynqRedisOpt(c.Redis)
+	if err != nil {
+		return nil, err
+	}
+	return asynq.NewServer(opt, asynq.Config{
+		Concurrency:     c.Concurrency, //max concurrent process job task num
+		Queues:          c.Queues,
+		StrictPriority:  c.StrictPriority,
+		RetryDelayFunc:  newRetryDelayFunc(c),
+		IsFailure:       isTaskFailure,
+		ErrorHandler:    asynq.ErrorHandlerFunc(handleTaskError),
+		Logger:          asynqLogger{},
+		ShutdownTimeout: time.Duration(c.ShutdownTimeout) * time.Second,
+	}), nil
+}
+
+// 按指数退避计算重试间隔,加上最多10%的抖动,避免同时重试
+func newRetryDelayFunc(c conf.TaskQueueConf) asynq.RetryDelayFunc {
+	base := time.Duration(c.RetryBaseDelay) * time.Second
+	max := time.Duration(c.RetryMaxDelay) * time.Second
+	return func(n int, e error, t *asynq.Task) time.Duration {
+		delay := time.Duration(float64(base) * math.Pow(2, float64(n)))
+		if delay <= 0 || delay > max {
+			delay = max
+		}
+		return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+	}
+}
+
+// 任务还在执行中或跳过执行不计入失败,不影响队列的健康检查
+func isTaskFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return !errors.Cmp(err, errors.OnGoing) && !errors.Cmp(err, errors.Jump)
+}
+
+func handleTaskError(ctx context.Context, task *asynq.Task, err error) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	logx.WithContext(ctx).Errorf("asynq task exec failure type:%v retry:%d/%d payload:%s err:%v",
+		task.Type(), retried, maxRetry, task.Payload(), err)
+}
+
+// AsynqService 实现了go-zero的service.Service,可以加入ServiceGroup中优雅退出
+type AsynqService struct {
+	Server *asynq.Server
+	Mux    *asynq.ServeMux
+}
+
+func NewAsynqService(c conf.TaskQueueConf) (*AsynqService, error) {
+	server, err := NewAsynqServerWithConf(c)
+	if err != nil {
+		return nil, err
+	}
+	return &AsynqService{Server: server, Mux: asynq.NewServeMux()}, nil
+}
+
+func (s *AsynqService) Start() {
+	if err := s.Server.Run(s.Mux); err != nil {
+		logx.Errorf("AsynqService run err:%v", err)
+	}
+}
+
+// Stop 停止拉取新任务并等待正在执行的任务完成,超过ShutdownTimeout的任务会重新入队
+func (s *AsynqService) Stop() {
+	s.Server.Shutdown()
+}
+
+type asynqLogger struct{}
+
+func (asynqLogger) Debug(args ...any) {
+	logx.Debug(args...)
+}
+
+func (asynqLogger) Info(args ...any) {
+	logx.Info(args...)
+}
+
+func (asynqLogger) Warn(args ...any) {
+	logx.Info(append([]any{"[warn] "}, args...)...)
+}
+
+func (asynqLogger) Error(args ...any) {
+	logx.Error(args...)
+}
+
+func (asynqLogger) Fatal(args ...any) {
+	logx.Must(fmt.Errorf("asynq fatal:%s", fmt.Sprint(args...)))
 }
 
 // create scheduler
 func NewTimedScheduler(c cache.ClusterConf) *TimedScheduler {
-	location, _ := time.LoadLocation("Asia/Shanghai")
-	return &TimedScheduler{Asynq: asynq.NewScheduler(
-		asynq.RedisClientOpt{
-			Addr:     c[0].Host,
-			Password: c[0].Pass,
-		}, &asynq.SchedulerOpts{
-			Location: location,
-			PostEnqueueFunc: func(task *asynq.TaskInfo, err error) {
-				if err == nil {
-					return
-				}
-				fmt.Printf("Scheduler PostEnqueueFunc  err : %+v , task : %+v", err, task)
-			},
-		})}
+	ret, err := NewTimedSchedulerWithConf(NewTaskQueueConf(c))
+	logx.Must(err)
+	return ret
+}
+
+func NewTimedSchedulerWithConf(c conf.TaskQueueConf) (*TimedScheduler, error) {
+	c = fillTaskQueueConf(c)
+	opt, err := NewAsynqRedisOpt(c.Redis)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, errors.Parameter.AddMsgf("任务队列时区配置错误:%v", c.TimeZone).AddDetail(err)
+	}
+	return &TimedScheduler{Asynq: asynq.NewScheduler(opt, &asynq.SchedulerOpts{
+		Location: location,
+		Logger:   asynqLogger{},
+		PostEnqueueFunc: func(task *asynq.TaskInfo, err error) {
+			if err == nil {
+				return
+			}
+			logx.Errorf("Scheduler PostEnqueueFunc err:%v task:%+v", err, task)
+		},
+	})}, nil
 }
 
 type TimedScheduler struct {
@@ -60,10 +295,9 @@ type TimedScheduler struct {
 }
 
 func (s *TimedScheduler) Register(cronspec string, taskCode string, payload []byte, opts ...asynq.Option) (err error) {
-	t, ok := s.r.Load(taskCode)
-	//	t, ok := s.run[taskCode]
+	_, ok := s.r.Load(taskCode)
 	if ok { //如果正在运行,需要先删除再注册
-		err = s.Unregister(t.(string))
+		err = s.Unregister(taskCode)
 		if err != nil {
 			return err
 		}
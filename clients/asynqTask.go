@@ -0,0 +1,220 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/events"
+	"gitee.com/unitedrhino/share/utils"
+	"github.com/hibiken/asynq"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/metric"
+	"github.com/zeromicro/go-zero/core/timex"
+	"sync"
+)
+
+const taskNamespace = "asynq"
+
+var (
+	metricTaskDur = metric.NewHistogramVec(&metric.HistogramVecOpts{
+		Namespace: taskNamespace,
+		Subsystem: "task",
+		Name:      "duration_ms",
+		Help:      "asynq task process duration(ms).",
+		Labels:    []string{"type"},
+		Buckets:   []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000},
+	})
+	metricTaskTotal = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: taskNamespace,
+		Subsystem: "task",
+		Name:      "total",
+		Help:      "asynq task process count.",
+		Labels:    []string{"type", "result"},
+	})
+)
+
+type TaskMiddleware = asynq.MiddlewareFunc
+
+// TaskQueue 任务队列,投递的任务会带上用户上下文及链路信息,执行时还原到ctx中
+type TaskQueue struct {
+	Conf    conf.TaskQueueConf
+	Client  *asynq.Client
+	Service *AsynqService
+	opts    []asynq.Option
+}
+
+var (
+	taskQueue     *TaskQueue
+	taskQueueOnce sync.Once
+
+	errTaskQueueNotInit = errors.System.AddDetail("task queue is not initialized, call InitTaskQueue first")
+)
+
+func NewTaskQueue(c conf.TaskQueueConf) (*TaskQueue, error) {
+	c = fillTaskQueueConf(c)
+	client, err := NewAsynqClientWithConf(c)
+	if err != nil {
+		return nil, err
+	}
+	service, err := NewAsynqService(c)
+	if err != nil {
+		return nil, err
+	}
+	q := TaskQueue{
+		Conf:    c,
+		Client:  client,
+		Service: service,
+		opts:    TaskOptions(c),
+	}
+	//panic恢复放在最里层,panic转换成的错误才会被记录日志及监控
+	q.Use(TaskLogMiddleware, TaskMetricMiddleware, TaskRecoverMiddleware)
+	return &q, nil
+}
+
+// InitTaskQueue 初始化默认的任务队列,RegisterHandler和Enqueue使用该队列
+func InitTaskQueue(c conf.TaskQueueConf) (q *TaskQueue, err error) {
+	taskQueueOnce.Do(func() {
+		taskQueue, err = NewTaskQueue(c)
+	})
+	return taskQueue, err
+}
+
+func GetTaskQueue() *TaskQueue {
+	return taskQueue
+}
+
+// Use 添加任务执行的中间件,默认已经添加了panic恢复,日志及监控
+func (q *TaskQueue) Use(mws ...TaskMiddleware) {
+	q.Service.Mux.Use(mws...)
+}
+
+// Start 开始执行任务,需要先注册好处理函数
+func (q *TaskQueue) Start() {
+	q.Service.Start()
+}
+
+func (q *TaskQueue) Stop() {
+	q.Service.Stop()
+	if err := q.Client.Close(); err != nil {
+		logx.Errorf("TaskQueue close client err:%v", err)
+	}
+}
+
+// RegisterHandler 在默认任务队列上注册处理函数,payload使用json反序列化,需要先调用InitTaskQueue
+func RegisterHandler[T any](code string, f func(ctx context.Context, payload T) error) error {
+	return RegisterQueueHandler(taskQueue, code, f)
+}
+
+func RegisterQueueHandler[T any](q *TaskQueue, code string, f func(ctx context.Context, payload T) error) error {
+	if q == nil {
+		return errTaskQueueNotInit
+	}
+	q.Service.Mux.HandleFunc(code, func(ctx context.Context, task *asynq.Task) error {
+		ctx, data := unpackTask(ctx, task.Payload())
+		var payload T
+		if err := json.Unmarshal(data, &payload); err != nil {
+			//格式不对重试也没有用
+			return fmt.Errorf("%v: %w", errors.Parameter.AddMsgf("任务%s的参数格式错误", code).AddDetail(err), asynq.SkipRetry)
+		}
+		return f(ctx, payload)
+	})
+	return nil
+}
+
+// Enqueue 往默认任务队列投递任务,需要先调用InitTaskQueue,opts可以使用 asynq.Unique asynq.ProcessIn asynq.ProcessAt asynq.Deadline asynq.Queue 等
+func Enqueue[T any](ctx context.Context, code string, payload T, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	return EnqueueQueue(ctx, taskQueue, code, payload, opts...)
+}
+
+func EnqueueQueue[T any](ctx context.Context, q *TaskQueue, code string, payload T, opts ...asynq.Option) (*asynq.TaskInfo, error) {
+	if q == nil {
+		return nil, errTaskQueueNotInit
+	}
+	data, err := packTask(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	//后面的选项会覆盖前面的,默认选项放在前面
+	task := asynq.NewTask(code, data, append(append([]asynq.Option{}, q.opts...), opts...)...)
+	info, err := q.Client.EnqueueContext(ctx, task)
+	if err != nil {
+		if errors.Is(err, asynq.ErrDuplicateTask) || errors.Is(err, asynq.ErrTaskIDConflict) {
+			return nil, errors.Duplicate.AddMsgf("任务%s已经存在", code).AddDetail(err)
+		}
+		return nil, errors.System.AddMsgf("任务%s投递失败", code).AddDetail(err)
+	}
+	return info, nil
+}
+
+// RegisterTimedTask 注册定时任务,payload的格式与Enqueue相同,可以用RegisterHandler注册的函数处理
+func RegisterTimedTask[T any](s *TimedScheduler, cronspec string, code string, payload T, opts ...asynq.Option) error {
+	data, err := packTask(context.Background(), payload)
+	if err != nil {
+		return err
+	}
+	return s.Register(cronspec, code, data, opts...)
+}
+
+func packTask[T any](ctx context.Context, payload T) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Parameter.AddDetail(err)
+	}
+	return events.NewEventMsg(ctx, data), nil
+}
+
+// 兼容没有经过packTask封装的原始payload
+func unpackTask(ctx context.Context, payload []byte) (context.Context, []byte) {
+	var msg events.MsgHead
+	if err := json.Unmarshal(payload, &msg); err != nil || msg.Timestamp == 0 {
+		return ctx, payload
+	}
+	return msg.WithCtx(ctx), msg.GetData()
+}
+
+// TaskRecoverMiddleware 任务panic时记录日志并返回错误,由asynq按重试策略处理
+func TaskRecoverMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				utils.HandleThrow(ctx, p, "task:"+task.Type())
+				err = errors.Panic.AddDetail(p)
+			}
+		}()
+		return next.ProcessTask(ctx, task)
+	})
+}
+
+func TaskLogMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+		startTime := timex.Now()
+		taskID, _ := asynq.GetTaskID(ctx)
+		retried, _ := asynq.GetRetryCount(ctx)
+		err := next.ProcessTask(ctx, task)
+		useTime := timex.Since(startTime)
+		if err != nil {
+			logx.WithContext(ctx).Errorf("[TASK %s] id:%s retry:%d use:%v payload:[%s] err:%v",
+				task.Type(), taskID, retried, useTime, task.Payload(), err)
+		} else {
+			logx.WithContext(ctx).Infof("[TASK %s] id:%s retry:%d use:%v",
+				task.Type(), taskID, retried, useTime)
+		}
+		return err
+	})
+}
+
+func TaskMetricMiddleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+		startTime := timex.Now()
+		err := next.ProcessTask(ctx, task)
+		metricTaskDur.Observe(timex.Since(startTime).Milliseconds(), task.Type())
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		metricTaskTotal.Inc(task.Type(), result)
+		return err
+	})
+}
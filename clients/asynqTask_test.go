@@ -0,0 +1,181 @@
+package clients
+
+import (
+	"context"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeromicro/go-zero/core/logx/logtest"
+	"testing"
+	"time"
+)
+
+func TestPackTask(t *testing.T) {
+	type payload struct {
+		DeviceName string
+		Count      int64
+	}
+	ctx := ctxs.SetUserCtx(context.Background(), &ctxs.UserCtx{TenantCode: "default", UserID: 123, InnerCtx: ctxs.InnerCtx{AllArea: true}})
+	data, err := packTask(ctx, payload{DeviceName: "dev1", Count: 2})
+	assert.NoError(t, err)
+
+	ctx2, body := unpackTask(context.Background(), data)
+	assert.JSONEq(t, `{"DeviceName":"dev1","Count":2}`, string(body))
+	uc := ctxs.GetUserCtx(ctx2)
+	if assert.NotNil(t, uc) {
+		assert.Equal(t, int64(123), uc.UserID)
+		assert.Equal(t, "default", uc.TenantCode)
+		assert.False(t, uc.AllArea) //内部权限不能通过任务传递
+	}
+
+	//兼容旧的原始payload
+	_, body = unpackTask(context.Background(), []byte(`{"DeviceName":"dev2"}`))
+	assert.Equal(t, `{"DeviceName":"dev2"}`, string(body))
+}
+
+type testTaskPayload struct {
+	DeviceName string
+	Count      int64
+}
+
+func newTestTaskQueue(t *testing.T) (*TaskQueue, *asynq.Inspector) {
+	mr := miniredis.RunT(t)
+	q, err := NewTaskQueue(conf.TaskQueueConf{
+		Redis:       conf.TaskRedisConf{Hosts: []string{mr.Addr()}},
+		MaxRetry:    5,
+		TaskTimeout: 30,
+	})
+	require.NoError(t, err)
+	inspector, err := NewAsynqInspectorWithConf(q.Conf)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		inspector.Close()
+		q.Client.Close()
+	})
+	return q, inspector
+}
+
+// 从redis中取出投递的任务交给mux执行,和asynq服务端执行的流程一致
+func processTestTask(t *testing.T, q *TaskQueue, inspector *asynq.Inspector, info *asynq.TaskInfo) error {
+	stored, err := inspector.GetTaskInfo(info.Queue, info.ID)
+	require.NoError(t, err)
+	return q.Service.Mux.ProcessTask(context.Background(), asynq.NewTask(stored.Type, stored.Payload))
+}
+
+func TestEnqueueQueue(t *testing.T) {
+	q, inspector := newTestTaskQueue(t)
+	ctx := ctxs.SetUserCtx(context.Background(), &ctxs.UserCtx{TenantCode: "default", UserID: 123})
+
+	info, err := EnqueueQueue(ctx, q, "test:default", testTaskPayload{DeviceName: "dev1"})
+	require.NoError(t, err)
+	stored, err := inspector.GetTaskInfo(info.Queue, info.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "test:default", stored.Type)
+	assert.Equal(t, 5, stored.MaxRetry)
+	assert.Equal(t, 30*time.Second, stored.Timeout)
+	_, body := unpackTask(context.Background(), stored.Payload)
+	assert.JSONEq(t, `{"DeviceName":"dev1","Count":0}`, string(body))
+
+	//调用时的选项覆盖默认选项
+	info, err = EnqueueQueue(ctx, q, "test:opts", testTaskPayload{}, asynq.MaxRetry(1), asynq.Queue("low"),
+		asynq.TaskID("t1"), asynq.ProcessIn(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "low", info.Queue)
+	assert.Equal(t, 1, info.MaxRetry)
+	assert.Equal(t, asynq.TaskStateScheduled, info.State)
+
+	_, err = EnqueueQueue(ctx, q, "test:opts", testTaskPayload{}, asynq.Queue("low"), asynq.TaskID("t1"))
+	assert.True(t, errors.Cmp(err, errors.Duplicate))
+	_, err = EnqueueQueue(ctx, q, "test:bad", func() {})
+	assert.True(t, errors.Cmp(err, errors.Parameter), "无法序列化的payload")
+}
+
+func TestRegisterQueueHandler(t *testing.T) {
+	q, inspector := newTestTaskQueue(t)
+	var (
+		got testTaskPayload
+		uc  *ctxs.UserCtx
+	)
+	require.NoError(t, RegisterQueueHandler(q, "test:typed", func(ctx context.Context, payload testTaskPayload) error {
+		got, uc = payload, ctxs.GetUserCtx(ctx)
+		return nil
+	}))
+	ctx := ctxs.SetUserCtx(context.Background(), &ctxs.UserCtx{TenantCode: "default", UserID: 123})
+	info, err := EnqueueQueue(ctx, q, "test:typed", testTaskPayload{DeviceName: "dev1", Count: 2})
+	require.NoError(t, err)
+	require.NoError(t, processTestTask(t, q, inspector, info))
+	assert.Equal(t, testTaskPayload{DeviceName: "dev1", Count: 2}, got)
+	if assert.NotNil(t, uc) {
+		assert.Equal(t, int64(123), uc.UserID)
+	}
+
+	//没有经过packTask封装的原始payload
+	require.NoError(t, q.Service.Mux.ProcessTask(context.Background(), asynq.NewTask("test:typed", []byte(`{"DeviceName":"dev2"}`))))
+	assert.Equal(t, "dev2", got.DeviceName)
+
+	//格式错误的payload不再重试
+	err = q.Service.Mux.ProcessTask(context.Background(), asynq.NewTask("test:typed", []byte(`{"Count":"x"}`)))
+	assert.ErrorIs(t, err, asynq.SkipRetry)
+}
+
+func TestTaskMiddleware(t *testing.T) {
+	q, inspector := newTestTaskQueue(t)
+	var calls []string
+	q.Use(func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+			calls = append(calls, "mw:"+task.Type())
+			return next.ProcessTask(ctx, task)
+		})
+	})
+	require.NoError(t, RegisterQueueHandler(q, "test:ok", func(ctx context.Context, payload testTaskPayload) error {
+		calls = append(calls, "handler")
+		return nil
+	}))
+	RegisterQueueHandler(q, "test:panic", func(ctx context.Context, payload testTaskPayload) error {
+		panic("boom")
+	})
+
+	info, err := EnqueueQueue(context.Background(), q, "test:ok", testTaskPayload{})
+	require.NoError(t, err)
+	require.NoError(t, processTestTask(t, q, inspector, info))
+	assert.Equal(t, []string{"mw:test:ok", "handler"}, calls)
+
+	//panic被恢复成错误,由asynq按重试策略处理,同时记录日志
+	logs := logtest.NewCollector(t)
+	info, err = EnqueueQueue(context.Background(), q, "test:panic", testTaskPayload{})
+	require.NoError(t, err)
+	err = processTestTask(t, q, inspector, info)
+	assert.True(t, errors.Cmp(err, errors.Panic))
+	assert.Contains(t, logs.String(), "[TASK test:panic]")
+	assert.Equal(t, []string{"mw:test:ok", "handler", "mw:test:panic"}, calls)
+}
+
+func TestDefaultTaskQueue(t *testing.T) {
+	q, inspector := newTestTaskQueue(t)
+	old := taskQueue
+	taskQueue = q
+	t.Cleanup(func() { taskQueue = old })
+	var got testTaskPayload
+	require.NoError(t, RegisterHandler("test:default", func(ctx context.Context, payload testTaskPayload) error {
+		got = payload
+		return nil
+	}))
+	info, err := Enqueue(context.Background(), "test:default", testTaskPayload{DeviceName: "dev1"})
+	require.NoError(t, err)
+	require.NoError(t, processTestTask(t, q, inspector, info))
+	assert.Equal(t, "dev1", got.DeviceName)
+}
+
+func TestTaskQueueNotInit(t *testing.T) {
+	old := taskQueue
+	taskQueue = nil
+	t.Cleanup(func() { taskQueue = old })
+	err := RegisterHandler("test:nil", func(ctx context.Context, payload testTaskPayload) error { return nil })
+	assert.True(t, errors.Cmp(err, errors.System))
+	_, err = Enqueue(context.Background(), "test:nil", testTaskPayload{})
+	assert.True(t, errors.Cmp(err, errors.System))
+}
@@ -0,0 +1,103 @@
+package clients
+
+import (
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"testing"
+	"time"
+)
+
+func TestNewTaskQueueConf(t *testing.T) {
+	c := NewTaskQueueConf(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: "127.0.0.1:6379", Type: redis.NodeType, Pass: "p"}}})
+	assert.Equal(t, conf.TaskRedisConf{Type: conf.TaskRedisNode, Hosts: []string{"127.0.0.1:6379"}, Pass: "p"}, c.Redis)
+	//没有通过conf.Load加载的配置补上默认值
+	assert.Equal(t, 20, c.Concurrency)
+	assert.Equal(t, map[string]int{"critical": 6, "default": 3, "low": 1}, c.Queues)
+	assert.True(t, c.StrictPriority)
+	assert.Equal(t, 25, c.MaxRetry)
+	assert.Equal(t, "Asia/Shanghai", c.TimeZone)
+
+	//cluster类型使用所有节点的地址
+	c = NewTaskQueueConf(cache.ClusterConf{
+		{RedisConf: redis.RedisConf{Host: "10.0.0.1:6379, 10.0.0.2:6379", Type: redis.ClusterType}},
+		{RedisConf: redis.RedisConf{Host: "10.0.0.3:6379", Type: redis.ClusterType}},
+	})
+	assert.Equal(t, conf.TaskRedisCluster, c.Redis.Type)
+	assert.Equal(t, []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"}, c.Redis.Hosts)
+
+	//配置了的值不会被覆盖
+	c = fillTaskQueueConf(conf.TaskQueueConf{Concurrency: 3, Queues: map[string]int{"q": 1}, MaxRetry: 2})
+	assert.Equal(t, 3, c.Concurrency)
+	assert.Equal(t, map[string]int{"q": 1}, c.Queues)
+	assert.False(t, c.StrictPriority)
+	assert.Equal(t, 2, c.MaxRetry)
+}
+
+func TestNewAsynqRedisOpt(t *testing.T) {
+	opt, err := NewAsynqRedisOpt(conf.TaskRedisConf{Type: conf.TaskRedisNode, Hosts: []string{"h1:6379", "h2:6379"}, User: "u", Pass: "p", DB: 2})
+	require.NoError(t, err)
+	assert.Equal(t, asynq.RedisClientOpt{Addr: "h1:6379", Username: "u", Password: "p", DB: 2}, opt)
+
+	opt, err = NewAsynqRedisOpt(conf.TaskRedisConf{Type: conf.TaskRedisCluster, Hosts: []string{"h1:6379", "h2:6379"}, Pass: "p", Tls: true})
+	require.NoError(t, err)
+	cluster, ok := opt.(asynq.RedisClusterClientOpt)
+	require.True(t, ok)
+	assert.Equal(t, []string{"h1:6379", "h2:6379"}, cluster.Addrs)
+	assert.Equal(t, "p", cluster.Password)
+	assert.NotNil(t, cluster.TLSConfig)
+
+	opt, err = NewAsynqRedisOpt(conf.TaskRedisConf{Type: conf.TaskRedisSentinel, Hosts: []string{"s1:26379"}, MasterName: "m", SentinelPass: "sp", Pass: "p", DB: 1})
+	require.NoError(t, err)
+	assert.Equal(t, asynq.RedisFailoverClientOpt{MasterName: "m", SentinelAddrs: []string{"s1:26379"}, SentinelPassword: "sp", Password: "p", DB: 1}, opt)
+
+	_, err = NewAsynqRedisOpt(conf.TaskRedisConf{Type: conf.TaskRedisSentinel, Hosts: []string{"s1:26379"}})
+	assert.True(t, errors.Cmp(err, errors.Parameter), "哨兵模式缺少MasterName")
+	_, err = NewAsynqRedisOpt(conf.TaskRedisConf{Type: conf.TaskRedisNode})
+	assert.True(t, errors.Cmp(err, errors.Parameter), "没有配置地址")
+	_, err = NewAsynqRedisOpt(conf.TaskRedisConf{Type: "unknown", Hosts: []string{"h1:6379"}})
+	assert.True(t, errors.Cmp(err, errors.Parameter))
+}
+
+func TestTaskOptions(t *testing.T) {
+	opts := TaskOptions(conf.TaskQueueConf{})
+	require.Len(t, opts, 1)
+	assert.Equal(t, asynq.MaxRetryOpt, opts[0].Type())
+	assert.Equal(t, 25, opts[0].Value())
+
+	opts = TaskOptions(conf.TaskQueueConf{MaxRetry: 3, TaskTimeout: 60})
+	require.Len(t, opts, 2)
+	assert.Equal(t, 3, opts[0].Value())
+	assert.Equal(t, asynq.TimeoutOpt, opts[1].Type())
+	assert.Equal(t, time.Minute, opts[1].Value())
+
+	_, err := NewTimedSchedulerWithConf(conf.TaskQueueConf{Redis: conf.TaskRedisConf{Hosts: []string{"h1:6379"}}, TimeZone: "Not/Exist"})
+	assert.True(t, errors.Cmp(err, errors.Parameter), "时区配置错误")
+}
+
+func TestRetryDelay(t *testing.T) {
+	delay := newRetryDelayFunc(fillTaskQueueConf(conf.TaskQueueConf{RetryBaseDelay: 2, RetryMaxDelay: 60}))
+	task := asynq.NewTask("test", nil)
+	for n, want := range map[int]time.Duration{0: 2 * time.Second, 1: 4 * time.Second, 3: 16 * time.Second, 5: time.Minute, 100: time.Minute} {
+		for i := 0; i < 20; i++ {
+			got := delay(n, nil, task)
+			assert.GreaterOrEqual(t, got, want, "retry %d", n)
+			assert.LessOrEqual(t, got, want+want/10, "retry %d 抖动不超过10%%", n)
+		}
+	}
+	//次数很大时溢出也使用最大间隔
+	got := delay(2000, nil, task)
+	assert.GreaterOrEqual(t, got, time.Minute)
+	assert.LessOrEqual(t, got, time.Minute+6*time.Second)
+}
+
+func TestIsTaskFailure(t *testing.T) {
+	assert.False(t, isTaskFailure(nil))
+	assert.True(t, isTaskFailure(errors.System))
+	assert.False(t, isTaskFailure(errors.OnGoing))
+	assert.False(t, isTaskFailure(errors.Jump.AddDetail("skip")))
+}
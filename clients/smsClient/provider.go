@@ -0,0 +1,64 @@
+package smsClient
+
+import (
+	"context"
+	"sync"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// ProviderReq 发给服务商的请求,模板已经转换为服务商的模板ID
+type ProviderReq struct {
+	PhoneNumbers  []string
+	SignName      string
+	TemplateID    string
+	TemplateParam map[string]any
+}
+
+type SendResult struct {
+	Provider string   `json:"provider"`
+	BizID    string   `json:"bizID"`            //服务商返回的发送流水号,回执中会带上
+	Phones   []string `json:"phones"`           //该服务商发送成功的手机号
+	Failed   []string `json:"failed,omitempty"` //部分号码发送失败时由服务商填写,会切换到下一个服务商只发送这些号码
+}
+
+// Provider 短信服务商,全部号码都发送失败时返回错误,部分失败时在SendResult.Failed中返回失败的号码
+type Provider interface {
+	Name() string
+	Send(ctx context.Context, req *ProviderReq) (*SendResult, error)
+}
+
+// ReportParser 服务商支持回执推送时实现,将回执推送的内容转换为Report
+type ReportParser interface {
+	ParseReport(body []byte) ([]*Report, error)
+}
+
+type ProviderFactory func(c conf.Sms) (Provider, error)
+
+var (
+	providerMutex sync.RWMutex
+	providers     = map[string]ProviderFactory{
+		conf.SmsAli:     newAliProvider,
+		conf.SmsTencent: newTencentProvider,
+		conf.SmsHttp:    newHttpProvider,
+		conf.SmsFake:    newFakeProvider,
+	}
+)
+
+// RegisterProvider 注册短信服务商,同名的会被覆盖
+func RegisterProvider(name string, f ProviderFactory) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	providers[name] = f
+}
+
+func newProvider(c conf.Sms, name string) (Provider, error) {
+	providerMutex.RLock()
+	f, ok := providers[name]
+	providerMutex.RUnlock()
+	if !ok {
+		return nil, errors.System.AddMsg("不支持的短信配置类型").AddDetail(name)
+	}
+	return f(c)
+}
@@ -0,0 +1,79 @@
+package smsClient
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+type ReportStatus = string
+
+const (
+	ReportStatusSuccess ReportStatus = "success" //用户已接收
+	ReportStatusFail    ReportStatus = "fail"    //发送失败
+)
+
+// Report 短信回执
+type Report struct {
+	Provider   string       `json:"provider"`
+	BizID      string       `json:"bizID"`
+	Phone      string       `json:"phone"`
+	Status     ReportStatus `json:"status"`
+	ErrCode    string       `json:"errCode,omitempty"`
+	ErrMsg     string       `json:"errMsg,omitempty"`
+	ReportTime time.Time    `json:"reportTime"`
+}
+
+type ReportHandler func(ctx context.Context, r *Report)
+
+// OnReport 注册回执处理函数,HandleReport收到回执后依次调用
+func (s *Sms) OnReport(h ReportHandler) {
+	s.reportMutex.Lock()
+	defer s.reportMutex.Unlock()
+	s.reportHandlers = append(s.reportHandlers, h)
+}
+
+// HandleReport 处理服务商推送的回执,body为推送的原始内容,在回执回调接口中调用
+func (s *Sms) HandleReport(ctx context.Context, provider string, body []byte) ([]*Report, error) {
+	p := s.Provider(provider)
+	if p == nil {
+		return nil, errors.NotFind.AddDetailf("sms provider %s not configured", provider)
+	}
+	parser, ok := p.(ReportParser)
+	if !ok {
+		return nil, errors.NotRealize.AddDetailf("sms provider %s not support report", provider)
+	}
+	reports, err := parser.ParseReport(body)
+	if err != nil {
+		logx.WithContext(ctx).Errorf("sms HandleReport provider:%v body:%v err:%v", provider, string(body), err)
+		return nil, errors.Parameter.AddDetail(err)
+	}
+	s.reportMutex.RLock()
+	handlers := s.reportHandlers
+	s.reportMutex.RUnlock()
+	for _, r := range reports {
+		r.Provider = provider
+		for _, h := range handlers {
+			h(ctx, r)
+		}
+	}
+	return reports, nil
+}
+
+// 通用的回执格式,http网关及fake使用
+func parseReport(body []byte) ([]*Report, error) {
+	var reports []*Report
+	err := json.Unmarshal(body, &reports)
+	return reports, err
+}
+
+func parseReportTime(t string) time.Time {
+	ret, err := time.ParseInLocation(time.DateTime, t, time.Local)
+	if err != nil {
+		return time.Now()
+	}
+	return ret
+}
@@ -1,12 +1,86 @@
 package smsClient
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
+
 	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
 	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
 	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
 	"github.com/alibabacloud-go/tea/tea"
 )
 
+type AliProvider struct {
+	cli *dysmsapi20170525.Client
+}
+
+func newAliProvider(c conf.Sms) (Provider, error) {
+	cli, err := CreateAliClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &AliProvider{cli: cli}, nil
+}
+
+func (p *AliProvider) Name() string {
+	return conf.SmsAli
+}
+
+func (p *AliProvider) Send(ctx context.Context, req *ProviderReq) (*SendResult, error) {
+	sendSmsRequest := &dysmsapi20170525.SendSmsRequest{
+		PhoneNumbers:  tea.String(strings.Join(req.PhoneNumbers, ",")),
+		SignName:      tea.String(req.SignName),
+		TemplateCode:  tea.String(req.TemplateID),
+		TemplateParam: tea.String(utils.MarshalNoErr(req.TemplateParam)),
+	}
+	resp, err := p.cli.SendSmsWithOptions(sendSmsRequest, &util.RuntimeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body == nil {
+		return nil, errors.System.AddDetail("ali sms empty response")
+	}
+	if code := tea.StringValue(resp.Body.Code); code != "OK" {
+		return nil, errors.System.AddDetailf("ali sms code:%s message:%s", code, tea.StringValue(resp.Body.Message))
+	}
+	return &SendResult{BizID: tea.StringValue(resp.Body.BizId)}, nil
+}
+
+// 阿里云短信回执消息推送的格式
+type aliReport struct {
+	PhoneNumber string `json:"phone_number"`
+	ReportTime  string `json:"report_time"`
+	Success     bool   `json:"success"`
+	ErrCode     string `json:"err_code"`
+	ErrMsg      string `json:"err_msg"`
+	BizID       string `json:"biz_id"`
+}
+
+func (p *AliProvider) ParseReport(body []byte) ([]*Report, error) {
+	var reports []aliReport
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return nil, err
+	}
+	var ret []*Report
+	for _, r := range reports {
+		report := Report{
+			BizID:      r.BizID,
+			Phone:      r.PhoneNumber,
+			Status:     ReportStatusSuccess,
+			ReportTime: parseReportTime(r.ReportTime),
+		}
+		if !r.Success {
+			report.Status, report.ErrCode, report.ErrMsg = ReportStatusFail, r.ErrCode, r.ErrMsg
+		}
+		ret = append(ret, &report)
+	}
+	return ret, nil
+}
+
 /**
  * 使用AK&SK初始化账号Client
  * @param accessKeyId
@@ -0,0 +1,81 @@
+package smsClient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/samber/lo"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// FakeProvider 只在本地记录短信,不实际发送,用于开发及测试
+type FakeProvider struct {
+	mutex    sync.Mutex
+	messages []*FakeMessage
+	err      error
+	failed   []string
+}
+
+type FakeMessage struct {
+	ProviderReq
+	BizID    string
+	SendTime time.Time
+}
+
+func newFakeProvider(c conf.Sms) (Provider, error) {
+	return &FakeProvider{}, nil
+}
+
+func (p *FakeProvider) Name() string {
+	return conf.SmsFake
+}
+
+func (p *FakeProvider) Send(ctx context.Context, req *ProviderReq) (*SendResult, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	var failed []string
+	if len(p.failed) > 0 {
+		failed = lo.Intersect(req.PhoneNumbers, p.failed)
+	}
+	if len(failed) > 0 && len(failed) == len(req.PhoneNumbers) {
+		return nil, errors.System.AddDetailf("fake sms failed phones %v", failed)
+	}
+	msg := FakeMessage{ProviderReq: *req, BizID: fmt.Sprintf("fake-%d", len(p.messages)+1), SendTime: time.Now()}
+	msg.PhoneNumbers = lo.Without(req.PhoneNumbers, failed...)
+	p.messages = append(p.messages, &msg)
+	logx.WithContext(ctx).Infof("fake sms bizID:%v phones:%v template:%v param:%v",
+		msg.BizID, msg.PhoneNumbers, req.TemplateID, req.TemplateParam)
+	return &SendResult{BizID: msg.BizID, Failed: failed}, nil
+}
+
+// SetFailPhones 设置后这些号码都发送失败,用于模拟部分号码失败
+func (p *FakeProvider) SetFailPhones(phones ...string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.failed = phones
+}
+
+// SetErr 设置后发送都返回该错误,用于模拟服务商故障,设置为nil恢复
+func (p *FakeProvider) SetErr(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.err = err
+}
+
+// Messages 返回记录的短信
+func (p *FakeProvider) Messages() []*FakeMessage {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*FakeMessage(nil), p.messages...)
+}
+
+func (p *FakeProvider) ParseReport(body []byte) ([]*Report, error) {
+	return parseReport(body)
+}
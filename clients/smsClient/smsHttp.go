@@ -0,0 +1,87 @@
+package smsClient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// HttpProvider 通过http接口接入的短信网关,smpp网关一般也提供http接口
+// 发送: POST Url {"phoneNumbers":[],"signName":"","templateID":"","templateParam":{}}
+// 网关返回2xx及 {"bizID":"","failed":[]} 表示成功,failed为发送失败的号码,会切换到备用服务商
+// 回执: 网关推送 []Report 格式的json
+type HttpProvider struct {
+	c   conf.SmsHttpConf
+	cli *http.Client
+}
+
+type httpSendReq struct {
+	PhoneNumbers  []string       `json:"phoneNumbers"`
+	SignName      string         `json:"signName"`
+	TemplateID    string         `json:"templateID"`
+	TemplateParam map[string]any `json:"templateParam"`
+}
+
+func newHttpProvider(c conf.Sms) (Provider, error) {
+	if c.Http.Url == "" {
+		return nil, errors.Parameter.AddDetail("sms http gateway url is empty")
+	}
+	timeout := c.Http.Timeout
+	if timeout <= 0 {
+		timeout = 10
+	}
+	return &HttpProvider{c: c.Http, cli: &http.Client{Timeout: time.Duration(timeout) * time.Second}}, nil
+}
+
+func (p *HttpProvider) Name() string {
+	return conf.SmsHttp
+}
+
+func (p *HttpProvider) Send(ctx context.Context, req *ProviderReq) (*SendResult, error) {
+	body, err := json.Marshal(httpSendReq{
+		PhoneNumbers:  req.PhoneNumbers,
+		SignName:      req.SignName,
+		TemplateID:    req.TemplateID,
+		TemplateParam: req.TemplateParam,
+	})
+	if err != nil {
+		return nil, errors.Parameter.AddDetail(err)
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.c.Url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if p.c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+p.c.Token)
+	}
+	resp, err := p.cli.Do(r)
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.System.AddDetailf("sms http gateway status:%d body:%s", resp.StatusCode, string(data))
+	}
+	var ret SendResult
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &ret); err != nil {
+			return nil, errors.System.AddDetailf("sms http gateway body:%s err:%v", string(data), err)
+		}
+	}
+	return &ret, nil
+}
+
+func (p *HttpProvider) ParseReport(body []byte) ([]*Report, error) {
+	return parseReport(body)
+}
@@ -1,13 +1,124 @@
 package smsClient
 
 import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
 	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+	"github.com/samber/lo"
+	"github.com/zeromicro/go-zero/core/logx"
 
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
 	sms "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/sms/v20210111" // 引入sms
 )
 
+type TencentProvider struct {
+	appID string
+	cli   *sms.Client
+}
+
+func newTencentProvider(c conf.Sms) (Provider, error) {
+	cli, err := CreateTencentClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &TencentProvider{appID: c.Tencent.AppID, cli: cli}, nil
+}
+
+func (p *TencentProvider) Name() string {
+	return conf.SmsTencent
+}
+
+func (p *TencentProvider) Send(ctx context.Context, req *ProviderReq) (*SendResult, error) {
+	request := sms.NewSendSmsRequest()
+	/* 短信应用ID: 短信SdkAppId在 [短信控制台] 添加应用后生成的实际SdkAppId，示例如1400006666 */
+	request.SmsSdkAppId = common.StringPtr(p.appID)
+	/* 短信签名内容: 使用 UTF-8 编码，必须填写已审核通过的签名 */
+	request.SignName = common.StringPtr(req.SignName)
+	/* 模板 ID: 必须填写已审核通过的模板 ID */
+	request.TemplateId = common.StringPtr(req.TemplateID)
+	keys := lo.Keys(req.TemplateParam)
+	slices.Sort(keys)
+	var paramSet []string
+	for _, k := range keys {
+		paramSet = append(paramSet, utils.ToString(req.TemplateParam[k]))
+	}
+	/* 模板参数: 模板参数的个数需要与 TemplateId 对应模板的变量个数保持一致，若无模板参数，则设置为空*/
+	request.TemplateParamSet = common.StringPtrs(paramSet)
+	/* 下发手机号码，采用 E.164 标准，+[国家或地区码][手机号]
+	 * 示例如：+8613711112222， 其中前面有一个+号 ，86为国家码，13711112222为手机号，最多不要超过200个手机号*/
+	request.PhoneNumberSet = common.StringPtrs(req.PhoneNumbers)
+	response, err := p.cli.SendSmsWithContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	logx.WithContext(ctx).Infof("tencent sms resp:%s", response.ToJsonString())
+	/* 每个号码单独返回发送状态,错误码参考 https://cloud.tencent.com/document/product/382/9558 */
+	var (
+		serialNos []string
+		failed    []string
+		codes     []string
+	)
+	for _, status := range response.Response.SendStatusSet {
+		if status == nil {
+			continue
+		}
+		if code := lo.FromPtr(status.Code); code != "Ok" {
+			failed = append(failed, lo.FromPtr(status.PhoneNumber))
+			codes = append(codes, lo.FromPtr(status.PhoneNumber)+":"+code)
+			continue
+		}
+		serialNos = append(serialNos, lo.FromPtr(status.SerialNo))
+	}
+	if len(serialNos) == 0 && len(failed) > 0 {
+		return nil, errors.System.AddDetailf("tencent sms failed %s", strings.Join(codes, ","))
+	}
+	if len(failed) > 0 { //部分号码失败,只有失败的号码切换服务商
+		logx.WithContext(ctx).Errorf("tencent sms partial failed %s", strings.Join(codes, ","))
+	}
+	return &SendResult{BizID: strings.Join(serialNos, ","), Failed: failed}, nil
+}
+
+// 腾讯云短信状态回调的格式
+type tencentReport struct {
+	UserReceiveTime string `json:"user_receive_time"`
+	NationCode      string `json:"nationcode"`
+	Mobile          string `json:"mobile"`
+	ReportStatus    string `json:"report_status"`
+	ErrMsg          string `json:"errmsg"`
+	Description     string `json:"description"`
+	Sid             string `json:"sid"`
+}
+
+func (p *TencentProvider) ParseReport(body []byte) ([]*Report, error) {
+	var reports []tencentReport
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return nil, err
+	}
+	var ret []*Report
+	for _, r := range reports {
+		report := Report{
+			BizID:      r.Sid,
+			Phone:      r.Mobile,
+			Status:     ReportStatusSuccess,
+			ReportTime: parseReportTime(r.UserReceiveTime),
+		}
+		if r.NationCode != "" {
+			report.Phone = "+" + r.NationCode + r.Mobile
+		}
+		if r.ReportStatus != "SUCCESS" {
+			report.Status, report.ErrCode, report.ErrMsg = ReportStatusFail, r.ErrMsg, r.Description
+		}
+		ret = append(ret, &report)
+	}
+	return ret, nil
+}
+
 func CreateTencentClient(c conf.Sms) (client *sms.Client, err error) {
 	/* 必要步骤：
 	 * 实例化一个认证对象，入参需要传入腾讯云账户密钥对secretId，secretKey。
@@ -1,12 +1,219 @@
 package smsClient
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
+
+	"gitee.com/unitedrhino/share/caches"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
 )
 
+var mr *miniredis.Miniredis
+
+// caches.InitStore只会初始化一次,整个包共用一个miniredis
+func TestMain(m *testing.M) {
+	mr = miniredis.NewMiniRedis()
+	if err := mr.Start(); err != nil {
+		panic(err)
+	}
+	caches.InitStore(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	code := m.Run()
+	mr.Close()
+	os.Exit(code)
+}
+
 func Test__main(t *testing.T) {
 	//err := _main(tea.StringSlice(os.Args[1:]))
 	//if err != nil {
 	//	panic(err)
 	//}
 }
+
+type badProvider struct{}
+
+func (badProvider) Name() string { return "bad" }
+
+func (badProvider) Send(ctx context.Context, req *ProviderReq) (*SendResult, error) {
+	return nil, errors.System.AddDetail("bad provider")
+}
+
+func TestSmsFailover(t *testing.T) {
+	RegisterProvider("bad", func(c conf.Sms) (Provider, error) { return badProvider{}, nil })
+	ctx := context.Background()
+	c := conf.Sms{Mode: "bad", Backups: []string{conf.SmsFake}, Enable: true, SignName: "联犀",
+		Templates: []conf.SmsTemplate{
+			{Code: "login", Providers: map[string]string{"bad": "B1", conf.SmsFake: "F1"}},
+			{Code: "badOnly", Providers: map[string]string{"bad": "B2"}},
+		}}
+	s, err := NewSms(c)
+	require.NoError(t, err)
+	ret, err := s.Send(ctx, SendSmsParam{PhoneNumbers: []string{"13800000000"}, TemplateCode: "login", TemplateParam: map[string]any{"code": "1234"}})
+	require.NoError(t, err)
+	assert.Equal(t, []*SendResult{{Provider: conf.SmsFake, BizID: "fake-1", Phones: []string{"13800000000"}}}, ret)
+	fake := s.Provider(conf.SmsFake).(*FakeProvider)
+	msgs := fake.Messages()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "F1", msgs[0].TemplateID)
+	assert.Equal(t, "联犀", msgs[0].SignName)
+
+	//未配置模板时直接使用服务商的模板ID
+	require.NoError(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"13800000000"}, SignName: "s", TemplateCode: "SMS_1"}))
+	assert.Equal(t, "SMS_1", fake.Messages()[1].TemplateID)
+
+	_, err = s.Send(ctx, SendSmsParam{PhoneNumbers: []string{"13800000000"}, TemplateCode: "badOnly"})
+	assert.True(t, errors.Cmp(err, errors.System))
+	fake.SetErr(errors.System.AddDetail("down"))
+	assert.Error(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"13800000000"}, TemplateCode: "login"}))
+
+	c.Enable = false
+	s, err = NewSms(c)
+	require.NoError(t, err)
+	assert.True(t, errors.Cmp(s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"1"}}), errors.NotEnable))
+	_, err = NewSms(conf.Sms{Mode: "unknown"})
+	assert.Error(t, err)
+}
+
+type partialProvider struct {
+	*FakeProvider
+}
+
+func (partialProvider) Name() string { return "partial" }
+
+func TestSmsPartialFailover(t *testing.T) {
+	primary := partialProvider{FakeProvider: &FakeProvider{}}
+	primary.SetFailPhones("2", "3")
+	RegisterProvider("partial", func(c conf.Sms) (Provider, error) { return primary, nil })
+	ctx := context.Background()
+	s, err := NewSms(conf.Sms{Mode: "partial", Backups: []string{conf.SmsFake}, Enable: true})
+	require.NoError(t, err)
+	backup := s.Provider(conf.SmsFake).(*FakeProvider)
+	ret, err := s.Send(ctx, SendSmsParam{PhoneNumbers: []string{"1", "2", "3"}, TemplateCode: "T1"})
+	require.NoError(t, err)
+	require.Len(t, ret, 2)
+	assert.Equal(t, []string{"1"}, ret[0].Phones)
+	assert.Equal(t, []string{"2", "3"}, ret[0].Failed)
+	assert.Equal(t, conf.SmsFake, ret[1].Provider)
+	require.Len(t, backup.Messages(), 1)
+	assert.Equal(t, []string{"2", "3"}, backup.Messages()[0].PhoneNumbers, "已经发送成功的号码不能重复发送")
+
+	backup.SetFailPhones("3")
+	ret, err = s.Send(ctx, SendSmsParam{PhoneNumbers: []string{"1", "2", "3"}, TemplateCode: "T1"})
+	assert.True(t, errors.Cmp(err, errors.System), "所有服务商都失败的号码返回错误")
+	require.Len(t, ret, 2)
+	assert.Equal(t, []string{"2"}, ret[1].Phones)
+	assert.Len(t, primary.Messages(), 2)
+}
+
+func TestSmsLimit(t *testing.T) {
+	mr.FlushAll()
+	ctx := context.Background()
+	s, err := NewSms(conf.Sms{Mode: conf.SmsFake, Enable: true,
+		PhoneLimit:    []conf.Limit{{Timeout: 60, TriggerTime: 1, ForbiddenTime: 60}},
+		TemplateLimit: []conf.Limit{{Timeout: 60, TriggerTime: 3, ForbiddenTime: 60}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"1"}, TemplateCode: "t1"}))
+	err = s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"1"}, TemplateCode: "t1"})
+	assert.True(t, errors.Cmp(err, errors.TooManyRequests), "同一手机号限制")
+	require.NoError(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"2"}, TemplateCode: "t1"}))
+	require.NoError(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"3"}, TemplateCode: "t1"}))
+	err = s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"4"}, TemplateCode: "t1"})
+	assert.True(t, errors.Cmp(err, errors.TooManyRequests), "同一模板限制")
+	require.NoError(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"4"}, TemplateCode: "t2"}))
+
+	//发送失败的不计数
+	fake := s.Provider(conf.SmsFake).(*FakeProvider)
+	fake.SetErr(errors.System.AddDetail("down"))
+	assert.True(t, errors.Cmp(s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"5"}, TemplateCode: "t3"}), errors.System))
+	fake.SetErr(nil)
+	require.NoError(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"5"}, TemplateCode: "t3"}))
+
+	//指定服务商发送也需要经过开关及限制
+	err = s.sendBy(ctx, conf.SmsFake, SendSmsParam{PhoneNumbers: []string{"5"}, TemplateCode: "t4"})
+	assert.True(t, errors.Cmp(err, errors.TooManyRequests), "指定服务商发送同一手机号限制")
+	d, err := NewSms(conf.Sms{Mode: conf.SmsFake})
+	require.NoError(t, err)
+	assert.True(t, errors.Cmp(d.sendBy(ctx, conf.SmsFake, SendSmsParam{PhoneNumbers: []string{"6"}}), errors.NotEnable))
+	assert.Empty(t, d.Provider(conf.SmsFake).(*FakeProvider).Messages())
+}
+
+// 并发发送同一个号码时不能绕过限制
+func TestSmsLimitConcurrent(t *testing.T) {
+	mr.FlushAll()
+	ctx := context.Background()
+	s, err := NewSms(conf.Sms{Mode: conf.SmsFake, Enable: true,
+		PhoneLimit: []conf.Limit{{Timeout: 60, TriggerTime: 2, ForbiddenTime: 60}},
+	})
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"1"}, TemplateCode: "t1"})
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, s.Provider(conf.SmsFake).(*FakeProvider).Messages(), 2)
+}
+
+func TestSmsHttp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req httpSendReq
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.TemplateID != "T1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"bizID":"b1"}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	s, err := NewSms(conf.Sms{Mode: conf.SmsHttp, Enable: true, Http: conf.SmsHttpConf{Url: srv.URL, Token: "token"}})
+	require.NoError(t, err)
+	ret, err := s.Send(ctx, SendSmsParam{PhoneNumbers: []string{"1"}, TemplateCode: "T1"})
+	require.NoError(t, err)
+	assert.Equal(t, "b1", ret[0].BizID)
+	assert.Error(t, s.SendSms(ctx, SendSmsParam{PhoneNumbers: []string{"1"}, TemplateCode: "T2"}))
+
+	var got []*Report
+	s.OnReport(func(ctx context.Context, r *Report) { got = append(got, r) })
+	_, err = s.HandleReport(ctx, conf.SmsHttp, []byte(`[{"bizID":"b1","phone":"1","status":"success"}]`))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, conf.SmsHttp, got[0].Provider)
+	assert.Equal(t, ReportStatusSuccess, got[0].Status)
+	_, err = s.HandleReport(ctx, conf.SmsAli, nil)
+	assert.Error(t, err)
+}
+
+func TestParseReport(t *testing.T) {
+	reports, err := (&AliProvider{}).ParseReport([]byte(`[{"phone_number":"138","report_time":"2024-08-30 00:00:00","success":false,"err_code":"DELIVERED","err_msg":"用户接收失败","biz_id":"b1"}]`))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, ReportStatusFail, reports[0].Status)
+	assert.Equal(t, "b1", reports[0].BizID)
+	assert.Equal(t, 2024, reports[0].ReportTime.Year())
+
+	reports, err = (&TencentProvider{}).ParseReport([]byte(`[{"user_receive_time":"2024-10-17 08:03:04","nationcode":"86","mobile":"138","report_status":"SUCCESS","errmsg":"DELIVRD","sid":"s1"}]`))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, ReportStatusSuccess, reports[0].Status)
+	assert.Equal(t, "+86138", reports[0].Phone)
+	assert.Equal(t, "s1", reports[0].BizID)
+}
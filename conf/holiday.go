@@ -0,0 +1,9 @@
+package conf
+
+type HolidayConf struct {
+	Region   string   `json:",default=cn"`                            //地区,对应内置日历文件 tools/holiday/{region}.json
+	TimeZone string   `json:",default=Asia/Shanghai"`                 //判断日期使用的时区
+	Files    []string `json:",optional"`                              //额外导入的日历文件(json或ics),优先级高于内置日历
+	UseHttp  bool     `json:",optional"`                              //是否使用timor.tech在线数据源(内网部署请勿开启)
+	HttpUrl  string   `json:",default=http://timor.tech/api/holiday"` //在线数据源地址
+}
@@ -0,0 +1,16 @@
+package conf
+
+type IpGeoType = string
+
+const (
+	IpGeoXdb  IpGeoType = "xdb"  //ip2region的xdb文件,只支持ipv4
+	IpGeoMmdb IpGeoType = "mmdb" //MaxMind的mmdb文件,支持ipv4和ipv6
+)
+
+// ip归属地查询配置
+type IpGeoConf struct {
+	DbType   IpGeoType `json:",default=xdb,options=xdb|mmdb"`
+	DbFile   string    `json:",optional"`      //离线ip库文件路径,不填则只识别内网ip
+	Language string    `json:",default=zh-CN"` //mmdb返回的地名语言
+	UseHttp  bool      `json:",optional"`      //离线库查不到时是否调用在线接口(会把用户ip发给第三方,内网部署请勿开启)
+}
@@ -0,0 +1,23 @@
+package conf
+
+type JwtAlg = string
+
+const (
+	JwtHS256 JwtAlg = "HS256" //共享密钥,签名及验证都需要密钥
+	JwtRS256 JwtAlg = "RS256"
+	JwtES256 JwtAlg = "ES256"
+	JwtEdDSA JwtAlg = "EdDSA"
+)
+
+// JwtConf 第一个密钥用于签名,其余的只用于验证,轮换密钥时将旧密钥往后放,等旧token过期后再删除
+type JwtConf struct {
+	Keys []JwtKey
+}
+
+type JwtKey struct {
+	Kid        string `json:",optional"` //不填时根据密钥生成
+	Alg        JwtAlg `json:",default=HS256,options=HS256|RS256|ES256|EdDSA"`
+	Secret     string `json:",optional"` //HS256的密钥
+	PrivateKey string `json:",optional"` //PEM格式的私钥(PKCS8,RSA也支持PKCS1,EC也支持SEC1),签名时需要
+	PublicKey  string `json:",optional"` //PEM格式的公钥,只用于验证时填,填了私钥时可以不填
+}
@@ -5,3 +5,20 @@ type Limit struct {
 	TriggerTime   int // 错误密码次数
 	ForbiddenTime int //账号或ip冻结时间
 }
+
+type RateLimitAlgorithm = string
+
+const (
+	RateLimitSlidingWindow RateLimitAlgorithm = "slidingWindow" //滑动窗口
+	RateLimitTokenBucket   RateLimitAlgorithm = "tokenBucket"   //令牌桶
+)
+
+// 通用限流配置
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm `json:",default=slidingWindow,options=slidingWindow|tokenBucket"`
+	Window    int                `json:",default=60"`  //滑动窗口大小:单位秒
+	Limit     int64              `json:",default=100"` //滑动窗口内允许的请求数
+	Rate      float64            `json:",optional"`    //令牌桶每秒生成的令牌数
+	Burst     int64              `json:",optional"`    //令牌桶容量,不填时等于Rate
+	KeyBy     []string           `json:",optional"`    //限流维度:tenant user ip app,不填则全局限流
+}
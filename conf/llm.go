@@ -0,0 +1,20 @@
+package conf
+
+type LlmType = string
+
+const (
+	LlmOpenai LlmType = "openai" //openai兼容的接口,如vLLM,Ollama
+	LlmDify   LlmType = "dify"
+	LlmFake   LlmType = "fake" //回显用户消息,用于测试
+)
+
+// 大模型对话的配置
+type LlmConf struct {
+	Mode     LlmType `json:",default=openai,env=llmMode,options=openai|dify|fake"`
+	Host     string  `json:",optional,env=llmHost"` //openai兼容接口配置到/v1,如http://localhost:11434/v1
+	Key      string  `json:",optional,env=llmKey"`
+	Model    string  `json:",optional"`   //请求中没有指定模型时使用
+	Timeout  int64   `json:",default=60"` //非流式请求的超时时间,单位秒
+	MaxRetry int     `json:",optional"`   //限流及网关错误的重试次数
+	User     string  `json:",optional"`   //dify的默认用户
+}
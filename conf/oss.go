@@ -7,19 +7,31 @@ import (
 )
 
 type OssConf struct {
-	OssType             string `json:",default=minio,options=minio|aliyun|local"` //oss的类型
-	AccessKeyID         string `json:",default=root,optional"`                    //账号
-	AccessKeySecret     string `json:",default=password,optional"`                //密码
-	PublicBucketName    string `json:",default=ithings-public,optional"`          //公开桶的名称
-	TemporaryBucketName string `json:",default=ithings-temporary,optional"`       //临时桶,30分钟有效期
-	PrivateBucketName   string `json:",default=ithings-private,optional"`         //私有桶的名称
-	Location            string `json:",default=localhost:9000,optional"`          // oss的地址
-	UseSSL              bool   `json:",optional"`                                 //是否使用ssl
-	CustomHost          string `json:",default=/oss,env=OssCustomHost"`           //带上host的返回前缀,支持环境变量
-	CustomPath          string `json:",default=/oss,optional"`                    //相对路径返回的前缀
-	ConnectTimeout      int64  //连接超时
-	ReadWriteTimeout    int64  //读写超时
-	StorePath           string `json:",optional,default=../oss"`
+	OssType             string   `json:",default=minio,options=minio|aliyun|local"` //oss的类型
+	AccessKeyID         string   `json:",default=root,optional"`                    //账号
+	AccessKeySecret     string   `json:",default=password,optional"`                //密码
+	PublicBucketName    string   `json:",default=ithings-public,optional"`          //公开桶的名称
+	TemporaryBucketName string   `json:",default=ithings-temporary,optional"`       //临时桶,30分钟有效期
+	PrivateBucketName   string   `json:",default=ithings-private,optional"`         //私有桶的名称
+	Location            string   `json:",default=localhost:9000,optional"`          // oss的地址
+	UseSSL              bool     `json:",optional"`                                 //是否使用ssl
+	CustomHost          string   `json:",default=/oss,env=OssCustomHost"`           //带上host的返回前缀,支持环境变量
+	CustomPath          string   `json:",default=/oss,optional"`                    //相对路径返回的前缀
+	ConnectTimeout      int64    //连接超时
+	ReadWriteTimeout    int64    //读写超时
+	StorePath           string   `json:",optional,default=../oss"`
+	TemporaryTTL        int64    `json:",optional,default=1800"` //本地存储临时桶文件的有效期(秒),定时清理,0为不清理
+	UploadGuard         bool     `json:",optional"`              //上传时按场景的策略检查文件的类型,大小等
+	ClamdAddr           string   `json:",optional"`              //clamd的地址,配置后上传的文件需要通过病毒扫描,如unix:///var/run/clamav/clamd.ctl
+	Quota               OssQuota `json:",optional"`              //租户的存储配额
+}
+
+// 租户存储配额,用量按GenFilePath生成的路径中的租户统计,需要redis
+type OssQuota struct {
+	Enable            bool             `json:",optional"`               //开启用量统计
+	Default           int64            `json:",optional"`               //每个租户的默认配额(字节),0为不限制
+	Tenants           map[string]int64 `json:",optional"`               //按租户配置的配额,优先于默认配额
+	ReconcileInterval int64            `json:",optional,default=86400"` //按文件列表重新统计用量的间隔(秒),0为不统计
 }
 
 type LocalConf struct {
@@ -0,0 +1,14 @@
+package conf
+
+// SessionConf 登录会话配置
+type SessionConf struct {
+	AccessExpire   int64          `json:",default=7200"`    //access token有效期,单位秒
+	RefreshExpire  int64          `json:",default=2592000"` //refresh token有效期,超过这个时间没有刷新会话失效,单位秒
+	MaxSessions    int            `json:",optional"`        //每个用户每个应用的最大会话数,0不限制,超出时踢掉最早登录的会话
+	AppMaxSessions []SessionLimit `json:",optional"`        //按应用配置最大会话数,优先于MaxSessions
+}
+
+type SessionLimit struct {
+	AppCode string
+	Max     int
+}
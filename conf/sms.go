@@ -5,13 +5,27 @@ type SmsType = string
 const (
 	SmsAli     SmsType = "ali"
 	SmsTencent SmsType = "tencent"
+	SmsHttp    SmsType = "http" //http短信网关,smpp网关可以通过其http接口接入
+	SmsFake    SmsType = "fake" //本地记录短信,不实际发送,用于开发测试
 )
 
 type Sms struct {
-	Mode    string         `json:",default=ali,env=smsMode,options=ali|tencent"`
-	Enable  bool           `json:",default=false"`
-	Ali     SmsAliConf     `json:",optional"`
-	Tencent SmsTencentConf `json:",optional"`
+	Mode          string         `json:",default=ali,env=smsMode"` //主用的短信服务商,可以是通过smsClient.RegisterProvider注册的服务商
+	Backups       []string       `json:",optional"`                //主用服务商发送失败时依次尝试的备用服务商
+	Enable        bool           `json:",default=false"`
+	SignName      string         `json:",optional"` //默认的短信签名
+	Templates     []SmsTemplate  `json:",optional"` //逻辑模板编码和各服务商模板ID的映射
+	PhoneLimit    []Limit        `json:",optional"` //每个手机号的发送频率限制
+	TemplateLimit []Limit        `json:",optional"` //每个模板的发送频率限制
+	Ali           SmsAliConf     `json:",optional"`
+	Tencent       SmsTencentConf `json:",optional"`
+	Http          SmsHttpConf    `json:",optional"`
+}
+
+type SmsTemplate struct {
+	Code      string            //逻辑模板编码,如 def.NotifyCodeSysUserLoginCaptcha
+	SignName  string            `json:",optional"` //模板使用的签名,不填使用默认签名
+	Providers map[string]string //服务商 -> 服务商的模板ID
 }
 
 type SmsAliConf struct {
@@ -25,3 +39,9 @@ type SmsTencentConf struct {
 	AppID           string `json:",env=tencentAppID"`
 	AppKey          string `json:",env=tencentAppKey"`
 }
+
+type SmsHttpConf struct {
+	Url     string `json:",optional"`   //网关的发送接口地址
+	Token   string `json:",optional"`   //以Bearer方式放在Authorization头中
+	Timeout int    `json:",default=10"` //单位秒
+}
@@ -0,0 +1,33 @@
+package conf
+
+const (
+	TaskRedisNode     = "node"     //单节点
+	TaskRedisCluster  = "cluster"  //redis集群
+	TaskRedisSentinel = "sentinel" //哨兵模式
+)
+
+// asynq任务队列使用的redis
+type TaskRedisConf struct {
+	Type         string   `json:",default=node,options=node|cluster|sentinel"`
+	Hosts        []string //node模式只使用第一个,cluster填集群节点,sentinel填哨兵节点
+	User         string   `json:",optional"`
+	Pass         string   `json:",optional"`
+	DB           int      `json:",optional"`
+	Tls          bool     `json:",optional"`
+	MasterName   string   `json:",optional"` //sentinel模式的主节点名称
+	SentinelPass string   `json:",optional"` //sentinel模式哨兵的密码
+}
+
+// 任务队列配置
+type TaskQueueConf struct {
+	Redis           TaskRedisConf
+	Concurrency     int            `json:",default=20"`   //同时执行的任务数
+	Queues          map[string]int `json:",optional"`     //队列及权重,不填使用def.TimerPriority
+	StrictPriority  bool           `json:",default=true"` //是否严格按优先级执行,为true时高优先级队列清空后才执行低优先级队列
+	MaxRetry        int            `json:",default=25"`   //任务默认的最大重试次数
+	RetryBaseDelay  int64          `json:",default=1"`    //重试的基础间隔:单位秒,按指数退避
+	RetryMaxDelay   int64          `json:",default=3600"` //重试的最大间隔:单位秒
+	TaskTimeout     int64          `json:",optional"`     //任务默认的超时时间:单位秒,0为不限制
+	ShutdownTimeout int64          `json:",default=8"`    //优雅退出时等待正在执行的任务的时间:单位秒
+	TimeZone        string         `json:",default=Asia/Shanghai"`
+}
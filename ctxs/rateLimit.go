@@ -0,0 +1,85 @@
+package ctxs
+
+import (
+	"context"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/spf13/cast"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/rest/httpx"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type RateLimitKeyBy = string
+
+const (
+	RateLimitByTenant RateLimitKeyBy = "tenant"
+	RateLimitByUser   RateLimitKeyBy = "user"
+	RateLimitByIP     RateLimitKeyBy = "ip"
+	RateLimitByApp    RateLimitKeyBy = "app"
+)
+
+// RateLimitChecker 限流器,由tools.RateLimiter实现
+type RateLimitChecker interface {
+	Take(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// GenRateLimitKey 按维度组合限流的key,如 tenant:default|user:123
+func (u *UserCtx) GenRateLimitKey(keyBy ...RateLimitKeyBy) string {
+	if u == nil {
+		return ""
+	}
+	var keys []string
+	for _, by := range keyBy {
+		var val string
+		switch by {
+		case RateLimitByTenant:
+			val = u.TenantCode
+		case RateLimitByUser:
+			val = cast.ToString(u.UserID)
+		case RateLimitByIP:
+			val = u.IP
+		case RateLimitByApp:
+			val = u.AppCode
+		default:
+			continue
+		}
+		keys = append(keys, by+":"+val)
+	}
+	return strings.Join(keys, "|")
+}
+
+// RateLimitMiddleware http限流中间件,需要放在InitMiddleware之后,按用户维度限流时还需要放在鉴权之后
+func RateLimitMiddleware(limiter RateLimitChecker, keyBy ...RateLimitKeyBy) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			uc := GetUserCtxNoNil(r.Context())
+			allowed, retryAfter, err := limiter.Take(r.Context(), uc.GenRateLimitKey(keyBy...))
+			if err != nil { //限流器出错时不影响正常请求
+				logx.WithContext(r.Context()).Errorf("RateLimitMiddleware uri:%v err:%v", r.RequestURI, err)
+			}
+			if err != nil || allowed {
+				next(w, r)
+				return
+			}
+			sec := int64(math.Ceil(retryAfter.Seconds()))
+			if sec < 1 {
+				sec = 1
+			}
+			er := errors.TooManyRequests.AddDetailf("retry after %ds", sec)
+			msg := er.GetI18nMsg(uc.AcceptLanguage)
+			w.Header().Set("Retry-After", cast.ToString(sec))
+			httpx.WriteJson(w, http.StatusTooManyRequests, struct {
+				Code int64  `json:"code"`
+				Msg  string `json:"msg"`
+			}{Code: er.Code, Msg: msg})
+			ret := GetResp(r)
+			if ret != nil {
+				//将接口的应答结果写入r.Response，为操作日志记录接口提供应答信息
+				*ret = http.Response{StatusCode: int(er.Code), Status: msg}
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package ctxs_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/tools"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter, err := tools.NewRateLimiter(conf.RateLimit{Window: 60, Limit: 2}, "test")
+	require.NoError(t, err)
+	var hits int
+	handler := ctxs.RateLimitMiddleware(limiter, ctxs.RateLimitByUser)(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	})
+	do := func(userID int64) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/test", nil)
+		r = r.WithContext(ctxs.SetUserCtx(r.Context(), &ctxs.UserCtx{UserID: userID}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, do(1).Code)
+	assert.Equal(t, http.StatusOK, do(1).Code)
+	w := do(1)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter := cast.ToInt(w.Header().Get("Retry-After"))
+	assert.True(t, retryAfter >= 1 && retryAfter <= 60, "Retry-After:%v", w.Header().Get("Retry-After"))
+	var body struct {
+		Code int64 `json:"code"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, errors.TooManyRequests.Code, body.Code)
+	assert.Equal(t, 2, hits, "被限流的请求不能进入下一个处理函数")
+
+	assert.Equal(t, http.StatusOK, do(2).Code, "不同用户分别限流")
+	assert.Equal(t, 3, hits)
+}
+
+type errRateLimiter struct{}
+
+func (errRateLimiter) Take(ctx context.Context, key string) (bool, time.Duration, error) {
+	return false, 0, errors.System.AddDetail("store down")
+}
+
+// 限流器出错时放行
+func TestRateLimitMiddlewareErr(t *testing.T) {
+	var hits int
+	handler := ctxs.RateLimitMiddleware(errRateLimiter{})(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, hits)
+}
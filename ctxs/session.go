@@ -0,0 +1,43 @@
+package ctxs
+
+import (
+	"context"
+	"net/http"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// SessionChecker 检查token的会话是否被吊销,由users.SessionStore实现
+type SessionChecker interface {
+	CheckToken(ctx context.Context, token string) error
+}
+
+// SessionMiddleware 拦截已吊销会话的请求,需要放在InitMiddleware之后
+func SessionMiddleware(checker SessionChecker) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			uc := GetUserCtxNoNil(r.Context())
+			if uc.Token == "" { //不需要登录的接口由鉴权处理
+				next(w, r)
+				return
+			}
+			err := checker.CheckToken(r.Context(), uc.Token)
+			if err == nil {
+				next(w, r)
+				return
+			}
+			er := errors.Fmt(err)
+			msg := er.GetI18nMsg(uc.AcceptLanguage)
+			httpx.WriteJson(w, http.StatusUnauthorized, struct {
+				Code int64  `json:"code"`
+				Msg  string `json:"msg"`
+			}{Code: er.Code, Msg: msg})
+			ret := GetResp(r)
+			if ret != nil {
+				//将接口的应答结果写入r.Response，为操作日志记录接口提供应答信息
+				*ret = http.Response{StatusCode: int(er.Code), Status: msg}
+			}
+		}
+	}
+}
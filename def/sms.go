@@ -29,4 +29,6 @@ const (
 	NotifyTypeMessage     NotifyType = "message"     //站内信通知
 	NotifyTypePhoneCall   NotifyType = "phoneCall"   //电话通知
 	NotifyTypeWxApp       NotifyType = "wxCorApp"    //企业微信app消息
+	NotifyTypeWebsocket   NotifyType = "websocket"   //websocket推送
+	NotifyTypeWebhook     NotifyType = "webhook"     //http回调
 )
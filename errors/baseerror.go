@@ -1,15 +1,19 @@
 package errors
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"gitee.com/unitedrhino/share/proto"
 	"github.com/dop251/goja"
 	"github.com/zeromicro/go-zero/core/logx"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +23,16 @@ type CodeError struct {
 	MsgStr  string     `json:"msg"`
 	Details []string   `json:"details,omitempty"`
 	Stack   []string   `json:"stack,omitempty"`
+	Cause   string     `json:"cause,omitempty"` //原始错误的信息,跨服务传递时只保留文本
+	cause   error      //原始错误,用于errors.Is及errors.As
+}
+
+// 是否在AddDetail及Wrap时记录调用栈,通过环境变量errorStack开启,WithStack不受影响
+var stackEnable, _ = strconv.ParseBool(os.Getenv("errorStack"))
+
+// SetStackEnable 设置是否在AddDetail及Wrap时记录调用栈
+func SetStackEnable(enable bool) {
+	stackEnable = enable
 }
 
 type RpcError interface {
@@ -30,16 +44,19 @@ type RpcError interface {
 //	return s.Err()
 //}
 
+// ToRpc 转换成grpc的错误,状态码见RpcCode,message为翻译后的错误信息,错误码及详情放在proto.Error的错误详情中.
+// 旧版本的message为CodeError的json且状态码都是codes.Unknown,旧版本的客户端解析不了新的格式,收到的都是System错误,
+// 需要先升级调用方再升级服务端
 func (c CodeError) ToRpc(accept string) error {
-	code := codes.Unknown
-	switch c.Code {
-	case Failure.Code: //失败需要回滚
-		code = codes.Aborted
-	case OnGoing.Code: //任务还在执行中
-		code = codes.FailedPrecondition
-	}
 	c.MsgStr = c.GetI18nMsg(accept)
-	s := status.New(code, c.Error())
+	s := status.New(c.RpcCode(), c.MsgStr)
+	details := []protoadapt.MessageV1{&proto.Error{Code: int32(c.Code), Message: c.MsgStr, Detail: c.Details}}
+	if cause := c.causeMsg(); cause != "" || len(c.Stack) != 0 { //原始错误及调用栈放在DebugInfo中
+		details = append(details, &errdetails.DebugInfo{Detail: cause, StackEntries: c.Stack})
+	}
+	if ds, err := s.WithDetails(details...); err == nil {
+		s = ds
+	}
 	return s.Err()
 }
 
@@ -78,9 +95,32 @@ func (c CodeError) AddMsgf(format string, a ...any) *CodeError {
 	return &c
 }
 
+// AddMsgTpl 添加模板消息,如 AddMsgTpl("设备{{.Name}}不在线", map[string]any{"Name": name})
+func (c CodeError) AddMsgTpl(format string, data map[string]any) *CodeError {
+	c.Msg = append(c.Msg, Tpl{Format: format, Data: data})
+	return &c
+}
+
+// AddMsgPlural 添加复数消息,翻译文件中按复数形式配置,如 {"one": "...", "other": "..."}
+func (c CodeError) AddMsgPlural(format string, count any, data map[string]any) *CodeError {
+	c.Msg = append(c.Msg, Tpl{Format: format, Data: data, Count: count})
+	return &c
+}
+
+// AddDetail 添加详情,如果参数中有error且还没有原始错误,则记录为原始错误
 func (c CodeError) AddDetail(msg ...any) *CodeError {
 	c.Details = append(c.Details, fmt.Sprint(msg...))
-	c.Stack = append(c.Stack, stack(2, 3))
+	if c.cause == nil {
+		for _, m := range msg {
+			if err, ok := m.(error); ok {
+				c.cause = err
+				break
+			}
+		}
+	}
+	if stackEnable {
+		c.Stack = append(c.Stack, stack(2, 3))
+	}
 	return &c
 }
 func (c CodeError) WithStack(skip int) *CodeError {
@@ -90,9 +130,55 @@ func (c CodeError) WithStack(skip int) *CodeError {
 
 func (c CodeError) AddDetailf(format string, a ...any) *CodeError {
 	c.Details = append(c.Details, fmt.Sprintf(format, a...))
+	if stackEnable {
+		c.Stack = append(c.Stack, stack(2, 3))
+	}
+	return &c
+}
+
+// WithCause 记录原始错误,可以通过errors.Is及errors.As判断
+func (c CodeError) WithCause(err error) *CodeError {
+	c.cause = err
+	c.Cause = ""
+	return &c
+}
+
+// Wrap 用错误码包装原始错误,cause为nil时返回错误码的副本
+func Wrap(cause error, code *CodeError) *CodeError {
+	c := *code
+	if cause != nil {
+		c.cause = cause
+		c.Cause = ""
+	}
+	if stackEnable {
+		c.Stack = append(c.Stack, stack(2, 3))
+	}
 	return &c
 }
 
+// Unwrap 返回原始错误,从grpc还原的错误只有Cause文本,返回nil
+func (c CodeError) Unwrap() error {
+	return c.cause
+}
+
+// Is 错误码相同即认为是同一个错误
+func (c CodeError) Is(target error) bool {
+	switch t := target.(type) {
+	case *CodeError:
+		return t != nil && t.Code == c.Code
+	case CodeError:
+		return t.Code == c.Code
+	}
+	return false
+}
+
+func (c CodeError) causeMsg() string {
+	if c.Cause == "" && c.cause != nil {
+		return c.cause.Error()
+	}
+	return c.Cause
+}
+
 func (c *CodeError) GetDetailMsg() string {
 	if c == nil {
 		return OK.GetDetailMsg()
@@ -131,6 +217,7 @@ func NewDefaultError(msg string) error {
 func (c CodeError) Error() string {
 	c.Stack = nil
 	c.MsgStr = c.GetI18nMsg("")
+	c.Cause = c.causeMsg()
 	ret, _ := json.Marshal(c)
 	return string(ret)
 }
@@ -151,26 +238,21 @@ func Fmt(errs error) *CodeError {
 	case *CodeError:
 		return errs.(*CodeError)
 	case RpcError: //如果是grpc类型的错误
-		s, _ := status.FromError(errs)
-		if s.Code() != codes.Unknown { //只有自定义的错误,grpc会返回unknown错误码
-			err := fmt.Sprintf("rpc err detail is nil|err=%#v", s)
-			return System.AddDetail(err)
-		}
-		var ret CodeError
-		err := json.Unmarshal([]byte(s.Message()), &ret)
-		ret.Msg = []I18nImpl{String(ret.MsgStr)}
-		if err != nil {
-			return System.AddDetail(err)
-		}
-		return &ret
+		return fromRpc(errs)
 	case *goja.Exception:
 		e := errs.(*goja.Exception)
 		return Script.AddMsg(e.Error())
 	default:
-		var ce CodeError
-		err := json.Unmarshal([]byte(errs.Error()), &ce)
+		var ce *CodeError
+		if errors.As(errs, &ce) { //被fmt.Errorf等包装过的错误
+			return ce
+		}
+		if errors.Is(errs, context.DeadlineExceeded) || errors.Is(errs, context.Canceled) {
+			return TimeOut.AddDetail(errs)
+		}
+		err := json.Unmarshal([]byte(errs.Error()), &CodeError{})
 		if err != nil {
-			return System.AddDetail(errs.Error())
+			return System.AddDetail(errs)
 		}
 		return Default.AddDetail(errs)
 	}
@@ -194,6 +276,9 @@ func IfNotNil(c *CodeError, err error) error {
 func Is(err, target error) bool {
 	return errors.Is(err, target)
 }
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
 
 func Must(err error, msg string) {
 	if err != nil {
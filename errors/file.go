@@ -2,6 +2,15 @@ package errors
 
 const FileError = 1000000
 
+// 新增的文件错误码,FileError和UserError重叠,为了不改变已有的错误码单独分配
+const FileExtError = 1100000
+
 var (
 	Upload = NewCodeError(FileError+1, "上传失败")
+
+	FileType      = NewCodeError(FileExtError+1, "文件类型不支持")
+	FileTooLarge  = NewCodeError(FileExtError+2, "文件过大")
+	FileInfected  = NewCodeError(FileExtError+3, "文件未通过安全扫描")
+	FileNameError = NewCodeError(FileExtError+4, "文件名不合法")
+	QuotaExceeded = NewCodeError(FileExtError+5, "存储空间不足")
 )
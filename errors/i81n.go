@@ -5,12 +5,20 @@ import (
 	"fmt"
 	"gitee.com/unitedrhino/share/i18ns"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"io/fs"
 	"strings"
+	"sync"
+	"text/template"
 )
 
 //go:embed locale/*.json
 var LocaleFS embed.FS
-var bundle *i18n.Bundle
+var (
+	bundle            *i18n.Bundle
+	matcher           *i18ns.Matcher
+	fallbackLanguages []string
+	bundleMutex       sync.RWMutex
+)
 
 type I18nImpl interface {
 	I81n(localizer *i18n.Localizer) string
@@ -23,12 +31,41 @@ type Msgf struct {
 }
 type String string
 
+// Tpl go-i18n模板语法的消息,Count不为nil时按语言的复数规则选择翻译,模板中可以用{{.Count}}
+type Tpl struct {
+	Format string
+	Data   map[string]any
+	Count  any
+}
+
 func init() {
 	bundle = i18ns.InitWithLocaleFS(LocaleFS, "locale")
+	matcher = i18ns.NewMatcher(bundle)
+}
+
+// MergeLocaleFS 将业务服务自己的语言文件合并到错误信息的翻译中,需要在服务启动时调用
+func MergeLocaleFS(fsys fs.FS, dir string) error {
+	bundleMutex.Lock()
+	defer bundleMutex.Unlock()
+	if err := i18ns.LoadLocaleFS(bundle, fsys, dir); err != nil {
+		return err
+	}
+	matcher = i18ns.NewMatcher(bundle)
+	return nil
 }
 
+// SetFallbackLanguage 设置用户的Accept-Language都不支持时使用的语言,都不支持时使用中文
+func SetFallbackLanguage(langs ...string) {
+	bundleMutex.Lock()
+	defer bundleMutex.Unlock()
+	fallbackLanguages = langs
+}
+
+// GetI18nMsg 按accept(一般为ctxs.UserCtx.AcceptLanguage)协商语言后翻译错误信息
 func (c CodeError) GetI18nMsg(accept string) string {
-	localizer := i18n.NewLocalizer(bundle, accept)
+	bundleMutex.RLock()
+	defer bundleMutex.RUnlock()
+	localizer := i18n.NewLocalizer(bundle, matcher.Match(append([]string{accept}, fallbackLanguages...)...).String())
 	var msgs []string
 	for _, v := range c.Msg {
 		msg := v.I81n(localizer)
@@ -65,3 +102,36 @@ func stringMsgs(in []I18nImpl) string {
 	}
 	return strings.Join(msgs, ":")
 }
+
+func (m Tpl) I81n(localizer *i18n.Localizer) string {
+	msg, _ := localizer.Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{ID: m.Format, Other: m.Format},
+		TemplateData:   m.data(),
+		PluralCount:    m.Count,
+	})
+	if msg == "" {
+		return m.String()
+	}
+	return msg
+}
+func (m Tpl) String() string {
+	t, err := template.New("").Parse(m.Format)
+	if err != nil {
+		return m.Format
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, m.data()); err != nil {
+		return m.Format
+	}
+	return buf.String()
+}
+func (m Tpl) data() map[string]any {
+	var data = make(map[string]any, len(m.Data)+1)
+	for k, v := range m.Data {
+		data[k] = v
+	}
+	if _, ok := data["Count"]; !ok && m.Count != nil {
+		data["Count"] = m.Count
+	}
+	return data
+}
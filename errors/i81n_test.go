@@ -0,0 +1,59 @@
+package errors_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/i18ns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetI18nMsg(t *testing.T) {
+	assert.Equal(t, "参数错误", errors.Parameter.GetI18nMsg(""))
+	assert.Equal(t, "parameter error", errors.Parameter.GetI18nMsg("en-US,en;q=0.9"))
+	assert.Equal(t, "参数错误", errors.Parameter.GetI18nMsg("fr"))
+	assert.Equal(t, "device is already bound:file too large", errors.DeviceBound.AddMsg("文件过大").GetI18nMsg("en"))
+	assert.Equal(t, "image too large:3x4", errors.Parameter.WithMsgf("图片过大:%dx%d", 3, 4).GetI18nMsg("en"))
+
+	errors.SetFallbackLanguage("en")
+	defer errors.SetFallbackLanguage()
+	assert.Equal(t, "parameter error", errors.Parameter.GetI18nMsg("fr"))
+	assert.Equal(t, "参数错误", errors.Parameter.GetI18nMsg("zh-CN"))
+}
+
+func TestI18nTpl(t *testing.T) {
+	require.NoError(t, errors.MergeLocaleFS(fstest.MapFS{
+		"locale/en.json": {Data: []byte(`{
+	"还有{{.Count}}台设备未绑定": {"one": "{{.Count}} device is not bound", "other": "{{.Count}} devices are not bound"},
+	"设备{{.Name}}不在线": "device {{.Name}} is offline"
+}`)},
+	}, "locale"))
+
+	err := errors.DeviceCantBound.WithMsg("设备无法绑定").AddMsgPlural("还有{{.Count}}台设备未绑定", 1, nil)
+	assert.Equal(t, "device cannot be bound:1 device is not bound", err.GetI18nMsg("en"))
+	assert.Equal(t, "设备无法绑定:还有1台设备未绑定", err.GetI18nMsg("zh"))
+	assert.Equal(t, "设备无法绑定:还有1台设备未绑定", err.GetMsg())
+	err = errors.Parameter.WithMsg("").AddMsgPlural("还有{{.Count}}台设备未绑定", 3, nil)
+	assert.Contains(t, err.GetI18nMsg("en"), "3 devices are not bound")
+
+	err = errors.NotOnline.AddMsgTpl("设备{{.Name}}不在线", map[string]any{"Name": "d1"})
+	assert.Contains(t, err.GetI18nMsg("en"), "device d1 is offline")
+	assert.Contains(t, err.GetMsg(), "设备d1不在线")
+	//没有翻译的模板使用原文
+	err = errors.Parameter.WithMsg("").AddMsgTpl("{{.A}}不存在", map[string]any{"A": "x"})
+	assert.Contains(t, err.GetI18nMsg("en"), "x不存在")
+}
+
+// 源码中所有的错误信息都需要有翻译,新增错误信息后执行 go run ./i18ns/cmd/i18n extract -src . -locale errors/locale
+func TestLocaleComplete(t *testing.T) {
+	msgs, err := i18ns.Extract("..")
+	require.NoError(t, err)
+	results, err := i18ns.Check(msgs, errors.LocaleFS, "locale")
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	for _, r := range results {
+		assert.Empty(t, r.Missing, r.Lang)
+	}
+}
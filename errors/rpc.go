@@ -0,0 +1,140 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"gitee.com/unitedrhino/share/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 错误码对应的grpc状态码,没有配置的返回codes.Unknown.
+// codes.Aborted及codes.FailedPrecondition只用于Failure及OnGoing,分布式事务依赖这两个状态码判断回滚及重试.
+// go-zero的熔断器会把DeadlineExceeded,Internal,Unavailable,DataLoss,Unimplemented,ResourceExhausted记为失败,
+// 这些状态码只用于服务自身的故障;超时,限流,配额及未实现等业务错误使用codes.Unknown,避免一个租户触发所有调用方的熔断
+var (
+	rpcCodeMap = map[int64]codes.Code{
+		OK.Code:               codes.OK,
+		Parameter.Code:        codes.InvalidArgument,
+		Type.Code:             codes.InvalidArgument,
+		OutRange.Code:         codes.InvalidArgument,
+		NotEmpty.Code:         codes.InvalidArgument,
+		Duplicate.Code:        codes.AlreadyExists,
+		NotFind.Code:          codes.NotFound,
+		Permissions.Code:      codes.PermissionDenied,
+		Company.Code:          codes.PermissionDenied,
+		TokenExpired.Code:     codes.Unauthenticated,
+		TokenNotValidYet.Code: codes.Unauthenticated,
+		TokenMalformed.Code:   codes.Unauthenticated,
+		TokenInvalid.Code:     codes.Unauthenticated,
+		SignatureExpired.Code: codes.Unauthenticated,
+		System.Code:           codes.Internal,
+		Database.Code:         codes.Internal,
+		Panic.Code:            codes.Internal,
+		Server.Code:           codes.Unavailable,
+		Failure.Code:          codes.Aborted,
+		OnGoing.Code:          codes.FailedPrecondition,
+
+		DuplicateUsername.Code:    codes.AlreadyExists,
+		DuplicateMobile.Code:      codes.AlreadyExists,
+		DuplicateRegister.Code:    codes.AlreadyExists,
+		BindAccount.Code:          codes.AlreadyExists,
+		UnRegister.Code:           codes.NotFound,
+		Password.Code:             codes.Unauthenticated,
+		Captcha.Code:              codes.Unauthenticated,
+		UseCaptcha.Code:           codes.Unauthenticated,
+		NotLogin.Code:             codes.Unauthenticated,
+		AccountKickedOut.Code:     codes.Unauthenticated,
+		AccountOrIpForbidden.Code: codes.PermissionDenied,
+		AccountDisable.Code:       codes.PermissionDenied,
+		UsernameFormatErr.Code:    codes.InvalidArgument,
+		PasswordLevel.Code:        codes.InvalidArgument,
+		NeedUserName.Code:         codes.InvalidArgument,
+
+		DeviceBound.Code:         codes.AlreadyExists,
+		OtaDeviceNumError.Code:   codes.InvalidArgument,
+		TriggerType.Code:         codes.InvalidArgument,
+		MediaNotfoundError.Code:  codes.NotFound,
+		MediaRecordNotFound.Code: codes.NotFound,
+
+		FileType.Code:      codes.InvalidArgument,
+		FileNameError.Code: codes.InvalidArgument,
+		FileTooLarge.Code:  codes.InvalidArgument,
+		FileInfected.Code:  codes.InvalidArgument,
+	}
+	// 没有带错误详情的grpc错误(如框架或非go的服务返回的)转换成的错误
+	rpcErrorMap = map[codes.Code]*CodeError{
+		codes.InvalidArgument:    Parameter,
+		codes.NotFound:           NotFind,
+		codes.AlreadyExists:      Duplicate,
+		codes.PermissionDenied:   Permissions,
+		codes.Unauthenticated:    TokenInvalid,
+		codes.DeadlineExceeded:   TimeOut,
+		codes.Canceled:           TimeOut,
+		codes.ResourceExhausted:  TooManyRequests,
+		codes.Unimplemented:      NotRealize,
+		codes.Aborted:            Failure,
+		codes.FailedPrecondition: OnGoing,
+	}
+	rpcCodeMutex sync.RWMutex
+)
+
+// RegisterRpcCode 配置错误码对应的grpc状态码,用于业务服务自定义的错误码
+func RegisterRpcCode(code int64, rpcCode codes.Code) {
+	rpcCodeMutex.Lock()
+	defer rpcCodeMutex.Unlock()
+	rpcCodeMap[code] = rpcCode
+}
+
+// RpcCode 获取错误码对应的grpc状态码
+func (c *CodeError) RpcCode() codes.Code {
+	rpcCodeMutex.RLock()
+	defer rpcCodeMutex.RUnlock()
+	if code, ok := rpcCodeMap[c.GetCode()]; ok {
+		return code
+	}
+	return codes.Unknown
+}
+
+// 从grpc的错误中还原,优先使用错误详情,兼容旧版本放在message中的json
+func fromRpc(errs error) *CodeError {
+	s, _ := status.FromError(errs)
+	var (
+		ret   *CodeError
+		debug *errdetails.DebugInfo
+	)
+	for _, d := range s.Details() {
+		switch e := d.(type) {
+		case *proto.Error:
+			ret = &CodeError{
+				Code:    int64(e.GetCode()),
+				Msg:     []I18nImpl{String(e.GetMessage())},
+				MsgStr:  e.GetMessage(),
+				Details: e.GetDetail(),
+			}
+		case *errdetails.DebugInfo:
+			debug = e
+		}
+	}
+	if ret != nil {
+		if debug != nil { //原始错误只能以文本的形式还原
+			ret.Cause = debug.GetDetail()
+			ret.Stack = debug.GetStackEntries()
+		}
+		return ret
+	}
+	if s.Code() == codes.Unknown { //旧版本的错误码都是unknown,错误放在message中
+		var ret CodeError
+		if err := json.Unmarshal([]byte(s.Message()), &ret); err == nil && ret.Code != 0 {
+			ret.Msg = []I18nImpl{String(ret.MsgStr)}
+			return &ret
+		}
+	}
+	if e, ok := rpcErrorMap[s.Code()]; ok {
+		return e.AddDetailf("rpc err code:%v msg:%s", s.Code(), s.Message())
+	}
+	return System.AddDetail(fmt.Sprintf("rpc err detail is nil|err=%#v", s))
+}
@@ -0,0 +1,101 @@
+package errors_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToRpc(t *testing.T) {
+	cases := []struct {
+		err  *errors.CodeError
+		code codes.Code
+	}{
+		{errors.Parameter, codes.InvalidArgument},
+		{errors.Permissions, codes.PermissionDenied},
+		{errors.NotFind, codes.NotFound},
+		{errors.TimeOut, codes.Unknown},
+		{errors.TokenExpired, codes.Unauthenticated},
+		{errors.TooManyRequests, codes.Unknown},
+		{errors.Failure, codes.Aborted},
+		{errors.OnGoing, codes.FailedPrecondition},
+		{errors.System, codes.Internal},
+		{errors.DeviceTimeOut, codes.Unknown},
+		{errors.QuotaExceeded, codes.Unknown},
+		{errors.NotOnline, codes.Unknown},
+	}
+	for _, c := range cases {
+		err := c.err.AddMsg("补充").AddDetail("detail").ToRpc("en")
+		s, ok := status.FromError(err)
+		require.True(t, ok)
+		assert.Equal(t, c.code, s.Code(), c.err.GetMsg())
+		require.Len(t, s.Details(), 1)
+		detail := s.Details()[0].(*proto.Error)
+		assert.Equal(t, int32(c.err.Code), detail.GetCode())
+		assert.Equal(t, []string{"detail"}, detail.GetDetail())
+
+		back := errors.Fmt(err)
+		assert.Equal(t, c.err.Code, back.Code)
+		assert.Equal(t, s.Message(), back.GetMsg())
+		assert.Equal(t, []string{"detail"}, back.Details)
+	}
+
+	s, _ := status.FromError(errors.Parameter.ToRpc("en"))
+	assert.Equal(t, "parameter error", s.Message(), "message为翻译后的错误信息,不再是json")
+
+	prev := errors.NotOnline.RpcCode()
+	t.Cleanup(func() { errors.RegisterRpcCode(errors.NotOnline.Code, prev) })
+	errors.RegisterRpcCode(errors.NotOnline.Code, codes.Unavailable)
+	s, _ = status.FromError(errors.NotOnline.ToRpc(""))
+	assert.Equal(t, codes.Unavailable, s.Code())
+
+	assert.Nil(t, errors.ToRpc(nil, ""))
+	raw := status.Error(codes.NotFound, "raw")
+	assert.Equal(t, raw, errors.ToRpc(raw, ""))
+	s, _ = status.FromError(errors.ToRpc(fmt.Errorf("plain"), ""))
+	assert.Equal(t, errors.System.Code, errors.Fmt(s.Err()).Code)
+}
+
+// 和go-zero的zrpc/internal/codes.Acceptable一致,返回false的状态码会被熔断器记为失败
+func breakerAcceptable(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss,
+		codes.Unimplemented, codes.ResourceExhausted:
+		return false
+	default:
+		return true
+	}
+}
+
+func TestRpcBreakerAcceptable(t *testing.T) {
+	//业务,限流,配额及超时错误不能触发调用方的熔断
+	for _, err := range []*errors.CodeError{errors.Parameter, errors.NotFind, errors.TooManyRequests, errors.QuotaExceeded,
+		errors.TimeOut, errors.DeviceTimeOut, errors.NotRealize, errors.Method, errors.Failure, errors.OnGoing, errors.DeviceBound} {
+		assert.True(t, breakerAcceptable(err.ToRpc("")), err.GetMsg())
+	}
+	for _, err := range []*errors.CodeError{errors.System, errors.Database, errors.Panic, errors.Server} {
+		assert.False(t, breakerAcceptable(err.ToRpc("")), err.GetMsg())
+	}
+}
+
+func TestFmtRpcCompatible(t *testing.T) {
+	//旧版本:错误码为unknown,错误以json放在message中
+	old, _ := json.Marshal(errors.CodeError{Code: errors.DeviceBound.Code, MsgStr: "设备已被绑定", Details: []string{"d"}})
+	err := errors.Fmt(status.Error(codes.Unknown, string(old)))
+	assert.Equal(t, errors.DeviceBound.Code, err.Code)
+	assert.Equal(t, "设备已被绑定", err.GetMsg())
+	assert.Equal(t, []string{"d"}, err.Details)
+
+	//没有错误详情的grpc错误按状态码转换
+	assert.Equal(t, errors.NotFind.Code, errors.Fmt(status.Error(codes.NotFound, "no rows")).Code)
+	assert.Equal(t, errors.TimeOut.Code, errors.Fmt(status.Error(codes.DeadlineExceeded, "deadline")).Code)
+	assert.Equal(t, errors.System.Code, errors.Fmt(status.Error(codes.Unknown, "not json")).Code)
+	assert.Equal(t, errors.System.Code, errors.Fmt(status.Error(codes.Internal, "internal")).Code)
+}
@@ -0,0 +1,83 @@
+package errors_test
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	err := errors.Wrap(sql.ErrNoRows, errors.NotFind)
+	assert.True(t, stderrors.Is(err, sql.ErrNoRows))
+	assert.True(t, stderrors.Is(err, errors.NotFind))
+	assert.False(t, stderrors.Is(err, errors.Parameter))
+	assert.Equal(t, errors.NotFind.Code, err.Code)
+	assert.Contains(t, err.Error(), sql.ErrNoRows.Error())
+	assert.Empty(t, errors.NotFind.Unwrap(), "不修改原错误码")
+
+	//多层包装后依然可以判断
+	wrapped := fmt.Errorf("query: %w", err.AddMsg("查询失败"))
+	assert.True(t, stderrors.Is(wrapped, sql.ErrNoRows))
+	var ce *errors.CodeError
+	require.True(t, stderrors.As(wrapped, &ce))
+	assert.Equal(t, errors.NotFind.Code, ce.Code)
+	assert.Equal(t, errors.NotFind.Code, errors.Fmt(wrapped).Code)
+
+	var pathErr *fs.PathError
+	err = errors.System.AddDetail("open file", &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist})
+	require.True(t, stderrors.As(err, &pathErr))
+	assert.Equal(t, "a", pathErr.Path)
+	assert.True(t, stderrors.Is(err, fs.ErrNotExist))
+
+	assert.Equal(t, errors.Parameter.Code, errors.Wrap(nil, errors.Parameter).Code)
+	assert.Nil(t, errors.Wrap(nil, errors.Parameter).Unwrap())
+	assert.True(t, stderrors.Is(errors.Parameter.WithCause(sql.ErrTxDone), sql.ErrTxDone))
+}
+
+func TestFmtCause(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	err := errors.Fmt(fmt.Errorf("call: %w", ctx.Err()))
+	assert.Equal(t, errors.TimeOut.Code, err.Code)
+	assert.True(t, stderrors.Is(err, context.DeadlineExceeded))
+
+	err = errors.Fmt(sql.ErrConnDone)
+	assert.Equal(t, errors.System.Code, err.Code)
+	assert.True(t, stderrors.Is(err, sql.ErrConnDone))
+	assert.True(t, stderrors.Is(errors.IfNotNil(errors.Database, sql.ErrConnDone), sql.ErrConnDone))
+}
+
+func TestRpcCause(t *testing.T) {
+	err := errors.Fmt(errors.ToRpc(errors.Wrap(sql.ErrNoRows, errors.NotFind), ""))
+	assert.Equal(t, errors.NotFind.Code, err.Code)
+	assert.Equal(t, sql.ErrNoRows.Error(), err.Cause)
+	assert.Nil(t, err.Unwrap(), "跨服务只保留原始错误的文本")
+	assert.True(t, stderrors.Is(err, errors.NotFind))
+
+	err = errors.Fmt(errors.Parameter.ToRpc(""))
+	assert.Empty(t, err.Cause)
+	assert.Empty(t, err.Stack)
+}
+
+func TestStackEnable(t *testing.T) {
+	assert.Empty(t, errors.System.AddDetail("a").Stack, "默认不记录调用栈")
+	assert.NotEmpty(t, errors.System.WithStack(0).Stack)
+
+	errors.SetStackEnable(true)
+	defer errors.SetStackEnable(false)
+	assert.Len(t, errors.System.AddDetail("a").AddDetailf("%s", "b").Stack, 2)
+	err := errors.Wrap(sql.ErrNoRows, errors.NotFind)
+	require.Len(t, err.Stack, 1)
+	assert.Contains(t, err.Stack[0], "wrap_test.go")
+
+	back := errors.Fmt(errors.ToRpc(err, ""))
+	assert.Equal(t, err.Stack, back.Stack)
+}
@@ -58,29 +58,34 @@ func GetEventMsg(data []byte) EventHandle {
 }
 
 func (m *MsgHead) GetCtx() context.Context {
+	return m.WithCtx(context.Background())
+}
+
+// WithCtx 将消息中的链路信息及用户上下文注入到ctx中,链路信息解析失败时只注入用户上下文
+func (m *MsgHead) WithCtx(ctx context.Context) context.Context {
 	var msg MySpanContextConfig
 	err := json.Unmarshal([]byte(m.Trace), &msg)
 	if err != nil {
 		logx.Errorf("[GetCtx]|json Unmarshal trace.SpanContextConfig MsgHead:%v  err:%v", utils.Fmt(m), err)
-		return context.Background()
+		return ctxs.SetUserCtx(ctx, m.UserCtx)
 	}
 	//将MsgHead 中的msg链路信息 重新注入ctx中并返回
 	t, err := trace.TraceIDFromHex(msg.TraceID)
 	if err != nil {
 		logx.Errorf("[GetCtx]|TraceIDFromHex MsgHead:%v  err:%v", utils.Fmt(m), err)
-		return context.Background()
+		return ctxs.SetUserCtx(ctx, m.UserCtx)
 	}
 	s, err := trace.SpanIDFromHex(msg.SpanID)
 	if err != nil {
 		logx.Errorf("[GetCtx]|SpanIDFromHex MsgHead:%v  err:%v", utils.Fmt(m), err)
-		return context.Background()
+		return ctxs.SetUserCtx(ctx, m.UserCtx)
 	}
 	parent := trace.NewSpanContext(trace.SpanContextConfig{
 		TraceID:    t,
 		SpanID:     s,
 		TraceFlags: 0x1,
 	})
-	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+	ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
 	return ctxs.SetUserCtx(ctx, m.UserCtx)
 }
 
@@ -0,0 +1,71 @@
+// i18n 提取源码中的错误信息到语言文件,并检查缺少的翻译
+//
+//	go run gitee.com/unitedrhino/share/i18ns/cmd/i18n extract -src . -locale errors/locale
+//	go run gitee.com/unitedrhino/share/i18ns/cmd/i18n check -src . -locale errors/locale
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gitee.com/unitedrhino/share/i18ns"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	fset := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	src := fset.String("src", ".", "源码目录")
+	locale := fset.String("locale", "locale", "语言文件目录")
+	prune := fset.Bool("prune", false, "extract时删除源码中已经没有的消息")
+	fset.Parse(os.Args[2:])
+
+	msgs, err := i18ns.Extract(*src)
+	if err != nil {
+		fatal(err)
+	}
+	switch os.Args[1] {
+	case "extract":
+		if err := i18ns.WriteCatalogs(*locale, msgs, *prune); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("提取了%d条消息到%s\n", len(msgs), *locale)
+	case "check":
+		results, err := i18ns.Check(msgs, os.DirFS(filepath.Dir(*locale)), filepath.Base(*locale))
+		if err != nil {
+			fatal(err)
+		}
+		var missing int
+		for _, r := range results {
+			fmt.Printf("%s: 缺少%d条翻译,%d条消息已不再使用\n", r.Lang, len(r.Missing), len(r.Unused))
+			for _, id := range r.Missing {
+				pos := msgs[id].Pos
+				sort.Strings(pos)
+				fmt.Printf("  missing %q (%s)\n", id, pos[0])
+			}
+			for _, id := range r.Unused {
+				fmt.Printf("  unused  %q\n", id)
+			}
+			missing += len(r.Missing)
+		}
+		if missing > 0 {
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: i18n extract|check [-src dir] [-locale dir] [-prune]")
+	os.Exit(2)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,290 @@
+package i18ns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// Message 源码中提取出的消息
+type Message struct {
+	ID     string
+	Plural bool     //是否是复数消息
+	Pos    []string //出现的位置 file:line
+}
+
+// CheckResult 一个语言文件的检查结果
+type CheckResult struct {
+	Lang    string
+	File    string
+	Missing []string //缺少翻译的消息
+	Unused  []string //源码中已经没有的消息
+}
+
+type extractFunc struct {
+	arg    int //消息所在的参数位置
+	plural bool
+}
+
+// 需要提取消息的函数,只提取字符串字面量
+var extractFuncs = map[string]extractFunc{
+	"NewCodeError":    {arg: 1},
+	"NewDefaultError": {arg: 0},
+	"WithMsg":         {arg: 0},
+	"WithMsgf":        {arg: 0},
+	"AddMsg":          {arg: 0},
+	"AddMsgf":         {arg: 0},
+	"AddMsgTpl":       {arg: 0},
+	"AddMsgPlural":    {arg: 0, plural: true},
+}
+
+var unmarshalFuncs = map[string]i18n.UnmarshalFunc{"json": json.Unmarshal}
+
+// Extract 提取root下所有go文件(不含测试文件)中的错误信息
+func Extract(root string) (map[string]*Message, error) {
+	var msgs = map[string]*Message{}
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			var funcName string
+			switch fun := call.Fun.(type) {
+			case *ast.Ident:
+				funcName = fun.Name
+			case *ast.SelectorExpr:
+				funcName = fun.Sel.Name
+			}
+			ef, ok := extractFuncs[funcName]
+			if !ok || len(call.Args) <= ef.arg {
+				return true
+			}
+			lit, ok := call.Args[ef.arg].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			id, err := strconv.Unquote(lit.Value)
+			if err != nil || id == "" {
+				return true
+			}
+			m := msgs[id]
+			if m == nil {
+				m = &Message{ID: id}
+				msgs[id] = m
+			}
+			m.Plural = m.Plural || ef.plural
+			m.Pos = append(m.Pos, fmt.Sprintf("%s:%d", filepath.ToSlash(rel), fset.Position(lit.Pos()).Line))
+			return true
+		})
+		return nil
+	})
+	return msgs, err
+}
+
+// WriteCatalogs 将消息写入dir下的语言文件:中文文件以消息ID作为翻译,
+// 其他语言文件保留已有的翻译,缺少的消息以空字符串补齐,prune为true时删除源码中已经没有的消息
+func WriteCatalogs(dir string, msgs map[string]*Message, prune bool) error {
+	zhFile := filepath.Join(dir, DefaultLanguage.String()+".json")
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(files, zhFile) {
+		files = append(files, zhFile)
+	}
+	for _, file := range files {
+		catalog, err := readCatalog(file)
+		if err != nil {
+			return err
+		}
+		if prune {
+			for id := range catalog {
+				if _, ok := msgs[id]; !ok {
+					delete(catalog, id)
+				}
+			}
+		}
+		tag := langOfFile(file)
+		for id, m := range msgs {
+			if tag == DefaultLanguage {
+				catalog[id], _ = marshalNoEscape(id)
+				continue
+			}
+			if _, ok := catalog[id]; ok {
+				continue
+			}
+			if !m.Plural {
+				catalog[id] = json.RawMessage(`""`)
+				continue
+			}
+			forms := map[string]string{}
+			for _, form := range PluralForms(tag) {
+				forms[form] = ""
+			}
+			catalog[id], _ = marshalNoEscape(forms)
+		}
+		data, err := marshalNoEscape(catalog)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "\t"); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check 检查dir下除中文外的语言文件缺少的翻译,复数消息需要包含该语言所有的复数形式
+func Check(msgs map[string]*Message, fsys fs.FS, dir string) ([]*CheckResult, error) {
+	dirs, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*CheckResult
+	for _, v := range dirs {
+		if v.IsDir() || !strings.HasSuffix(v.Name(), ".json") {
+			continue
+		}
+		file := dir + "/" + v.Name()
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		mf, err := i18n.ParseMessageFileBytes(data, file, unmarshalFuncs)
+		if err != nil {
+			return nil, err
+		}
+		if mf.Tag == DefaultLanguage {
+			continue
+		}
+		result := CheckResult{Lang: mf.Tag.String(), File: file}
+		var translated = map[string]*i18n.Message{}
+		for _, m := range mf.Messages {
+			translated[m.ID] = m
+			if _, ok := msgs[m.ID]; !ok {
+				result.Unused = append(result.Unused, m.ID)
+			}
+		}
+		for id, m := range msgs {
+			if !isTranslated(translated[id], m.Plural, mf.Tag) {
+				result.Missing = append(result.Missing, id)
+			}
+		}
+		sort.Strings(result.Missing)
+		sort.Strings(result.Unused)
+		ret = append(ret, &result)
+	}
+	return ret, nil
+}
+
+// PluralForms 语言用到的复数形式,go-i18n的复数规则在internal包中,这里通过翻译探测
+func PluralForms(tag language.Tag) []string {
+	bundle := i18n.NewBundle(tag)
+	if err := bundle.AddMessages(tag, &i18n.Message{ID: "p",
+		Zero: "zero", One: "one", Two: "two", Few: "few", Many: "many", Other: "other"}); err != nil {
+		return []string{"other"}
+	}
+	localizer := i18n.NewLocalizer(bundle, tag.String())
+	var set = map[string]struct{}{}
+	for _, count := range []any{0, 1, 2, 3, 4, 5, 6, 11, 12, 21, 22, 100, 101, 1000000, "1.5"} {
+		form, err := localizer.Localize(&i18n.LocalizeConfig{MessageID: "p", PluralCount: count})
+		if err == nil {
+			set[form] = struct{}{}
+		}
+	}
+	var forms []string
+	for _, form := range []string{"zero", "one", "two", "few", "many", "other"} {
+		if _, ok := set[form]; ok {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
+
+func isTranslated(m *i18n.Message, plural bool, tag language.Tag) bool {
+	if m == nil {
+		return false
+	}
+	if !plural {
+		return m.Other != ""
+	}
+	var forms = map[string]string{"zero": m.Zero, "one": m.One, "two": m.Two, "few": m.Few, "many": m.Many, "other": m.Other}
+	for _, form := range PluralForms(tag) {
+		if forms[form] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func readCatalog(file string) (map[string]json.RawMessage, error) {
+	var catalog = map[string]json.RawMessage{}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return catalog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return catalog, nil
+}
+
+func langOfFile(file string) language.Tag {
+	name := strings.TrimSuffix(filepath.Base(file), ".json")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	tag, _ := language.Parse(name)
+	return tag
+}
+
+func marshalNoEscape(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
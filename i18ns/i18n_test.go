@@ -0,0 +1,126 @@
+package i18ns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+const testSrc = `package demo
+
+import "gitee.com/unitedrhino/share/errors"
+
+var (
+	Bound   = errors.NewCodeError(100, "设备已被绑定")
+	Offline = errors.NewCodeError(101, "设备离线")
+)
+
+func f(name string, n int) error {
+	_ = errors.Parameter.AddMsg(name)
+	_ = errors.Parameter.AddMsgf("设备%s不存在", name)
+	return errors.Parameter.AddMsgPlural("还有{{.Count}}台设备未绑定", n, nil).WithMsg("设备离线")
+}
+`
+
+func TestExtract(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "demo"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "testdata"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "demo", "err.go"), []byte(testSrc), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "demo", "err_test.go"), []byte(`package demo
+var _ = errors.NewCodeError(1, "测试")`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "testdata", "a.go"), []byte(testSrc), 0644))
+
+	msgs, err := Extract(root)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 4)
+	assert.Equal(t, []string{"demo/err.go:7", "demo/err.go:13"}, msgs["设备离线"].Pos)
+	assert.True(t, msgs["还有{{.Count}}台设备未绑定"].Plural)
+	assert.Contains(t, msgs, "设备%s不存在")
+
+	locale := filepath.Join(root, "locale")
+	require.NoError(t, os.MkdirAll(locale, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(locale, "en.json"), []byte(`{"设备离线": "device offline", "旧的消息": "old"}`), 0644))
+	require.NoError(t, WriteCatalogs(locale, msgs, false))
+
+	results, err := Check(msgs, os.DirFS(root), "locale")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "en", results[0].Lang)
+	assert.Equal(t, []string{"设备%s不存在", "设备已被绑定", "还有{{.Count}}台设备未绑定"}, results[0].Missing)
+	assert.Equal(t, []string{"旧的消息"}, results[0].Unused)
+
+	data, err := os.ReadFile(filepath.Join(locale, "en.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"还有{{.Count}}台设备未绑定": {`)
+	assert.Contains(t, string(data), `"one": ""`)
+	data, err = os.ReadFile(filepath.Join(locale, "zh.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"设备已被绑定": "设备已被绑定"`)
+
+	//只翻译了other的复数消息依然缺少one
+	require.NoError(t, os.WriteFile(filepath.Join(locale, "en.json"), []byte(`{
+	"设备离线": "device offline",
+	"设备已被绑定": "device is already bound",
+	"设备%s不存在": "device %s does not exist",
+	"还有{{.Count}}台设备未绑定": {"other": "{{.Count}} devices are not bound"}
+}`), 0644))
+	results, err = Check(msgs, os.DirFS(root), "locale")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"还有{{.Count}}台设备未绑定"}, results[0].Missing)
+
+	require.NoError(t, WriteCatalogs(locale, msgs, true))
+	results, err = Check(msgs, os.DirFS(root), "locale")
+	require.NoError(t, err)
+	assert.Empty(t, results[0].Unused)
+}
+
+func TestPluralForms(t *testing.T) {
+	assert.Equal(t, []string{"other"}, PluralForms(language.Chinese))
+	assert.Equal(t, []string{"one", "other"}, PluralForms(language.English))
+	assert.Equal(t, []string{"one", "few", "many", "other"}, PluralForms(language.Russian))
+}
+
+func TestLoadLocaleFS(t *testing.T) {
+	bundle := InitWithLocaleFS(fstest.MapFS{
+		"locale/en.json": {Data: []byte(`{"成功": "success", "还有{{.Count}}台设备未绑定": {"one": "{{.Count}} device is not bound", "other": "{{.Count}} devices are not bound"}}`)},
+		"locale/zh.json": {Data: []byte(`{"成功": "成功了"}`)},
+		"locale/readme":  {Data: []byte("not json")},
+	}, "locale")
+	zh := i18n.NewLocalizer(bundle, "zh")
+	en := i18n.NewLocalizer(bundle, "en")
+	assert.Equal(t, "成功了", zh.MustLocalize(&i18n.LocalizeConfig{MessageID: "成功"}))
+	assert.Equal(t, "success", en.MustLocalize(&i18n.LocalizeConfig{MessageID: "成功"}))
+	id := "还有{{.Count}}台设备未绑定"
+	assert.Equal(t, "还有2台设备未绑定", zh.MustLocalize(&i18n.LocalizeConfig{MessageID: id, PluralCount: 2, TemplateData: map[string]any{"Count": 2}}))
+	assert.Equal(t, "1 device is not bound", en.MustLocalize(&i18n.LocalizeConfig{MessageID: id, PluralCount: 1, TemplateData: map[string]any{"Count": 1}}))
+
+	//合并的语言文件覆盖已有的翻译
+	require.NoError(t, LoadLocaleFS(bundle, fstest.MapFS{
+		"i18n/en.json": {Data: []byte(`{"成功": "ok", "失败": "failed"}`)},
+	}, "i18n"))
+	assert.Equal(t, "ok", en.MustLocalize(&i18n.LocalizeConfig{MessageID: "成功"}))
+	assert.Equal(t, "成功了", zh.MustLocalize(&i18n.LocalizeConfig{MessageID: "成功"}))
+	assert.Equal(t, "失败", zh.MustLocalize(&i18n.LocalizeConfig{MessageID: "失败"}))
+	assert.Error(t, LoadLocaleFS(bundle, fstest.MapFS{}, "none"))
+}
+
+func TestMatcher(t *testing.T) {
+	bundle := InitWithLocaleFS(fstest.MapFS{
+		"locale/en.json": {Data: []byte(`{"成功": "success"}`)},
+	}, "locale")
+	m := NewMatcher(bundle)
+	assert.Equal(t, language.English, m.Match("en-US,en;q=0.9"))
+	assert.Equal(t, language.English, m.Match("fr-FR,en;q=0.5"))
+	assert.Equal(t, language.Chinese, m.Match("zh-CN,zh;q=0.9,en;q=0.8"))
+	assert.Equal(t, language.English, m.Match("fr", "", "en"), "不支持时使用后面的语言")
+	assert.Equal(t, language.Chinese, m.Match("fr", "de"))
+	assert.Equal(t, language.Chinese, m.Match("!!!"))
+	assert.Equal(t, language.Chinese, m.Match())
+}
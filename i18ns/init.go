@@ -1,35 +1,63 @@
 package i18ns
 
 import (
-	"embed"
 	"encoding/json"
+	"errors"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/zeromicro/go-zero/core/logx"
 	"golang.org/x/text/language"
 	"io/fs"
+	"path"
+	"strings"
 )
 
-func InitWithLocaleFS(LocaleFS embed.FS, dir string) *i18n.Bundle {
-	dirs, err := LocaleFS.ReadDir(dir)
-	logx.Must(err)
-	bundle := i18n.NewBundle(language.Chinese)
+// DefaultLanguage 源码中的消息都是中文,中文的语言文件以消息ID作为翻译
+var DefaultLanguage = language.Chinese
+
+func NewBundle() *i18n.Bundle {
+	bundle := i18n.NewBundle(DefaultLanguage)
 	bundle.RegisterUnmarshalFunc("json", json.Unmarshal)
-	var dataOne = map[string]string{}
+	return bundle
+}
+
+// InitWithLocaleFS 加载目录下的语言文件
+func InitWithLocaleFS(LocaleFS fs.FS, dir string) *i18n.Bundle {
+	bundle := NewBundle()
+	logx.Must(LoadLocaleFS(bundle, LocaleFS, dir))
+	return bundle
+}
+
+// LoadLocaleFS 将目录下的json语言文件合并到bundle中,同一个消息后加载的覆盖先加载的.
+// 其他语言有而中文没有的消息以消息ID作为中文
+func LoadLocaleFS(bundle *i18n.Bundle, fsys fs.FS, dir string) error {
+	dirs, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	var ids = map[string]struct{}{}
 	for _, v := range dirs {
-		path := dir + "/" + v.Name()
-		_, err = bundle.LoadMessageFileFS(LocaleFS, path)
-		logx.Must(err)
+		if v.IsDir() || !strings.HasSuffix(v.Name(), ".json") {
+			continue
+		}
+		mf, err := bundle.LoadMessageFileFS(fsys, path.Join(dir, v.Name()))
+		if err != nil {
+			return err
+		}
+		if mf.Tag == DefaultLanguage {
+			continue
+		}
+		for _, m := range mf.Messages {
+			ids[m.ID] = struct{}{}
+		}
 	}
-	path := dir + "/" + dirs[0].Name()
-	data, err := fs.ReadFile(LocaleFS, path)
-	logx.Must(err)
-	json.Unmarshal(data, &dataOne)
-	for k := range dataOne {
-		dataOne[k] = k
+	localizer := i18n.NewLocalizer(bundle, DefaultLanguage.String())
+	var msgs []*i18n.Message
+	for id := range ids {
+		_, err := localizer.LocalizeMessage(&i18n.Message{ID: id})
+		var notFound *i18n.MessageNotFoundErr
+		if errors.As(err, &notFound) {
+			msgs = append(msgs, &i18n.Message{ID: id, Other: id})
+		}
 	}
-	data, err = json.Marshal(dataOne)
-	logx.Must(err)
-	_, err = bundle.ParseMessageFileBytes(data, "zh.json")
-	logx.Must(err)
-	return bundle
+	return bundle.AddMessages(DefaultLanguage, msgs...)
 }
@@ -0,0 +1,36 @@
+package i18ns
+
+import (
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// Matcher 根据Accept-Language协商bundle中支持的语言
+type Matcher struct {
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+// NewMatcher bundle加载新的语言后需要重新创建
+func NewMatcher(bundle *i18n.Bundle) *Matcher {
+	tags := bundle.LanguageTags()
+	return &Matcher{tags: tags, matcher: language.NewMatcher(tags)}
+}
+
+// Match 依次尝试accepts(如用户的Accept-Language,服务配置的默认语言),都不支持时返回bundle的默认语言
+func (m *Matcher) Match(accepts ...string) language.Tag {
+	for _, accept := range accepts {
+		if accept == "" {
+			continue
+		}
+		tags, _, err := language.ParseAcceptLanguage(accept)
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+		_, i, confidence := m.matcher.Match(tags...)
+		if confidence != language.No {
+			return m.tags[i]
+		}
+	}
+	return m.tags[0]
+}
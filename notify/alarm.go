@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitee.com/unitedrhino/share/eventBus"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	AlarmModeTrigger = "trigger" //触发告警
+	AlarmModeRelieve = "relieve" //解除告警
+)
+
+// AlarmConverter 将告警消息转换为通知,返回nil时不通知
+type AlarmConverter func(ctx context.Context, mode string, body []byte) (*Notification, error)
+
+// SubscribeAlarm 订阅规则引擎的告警通知(eventBus.UdRuleAlarmNotify),同一个服务的多个节点只有一个会收到
+func (d *Dispatcher) SubscribeAlarm(fe *eventBus.FastEvent, conv AlarmConverter) error {
+	for _, mode := range []string{AlarmModeTrigger, AlarmModeRelieve} {
+		err := fe.QueueSubscribe(fmt.Sprintf(eventBus.UdRuleAlarmNotify, mode), func(ctx context.Context, t time.Time, body []byte) error {
+			n, err := conv(ctx, mode, body)
+			if err != nil {
+				logx.WithContext(ctx).Errorf("notify alarm convert mode:%v body:%v err:%v", mode, string(body), err)
+				return err
+			}
+			if n == nil {
+				return nil
+			}
+			if n.Time.IsZero() {
+				n.Time = t
+			}
+			_, err = d.Dispatch(ctx, n)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
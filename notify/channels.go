@@ -0,0 +1,240 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitee.com/unitedrhino/share/clients/dingClient"
+	"gitee.com/unitedrhino/share/clients/smsClient"
+	"gitee.com/unitedrhino/share/clients/wxClient"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/tools"
+	"gitee.com/unitedrhino/share/utils"
+)
+
+// SmsChannel 短信,使用模板的SmsTemplateCode及通知参数发送
+// 腾讯云等按参数顺序填充模板,多出的参数会错位,所以只发送模板声明的参数
+type SmsChannel struct {
+	Sms *smsClient.Sms
+}
+
+func (c *SmsChannel) Type() def.NotifyType {
+	return def.NotifyTypeSms
+}
+
+func (c *SmsChannel) Send(ctx context.Context, msg *Message) error {
+	code := msg.Template.SmsTemplateCode
+	if code == "" {
+		code = msg.Template.Code
+	}
+	return c.Sms.SendSms(ctx, smsClient.SendSmsParam{
+		PhoneNumbers:  []string{msg.To},
+		TemplateCode:  code,
+		TemplateParam: smsParams(msg),
+	})
+}
+
+func smsParams(msg *Message) map[string]any {
+	if len(msg.Template.SmsParams) == 0 {
+		return msg.Notification.Params
+	}
+	params := make(map[string]any, len(msg.Template.SmsParams))
+	for _, k := range msg.Template.SmsParams {
+		if v, ok := msg.Params[k]; ok {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+type EmailChannel struct {
+	Conf conf.Email
+}
+
+func (c *EmailChannel) Type() def.NotifyType {
+	return def.NotifyTypeEmail
+}
+
+func (c *EmailChannel) Send(ctx context.Context, msg *Message) error {
+	return utils.SendEmail(c.Conf, []string{msg.To}, msg.Subject, msg.Body)
+}
+
+// DingRobotChannel 钉钉群机器人,地址为机器人的webhook地址或access_token
+type DingRobotChannel struct{}
+
+func (c *DingRobotChannel) Type() def.NotifyType {
+	return def.NotifyTypeDingWebhook
+}
+
+func (c *DingRobotChannel) Send(ctx context.Context, msg *Message) error {
+	robot := dingClient.NewDingRobotClient(msg.To)
+	ret, err := robot.SendRobotMsg(dingClient.NewTextMessage(msg.Body))
+	if err != nil {
+		return err
+	}
+	if ret.Code != 0 {
+		return errors.System.AddDetailf("ding robot code:%d msg:%s", ret.Code, ret.Msg)
+	}
+	return nil
+}
+
+// WxRobotChannel 企业微信群机器人,地址为机器人的webhook地址或key
+type WxRobotChannel struct{}
+
+func (c *WxRobotChannel) Type() def.NotifyType {
+	return def.NotifyTypeWxEWebhook
+}
+
+func (c *WxRobotChannel) Send(ctx context.Context, msg *Message) error {
+	return wxClient.SendRobotMsg(ctx, msg.To, msg.Body)
+}
+
+// Publisher websocket推送,websocket.UserSubscribe实现了这个接口
+type Publisher interface {
+	Publish(ctx context.Context, code string, data any, params ...map[string]any) error
+}
+
+// WebsocketChannel 推送给用户的websocket连接,订阅参数为 {"userID":用户ID}
+type WebsocketChannel struct {
+	Publisher Publisher
+	Code      string //订阅的编码,默认为notify
+}
+
+func (c *WebsocketChannel) Type() def.NotifyType {
+	return def.NotifyTypeWebsocket
+}
+
+func (c *WebsocketChannel) Send(ctx context.Context, msg *Message) error {
+	code := c.Code
+	if code == "" {
+		code = "notify"
+	}
+	return c.Publisher.Publish(ctx, code, newWebhookBody(msg), map[string]any{"userID": msg.Recipient.UserID})
+}
+
+// WebhookChannel 以json POST到接收人的webhook地址,2xx表示成功
+// 地址由接收人填写,只允许http(s),并在连接时拒绝内网、回环及链路本地地址,防止请求打到内部服务
+type WebhookChannel struct {
+	Client     *http.Client //不填使用10秒超时的默认客户端,自定义客户端需自行限制连接的地址
+	AllowHosts []string     //允许的主机名,填了后只能发给这些主机,且允许是内网地址
+	once       sync.Once
+	cli        *http.Client
+}
+
+type WebhookBody struct {
+	ID      string         `json:"id"`
+	Code    string         `json:"code"`
+	Key     string         `json:"key"`
+	Subject string         `json:"subject"`
+	Body    string         `json:"body"`
+	Params  map[string]any `json:"params"`
+	Time    int64          `json:"time"` //毫秒时间戳
+}
+
+func newWebhookBody(msg *Message) *WebhookBody {
+	n := msg.Notification
+	return &WebhookBody{ID: n.ID, Code: n.Code, Key: n.Key, Subject: msg.Subject, Body: msg.Body, Params: msg.Params, Time: n.Time.UnixMilli()}
+}
+
+func (c *WebhookChannel) Type() def.NotifyType {
+	return def.NotifyTypeWebhook
+}
+
+func (c *WebhookChannel) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	c.once.Do(func() {
+		dialer := &net.Dialer{Timeout: 5 * time.Second, Control: c.checkDial}
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.Proxy = nil //走代理时连接的是代理地址,无法校验目标地址
+		tr.DialContext = dialer.DialContext
+		c.cli = &http.Client{Timeout: 10 * time.Second, Transport: tr,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 3 {
+					return http.ErrUseLastResponse
+				}
+				return c.checkURL(req.URL)
+			}}
+	})
+	return c.cli
+}
+
+func (c *WebhookChannel) allowHost(host string) bool {
+	return len(c.AllowHosts) != 0 && slices.Contains(c.AllowHosts, strings.ToLower(host))
+}
+
+func (c *WebhookChannel) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Parameter.AddDetailf("webhook scheme not allowed:%s", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.Parameter.AddDetail("webhook host is empty")
+	}
+	if len(c.AllowHosts) != 0 && !c.allowHost(u.Hostname()) {
+		return errors.Parameter.AddDetailf("webhook host not allowed:%s", u.Hostname())
+	}
+	return nil
+}
+
+// checkDial 在连接时校验解析后的地址,防止域名解析到内网(DNS重绑定)
+func (c *WebhookChannel) checkDial(network, address string, _ syscall.RawConn) error {
+	if len(c.AllowHosts) != 0 {
+		return nil //白名单已在checkURL中校验过主机名
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if tools.IsPrivateIp(addr) {
+		return errors.Parameter.AddDetailf("webhook address not allowed:%s", host)
+	}
+	return nil
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, msg *Message) error {
+	u, err := url.Parse(msg.To)
+	if err != nil {
+		return errors.Parameter.AddDetail(err)
+	}
+	if err := c.checkURL(u); err != nil {
+		return err
+	}
+	cli := c.client()
+	body, err := json.Marshal(newWebhookBody(msg))
+	if err != nil {
+		return errors.Parameter.AddDetail(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return errors.Parameter.AddDetail(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cli.Do(req)
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.System.AddDetailf("webhook status:%d body:%s", resp.StatusCode, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Notification 一次通知,如一次设备告警
+type Notification struct {
+	ID         string           `json:"id"` //不填时自动生成
+	Code       def.NotifyCode   `json:"code"`
+	Key        string           `json:"key"`    //去重及聚合的维度,如告警配置ID+设备,不填时不去重
+	Params     map[string]any   `json:"params"` //模板参数
+	Recipients []*Recipient     `json:"recipients"`
+	Channels   []def.NotifyType `json:"channels"` //不填时使用该通知配置了模板的所有通道
+	Urgent     bool             `json:"urgent"`   //紧急通知不受免打扰时段限制
+	Time       time.Time        `json:"time"`
+}
+
+// Recipient 接收人,可以是用户,也可以是机器人、webhook等接收地址
+type Recipient struct {
+	UserID  int64                     `json:"userID"`
+	Name    string                    `json:"name"`
+	Phone   string                    `json:"phone"`
+	Email   string                    `json:"email"`
+	Address map[def.NotifyType]string `json:"address"` //其他通道的接收地址,如钉钉及企业微信机器人、webhook的地址
+}
+
+// To 获取接收人在通道上的地址,为空表示不能通过该通道接收
+func (r *Recipient) To(t def.NotifyType) string {
+	switch t {
+	case def.NotifyTypeSms:
+		return r.Phone
+	case def.NotifyTypeEmail:
+		return r.Email
+	case def.NotifyTypeWebsocket:
+		if r.UserID == 0 {
+			return ""
+		}
+		return strconv.FormatInt(r.UserID, 10)
+	}
+	return r.Address[t]
+}
+
+// Template 通知在一个通道上的模板,Subject及Body使用text/template语法,参数为Notification.Params
+type Template struct {
+	Code            def.NotifyCode
+	Channel         def.NotifyType
+	Subject         string //邮件标题等
+	Body            string
+	SmsTemplateCode string   //短信使用服务商模板,为smsClient的逻辑模板编码,不填使用Code
+	SmsParams       []string //短信模板的参数名,不填只发送通知自己的参数(不含recipientName等注入参数)
+	subject         *template.Template
+	body            *template.Template
+}
+
+// Message 发给通道的消息
+type Message struct {
+	Notification *Notification
+	Recipient    *Recipient
+	Template     *Template
+	To           string
+	Subject      string
+	Body         string
+	Params       map[string]any
+}
+
+// Channel 通知通道
+type Channel interface {
+	Type() def.NotifyType
+	Send(ctx context.Context, msg *Message) error
+}
+
+// RecipientResolver 根据通知查找接收人,如告警配置的通知人
+type RecipientResolver interface {
+	Resolve(ctx context.Context, n *Notification) ([]*Recipient, error)
+}
+
+type DeliveryStatus = string
+
+const (
+	DeliverySuccess DeliveryStatus = "success"
+	DeliveryFail    DeliveryStatus = "fail"
+	DeliverySkip    DeliveryStatus = "skip"  //接收人没有该通道的地址、关闭了该通道或者通道没有配置
+	DeliveryQuiet   DeliveryStatus = "quiet" //免打扰时段不发送
+	DeliveryDedup   DeliveryStatus = "dedup" //去重窗口内重复的通知,计入窗口后第一条通知的聚合次数
+)
+
+// Delivery 每个接收人每个通道的发送记录
+type Delivery struct {
+	NotifyID string         `json:"notifyID"`
+	Code     def.NotifyCode `json:"code"`
+	Key      string         `json:"key"`
+	Channel  def.NotifyType `json:"channel"`
+	UserID   int64          `json:"userID"`
+	To       string         `json:"to"`
+	Status   DeliveryStatus `json:"status"`
+	Attempts int            `json:"attempts"` //发送次数,包括重试
+	Err      string         `json:"err"`
+	Time     time.Time      `json:"time"`
+}
+
+// DeliveryRepo 保存发送记录
+type DeliveryRepo interface {
+	SaveDeliveries(ctx context.Context, ds []*Delivery) error
+}
+
+const (
+	DefaultMaxRetry  = 2
+	DefaultRetryWait = time.Second
+
+	ParamAggregateCount = "aggregateCount" //模板参数:窗口内被合并的通知次数
+	ParamRecipientName  = "recipientName"  //模板参数:接收人名称
+)
+
+type Options struct {
+	Templates   []*Template
+	Window      time.Duration //去重及聚合窗口,为0时不去重
+	MaxRetry    int           //发送失败的重试次数,默认2,小于0不重试
+	RetryWait   time.Duration //第一次重试的等待时间,之后每次翻倍,默认1秒
+	Resolver    RecipientResolver
+	Preferences PreferenceRepo
+	Deliveries  DeliveryRepo
+}
+
+type Dispatcher struct {
+	opts      Options
+	channels  map[def.NotifyType]Channel
+	templates map[def.NotifyCode]map[def.NotifyType]*Template
+	mutex     sync.RWMutex
+	window    *window
+}
+
+func NewDispatcher(opts Options, channels ...Channel) (*Dispatcher, error) {
+	if opts.MaxRetry == 0 {
+		opts.MaxRetry = DefaultMaxRetry
+	}
+	if opts.RetryWait <= 0 {
+		opts.RetryWait = DefaultRetryWait
+	}
+	d := Dispatcher{
+		opts:      opts,
+		channels:  map[def.NotifyType]Channel{},
+		templates: map[def.NotifyCode]map[def.NotifyType]*Template{},
+		window:    newWindow(opts.Window),
+	}
+	for _, c := range channels {
+		d.channels[c.Type()] = c
+	}
+	for _, t := range opts.Templates {
+		if err := d.SetTemplate(t); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// SetTemplate 设置通知在一个通道上的模板,已有的会被替换
+func (d *Dispatcher) SetTemplate(tpl *Template) error {
+	var (
+		t   = *tpl
+		err error
+	)
+	t.subject, err = template.New("subject").Parse(t.Subject)
+	if err != nil {
+		return errors.Parameter.AddDetailf("notify template %s/%s subject err:%v", t.Code, t.Channel, err)
+	}
+	t.body, err = template.New("body").Parse(t.Body)
+	if err != nil {
+		return errors.Parameter.AddDetailf("notify template %s/%s body err:%v", t.Code, t.Channel, err)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.templates[t.Code] == nil {
+		d.templates[t.Code] = map[def.NotifyType]*Template{}
+	}
+	d.templates[t.Code][t.Channel] = &t
+	return nil
+}
+
+func (d *Dispatcher) getTemplates(code def.NotifyCode) map[def.NotifyType]*Template {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.templates[code]
+}
+
+// Dispatch 发送通知,返回每个接收人每个通道的发送记录,单个通道发送失败记录在Delivery中不返回错误
+func (d *Dispatcher) Dispatch(ctx context.Context, n *Notification) ([]*Delivery, error) {
+	if n.ID == "" {
+		n.ID = uuid.NewString()
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	recipients := n.Recipients
+	if d.opts.Resolver != nil {
+		rs, err := d.opts.Resolver.Resolve(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(slices.Clone(recipients), rs...)
+	}
+	templates := d.getTemplates(n.Code)
+	channels := n.Channels
+	if len(channels) == 0 {
+		channels = lo.Keys(templates)
+		slices.Sort(channels)
+	}
+	var (
+		deliveries []*Delivery
+		wg         sync.WaitGroup
+	)
+	for _, r := range uniqRecipients(recipients) {
+		pref, err := d.getPreference(ctx, r, n.Code)
+		if err != nil { //获取失败时按没有设置偏好发送
+			logx.WithContext(ctx).Errorf("notify getPreference userID:%v err:%v", r.UserID, err)
+		}
+		for _, ch := range channels {
+			dl := &Delivery{NotifyID: n.ID, Code: n.Code, Key: n.Key, Channel: ch, UserID: r.UserID, To: r.To(ch), Time: n.Time}
+			deliveries = append(deliveries, dl)
+			tpl, c := templates[ch], d.channels[ch]
+			switch {
+			case tpl == nil || c == nil:
+				dl.Status, dl.Err = DeliverySkip, "channel or template not configured"
+				continue
+			case dl.To == "":
+				dl.Status, dl.Err = DeliverySkip, "recipient has no address"
+				continue
+			case !pref.Allow(ch):
+				dl.Status = DeliverySkip
+				dl.Err = "disabled by user"
+				continue
+			case !n.Urgent && pref.Quiet(ch, n.Time):
+				dl.Status = DeliveryQuiet
+				continue
+			}
+			params := lo.Assign(n.Params, map[string]any{ParamRecipientName: r.Name})
+			var (
+				windowKey string
+				count     int64
+			)
+			if n.Key != "" {
+				var send bool
+				windowKey = n.Code + ":" + n.Key + ":" + ch + ":" + dl.To
+				send, count = d.window.take(ctx, windowKey, n.Time)
+				if !send {
+					dl.Status = DeliveryDedup
+					continue
+				}
+				params[ParamAggregateCount] = count
+			}
+			msg := Message{Notification: n, Recipient: r, Template: tpl, To: dl.To, Params: params}
+			if err := tpl.render(&msg); err != nil {
+				dl.Status, dl.Err = DeliveryFail, err.Error()
+				if windowKey != "" {
+					d.window.release(ctx, windowKey, count, n.Time)
+				}
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.send(ctx, c, &msg, dl)
+				if dl.Status == DeliveryFail && windowKey != "" { //没有送达,不能让后续的通知被去重
+					d.window.release(ctx, windowKey, count, n.Time)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if d.opts.Deliveries != nil && len(deliveries) > 0 {
+		if err := d.opts.Deliveries.SaveDeliveries(ctx, deliveries); err != nil {
+			logx.WithContext(ctx).Errorf("notify SaveDeliveries notifyID:%v err:%v", n.ID, err)
+			return deliveries, err
+		}
+	}
+	return deliveries, nil
+}
+
+// 发送失败时按指数退避重试
+func (d *Dispatcher) send(ctx context.Context, c Channel, msg *Message, dl *Delivery) {
+	wait := d.opts.RetryWait
+	for {
+		dl.Attempts++
+		err := c.Send(ctx, msg)
+		if err == nil {
+			dl.Status, dl.Err = DeliverySuccess, ""
+			return
+		}
+		dl.Status, dl.Err = DeliveryFail, err.Error()
+		logx.WithContext(ctx).Errorf("notify send notifyID:%v channel:%v to:%v attempts:%v err:%v",
+			msg.Notification.ID, dl.Channel, dl.To, dl.Attempts, err)
+		if dl.Attempts > d.opts.MaxRetry {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (t *Template) render(msg *Message) error {
+	var buf bytes.Buffer
+	if t.subject != nil {
+		if err := t.subject.Execute(&buf, msg.Params); err != nil {
+			return err
+		}
+		msg.Subject = buf.String()
+		buf.Reset()
+	}
+	if t.body != nil {
+		if err := t.body.Execute(&buf, msg.Params); err != nil {
+			return err
+		}
+		msg.Body = buf.String()
+	}
+	return nil
+}
+
+// 同一个用户或同一组地址只发一次
+func uniqRecipients(rs []*Recipient) []*Recipient {
+	return lo.UniqBy(rs, func(r *Recipient) string {
+		if r.UserID != 0 {
+			return "user:" + strconv.FormatInt(r.UserID, 10)
+		}
+		return "addr:" + r.Phone + ":" + r.Email + ":" + fmtAddress(r.Address)
+	})
+}
+
+func fmtAddress(a map[def.NotifyType]string) string {
+	keys := lo.Keys(a)
+	slices.Sort(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString(k + "=" + a[k] + ";")
+	}
+	return buf.String()
+}
@@ -0,0 +1,239 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/clients/smsClient"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+type fakeChannel struct {
+	t     def.NotifyType
+	fails int //前几次发送失败
+	mutex sync.Mutex
+	msgs  []*Message
+	calls int
+}
+
+func (c *fakeChannel) Type() def.NotifyType { return c.t }
+
+func (c *fakeChannel) Send(ctx context.Context, msg *Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.calls++
+	if c.calls <= c.fails {
+		return errors.System.AddDetail("fail")
+	}
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+type fakeRepo struct {
+	prefs      map[int64]*Preference
+	deliveries []*Delivery
+}
+
+func (r *fakeRepo) Resolve(ctx context.Context, n *Notification) ([]*Recipient, error) {
+	return []*Recipient{{UserID: 1, Name: "张三", Phone: "138"}, {UserID: 2, Name: "李四", Email: "a@b.c"}}, nil
+}
+
+func (r *fakeRepo) GetPreference(ctx context.Context, userID int64, code def.NotifyCode) (*Preference, error) {
+	return r.prefs[userID], nil
+}
+
+func (r *fakeRepo) SaveDeliveries(ctx context.Context, ds []*Delivery) error {
+	r.deliveries = append(r.deliveries, ds...)
+	return nil
+}
+
+var alarmTemplates = []*Template{
+	{Code: def.NotifyCodeDeviceAlarm, Channel: def.NotifyTypeSms},
+	{Code: def.NotifyCodeDeviceAlarm, Channel: def.NotifyTypeEmail, Subject: "{{.device}}告警", Body: "{{.recipientName}}:{{.device}}温度过高{{if .aggregateCount}},期间又告警{{.aggregateCount}}次{{end}}"},
+}
+
+func TestDispatch(t *testing.T) {
+	sms, email := &fakeChannel{t: def.NotifyTypeSms}, &fakeChannel{t: def.NotifyTypeEmail, fails: 1}
+	repo := &fakeRepo{prefs: map[int64]*Preference{}}
+	d, err := NewDispatcher(Options{Templates: alarmTemplates, RetryWait: time.Millisecond,
+		Resolver: repo, Preferences: repo, Deliveries: repo}, sms, email)
+	require.NoError(t, err)
+	ctx := context.Background()
+	n := &Notification{Code: def.NotifyCodeDeviceAlarm, Params: map[string]any{"device": "d1"},
+		Recipients: []*Recipient{{UserID: 1, Phone: "138"}, {Address: map[def.NotifyType]string{def.NotifyTypeEmail: "g@b.c"}}}}
+	ds, err := d.Dispatch(ctx, n)
+	require.NoError(t, err)
+	require.Len(t, ds, 6, "3个接收人(用户1去重) * 2个通道")
+	assert.Equal(t, repo.deliveries, ds)
+	status := map[string]string{}
+	for _, dl := range ds {
+		assert.Equal(t, n.ID, dl.NotifyID)
+		status[dl.Channel+":"+dl.To] = dl.Status
+	}
+	assert.Equal(t, map[string]string{"sms:138": DeliverySuccess, "email:": DeliverySkip, "sms:": DeliverySkip, "email:a@b.c": DeliverySuccess}, status)
+	require.Len(t, sms.msgs, 1)
+	require.Len(t, email.msgs, 1)
+	assert.Equal(t, 2, email.calls, "失败后重试")
+	assert.Equal(t, "d1告警", email.msgs[0].Subject)
+	assert.Equal(t, "李四:d1温度过高", email.msgs[0].Body)
+
+	//用户偏好及免打扰
+	repo.prefs[1] = &Preference{Channels: []def.NotifyType{def.NotifyTypeEmail}}
+	repo.prefs[2] = &Preference{QuietHours: &QuietHours{Start: "22:00", End: "07:00"}}
+	night := time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	ds, err = d.Dispatch(ctx, &Notification{Code: def.NotifyCodeDeviceAlarm, Channels: []def.NotifyType{def.NotifyTypeSms, def.NotifyTypeEmail}, Time: night})
+	require.NoError(t, err)
+	assert.Equal(t, "disabled by user", ds[0].Err)
+	assert.Equal(t, DeliveryQuiet, ds[3].Status)
+	ds, err = d.Dispatch(ctx, &Notification{Code: def.NotifyCodeDeviceAlarm, Urgent: true, Time: night})
+	require.NoError(t, err)
+	assert.Equal(t, DeliverySuccess, ds[2].Status, "紧急通知不受免打扰限制")
+}
+
+func TestDispatchRetryFail(t *testing.T) {
+	sms := &fakeChannel{t: def.NotifyTypeSms, fails: 10}
+	d, err := NewDispatcher(Options{Templates: alarmTemplates[:1], RetryWait: time.Millisecond, MaxRetry: 2}, sms)
+	require.NoError(t, err)
+	ds, err := d.Dispatch(context.Background(), &Notification{Code: def.NotifyCodeDeviceAlarm, Recipients: []*Recipient{{Phone: "1"}}})
+	require.NoError(t, err)
+	require.Len(t, ds, 1)
+	assert.Equal(t, DeliveryFail, ds[0].Status)
+	assert.Equal(t, 3, ds[0].Attempts)
+
+	_, err = NewDispatcher(Options{Templates: []*Template{{Body: "{{"}}})
+	assert.Error(t, err)
+}
+
+func TestDispatchWindow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	for name, store := range map[string]kv.Store{
+		"local": nil,
+		"redis": kv.NewStore(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			email := &fakeChannel{t: def.NotifyTypeEmail}
+			d, err := NewDispatcher(Options{Templates: alarmTemplates[1:], Window: time.Minute, MaxRetry: -1}, email)
+			require.NoError(t, err)
+			d.window.store = store
+			ctx := context.Background()
+			now := time.Now()
+			send := func(at time.Time, key ...string) string {
+				ds, err := d.Dispatch(ctx, &Notification{Code: def.NotifyCodeDeviceAlarm, Key: append(key, "alarm1:d1")[0], Time: at,
+					Params: map[string]any{"device": "d1"}, Recipients: []*Recipient{{Email: "a@b.c"}}})
+				require.NoError(t, err)
+				return ds[0].Status
+			}
+			assert.Equal(t, DeliverySuccess, send(now))
+			assert.Equal(t, DeliveryDedup, send(now.Add(time.Second)))
+			assert.Equal(t, DeliveryDedup, send(now.Add(2*time.Second)))
+			assert.Equal(t, DeliverySuccess, send(now.Add(61*time.Second)))
+			require.Len(t, email.msgs, 2)
+			assert.Equal(t, ":d1温度过高,期间又告警2次", email.msgs[1].Body)
+
+			//窗口内第一条发送失败时不能让后续的通知被去重
+			email.fails = email.calls + 1
+			assert.Equal(t, DeliveryFail, send(now, "alarm2:d1"))
+			assert.Equal(t, DeliverySuccess, send(now.Add(time.Second), "alarm2:d1"))
+			assert.Equal(t, DeliveryDedup, send(now.Add(2*time.Second), "alarm2:d1"))
+		})
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 1, 1, h, m, 0, 0, time.Local) }
+	p := &Preference{QuietHours: &QuietHours{Start: "12:00", End: "13:30", Channels: []def.NotifyType{def.NotifyTypeWebsocket}}}
+	assert.True(t, p.Quiet(def.NotifyTypeSms, at(12, 0)))
+	assert.False(t, p.Quiet(def.NotifyTypeSms, at(13, 30)))
+	assert.False(t, p.Quiet(def.NotifyTypeWebsocket, at(12, 30)))
+	p.QuietHours.Start, p.QuietHours.End = "22:00", "07:00"
+	assert.True(t, p.Quiet(def.NotifyTypeSms, at(6, 59)))
+	assert.False(t, p.Quiet(def.NotifyTypeSms, at(21, 59)))
+	assert.False(t, (*Preference)(nil).Quiet(def.NotifyTypeSms, at(23, 0)))
+}
+
+func TestSmsChannel(t *testing.T) {
+	s, err := smsClient.NewSms(conf.Sms{Mode: conf.SmsFake, Enable: true})
+	require.NoError(t, err)
+	d, err := NewDispatcher(Options{Templates: alarmTemplates[:1], Window: time.Minute}, &SmsChannel{Sms: s})
+	require.NoError(t, err)
+	ds, err := d.Dispatch(context.Background(), &Notification{Code: def.NotifyCodeDeviceAlarm, Key: "alarm1:d1",
+		Params: map[string]any{"device": "d1"}, Recipients: []*Recipient{{Name: "张三", Phone: "138"}}})
+	require.NoError(t, err)
+	assert.Equal(t, DeliverySuccess, ds[0].Status)
+	msgs := s.Provider(conf.SmsFake).(*smsClient.FakeProvider).Messages()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, def.NotifyCodeDeviceAlarm, msgs[0].TemplateID)
+	assert.Equal(t, map[string]any{"device": "d1"}, msgs[0].TemplateParam, "注入的参数会让按顺序填充的短信模板错位")
+
+	tpl := *alarmTemplates[0]
+	tpl.SmsParams = []string{"device", ParamAggregateCount}
+	d, err = NewDispatcher(Options{Templates: []*Template{&tpl}, Window: time.Minute}, &SmsChannel{Sms: s})
+	require.NoError(t, err)
+	_, err = d.Dispatch(context.Background(), &Notification{Code: def.NotifyCodeDeviceAlarm, Key: "alarm2:d1",
+		Params: map[string]any{"device": "d1", "level": 1}, Recipients: []*Recipient{{Name: "张三", Phone: "138"}}})
+	require.NoError(t, err)
+	msgs = s.Provider(conf.SmsFake).(*smsClient.FakeProvider).Messages()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, map[string]any{"device": "d1", ParamAggregateCount: int64(0)}, msgs[1].TemplateParam)
+}
+
+func TestWebhookChannel(t *testing.T) {
+	var got WebhookBody
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+	d, err := NewDispatcher(Options{Templates: []*Template{{Code: def.NotifyCodeRuleScene, Channel: def.NotifyTypeWebhook, Body: "场景{{.scene}}执行"}}},
+		&WebhookChannel{AllowHosts: []string{"127.0.0.1"}})
+	require.NoError(t, err)
+	ds, err := d.Dispatch(context.Background(), &Notification{Code: def.NotifyCodeRuleScene, Params: map[string]any{"scene": "回家"},
+		Recipients: []*Recipient{{Address: map[def.NotifyType]string{def.NotifyTypeWebhook: srv.URL}}}})
+	require.NoError(t, err)
+	assert.Equal(t, DeliverySuccess, ds[0].Status)
+	assert.Equal(t, "场景回家执行", got.Body)
+	assert.Equal(t, def.NotifyCodeRuleScene, got.Code)
+}
+
+func TestWebhookChannelReject(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+	msg := func(to string) *Message {
+		return &Message{Notification: &Notification{Code: def.NotifyCodeRuleScene}, To: to}
+	}
+	c := &WebhookChannel{}
+	for _, to := range []string{
+		srv.URL, //回环
+		strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), //域名解析到回环
+		"http://169.254.169.254/latest/meta-data",             //云主机元数据
+		"http://10.0.0.1/hook",
+		"http://[::1]:80/hook",
+		"file:///etc/passwd",
+		"gopher://example.com/",
+	} {
+		err := c.Send(context.Background(), msg(to))
+		assert.Error(t, err, to)
+	}
+	assert.Zero(t, hits.Load())
+
+	c = &WebhookChannel{AllowHosts: []string{"example.com"}}
+	assert.True(t, errors.Cmp(c.Send(context.Background(), msg(srv.URL)), errors.Parameter), "不在白名单的主机")
+	assert.Zero(t, hits.Load())
+}
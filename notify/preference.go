@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// Preference 用户的通知偏好
+type Preference struct {
+	Channels   []def.NotifyType `json:"channels"` //用户开启的通道,为空时不限制
+	QuietHours *QuietHours      `json:"quietHours"`
+}
+
+// QuietHours 免打扰时段,使用本地时间
+type QuietHours struct {
+	Start    string           `json:"start"`    //开始时间 如 22:00
+	End      string           `json:"end"`      //结束时间 如 07:00,小于开始时间表示跨天
+	Channels []def.NotifyType `json:"channels"` //免打扰时段仍然发送的通道,如websocket推送
+}
+
+// PreferenceRepo 获取用户对某类通知的偏好,没有设置时返回nil
+type PreferenceRepo interface {
+	GetPreference(ctx context.Context, userID int64, code def.NotifyCode) (*Preference, error)
+}
+
+func (p *Preference) Allow(ch def.NotifyType) bool {
+	if p == nil || len(p.Channels) == 0 {
+		return true
+	}
+	return slices.Contains(p.Channels, ch)
+}
+
+// Quiet 通道在t时刻是否处于免打扰
+func (p *Preference) Quiet(ch def.NotifyType, t time.Time) bool {
+	if p == nil || p.QuietHours == nil {
+		return false
+	}
+	q := p.QuietHours
+	if slices.Contains(q.Channels, ch) {
+		return false
+	}
+	start, err1 := parseClock(q.Start)
+	end, err2 := parseClock(q.End)
+	if err1 != nil || err2 != nil || start == end {
+		return false
+	}
+	t = t.Local()
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// 返回一天中的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Parameter.AddDetailf("quiet hours %s err:%v", s, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (d *Dispatcher) getPreference(ctx context.Context, r *Recipient, code def.NotifyCode) (*Preference, error) {
+	if d.opts.Preferences == nil || r.UserID == 0 {
+		return nil, nil
+	}
+	return d.opts.Preferences.GetPreference(ctx, r.UserID, code)
+}
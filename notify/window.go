@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitee.com/unitedrhino/share/caches"
+	"github.com/spf13/cast"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+)
+
+// 去重及聚合窗口:窗口内的第一条通知发送并开启窗口,之后的只计数不发送,
+// 窗口结束后的第一条通知发送时带上窗口内被合并的次数
+// KEYS[1] key ARGV[1] 当前毫秒 ARGV[2] 窗口毫秒
+// 返回 {是否发送, 被合并的次数}
+const windowScript = `local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local data = redis.call('HMGET', KEYS[1], 'until', 'count')
+local untilTs = tonumber(data[1]) or 0
+local count = tonumber(data[2]) or 0
+if now >= untilTs then
+  redis.call('HSET', KEYS[1], 'until', now + window, 'count', 0)
+  redis.call('PEXPIRE', KEYS[1], window * 2)
+  return {1, count}
+end
+redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('PEXPIRE', KEYS[1], untilTs - now + window)
+return {0, 0}`
+
+// 窗口内的第一条通知发送失败时释放窗口,下一条通知可以立即发送,并带上原本要带的合并次数
+// KEYS[1] key ARGV[1] 合并次数
+const releaseScript = `if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+redis.call('HINCRBY', KEYS[1], 'count', ARGV[1])
+redis.call('HSET', KEYS[1], 'until', 0)
+return 1`
+
+const maxLocalWindow = 1024 //本地窗口超过这个数量时清理过期的
+
+type window struct {
+	size  time.Duration
+	store kv.Store
+	mutex sync.Mutex
+	local map[string]*windowState //没有redis或redis出错时使用
+}
+
+type windowState struct {
+	until time.Time
+	count int64
+}
+
+func newWindow(size time.Duration) *window {
+	return &window{size: size, store: caches.GetStore(), local: map[string]*windowState{}}
+}
+
+// 返回是否需要发送及上个窗口被合并的次数
+func (w *window) take(ctx context.Context, key string, now time.Time) (bool, int64) {
+	if w.size <= 0 {
+		return true, 0
+	}
+	key = genWindowKey(key)
+	if w.store != nil {
+		ret, err := w.store.EvalCtx(ctx, windowScript, key, now.UnixMilli(), w.size.Milliseconds())
+		if err == nil {
+			if vals, ok := ret.([]any); ok && len(vals) == 2 {
+				return cast.ToInt64(vals[0]) == 1, cast.ToInt64(vals[1])
+			}
+		}
+		logx.WithContext(ctx).Errorf("notify window redis ret:%v err:%v,use local window", ret, err)
+	}
+	return w.takeLocal(key, now)
+}
+
+// 释放take获取的窗口,count为take返回的合并次数
+func (w *window) release(ctx context.Context, key string, count int64, now time.Time) {
+	if w.size <= 0 {
+		return
+	}
+	key = genWindowKey(key)
+	if w.store != nil {
+		_, err := w.store.EvalCtx(ctx, releaseScript, key, count)
+		if err == nil {
+			return
+		}
+		logx.WithContext(ctx).Errorf("notify window release redis err:%v,use local window", err)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if s := w.local[key]; s != nil {
+		s.until, s.count = now, s.count+count
+	}
+}
+
+func genWindowKey(key string) string {
+	return "notify:window:" + key
+}
+
+func (w *window) takeLocal(key string, now time.Time) (bool, int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	s := w.local[key]
+	if s == nil || !now.Before(s.until) {
+		var count int64
+		if s != nil && now.Before(s.until.Add(w.size)) {
+			count = s.count
+		}
+		w.local[key] = &windowState{until: now.Add(w.size)}
+		if len(w.local) > maxLocalWindow {
+			w.clean(now)
+		}
+		return true, count
+	}
+	s.count++
+	return false, 0
+}
+
+// 清理过期的窗口
+func (w *window) clean(now time.Time) {
+	for k, s := range w.local {
+		if now.After(s.until.Add(w.size)) {
+			delete(w.local, k)
+		}
+	}
+}
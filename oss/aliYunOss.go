@@ -2,24 +2,29 @@ package oss
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
 	"gitee.com/unitedrhino/share/oss/common"
 	aliOss "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/zeromicro/go-zero/core/logx"
 )
 
 type AliYunOss struct {
-	setting         conf.AliYunConf
-	client          *aliOss.Client
-	bucket          *aliOss.Bucket
-	b4IsObjectExist *aliOss.Bucket
-}
-
-func (a *AliYunOss) GetObjectLocal(ctx context.Context, filePath string, localPath string) error {
-	//TODO implement me
-	panic("implement me")
+	setting           conf.OssConf
+	client            *aliOss.Client
+	bucket            *aliOss.Bucket
+	currentBucketName string
 }
 
 func newAliYunOss(conf conf.AliYunConf) (*AliYunOss, error) {
@@ -27,63 +32,272 @@ func newAliYunOss(conf conf.AliYunConf) (*AliYunOss, error) {
 	if err != nil {
 		return nil, err
 	}
-	bucket, err := client.Bucket(conf.PrivateBucketName)
-	if err != nil {
+	return initAliYunOss(conf.OssConf, client)
+}
+
+func initAliYunOss(setting conf.OssConf, client *aliOss.Client) (*AliYunOss, error) {
+	a := &AliYunOss{client: client, setting: setting}
+	if err := a.initBucket(setting.PrivateBucketName, aliOss.ACLPrivate); err != nil { //私有桶
 		return nil, err
 	}
-	b4IsObjectExist := bucket
-	return &AliYunOss{client: client, bucket: bucket, setting: conf, b4IsObjectExist: b4IsObjectExist}, nil
+	if err := a.initBucket(setting.PublicBucketName, aliOss.ACLPublicRead); err != nil { //公共读桶
+		return nil, err
+	}
+	if err := a.initBucket(setting.TemporaryBucketName, aliOss.ACLPublicRead); err != nil { //临时桶
+		return nil, err
+	}
+	if err := a.initTemporaryLifecycle(); err != nil {
+		//子账号可能没有配置生命周期的权限,不影响使用
+		logx.Errorf("aliyun oss set temporary bucket lifecycle err:%v", err)
+	}
+	return a.withBucket(setting.PrivateBucketName), nil //未选择桶时使用私有桶
+}
+
+// 子账号一般只授权了桶内的操作,没有列举及创建桶的权限,这时认为桶已由管理员创建好
+func (a *AliYunOss) initBucket(bucketName string, acl aliOss.ACLType) error {
+	exists, err := a.client.IsBucketExist(bucketName)
+	if err == nil && !exists {
+		err = a.client.CreateBucket(bucketName, aliOss.ACL(acl))
+	}
+	if isAliYunAccessDenied(err) {
+		logx.Errorf("aliyun oss init bucket:%s no permission, skip err:%v", bucketName, err)
+		return nil
+	}
+	return err
+}
+
+func isAliYunAccessDenied(err error) bool {
+	var se aliOss.ServiceError
+	return errors.As(err, &se) && se.StatusCode == http.StatusForbidden
+}
+
+// 临时桶的文件到期自动删除,只新增或更新自己的规则,保留桶上已有的其他规则
+func (a *AliYunOss) initTemporaryLifecycle() error {
+	var rules []aliOss.LifecycleRule
+	ret, err := a.client.GetBucketLifecycle(a.setting.TemporaryBucketName)
+	if err != nil {
+		var se aliOss.ServiceError
+		if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound { //404表示还没有配置生命周期
+			return err
+		}
+	}
+	for _, r := range ret.Rules {
+		if r.ID != temporaryLifecycleID {
+			rules = append(rules, r)
+		}
+	}
+	rules = append(rules, aliOss.LifecycleRule{
+		ID:         temporaryLifecycleID,
+		Prefix:     "",
+		Status:     "Enabled",
+		Expiration: &aliOss.LifecycleExpiration{Days: temporaryExpireDays},
+	})
+	return a.client.SetBucketLifecycle(a.setting.TemporaryBucketName, rules)
 }
+
+// 返回绑定到指定桶的副本,不修改共享的实例,并发安全
+func (a *AliYunOss) withBucket(bucketName string) *AliYunOss {
+	view := *a
+	view.bucket, _ = a.client.Bucket(bucketName)
+	view.currentBucketName = bucketName
+	return &view
+}
+
 func (a *AliYunOss) PrivateBucket() Handle {
-	a.bucket, _ = a.client.Bucket(a.setting.PrivateBucketName)
-	return a
+	return a.withBucket(a.setting.PrivateBucketName)
 }
 func (a *AliYunOss) PublicBucket() Handle {
-	a.bucket, _ = a.client.Bucket(a.setting.PublicBucketName)
-	return a
+	return a.withBucket(a.setting.PublicBucketName)
 }
 func (a *AliYunOss) TemporaryBucket() Handle {
-	a.bucket, _ = a.client.Bucket(a.setting.PublicBucketName)
-	return a
+	return a.withBucket(a.setting.TemporaryBucketName)
 }
 
 // 获取put上传url
 func (a *AliYunOss) SignedPutUrl(ctx context.Context, fileDir string, expiredSec int64, opKv common.OptionKv) (string, error) {
 	return a.bucket.SignURL(fileDir, aliOss.HTTPPut, expiredSec, opKv.ToAliYunOptions()...)
 }
+
+// 获取get下载url
 func (a *AliYunOss) SignedGetUrl(ctx context.Context, fileDir string, expiredSec int64, opKv common.OptionKv) (string, error) {
 	return a.bucket.SignURL(fileDir, aliOss.HTTPGet, expiredSec, opKv.ToAliYunOptions()...)
 }
+
+// 删除
 func (a *AliYunOss) Delete(ctx context.Context, fileDir string, opKv common.OptionKv) error {
 	return a.bucket.DeleteObject(fileDir, opKv.ToAliYunOptions()...)
 }
-func (a *AliYunOss) GetObjectInfo(ctx context.Context, fileDir string) (*common.StorageObjectInfo, error) {
-	metaInfo, err := a.bucket.GetObjectDetailedMeta(fileDir)
+
+func (a *AliYunOss) IsObjectExist(ctx context.Context, filePath string, opKv common.OptionKv) (bool, error) {
+	return a.bucket.IsObjectExist(filePath)
+}
+
+func (a *AliYunOss) Upload(ctx context.Context, filePath string, content io.Reader, opKv common.OptionKv) (string, error) {
+	options := append(opKv.ToAliYunOptions(), aliOss.ContentType(common.GetFilePathMineType(filePath)))
+	err := a.bucket.PutObject(filePath, content, options...)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	contentLength := metaInfo.Get("Content-Length")
-	size, err := strconv.ParseInt(contentLength, 10, 64)
+	return a.GetUrl(filePath, false)
+}
 
+func (a *AliYunOss) GetObjectLocal(ctx context.Context, filePath string, localPath string) error {
+	err := os.MkdirAll(filepath.Dir(localPath), 0755)
+	if err != nil {
+		return err
+	}
+	return a.bucket.GetObjectToFile(filePath, localPath)
+}
+
+func (a *AliYunOss) GetObjectInfo(ctx context.Context, filePath string) (*common.StorageObjectInfo, error) {
+	metaInfo, err := a.bucket.GetObjectDetailedMeta(filePath)
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(metaInfo.Get(aliOss.HTTPHeaderContentLength), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	md5 := aliYunEtagToMd5(metaInfo.Get(aliOss.HTTPHeaderEtag))
+	//简单上传的文件会返回Content-MD5,分片上传的文件只有ETag
+	if contentMd5, er := base64.StdEncoding.DecodeString(metaInfo.Get(aliOss.HTTPHeaderContentMD5)); er == nil && len(contentMd5) > 0 {
+		md5 = hex.EncodeToString(contentMd5)
+	}
 	return &common.StorageObjectInfo{
-		Size: size,
-		Md5:  "",
-	}, err
+		FilePath: filePath,
+		Size:     size,
+		Md5:      md5,
+	}, nil
 }
 
 func (a *AliYunOss) ListObjects(ctx context.Context, prefix string) (ret []*common.StorageObjectInfo, err error) {
-	//todo
-	return
+	marker := ""
+	for {
+		objs, err := a.bucket.ListObjects(aliOss.Prefix(prefix), aliOss.Marker(marker), aliOss.MaxKeys(1000))
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs.Objects {
+			ret = append(ret, &common.StorageObjectInfo{
+				FilePath: obj.Key,
+				Size:     obj.Size,
+				Md5:      aliYunEtagToMd5(obj.ETag),
+			})
+		}
+		if !objs.IsTruncated || objs.NextMarker == "" {
+			return ret, nil
+		}
+		marker = objs.NextMarker
+	}
 }
 
-func (a *AliYunOss) Upload(ctx context.Context, filePath string, content io.Reader, opKv common.OptionKv) (string, error) {
-	err := a.bucket.PutObject(filePath, content, opKv.ToAliYunOptions()...)
-	//fmt.Println(uploadInfo)
-	return filePath, err
-}
 func (a *AliYunOss) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
-	return "", nil //TODO
+	_, err := a.bucket.CopyObjectFrom(a.setting.TemporaryBucketName, tempPath, dstPath)
+	if err != nil {
+		return "", err
+	}
+	return dstPath, nil
+}
+
+// 获取链接,和minio一样withHost时使用CustomHost作为前缀,否则使用CustomPath;
+// 没有配置对应的前缀时直接通过oss的域名访问
+func (a *AliYunOss) GetUrl(path string, withHost bool) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", errors.Parameter.AddDetail("oss path is empty")
+	}
+	prefix := a.setting.CustomPath
+	if withHost {
+		prefix = a.setting.CustomHost
+	}
+	if prefix != "" {
+		return prefix + "/" + a.currentBucketName + "/" + path, nil
+	}
+	endpoint, err := url.Parse(a.client.Config.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	if endpoint.Scheme == "" {
+		endpoint.Scheme = "http"
+	}
+	host := endpoint.Host
+	if !a.client.Config.IsCname {
+		if hostname := endpoint.Hostname(); net.ParseIP(hostname) != nil || hostname == "localhost" {
+			path = a.currentBucketName + "/" + path
+		} else {
+			host = a.currentBucketName + "." + host
+		}
+	}
+	return endpoint.Scheme + "://" + host + "/" + path, nil
+}
+
+// 阿里云的ETag是大写并带引号的
+func aliYunEtagToMd5(etag string) string {
+	return strings.ToLower(strings.Trim(etag, `"`))
+}
+
+func (a *AliYunOss) imur(filePath string, uploadID string) aliOss.InitiateMultipartUploadResult {
+	return aliOss.InitiateMultipartUploadResult{Bucket: a.currentBucketName, Key: filePath, UploadID: uploadID}
+}
+
+func (a *AliYunOss) InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (string, error) {
+	options := append(opKv.ToAliYunOptions(), aliOss.ContentType(common.GetFilePathMineType(filePath)))
+	result, err := a.bucket.InitiateMultipartUpload(filePath, options...)
+	if err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+func (a *AliYunOss) UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error) {
+	part, err := a.bucket.UploadPart(a.imur(filePath, uploadID), reader, size, partNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &common.MultipartPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: size}, nil
+}
+
+func (a *AliYunOss) ListParts(ctx context.Context, filePath string, uploadID string) (ret []*common.MultipartPart, err error) {
+	marker := 0
+	for {
+		result, err := a.bucket.ListUploadedParts(a.imur(filePath, uploadID), aliOss.PartNumberMarker(marker), aliOss.MaxParts(1000))
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.UploadedParts {
+			ret = append(ret, &common.MultipartPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: int64(part.Size)})
+		}
+		if !result.IsTruncated {
+			return ret, nil
+		}
+		marker, err = strconv.Atoi(result.NextPartNumberMarker)
+		if err != nil {
+			return nil, err
+		}
+	}
 }
-func (a *AliYunOss) GetUrl(filePath string, withHost bool) (string, error) {
-	return "", nil //TODO
+
+// 获取分片的put上传url
+func (a *AliYunOss) SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error) {
+	return a.bucket.SignURL(filePath, aliOss.HTTPPut, expiredSec, aliOss.AddParam("partNumber", strconv.Itoa(partNumber)), aliOss.AddParam("uploadId", uploadID))
+}
+
+func (a *AliYunOss) CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error) {
+	parts, err := sortParts(parts)
+	if err != nil {
+		return "", err
+	}
+	var uploadParts []aliOss.UploadPart
+	for _, part := range parts {
+		uploadParts = append(uploadParts, aliOss.UploadPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	_, err = a.bucket.CompleteMultipartUpload(a.imur(filePath, uploadID), uploadParts)
+	if err != nil {
+		return "", err
+	}
+	return a.GetUrl(filePath, false)
+}
+
+func (a *AliYunOss) AbortMultipart(ctx context.Context, filePath string, uploadID string) error {
+	return a.bucket.AbortMultipartUpload(a.imur(filePath, uploadID))
 }
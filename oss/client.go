@@ -1,7 +1,6 @@
 package oss
 
 import (
-	"context"
 	"gitee.com/unitedrhino/share/errors"
 	"sync"
 
@@ -21,8 +20,14 @@ var (
 func NewOssClient(c conf.OssConf) (cli *Client, err error) {
 	newOnce.Do(func() {
 		ossManager, er := newOssManager(c)
+		if er == nil {
+			ossManager, er = newGuardWithConf(c, ossManager)
+		}
+		if er == nil {
+			ossManager, er = newQuotaWithConf(c, ossManager)
+		}
 		if er != nil {
-			err = errors.Parameter.AddMsgf("oss 初始化失败 err:%v", err)
+			err = errors.Parameter.AddMsgf("oss 初始化失败 err:%v", er)
 			return
 		}
 		client = &Client{
@@ -35,8 +40,35 @@ func NewOssClient(c conf.OssConf) (cli *Client, err error) {
 
 type OpOption func(*common.OptionKv)
 
-func (c *Client) getDefaultOption(ctx context.Context) OpOption {
+// WithImageProcess 下载图片时进行处理,如 image/resize,w_200,h_200,m_fill/format,webp
+func WithImageProcess(process string) OpOption {
 	return func(option *common.OptionKv) {
-		option.SetHttpParams("x-process", "xxxxx")
+		option.SetHttpParams(common.Process, process)
+	}
+}
+
+// 去掉Client的包装,获取实际的存储实现
+func unwrapHandle(h Handle) Handle {
+	if c, ok := h.(*Client); ok {
+		return c.Handle
+	}
+	return h
+}
+
+// 去掉所有的包装,获取最终读取文件的存储实现
+func baseHandle(h Handle) Handle {
+	for {
+		switch v := h.(type) {
+		case *Client:
+			h = v.Handle
+		case *Guard:
+			h = v.Handle
+		case *Quota:
+			h = v.Handle
+		case *Mirror:
+			h = v.primary
+		default:
+			return h
+		}
 	}
 }
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// 图片处理参数,格式和阿里云的x-oss-process一致,如:
+// image/resize,w_200,h_200,m_fill/crop,x_0,y_0,w_100,h_100/format,webp/quality,q_80
+const (
+	ImageActionResize = "resize"
+	ImageActionCrop   = "crop"
+
+	ImageResizeLfit  = "lfit"  //等比缩放到宽高范围内,默认
+	ImageResizeFill  = "fill"  //等比缩放到覆盖宽高后居中裁剪
+	ImageResizeFixed = "fixed" //强制缩放到指定宽高
+
+	ImageFormatJpeg = "jpeg"
+	ImageFormatPng  = "png"
+	ImageFormatWebp = "webp"
+
+	ImageMaxSize = 4096 //处理后的宽高上限
+)
+
+type ImageAction struct {
+	Action string //resize或crop
+	Width  int
+	Height int
+	Mode   string //resize的模式
+	X      int    //crop的起点
+	Y      int
+}
+
+type ImageProcess struct {
+	Actions []ImageAction //按参数中的顺序执行
+	Format  string        //为空时和原图格式一致
+	Quality int           //1-100,只对jpeg生效,webp为无损编码
+}
+
+func ParseImageProcess(process string) (*ImageProcess, error) {
+	steps := strings.Split(strings.Trim(process, "/"), "/")
+	if len(steps) < 2 || steps[0] != "image" {
+		return nil, errors.Parameter.AddMsgf("图片处理参数错误:%s", process)
+	}
+	var ret ImageProcess
+	for _, step := range steps[1:] {
+		fields := strings.Split(step, ",")
+		params := map[string]int{}
+		mode := ImageResizeLfit
+		for _, field := range fields[1:] {
+			k, v, ok := strings.Cut(field, "_")
+			if !ok {
+				if fields[0] == "format" {
+					continue
+				}
+				return nil, errors.Parameter.AddMsgf("图片处理参数错误:%s", step)
+			}
+			if fields[0] == ImageActionResize && k == "m" {
+				mode = v
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, errors.Parameter.AddMsgf("图片处理参数错误:%s", step)
+			}
+			params[strings.ToLower(k)] = n
+		}
+		switch fields[0] {
+		case ImageActionResize:
+			a := ImageAction{Action: ImageActionResize, Width: params["w"], Height: params["h"], Mode: mode}
+			if mode != ImageResizeLfit && mode != ImageResizeFill && mode != ImageResizeFixed {
+				return nil, errors.Parameter.AddMsgf("不支持的图片缩放模式:%s", mode)
+			}
+			if (a.Width == 0 && a.Height == 0) || a.Width > ImageMaxSize || a.Height > ImageMaxSize {
+				return nil, errors.Parameter.AddMsgf("图片缩放的宽高需要在1-%d之间", ImageMaxSize)
+			}
+			if a.Mode != ImageResizeLfit && (a.Width == 0 || a.Height == 0) {
+				return nil, errors.Parameter.AddMsgf("图片缩放模式%s需要同时指定宽高", a.Mode)
+			}
+			ret.Actions = append(ret.Actions, a)
+		case ImageActionCrop:
+			a := ImageAction{Action: ImageActionCrop, X: params["x"], Y: params["y"], Width: params["w"], Height: params["h"]}
+			if a.Width > ImageMaxSize || a.Height > ImageMaxSize {
+				return nil, errors.Parameter.AddMsgf("图片裁剪的宽高需要小于%d", ImageMaxSize)
+			}
+			ret.Actions = append(ret.Actions, a)
+		case "format":
+			if len(fields) != 2 {
+				return nil, errors.Parameter.AddMsgf("图片处理参数错误:%s", step)
+			}
+			switch strings.ToLower(fields[1]) {
+			case "jpg", ImageFormatJpeg:
+				ret.Format = ImageFormatJpeg
+			case ImageFormatPng:
+				ret.Format = ImageFormatPng
+			case ImageFormatWebp:
+				ret.Format = ImageFormatWebp
+			default:
+				return nil, errors.Parameter.AddMsgf("不支持的图片格式:%s", fields[1])
+			}
+		case "quality":
+			q := params["q"]
+			if q < 1 || q > 100 {
+				return nil, errors.Parameter.AddMsg("图片质量需要在1-100之间")
+			}
+			ret.Quality = q
+		default:
+			return nil, errors.Parameter.AddMsgf("不支持的图片处理:%s", fields[0])
+		}
+	}
+	return &ret, nil
+}
+
+// String 规范化后的参数,参数顺序不同但效果相同时结果一致,用于生成缓存的文件名
+func (p ImageProcess) String() string {
+	ret := "image"
+	for _, a := range p.Actions {
+		switch a.Action {
+		case ImageActionResize:
+			ret += fmt.Sprintf("/resize,w_%d,h_%d,m_%s", a.Width, a.Height, a.Mode)
+		case ImageActionCrop:
+			ret += fmt.Sprintf("/crop,x_%d,y_%d,w_%d,h_%d", a.X, a.Y, a.Width, a.Height)
+		}
+	}
+	if p.Format != "" {
+		ret += "/format," + p.Format
+	}
+	if p.Quality != 0 {
+		ret += fmt.Sprintf("/quality,q_%d", p.Quality)
+	}
+	return ret
+}
@@ -0,0 +1,8 @@
+package common
+
+// MultipartPart 分片上传中已经上传的分片,完成上传时需要按分片号传回
+type MultipartPart struct {
+	PartNumber int    //分片号,从1开始
+	ETag       string //分片的ETag
+	Size       int64  //分片大小
+}
@@ -77,6 +77,11 @@ func (o *OptionKv) ToMinioReqParams() url.Values {
 	return values
 }
 
+// DelHttpParams 删除参数,如图片已经在服务端处理后删除Process
+func (o *OptionKv) DelHttpParams(k string) {
+	delete(o.httpParams, k)
+}
+
 func (o *OptionKv) CheckAndGetMinioProcess() (interface{}, bool) {
 	value, ok := o.httpParams[Process]
 	return value, ok
@@ -0,0 +1,220 @@
+package oss
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const defaultQuarantinePrefix = "_quarantine"
+
+type GuardOption struct {
+	Scanner          Scanner //安全扫描,为空时不扫描
+	FailOpen         bool    //扫描服务不可用时放行,默认拒绝上传
+	QuarantinePrefix string  //未通过扫描的文件隔离到私有桶的该目录下,为空时直接丢弃
+}
+
+// Guard 上传检查,写入存储前按场景的上传策略检查文件并进行安全扫描.
+// 直传到临时桶的文件在CopyFromTempBucket时检查,分片上传的文件在合并后检查,未通过时删除
+type Guard struct {
+	Handle
+	opt GuardOption
+}
+
+func NewGuard(h Handle, opt GuardOption) *Guard {
+	return &Guard{Handle: unwrapHandle(h), opt: opt}
+}
+
+// 按配置开启上传检查
+func newGuardWithConf(c conf.OssConf, h Handle) (Handle, error) {
+	if !c.UploadGuard && c.ClamdAddr == "" {
+		return h, nil
+	}
+	opt := GuardOption{QuarantinePrefix: defaultQuarantinePrefix}
+	if c.ClamdAddr != "" {
+		scanner, err := NewClamdScanner(c.ClamdAddr, 0)
+		if err != nil {
+			return nil, err
+		}
+		opt.Scanner = scanner
+	}
+	return NewGuard(h, opt), nil
+}
+
+func (g *Guard) PrivateBucket() Handle {
+	return &Guard{Handle: g.Handle.PrivateBucket(), opt: g.opt}
+}
+
+func (g *Guard) PublicBucket() Handle {
+	return &Guard{Handle: g.Handle.PublicBucket(), opt: g.opt}
+}
+
+func (g *Guard) TemporaryBucket() Handle {
+	return &Guard{Handle: g.Handle.TemporaryBucket(), opt: g.opt}
+}
+
+func (g *Guard) Upload(ctx context.Context, filePath string, reader io.Reader, opKv common.OptionKv) (string, error) {
+	tmp, err := os.CreateTemp("", "oss-guard-*")
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return "", errors.System.AddMsg("读取上传的数据失败").AddDetail(err)
+	}
+	if err = g.check(ctx, filePath, tmp, size); err != nil {
+		return "", err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	return g.Handle.Upload(ctx, filePath, tmp, opKv)
+}
+
+func (g *Guard) SignedGetUrl(ctx context.Context, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	return signedGetUrlWithProcess(ctx, g, g.Handle, filePath, expiredSec, opKv)
+}
+
+func (g *Guard) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
+	ctx := context.Background()
+	temp := g.Handle.TemporaryBucket()
+	if err := g.checkStored(ctx, temp, tempPath, dstPath); err != nil {
+		if er := temp.Delete(ctx, tempPath, common.OptionKv{}); er != nil {
+			logx.WithContext(ctx).Errorf("oss guard delete tempPath:%s err:%v", tempPath, er)
+		}
+		return "", err
+	}
+	return g.Handle.CopyFromTempBucket(tempPath, dstPath)
+}
+
+// 检查已经在存储中的文件,checkPath为按策略检查时使用的路径
+func (g *Guard) checkStored(ctx context.Context, h Handle, filePath string, checkPath string) error {
+	tmp, err := os.CreateTemp("", "oss-guard-*")
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err = h.GetObjectLocal(ctx, filePath, tmp.Name()); err != nil {
+		return err
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	return g.check(ctx, checkPath, f, stat.Size())
+}
+
+func (g *Guard) check(ctx context.Context, filePath string, f *os.File, size int64) error {
+	if p, ok := FindUploadPolicy(filePath); ok {
+		if _, err := p.Check(path.Base(filePath), f, size); err != nil {
+			return err
+		}
+	}
+	if g.opt.Scanner == nil {
+		return nil
+	}
+	ret, err := g.opt.Scanner.Scan(ctx, io.NewSectionReader(f, 0, size))
+	if err != nil {
+		if g.opt.FailOpen {
+			logx.WithContext(ctx).Errorf("oss guard scan skipped filePath:%s err:%v", filePath, err)
+			return nil
+		}
+		return errors.System.AddMsg("文件安全扫描失败").AddDetail(err)
+	}
+	if !ret.Infected {
+		return nil
+	}
+	logx.WithContext(ctx).Errorf("oss guard infected filePath:%s signature:%s", filePath, ret.Signature)
+	g.quarantine(ctx, filePath, io.NewSectionReader(f, 0, size))
+	return errors.FileInfected.AddMsgf("命中特征:%s", ret.Signature)
+}
+
+func (g *Guard) quarantine(ctx context.Context, filePath string, reader io.Reader) {
+	if g.opt.QuarantinePrefix == "" {
+		return
+	}
+	qPath := path.Join(g.opt.QuarantinePrefix, time.Now().Format("20060102"), filePath)
+	if _, err := g.Handle.PrivateBucket().Upload(ctx, qPath, reader, common.OptionKv{}); err != nil {
+		logx.WithContext(ctx).Errorf("oss guard quarantine filePath:%s err:%v", filePath, err)
+	}
+}
+
+func (g *Guard) multipart() (MultipartHandle, error) {
+	return GetMultipartHandle(g.Handle)
+}
+
+func (g *Guard) InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (string, error) {
+	mh, err := g.multipart()
+	if err != nil {
+		return "", err
+	}
+	return mh.InitiateMultipart(ctx, filePath, opKv)
+}
+
+func (g *Guard) UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error) {
+	mh, err := g.multipart()
+	if err != nil {
+		return nil, err
+	}
+	return mh.UploadPart(ctx, filePath, uploadID, partNumber, reader, size)
+}
+
+func (g *Guard) ListParts(ctx context.Context, filePath string, uploadID string) ([]*common.MultipartPart, error) {
+	mh, err := g.multipart()
+	if err != nil {
+		return nil, err
+	}
+	return mh.ListParts(ctx, filePath, uploadID)
+}
+
+func (g *Guard) SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error) {
+	mh, err := g.multipart()
+	if err != nil {
+		return "", err
+	}
+	return mh.SignedPartUrl(ctx, filePath, uploadID, partNumber, expiredSec)
+}
+
+// CompleteMultipart 合并后检查文件,未通过时删除
+func (g *Guard) CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error) {
+	mh, err := g.multipart()
+	if err != nil {
+		return "", err
+	}
+	ret, err := mh.CompleteMultipart(ctx, filePath, uploadID, parts)
+	if err != nil {
+		return "", err
+	}
+	if err = g.checkStored(ctx, g.Handle, filePath, filePath); err != nil {
+		if er := g.Handle.Delete(ctx, filePath, common.OptionKv{}); er != nil {
+			logx.WithContext(ctx).Errorf("oss guard delete filePath:%s err:%v", filePath, er)
+		}
+		return "", err
+	}
+	return ret, nil
+}
+
+func (g *Guard) AbortMultipart(ctx context.Context, filePath string, uploadID string) error {
+	mh, err := g.multipart()
+	if err != nil {
+		return err
+	}
+	return mh.AbortMultipart(ctx, filePath, uploadID)
+}
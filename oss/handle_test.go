@@ -0,0 +1,200 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/oss/common"
+	aliOss "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type handleBackend struct {
+	name      string
+	newHandle func(t *testing.T) Handle
+	lifecycle func(bucketName string) string //返回桶上配置的生命周期规则
+}
+
+func testOssConf() conf.OssConf {
+	return conf.OssConf{
+		AccessKeyID:         "root",
+		AccessKeySecret:     "password",
+		PublicBucketName:    "ithings-public",
+		TemporaryBucketName: "ithings-temporary",
+		PrivateBucketName:   "ithings-private",
+		CustomHost:          "/oss",
+		CustomPath:          "/oss",
+	}
+}
+
+func testHandleBackends() []handleBackend {
+	minioServer := newFakeObjectServer()
+	aliYunServer := newFakeObjectServer()
+	return []handleBackend{
+		{
+			name: "local",
+			newHandle: func(t *testing.T) Handle {
+				c := testOssConf()
+				c.StorePath = t.TempDir()
+				h, err := newLocal(c)
+				require.NoError(t, err)
+				return h
+			},
+		},
+		{
+			name: "minio",
+			newHandle: func(t *testing.T) Handle {
+				u, _ := url.Parse(minioServer.URL)
+				c := testOssConf()
+				c.Location = u.Host
+				h, err := newMinio(conf.MinioConf{OssConf: c})
+				require.NoError(t, err)
+				return h
+			},
+			lifecycle: func(bucketName string) string {
+				return minioServer.lifecycles[bucketName]
+			},
+		},
+		{
+			name: "aliyun",
+			newHandle: func(t *testing.T) Handle {
+				client, err := aliOss.New(aliYunServer.URL, "root", "password")
+				require.NoError(t, err)
+				h, err := initAliYunOss(testOssConf(), client)
+				require.NoError(t, err)
+				return h
+			},
+			lifecycle: func(bucketName string) string {
+				return aliYunServer.lifecycles[bucketName]
+			},
+		},
+	}
+}
+
+// 所有的存储后端都需要通过相同的用例
+func TestHandleConformance(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range testHandleBackends() {
+		t.Run(b.name, func(t *testing.T) {
+			h := b.newHandle(t)
+			content := []byte("unitedrhino oss conformance")
+			tempPath := "deviceManage/deviceImg/tmp/a.png"
+			dstPath := "deviceManage/deviceImg/a.png"
+
+			u, err := h.TemporaryBucket().Upload(ctx, tempPath, bytes.NewReader(content), common.OptionKv{})
+			require.NoError(t, err)
+			u, _ = url.QueryUnescape(u) //本地存储的路径在参数中
+			assert.Contains(t, u, tempPath)
+
+			info, err := h.TemporaryBucket().GetObjectInfo(ctx, tempPath)
+			require.NoError(t, err)
+			assert.Equal(t, tempPath, info.FilePath)
+			assert.Equal(t, int64(len(content)), info.Size)
+			assert.NotEmpty(t, info.Md5)
+			//临时桶的文件不能出现在其他桶中
+			_, err = h.PublicBucket().GetObjectInfo(ctx, tempPath)
+			assert.Error(t, err)
+			_, err = h.PrivateBucket().GetObjectInfo(ctx, tempPath)
+			assert.Error(t, err)
+
+			_, err = CheckWithCopy(ctx, h.PrivateBucket(), tempPath, BusinessProductManage, SceneProductImg)
+			assert.Error(t, err)
+			path, err := CheckWithCopy(ctx, h.PrivateBucket(), tempPath, BusinessDeviceManage, SceneDeviceImg)
+			require.NoError(t, err)
+			assert.Equal(t, tempPath, path)
+			path, err = h.PrivateBucket().CopyFromTempBucket(tempPath, dstPath)
+			require.NoError(t, err)
+			assert.Equal(t, dstPath, path)
+			info, err = h.PrivateBucket().GetObjectInfo(ctx, dstPath)
+			require.NoError(t, err)
+			assert.Equal(t, dstPath, info.FilePath)
+			assert.Equal(t, int64(len(content)), info.Size)
+
+			localPath := filepath.Join(t.TempDir(), "download", "a.png")
+			require.NoError(t, h.PrivateBucket().GetObjectLocal(ctx, dstPath, localPath))
+			data, err := os.ReadFile(localPath)
+			require.NoError(t, err)
+			assert.Equal(t, content, data)
+
+			u, err = h.PrivateBucket().GetUrl(dstPath, true)
+			require.NoError(t, err)
+			u, _ = url.QueryUnescape(u)
+			assert.Contains(t, u, dstPath)
+			assert.True(t, strings.HasPrefix(u, "/oss/"), "使用CustomHost作为前缀")
+			_, err = h.PrivateBucket().GetUrl("", true)
+			assert.Error(t, err)
+
+			list, err := h.PrivateBucket().ListObjects(ctx, "deviceManage/")
+			require.NoError(t, err)
+			require.Len(t, list, 2)
+			sort.Slice(list, func(i, j int) bool { return list[i].FilePath < list[j].FilePath })
+			assert.Equal(t, dstPath, list[0].FilePath)
+			assert.Equal(t, int64(len(content)), list[0].Size)
+			assert.NotEmpty(t, list[0].Md5)
+			assert.Equal(t, tempPath, list[1].FilePath)
+
+			require.NoError(t, h.PrivateBucket().Delete(ctx, dstPath, common.OptionKv{}))
+			_, err = h.PrivateBucket().GetObjectInfo(ctx, dstPath)
+			assert.Error(t, err)
+
+			if b.lifecycle != nil {
+				assert.Contains(t, b.lifecycle(testOssConf().TemporaryBucketName), "<Days>1</Days>")
+			}
+		})
+	}
+}
+
+// 启动时只更新临时桶自己的生命周期规则,不能覆盖桶上已有的其他规则
+func TestInitTemporaryLifecycleMerge(t *testing.T) {
+	const keepRule = `<LifecycleConfiguration><Rule><ID>keep-logs</ID><Prefix>logs/</Prefix><Status>Enabled</Status>` +
+		`<Expiration><Days>30</Days></Expiration></Rule></LifecycleConfiguration>`
+	tempBucket := testOssConf().TemporaryBucketName
+	newHandles := map[string]func(t *testing.T, f *fakeObjectServer){
+		"minio": func(t *testing.T, f *fakeObjectServer) {
+			u, _ := url.Parse(f.URL)
+			c := testOssConf()
+			c.Location = u.Host
+			_, err := newMinio(conf.MinioConf{OssConf: c})
+			require.NoError(t, err)
+		},
+		"aliyun": func(t *testing.T, f *fakeObjectServer) {
+			client, err := aliOss.New(f.URL, "root", "password")
+			require.NoError(t, err)
+			_, err = initAliYunOss(testOssConf(), client)
+			require.NoError(t, err)
+		},
+	}
+	for name, newHandle := range newHandles {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeObjectServer()
+			defer f.Close()
+			f.lifecycles[tempBucket] = keepRule
+			newHandle(t, f)
+			newHandle(t, f) //重复启动不能重复添加规则
+			lc := f.lifecycles[tempBucket]
+			assert.Contains(t, lc, "keep-logs")
+			assert.Contains(t, lc, "<Days>30</Days>")
+			assert.Equal(t, 1, strings.Count(lc, temporaryLifecycleID), lc)
+			assert.Contains(t, lc, "<Days>1</Days>")
+		})
+	}
+}
+
+// 子账号没有列举及创建桶的权限时也能启动
+func TestAliYunInitWithoutBucketPermission(t *testing.T) {
+	f := newFakeObjectServer()
+	defer f.Close()
+	f.denyAdmin = true
+	client, err := aliOss.New(f.URL, "root", "password")
+	require.NoError(t, err)
+	_, err = initAliYunOss(testOssConf(), client)
+	require.NoError(t, err)
+}
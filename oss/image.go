@@ -0,0 +1,231 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	imageProcessDir = "_process" //处理后的图片保存在原图所在目录的该子目录下
+	imageMaxPixels  = 50000000   //原图像素上限,避免解码超大图片占满内存
+	imageDefQuality = 85         //jpeg的默认质量
+)
+
+// ProcessImage 按process处理图片,结果保存到原图所在的桶中,原图不变时相同的参数只处理一次,返回处理后图片的路径.
+// 阿里云可以直接使用x-oss-process,minio和本地存储通过该函数在服务端处理
+func ProcessImage(ctx context.Context, h Handle, filePath string, process string) (string, error) {
+	p, err := common.ParseImageProcess(process)
+	if err != nil {
+		return "", err
+	}
+	info, err := h.GetObjectInfo(ctx, filePath)
+	if err != nil {
+		return "", errors.NotFind.AddMsg("图片不存在").AddDetail(err)
+	}
+	derivedPath := imageDerivedPath(filePath, info.Md5, p)
+	if _, err := h.GetObjectInfo(ctx, derivedPath); err == nil {
+		return derivedPath, nil
+	}
+	tmp, err := os.CreateTemp("", "oss-image-*")
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err = h.GetObjectLocal(ctx, filePath, tmp.Name()); err != nil {
+		return "", err
+	}
+	src, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	data, err := ProcessImageData(src, p)
+	if err != nil {
+		return "", err
+	}
+	if _, err = h.Upload(ctx, derivedPath, bytes.NewReader(data), common.OptionKv{}); err != nil {
+		return "", err
+	}
+	return derivedPath, nil
+}
+
+// GetProcessUrl 获取处理后图片的链接,阿里云使用原生的图片处理,其他存储先处理并缓存
+func GetProcessUrl(ctx context.Context, h Handle, filePath string, process string, withHost bool) (string, error) {
+	if _, ok := baseHandle(h).(*AliYunOss); ok {
+		if _, err := common.ParseImageProcess(process); err != nil {
+			return "", err
+		}
+		u, err := h.GetUrl(filePath, withHost)
+		if err != nil {
+			return "", err
+		}
+		return u + "?x-oss-process=" + process, nil
+	}
+	derivedPath, err := ProcessImage(ctx, h, filePath, process)
+	if err != nil {
+		return "", err
+	}
+	return h.GetUrl(derivedPath, withHost)
+}
+
+// 配额及安全检查等包装生成下载链接时先处理图片,处理结果通过h写入,不会绕过包装直接写到存储中
+func signedGetUrlWithProcess(ctx context.Context, h Handle, inner Handle, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	if process, ok := opKv.CheckAndGetMinioProcess(); ok {
+		if _, ali := baseHandle(inner).(*AliYunOss); !ali { //阿里云使用原生的图片处理
+			derivedPath, err := ProcessImage(ctx, h, filePath, fmt.Sprint(process))
+			if err != nil {
+				return "", err
+			}
+			filePath = derivedPath
+			opKv.DelHttpParams(common.Process)
+		}
+	}
+	return inner.SignedGetUrl(ctx, filePath, expiredSec, opKv)
+}
+
+// 原图的md5和参数都参与文件名的计算,原图更新后会重新处理
+func imageDerivedPath(filePath string, md5 string, p *common.ImageProcess) string {
+	sum := sha1.Sum([]byte(p.String() + "|" + md5))
+	dir, name := path.Split(filePath)
+	ext := path.Ext(name)
+	if p.Format != "" {
+		ext = imageFormatExt(p.Format)
+	}
+	return dir + imageProcessDir + "/" + strings.TrimSuffix(name, path.Ext(name)) + "_" + hex.EncodeToString(sum[:8]) + ext
+}
+
+func imageFormatExt(format string) string {
+	switch format {
+	case common.ImageFormatJpeg:
+		return ".jpg"
+	case common.ImageFormatPng:
+		return ".png"
+	case common.ImageFormatWebp:
+		return ".webp"
+	case "gif":
+		return ".gif"
+	}
+	return ""
+}
+
+// ProcessImageData 处理图片数据,支持jpeg,png,gif及webp格式的原图
+func ProcessImageData(src []byte, p *common.ImageProcess) ([]byte, error) {
+	conf, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, errors.Parameter.AddMsg("不支持的图片格式").AddDetail(err)
+	}
+	if conf.Width*conf.Height > imageMaxPixels {
+		return nil, errors.Parameter.AddMsgf("图片过大:%dx%d", conf.Width, conf.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, errors.Parameter.AddMsg("图片解码失败").AddDetail(err)
+	}
+	for _, a := range p.Actions {
+		switch a.Action {
+		case common.ImageActionResize:
+			img = resizeImage(img, a)
+		case common.ImageActionCrop:
+			img, err = cropImage(img, a)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.Format != "" {
+		format = p.Format
+	}
+	var buf bytes.Buffer
+	switch format {
+	case common.ImageFormatJpeg:
+		quality := p.Quality
+		if quality == 0 {
+			quality = imageDefQuality
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case common.ImageFormatPng:
+		err = png.Encode(&buf, img)
+	case common.ImageFormatWebp:
+		err = nativewebp.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, errors.Parameter.AddMsgf("不支持的图片格式:%s", format)
+	}
+	if err != nil {
+		return nil, errors.System.AddMsg("图片编码失败").AddDetail(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func resizeImage(img image.Image, a common.ImageAction) image.Image {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	if srcW == 0 || srcH == 0 {
+		return img
+	}
+	w, h := a.Width, a.Height
+	switch a.Mode {
+	case common.ImageResizeFixed:
+	case common.ImageResizeFill:
+		//按比例缩放到覆盖目标宽高,再居中裁剪
+		scale := max(float64(w)/float64(srcW), float64(h)/float64(srcH))
+		cw, ch := min(srcW, int(float64(w)/scale+0.5)), min(srcH, int(float64(h)/scale+0.5))
+		x, y := b.Min.X+(srcW-cw)/2, b.Min.Y+(srcH-ch)/2
+		img = subImage(img, image.Rect(x, y, x+cw, y+ch))
+	default:
+		scale := 0.0
+		if w > 0 {
+			scale = float64(w) / float64(srcW)
+		}
+		if h > 0 && (scale == 0 || float64(h)/float64(srcH) < scale) {
+			scale = float64(h) / float64(srcH)
+		}
+		w, h = max(1, int(float64(srcW)*scale+0.5)), max(1, int(float64(srcH)*scale+0.5))
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func cropImage(img image.Image, a common.ImageAction) (image.Image, error) {
+	b := img.Bounds()
+	if a.X >= b.Dx() || a.Y >= b.Dy() {
+		return nil, errors.Parameter.AddMsg("图片裁剪的起点超出了图片范围")
+	}
+	rect := image.Rect(b.Min.X+a.X, b.Min.Y+a.Y, b.Max.X, b.Max.Y)
+	if a.Width > 0 {
+		rect.Max.X = min(rect.Min.X+a.Width, b.Max.X)
+	}
+	if a.Height > 0 {
+		rect.Max.Y = min(rect.Min.Y+a.Height, b.Max.Y)
+	}
+	return subImage(img, rect), nil
+}
+
+func subImage(img image.Image, rect image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
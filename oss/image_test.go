@@ -0,0 +1,176 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageProcess(t *testing.T) {
+	p, err := common.ParseImageProcess("image/resize,w_200,h_100,m_fill/crop,x_10,y_20,w_50/format,jpg/quality,q_80")
+	require.NoError(t, err)
+	assert.Equal(t, []common.ImageAction{
+		{Action: common.ImageActionResize, Width: 200, Height: 100, Mode: common.ImageResizeFill},
+		{Action: common.ImageActionCrop, X: 10, Y: 20, Width: 50},
+	}, p.Actions)
+	assert.Equal(t, common.ImageFormatJpeg, p.Format)
+	assert.Equal(t, 80, p.Quality)
+	assert.Equal(t, "image/resize,w_200,h_100,m_fill/crop,x_10,y_20,w_50,h_0/format,jpeg/quality,q_80", p.String())
+
+	//参数顺序不同时规范化的结果一致
+	p1, err := common.ParseImageProcess("image/resize,h_100,w_200")
+	require.NoError(t, err)
+	p2, err := common.ParseImageProcess("image/resize,w_200,h_100,m_lfit")
+	require.NoError(t, err)
+	assert.Equal(t, p1.String(), p2.String())
+
+	for _, process := range []string{
+		"",
+		"image",
+		"video/snapshot,t_1000",
+		"image/resize",
+		"image/resize,w_abc",
+		"image/resize,w_-1",
+		"image/resize,w_99999",
+		"image/resize,w_100,m_fill",
+		"image/resize,w_100,m_pad",
+		"image/format,bmp",
+		"image/quality,q_0",
+		"image/rotate,90",
+	} {
+		_, err := common.ParseImageProcess(process)
+		assert.Error(t, err, process)
+	}
+}
+
+func TestProcessImageData(t *testing.T) {
+	src := testPng(t, 200, 100)
+	cases := []struct {
+		process string
+		format  string
+		width   int
+		height  int
+	}{
+		{"image/resize,w_50", "png", 50, 25},
+		{"image/resize,w_50,h_50", "png", 50, 25},
+		{"image/resize,w_50,h_50,m_fill/format,jpeg", "jpeg", 50, 50},
+		{"image/resize,w_50,h_50,m_fixed", "png", 50, 50},
+		{"image/crop,x_150,y_10,w_100,h_20", "png", 50, 20},
+		{"image/crop,x_10,y_10/resize,h_45/format,webp", "webp", 95, 45},
+	}
+	for _, c := range cases {
+		p, err := common.ParseImageProcess(c.process)
+		require.NoError(t, err)
+		data, err := ProcessImageData(src, p)
+		require.NoError(t, err, c.process)
+		conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+		require.NoError(t, err, c.process)
+		assert.Equal(t, c.format, format, c.process)
+		assert.Equal(t, c.width, conf.Width, c.process)
+		assert.Equal(t, c.height, conf.Height, c.process)
+	}
+
+	p, _ := common.ParseImageProcess("image/crop,x_300,y_0")
+	_, err := ProcessImageData(src, p)
+	assert.Error(t, err)
+	_, err = ProcessImageData([]byte("not an image"), p)
+	assert.Error(t, err)
+}
+
+func TestProcessImage(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range testHandleBackends() {
+		if b.name == "aliyun" { //阿里云使用原生的图片处理
+			continue
+		}
+		t.Run(b.name, func(t *testing.T) {
+			h := &Client{Handle: b.newHandle(t).PublicBucket()}
+			filePath := "img/logo.png"
+			_, err := h.Upload(ctx, filePath, bytes.NewReader(testPng(t, 200, 100)), common.OptionKv{})
+			require.NoError(t, err)
+
+			process := "image/resize,w_50/format,jpeg/quality,q_80"
+			derivedPath, err := ProcessImage(ctx, h, filePath, process)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(derivedPath, "img/"+imageProcessDir+"/logo_"), derivedPath)
+			assert.True(t, strings.HasSuffix(derivedPath, ".jpg"), derivedPath)
+
+			local := filepath.Join(t.TempDir(), "logo.jpg")
+			require.NoError(t, h.GetObjectLocal(ctx, derivedPath, local))
+			data, err := os.ReadFile(local)
+			require.NoError(t, err)
+			conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, 50, conf.Width)
+			assert.Equal(t, 25, conf.Height)
+
+			//相同的参数直接使用缓存
+			again, err := ProcessImage(ctx, h, filePath, "image/quality,q_80/format,jpg/resize,w_50")
+			require.NoError(t, err)
+			assert.Equal(t, derivedPath, again)
+
+			//原图更新后重新处理
+			_, err = h.Upload(ctx, filePath, bytes.NewReader(testPng(t, 100, 100)), common.OptionKv{})
+			require.NoError(t, err)
+			updated, err := ProcessImage(ctx, h, filePath, process)
+			require.NoError(t, err)
+			assert.NotEqual(t, derivedPath, updated)
+
+			u, err := GetProcessUrl(ctx, h, filePath, process, false)
+			require.NoError(t, err)
+			assert.Contains(t, u, imageProcessDir)
+
+			if b.name == "minio" { //本地存储的签名依赖redis
+				opKv := common.OptionKv{}
+				WithImageProcess(process)(&opKv)
+				_, err = h.PrivateBucket().SignedGetUrl(ctx, filePath, 60, opKv)
+				assert.Error(t, err, "私有桶中没有该图片")
+				signed, err := h.SignedGetUrl(ctx, filePath, 60, opKv)
+				require.NoError(t, err)
+				assert.Contains(t, signed, imageProcessDir)
+			}
+
+			_, err = ProcessImage(ctx, h, "img/notExist.png", process)
+			assert.Error(t, err)
+			_, err = ProcessImage(ctx, h, filePath, "image/rotate,90")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAliYunProcessUrl(t *testing.T) {
+	for _, b := range testHandleBackends() {
+		if b.name != "aliyun" {
+			continue
+		}
+		h := &Client{Handle: b.newHandle(t).PublicBucket()}
+		u, err := GetProcessUrl(context.Background(), h, "img/logo.png", "image/resize,w_50", true)
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(u, "img/logo.png?x-oss-process=image/resize,w_50"), u)
+		_, err = GetProcessUrl(context.Background(), h, "img/logo.png", "image/rotate,90", true)
+		assert.Error(t, err)
+	}
+}
+
+func testPng(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
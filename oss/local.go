@@ -4,18 +4,27 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"gitee.com/unitedrhino/share/caches"
 	"gitee.com/unitedrhino/share/conf"
 	"gitee.com/unitedrhino/share/errors"
 	"gitee.com/unitedrhino/share/oss/common"
 	"github.com/google/uuid"
+	"github.com/zeromicro/go-zero/core/collection"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/threading"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type Local struct {
@@ -25,38 +34,57 @@ type Local struct {
 
 func newLocal(conf conf.OssConf) (*Local, error) {
 	conf.CustomPath = "/api/v1/system/common/download-file"
-	_, err := os.Stat(conf.StorePath)
-	if err != nil {
-		err = os.Mkdir(conf.StorePath, os.ModeDir)
-		if err != nil {
-			return nil, err
-		}
-		err = os.Mkdir(fmt.Sprintf("%s%c%s", conf.StorePath, os.PathSeparator, conf.PublicBucketName), os.ModeDir)
-		if err != nil {
-			return nil, err
-		}
-		err = os.Mkdir(fmt.Sprintf("%s%c%s", conf.StorePath, os.PathSeparator, conf.PrivateBucketName), os.ModeDir)
-		if err != nil {
-			return nil, err
-		}
-		err = os.Mkdir(fmt.Sprintf("%s%c%s", conf.StorePath, os.PathSeparator, conf.TemporaryBucketName), os.ModeDir)
+	for _, bucket := range []string{conf.PublicBucketName, conf.PrivateBucketName, conf.TemporaryBucketName} {
+		err := os.MkdirAll(filepath.Join(conf.StorePath, bucket), 0755)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return &Local{setting: conf}, nil
+	m := &Local{setting: conf, currentBucketName: conf.PrivateBucketName} //未选择桶时使用私有桶
+	if conf.TemporaryTTL > 0 {
+		threading.GoSafe(m.runTemporaryJanitor)
+	}
+	return m, nil
 }
+
+// 返回绑定到指定桶的副本,不修改共享的实例,并发安全
+func (m *Local) withBucket(bucketName string) *Local {
+	view := *m
+	view.currentBucketName = bucketName
+	return &view
+}
+
 func (m *Local) PrivateBucket() Handle {
-	m.currentBucketName = m.setting.PrivateBucketName
-	return m
+	return m.withBucket(m.setting.PrivateBucketName)
 }
 func (m *Local) PublicBucket() Handle {
-	m.currentBucketName = m.setting.PublicBucketName
-	return m
+	return m.withBucket(m.setting.PublicBucketName)
 }
 func (m *Local) TemporaryBucket() Handle {
-	m.currentBucketName = m.setting.TemporaryBucketName
-	return m
+	return m.withBucket(m.setting.TemporaryBucketName)
+}
+
+// 文件在磁盘上的路径,不允许通过..或绝对路径访问桶以外的文件
+func (m *Local) objectPath(filePath string) (string, error) {
+	return localObjectPath(m.setting.StorePath, m.currentBucketName, filePath)
+}
+
+func localObjectPath(storePath string, bucket string, filePath string) (string, error) {
+	if bucket == "" || filePath == "" || strings.ContainsRune(filePath, 0) || filepath.IsAbs(filePath) ||
+		strings.HasPrefix(filePath, "/") || filepath.VolumeName(filePath) != "" {
+		return "", errors.Parameter.AddMsg("文件路径错误")
+	}
+	for _, seg := range strings.FieldsFunc(filePath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return "", errors.Parameter.AddMsg("文件路径错误")
+		}
+	}
+	root := filepath.Join(storePath, bucket)
+	path := filepath.Join(root, filepath.FromSlash(filePath))
+	if rel, err := filepath.Rel(root, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", errors.Parameter.AddMsg("文件路径错误")
+	}
+	return path, nil
 }
 
 // 获取put上传url
@@ -82,6 +110,13 @@ func (m *Local) fmtKey(uuid string) string {
 
 // 获取get下载url
 func (m *Local) SignedGetUrl(ctx context.Context, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	if process, ok := opKv.CheckAndGetMinioProcess(); ok { //处理后缓存到桶中
+		derivedPath, err := ProcessImage(ctx, m, filePath, fmt.Sprint(process))
+		if err != nil {
+			return "", err
+		}
+		filePath = derivedPath
+	}
 	path := fmt.Sprintf("%s/%s", m.currentBucketName, filePath)
 	params := url.Values{}
 	params.Add("filePath", path)
@@ -97,8 +132,10 @@ func (m *Local) SignedGetUrl(ctx context.Context, filePath string, expiredSec in
 
 // 删除
 func (m *Local) Delete(ctx context.Context, filePath string, opKv common.OptionKv) error {
-	path := fmt.Sprintf("%s/%s/%s", m.setting.StorePath, m.currentBucketName, filePath)
-
+	path, err := m.objectPath(filePath)
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(path); err == nil {
 		err := os.Remove(path)
 		if err != nil {
@@ -109,7 +146,10 @@ func (m *Local) Delete(ctx context.Context, filePath string, opKv common.OptionK
 }
 
 func (m *Local) IsObjectExist(ctx context.Context, filePath string, opKv common.OptionKv) (bool, error) {
-	path := fmt.Sprintf("%s/%s/%s", m.setting.StorePath, m.currentBucketName, filePath)
+	path, err := m.objectPath(filePath)
+	if err != nil {
+		return false, err
+	}
 	if _, err := os.Stat(path); err == nil {
 		return true, nil
 	}
@@ -117,9 +157,12 @@ func (m *Local) IsObjectExist(ctx context.Context, filePath string, opKv common.
 }
 
 func (m *Local) Upload(ctx context.Context, filePath string, reader io.Reader, opKv common.OptionKv) (string, error) {
-	path := fmt.Sprintf("%s/%s/%s", m.setting.StorePath, m.currentBucketName, filePath)
+	path, err := m.objectPath(filePath)
+	if err != nil {
+		return "", err
+	}
 	dir := filepath.Dir(path)
-	err := os.MkdirAll(dir, 0755)
+	err = os.MkdirAll(dir, 0755)
 	if err != nil {
 		return "", errors.System.AddDetailf("无法创建目录: %v", err)
 	}
@@ -131,31 +174,53 @@ func (m *Local) Upload(ctx context.Context, filePath string, reader io.Reader, o
 	defer file.Close()
 
 	// 将 reader 中的数据复制到文件中
-	_, err = io.Copy(file, reader)
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), reader)
 	if err != nil {
 		return "", errors.System.AddDetailf("写入文件时出错: %v", err)
 	}
+	if info, err := file.Stat(); err == nil {
+		setLocalMd5(path, info, hex.EncodeToString(hash.Sum(nil)))
+	}
 	return m.GetUrl(filePath, false)
 }
 
+// DownloadFile 兼容旧的下载接口,不支持Range及缓存协商,新代码使用ServeFile
 func (m *Local) DownloadFile(ctx context.Context, filePath string, sign string, w http.ResponseWriter) error {
-	if !strings.HasPrefix(filePath, m.setting.TemporaryBucketName) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	return m.ServeFile(ctx, filePath, sign, w, r)
+}
+
+// ServeFile 下载文件,filePath为 桶名/文件路径,非临时桶需要SignedGetUrl生成的签名.
+// 支持Range(视频拖动)及If-None-Match/If-Modified-Since缓存协商
+func (m *Local) ServeFile(ctx context.Context, filePath string, sign string, w http.ResponseWriter, r *http.Request) error {
+	bucket, objectPath, _ := strings.Cut(filePath, "/")
+	if bucket != m.setting.PublicBucketName && bucket != m.setting.PrivateBucketName && bucket != m.setting.TemporaryBucketName {
+		return errors.Parameter.AddMsg("文件路径错误")
+	}
+	path, err := localObjectPath(m.setting.StorePath, bucket, objectPath)
+	if err != nil {
+		return err
+	}
+	if bucket != m.setting.TemporaryBucketName {
 		if sign == "" {
 			return errors.Permissions
 		}
-		bucket, _, _ := strings.Cut(filePath, "/")
-		path, err := caches.GetStore().Get(fmt.Sprintf("oss:local:%s:%s", bucket, sign))
+		signPath, err := caches.GetStore().GetCtx(ctx, fmt.Sprintf("oss:local:%s:%s", bucket, sign))
 		if err != nil {
 			return errors.Permissions.AddDetail(err)
 		}
-		if path != filePath {
+		if signPath != filePath {
 			return errors.Permissions
 		}
 	}
 	// 打开文件
-	file, err := os.Open(fmt.Sprintf(m.setting.StorePath + "/" + filePath))
+	file, err := os.Open(path)
 	if err != nil {
-		return errors.System.AddMsgf("文件不存在").AddDetail(err)
+		return errors.NotFind.AddMsgf("文件不存在").AddDetail(err)
 	}
 	defer file.Close()
 
@@ -164,22 +229,56 @@ func (m *Local) DownloadFile(ctx context.Context, filePath string, sign string,
 	if err != nil {
 		return errors.System.AddMsgf("无法获取文件信息").AddDetail(err)
 	}
-	// 设置响应头
-	// Content-Disposition 用于指定文件名
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileInfo.Name()))
-	// Content-Type 可以根据文件类型设置，这里使用通用的二进制类型
-	w.Header().Set("Content-Type", "application/octet-stream")
-	// Content-Length 用于指定文件大小
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
-	_, err = io.Copy(w, file)
-	if err != nil {
-		return errors.System.AddMsgf("文件下载出错").AddDetail(err)
+	if fileInfo.IsDir() {
+		return errors.NotFind.AddMsgf("文件不存在")
 	}
+	w.Header().Set("Content-Disposition", contentDisposition(fileInfo.Name()))
+	w.Header().Set("Content-Type", common.GetFilePathMineType(fileInfo.Name()))
+	w.Header().Set("ETag", localEtag(fileInfo))
+	//ServeContent会处理Range及缓存协商,并设置Content-Length
+	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
 	return nil
 }
 
+// 文件没有变化时ETag不变,不需要读取文件内容
+func localEtag(fileInfo fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, fileInfo.ModTime().UnixNano(), fileInfo.Size())
+}
+
+// 按RFC 6266生成文件名,非ASCII文件名使用filename*,并带上ASCII的备用文件名
+func contentDisposition(fileName string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r < 0x20 || r == '"' || r == '\\' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, fileName)
+	if fallback == fileName {
+		return fmt.Sprintf(`attachment; filename="%s"`, fileName)
+	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback, rfc5987Escape(fileName))
+}
+
+// RFC 5987中attr-char以外的字符都需要转义
+func rfc5987Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.IndexByte("!#$&+-.^_`|~", c) >= 0) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
 func (m *Local) GetObjectLocal(ctx context.Context, filePath string, localPath string) error {
-	sourceFile, err := os.Open(fmt.Sprintf(m.setting.StorePath + "/" + m.currentBucketName + "/" + filePath))
+	path, err := m.objectPath(filePath)
+	if err != nil {
+		return err
+	}
+	sourceFile, err := os.Open(path)
 	if err != nil {
 		return errors.System.AddMsgf("文件不存在").AddDetail(err)
 	}
@@ -212,53 +311,81 @@ func (m *Local) GetObjectLocal(ctx context.Context, filePath string, localPath s
 }
 
 func (m *Local) GetObjectInfo(ctx context.Context, filePath string) (*common.StorageObjectInfo, error) {
-	// 打开文件
-	file, err := os.Open(fmt.Sprintf(m.setting.StorePath + "/" + m.currentBucketName + "/" + filePath))
+	path, err := m.objectPath(filePath)
 	if err != nil {
-		return nil, errors.System.AddMsgf("文件不存在").AddDetail(err)
-	}
-	defer file.Close()
-
-	// 创建一个新的 MD5 哈希对象
-	hash := md5.New()
-
-	// 将文件内容复制到哈希对象中
-	if _, err := io.Copy(hash, file); err != nil {
 		return nil, err
 	}
-
-	// 获取哈希值的字节切片
-	hashInBytes := hash.Sum(nil)
-
-	// 将字节切片转换为十六进制字符串
-	hashString := hex.EncodeToString(hashInBytes)
-	fileStat, err := file.Stat()
+	md5, info, err := localStatMd5(path)
 	if err != nil {
-		return nil, err
+		return nil, errors.System.AddMsgf("文件不存在").AddDetail(err)
 	}
 	return &common.StorageObjectInfo{
 		FilePath: filePath,
-		Size:     fileStat.Size(),
-		Md5:      hashString,
-	}, err
+		Size:     info.Size(),
+		Md5:      md5,
+	}, nil
 }
 
+// ListObjects 列举时不读取文件内容,Md5只在缓存中有时返回,需要时使用GetObjectInfo获取
+
 func (m *Local) ListObjects(ctx context.Context, prefix string) (ret []*common.StorageObjectInfo, err error) {
-	//objs := m.client.ListObjects(ctx, m.currentBucketName, minio.ListObjectsOptions{Prefix: prefix})
-	//for obj := range objs {
-	//	ret = append(ret, &common.StorageObjectInfo{
-	//		FilePath: obj.Key,
-	//		Size:     obj.Size,
-	//		Md5:      obj.ETag,
-	//	})
-	//}
-	return
+	root := filepath.Join(m.setting.StorePath, m.currentBucketName)
+	//从前缀所在的目录开始遍历,不用遍历整个桶
+	start := root
+	if dir, _, ok := cutLastSlash(prefix); ok {
+		start, err = localObjectPath(m.setting.StorePath, m.currentBucketName, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") { //分片合并中的临时文件
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		filePath := filepath.ToSlash(rel)
+		if !strings.HasPrefix(filePath, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ret = append(ret, &common.StorageObjectInfo{
+			FilePath: filePath,
+			Size:     info.Size(),
+			Md5:      cachedLocalMd5(path, info),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	return ret, nil
+}
+
+func cutLastSlash(s string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, "/"); i > 0 {
+		return s[:i], s[i+1:], true
+	}
+	return "", s, false
 }
 
 func (m *Local) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
-	bucket := m.currentBucketName
-	err := m.TemporaryBucket().GetObjectLocal(context.Background(), tempPath,
-		fmt.Sprintf(m.setting.StorePath+"/"+bucket+"/"+dstPath))
+	path, err := m.objectPath(dstPath)
+	if err != nil {
+		return "", err
+	}
+	err = m.TemporaryBucket().GetObjectLocal(context.Background(), tempPath, path)
 	if err != nil {
 		return "", err
 	}
@@ -267,16 +394,302 @@ func (m *Local) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
 
 // 获取完整链接
 func (m *Local) GetUrl(path string, withHost bool) (string, error) {
-	if path[0] == '/' {
-		path = path[1:]
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", errors.Parameter.AddDetail("oss path is empty")
 	}
 	path = fmt.Sprintf("%s/%s", m.currentBucketName, path)
 	params := url.Values{}
 	params.Add("filePath", path)
+	url := fmt.Sprintf("%s?%s", m.setting.CustomPath, params.Encode())
 	if withHost {
-		url := fmt.Sprintf("%s?%s", m.setting.CustomPath, params.Encode())
-		return m.setting.CustomHost + "/" + url, nil
+		return m.setting.CustomHost + url, nil
 	}
-	url := fmt.Sprintf("%s?%s", m.setting.CustomPath, params.Encode())
 	return url, nil
 }
+
+// CleanTemporary 删除临时桶中修改时间早于before的文件,返回删除的数量
+func (m *Local) CleanTemporary(ctx context.Context, before time.Time) (count int, err error) {
+	root := filepath.Join(m.setting.StorePath, m.setting.TemporaryBucketName)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			logx.WithContext(ctx).Errorf("oss local clean temporary file:%s err:%v", path, err)
+			return nil
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// 本地存储没有生命周期规则,定时清理临时桶中过期的文件
+func (m *Local) runTemporaryJanitor() {
+	ttl := time.Duration(m.setting.TemporaryTTL) * time.Second
+	ticker := time.NewTicker(min(max(ttl/2, time.Minute), 10*time.Minute))
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		count, err := m.CleanTemporary(ctx, time.Now().Add(-ttl))
+		if err != nil {
+			logx.WithContext(ctx).Errorf("oss local clean temporary bucket err:%v", err)
+		} else if count > 0 {
+			logx.WithContext(ctx).Infof("oss local clean temporary bucket count:%d", count)
+		}
+	}
+}
+
+const localMultipartDir = ".multipart" //分片上传的临时目录,在StorePath下
+
+type localMultipartInfo struct {
+	Bucket   string
+	FilePath string
+}
+
+// 分片保存在 StorePath/.multipart/uploadID 目录下,合并时按分片号拼接
+func (m *Local) multipartDir(filePath string, uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", errors.Parameter.AddMsg("上传id错误")
+	}
+	dir := filepath.Join(m.setting.StorePath, localMultipartDir, uploadID)
+	data, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if err != nil {
+		return "", errors.NotFind.AddMsg("分片上传不存在或已经完成").AddDetail(err)
+	}
+	var info localMultipartInfo
+	if err = json.Unmarshal(data, &info); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	if info.Bucket != m.currentBucketName || info.FilePath != filePath {
+		return "", errors.Parameter.AddMsg("上传id与文件不匹配")
+	}
+	return dir, nil
+}
+
+func (m *Local) InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (string, error) {
+	if opKv.IsForbidOverwrite() {
+		if ok, _ := m.IsObjectExist(ctx, filePath, opKv); ok {
+			return "", common.ForbidWriteErr
+		}
+	}
+	uploadID := uuid.NewString()
+	dir := filepath.Join(m.setting.StorePath, localMultipartDir, uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.System.AddDetailf("无法创建目录: %v", err)
+	}
+	data, _ := json.Marshal(localMultipartInfo{Bucket: m.currentBucketName, FilePath: filePath})
+	if err := os.WriteFile(filepath.Join(dir, "upload.json"), data, 0644); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	return uploadID, nil
+}
+
+func (m *Local) UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error) {
+	if partNumber <= 0 || partNumber > MaxPartCount {
+		return nil, errors.Parameter.AddMsgf("分片号错误:%d", partNumber)
+	}
+	dir, err := m.multipartDir(filePath, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	//先写临时文件,避免续传时读到写了一半的分片
+	partPath := filepath.Join(dir, fmt.Sprintf("%d.part", partNumber))
+	file, err := os.CreateTemp(dir, "part-*")
+	if err != nil {
+		return nil, errors.System.AddDetailf("无法创建文件: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err != nil {
+		return nil, errors.System.AddDetailf("写入文件时出错: %v", err)
+	}
+	if size >= 0 && n != size {
+		return nil, errors.Parameter.AddMsgf("分片大小不一致,期望%d实际%d", size, n)
+	}
+	if err = file.Close(); err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	if err = os.Rename(file.Name(), partPath); err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	if info, err := os.Stat(partPath); err == nil {
+		setLocalMd5(partPath, info, hex.EncodeToString(hash.Sum(nil)))
+	}
+	return &common.MultipartPart{PartNumber: partNumber, ETag: hex.EncodeToString(hash.Sum(nil)), Size: n}, nil
+}
+
+func (m *Local) ListParts(ctx context.Context, filePath string, uploadID string) (ret []*common.MultipartPart, err error) {
+	dir, err := m.multipartDir(filePath, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	for _, entry := range entries {
+		numStr, ok := strings.CutSuffix(entry.Name(), ".part")
+		if !ok {
+			continue
+		}
+		partNumber, err := strconv.Atoi(numStr)
+		if err != nil {
+			continue
+		}
+		etag, info, err := localStatMd5(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &common.MultipartPart{PartNumber: partNumber, ETag: etag, Size: info.Size()})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].PartNumber < ret[j].PartNumber })
+	return ret, nil
+}
+
+// 获取分片上传url,和SignedPutUrl一样由业务服务的上传接口调用UploadPart写入
+func (m *Local) SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error) {
+	params := url.Values{}
+	params.Add("filePath", fmt.Sprintf("%s/%s", m.currentBucketName, filePath))
+	params.Add("uploadId", uploadID)
+	params.Add("partNumber", strconv.Itoa(partNumber))
+	return fmt.Sprintf("%s?%s", m.setting.CustomPath, params.Encode()), nil
+}
+
+func (m *Local) CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error) {
+	dir, err := m.multipartDir(filePath, uploadID)
+	if err != nil {
+		return "", err
+	}
+	parts, err = sortParts(parts)
+	if err != nil {
+		return "", err
+	}
+	path, err := m.objectPath(filePath)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", errors.System.AddDetailf("无法创建目录: %v", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", errors.System.AddDetailf("无法创建文件: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	for _, part := range parts {
+		if err = appendLocalPart(file, filepath.Join(dir, fmt.Sprintf("%d.part", part.PartNumber)), part); err != nil {
+			return "", err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	if err = os.Rename(file.Name(), path); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		logx.WithContext(ctx).Errorf("oss local remove multipart dir:%s err:%v", dir, err)
+	}
+	return m.GetUrl(filePath, false)
+}
+
+func appendLocalPart(dst io.Writer, partPath string, part *common.MultipartPart) error {
+	src, err := os.Open(partPath)
+	if err != nil {
+		return errors.Parameter.AddMsgf("分片%d不存在", part.PartNumber).AddDetail(err)
+	}
+	defer src.Close()
+	hash := md5.New()
+	if _, err = io.Copy(io.MultiWriter(dst, hash), src); err != nil {
+		return errors.System.AddDetailf("写入文件时出错: %v", err)
+	}
+	if part.ETag != "" && strings.Trim(part.ETag, `"`) != hex.EncodeToString(hash.Sum(nil)) {
+		return errors.Parameter.AddMsgf("分片%d的ETag不一致", part.PartNumber)
+	}
+	return nil
+}
+
+func (m *Local) AbortMultipart(ctx context.Context, filePath string, uploadID string) error {
+	dir, err := m.multipartDir(filePath, uploadID)
+	if err != nil {
+		return err
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		return errors.System.AddMsg("删除失败").AddDetail(err)
+	}
+	return nil
+}
+
+type localMd5Entry struct {
+	size    int64
+	modTime time.Time
+	md5     string
+}
+
+// 文件md5的缓存,文件大小及修改时间不变时不重新读取文件计算
+var localMd5Cache, _ = collection.NewCache(time.Hour, collection.WithLimit(100000))
+
+func cachedLocalMd5(path string, info fs.FileInfo) string {
+	v, ok := localMd5Cache.Get(path)
+	if !ok {
+		return ""
+	}
+	e := v.(*localMd5Entry)
+	if e.size != info.Size() || !e.modTime.Equal(info.ModTime()) {
+		return ""
+	}
+	return e.md5
+}
+
+func setLocalMd5(path string, info fs.FileInfo, md5 string) {
+	localMd5Cache.Set(path, &localMd5Entry{size: info.Size(), modTime: info.ModTime(), md5: md5})
+}
+
+// 获取文件信息及md5,缓存中没有时读取文件计算
+func localStatMd5(path string) (string, fs.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, errors.System.AddDetail(err)
+	}
+	if info.IsDir() {
+		return "", nil, errors.NotFind.AddDetail(path)
+	}
+	if md5 := cachedLocalMd5(path, info); md5 != "" {
+		return md5, info, nil
+	}
+	md5, _, err := localFileMd5(path)
+	if err != nil {
+		return "", nil, err
+	}
+	setLocalMd5(path, info, md5)
+	return md5, info, nil
+}
+
+func localFileMd5(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, errors.System.AddDetail(err)
+	}
+	defer file.Close()
+	hash := md5.New()
+	n, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, errors.System.AddDetail(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
@@ -0,0 +1,182 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 并发选择不同的桶上传,文件不能写到其他请求选择的桶中
+func TestLocalBucketRace(t *testing.T) {
+	h := newTestLocal(t)
+	c := h.setting
+	cli := &Client{Handle: h}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			handle, bucket := cli.PrivateBucket(), c.PrivateBucketName
+			switch i % 3 {
+			case 1:
+				handle, bucket = cli.PublicBucket(), c.PublicBucketName
+			case 2:
+				handle, bucket = cli.TemporaryBucket(), c.TemporaryBucketName
+			}
+			filePath := fmt.Sprintf("race/%s/%d.txt", bucket, i)
+			_, err := handle.Upload(ctx, filePath, strings.NewReader(bucket), common.OptionKv{})
+			assert.NoError(t, err)
+			u, err := handle.GetUrl(filePath, false)
+			assert.NoError(t, err)
+			assert.Contains(t, u, "filePath="+bucket)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, bucket := range []string{c.PrivateBucketName, c.PublicBucketName, c.TemporaryBucketName} {
+		dir := filepath.Join(c.StorePath, bucket, "race")
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1, "桶%s中出现了其他桶的文件", bucket)
+		assert.Equal(t, bucket, entries[0].Name())
+	}
+	//未选择桶时使用私有桶
+	_, err := cli.Upload(ctx, "default.txt", strings.NewReader("default"), common.OptionKv{})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(c.StorePath, c.PrivateBucketName, "default.txt"))
+}
+
+func newTestLocal(t *testing.T) *Local {
+	c := testOssConf()
+	c.StorePath = t.TempDir()
+	h, err := newLocal(c)
+	require.NoError(t, err)
+	return h
+}
+
+func TestLocalPathSanitize(t *testing.T) {
+	ctx := context.Background()
+	h := newTestLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(h.setting.StorePath, "secret.txt"), []byte("secret"), 0644))
+	for _, p := range []string{"../secret.txt", "a/../../secret.txt", "/etc/passwd", `..\secret.txt`, "", "."} {
+		_, err := h.Upload(ctx, p, strings.NewReader("x"), common.OptionKv{})
+		assert.Error(t, err, p)
+		_, err = h.GetObjectInfo(ctx, p)
+		assert.Error(t, err, p)
+		assert.Error(t, h.Delete(ctx, p, common.OptionKv{}), p)
+	}
+	for _, p := range []string{"ithings-temporary/../secret.txt", "../secret.txt", "ithings-temporary//etc/passwd", "other/a.txt"} {
+		w := httptest.NewRecorder()
+		assert.Error(t, h.ServeFile(ctx, p, "", w, httptest.NewRequest(http.MethodGet, "/", nil)), p)
+	}
+	assert.FileExists(t, filepath.Join(h.setting.StorePath, "secret.txt"))
+	_, err := h.Upload(ctx, "a/./b/../c.txt", strings.NewReader("x"), common.OptionKv{})
+	assert.Error(t, err)
+	_, err = h.Upload(ctx, "a/b/c.txt", strings.NewReader("x"), common.OptionKv{})
+	assert.NoError(t, err)
+}
+
+func TestLocalServeFile(t *testing.T) {
+	ctx := context.Background()
+	h := newTestLocal(t).TemporaryBucket().(*Local)
+	content := strings.Repeat("0123456789", 10)
+	_, err := h.Upload(ctx, "video/录像 1.mp4", strings.NewReader(content), common.OptionKv{})
+	require.NoError(t, err)
+	filePath := h.setting.TemporaryBucketName + "/video/录像 1.mp4"
+
+	w := httptest.NewRecorder()
+	require.NoError(t, h.ServeFile(ctx, filePath, "", w, httptest.NewRequest(http.MethodGet, "/", nil)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "video/mp4", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="__ 1.mp4"; filename*=UTF-8''%E5%BD%95%E5%83%8F%201.mp4`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, content, w.Body.String())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Range", "bytes=10-19")
+	w = httptest.NewRecorder()
+	require.NoError(t, h.ServeFile(ctx, filePath, "", w, r))
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 10-19/100", w.Header().Get("Content-Range"))
+	assert.Equal(t, content[10:20], w.Body.String())
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	require.NoError(t, h.ServeFile(ctx, filePath, "", w, r))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	assert.Equal(t, `attachment; filename="a.png"`, contentDisposition("a.png"))
+	//非临时桶需要签名
+	assert.Error(t, h.ServeFile(ctx, h.setting.PrivateBucketName+"/a.png", "", httptest.NewRecorder(), r))
+}
+
+func TestLocalCleanTemporary(t *testing.T) {
+	ctx := context.Background()
+	h := newTestLocal(t)
+	_, err := h.TemporaryBucket().Upload(ctx, "old/a.txt", strings.NewReader("a"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.TemporaryBucket().Upload(ctx, "new/b.txt", strings.NewReader("b"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PrivateBucket().Upload(ctx, "old/a.txt", strings.NewReader("a"), common.OptionKv{})
+	require.NoError(t, err)
+	old := time.Now().Add(-time.Hour)
+	for _, bucket := range []string{h.setting.TemporaryBucketName, h.setting.PrivateBucketName} {
+		require.NoError(t, os.Chtimes(filepath.Join(h.setting.StorePath, bucket, "old/a.txt"), old, old))
+	}
+
+	count, err := h.CleanTemporary(ctx, time.Now().Add(-30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	list, err := h.TemporaryBucket().ListObjects(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "new/b.txt", list[0].FilePath)
+	//其他桶的文件不受影响
+	list, err = h.PrivateBucket().ListObjects(ctx, "old/")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = h.PrivateBucket().ListObjects(ctx, "ol")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+// 列举不读取文件内容,md5在上传时缓存,文件变化后重新计算
+func TestLocalObjectMd5(t *testing.T) {
+	ctx := context.Background()
+	h := newTestLocal(t).PrivateBucket()
+	_, err := h.Upload(ctx, "md5/a.txt", strings.NewReader("a"), common.OptionKv{})
+	require.NoError(t, err)
+	path := filepath.Join(h.(*Local).setting.StorePath, h.(*Local).currentBucketName, "md5/b.txt")
+	require.NoError(t, os.WriteFile(path, []byte("b"), 0644))
+
+	list, err := h.ListObjects(ctx, "md5/")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "0cc175b9c0f1b6a831c399e269772661", list[0].Md5, "上传时已经缓存")
+	assert.Equal(t, "", list[1].Md5, "列举不读取文件内容")
+
+	info, err := h.GetObjectInfo(ctx, "md5/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "92eb5ffee6ae2fec3ad71c777531578f", info.Md5)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(path, []byte("c"), 0644))
+	require.NoError(t, os.Chtimes(path, later, later))
+	info, err = h.GetObjectInfo(ctx, "md5/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "4a8a08f09d37b73795649038408b5f33", info.Md5, "文件变化后重新计算")
+}
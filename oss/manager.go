@@ -3,8 +3,14 @@ package oss
 import (
 	"gitee.com/unitedrhino/share/conf"
 	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
 )
 
+// NewOssHandle 按配置创建新的存储实例,不是单例,用于迁移等需要同时使用多个存储的场景
+func NewOssHandle(c conf.OssConf) (Handle, error) {
+	return newOssManager(c)
+}
+
 func newOssManager(setting conf.OssConf) (sm Handle, err error) {
 	OssType := setting.OssType
 	switch OssType {
@@ -14,6 +20,8 @@ func newOssManager(setting conf.OssConf) (sm Handle, err error) {
 		sm, err = newMinio(conf.MinioConf{OssConf: setting})
 	case def.OssLocal:
 		sm, err = newLocal(setting)
+	default:
+		err = errors.Parameter.AddMsgf("不支持的oss类型:%s", OssType)
 	}
 	return sm, err
 }
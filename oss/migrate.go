@@ -0,0 +1,383 @@
+package oss
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	BucketPrivate   = "private"
+	BucketPublic    = "public"
+	BucketTemporary = "temporary"
+
+	defaultMigrateConcurrency = 4
+)
+
+// MigrateScene 按业务和场景过滤需要迁移的文件,Scene为空时迁移该业务下的所有场景
+type MigrateScene struct {
+	Business string
+	Scene    string
+}
+
+type MigrateOption struct {
+	Buckets     []string            //需要迁移的桶,默认为私有桶和公开桶,临时桶的文件会过期一般不需要迁移
+	Prefixes    []string            //只迁移符合前缀的文件,默认迁移全部
+	Scenes      []MigrateScene      //只迁移这些业务场景下的文件,路径格式见GenFilePath及GenCommonFilePath
+	DryRun      bool                //只统计需要迁移的文件,不实际复制
+	Checkpoint  string              //断点文件,记录已经迁移完成的文件,中断后再次执行会跳过这些文件
+	Concurrency int                 //并发复制的数量,默认4
+	Progress    func(MigrateRecord) //每处理完一个文件回调一次
+}
+
+const (
+	MigrateStatusCopied  = "copied"  //已复制并校验通过
+	MigrateStatusSkipped = "skipped" //目标中已存在相同的文件或断点中已完成
+	MigrateStatusPending = "pending" //DryRun时需要复制的文件
+	MigrateStatusFailed  = "failed"
+)
+
+type MigrateRecord struct {
+	Bucket   string
+	FilePath string
+	Size     int64
+	Status   string
+	Err      error
+}
+
+type MigrateResult struct {
+	Total   int
+	Copied  int
+	Skipped int
+	Pending int
+	Failed  []MigrateRecord
+	Bytes   int64 //复制的字节数,DryRun时为需要复制的字节数
+}
+
+// Migrate 将src中的文件复制到dst,复制后校验md5,目标中已经存在相同的文件会跳过,所以可以重复执行.
+// 文件复制失败不会中断迁移,失败的文件在MigrateResult.Failed中返回
+func Migrate(ctx context.Context, src, dst Handle, opt MigrateOption) (*MigrateResult, error) {
+	buckets := opt.Buckets
+	if len(buckets) == 0 {
+		buckets = []string{BucketPrivate, BucketPublic}
+	}
+	cp, err := openMigrateCheckpoint(opt.Checkpoint, opt.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer cp.Close()
+	var (
+		ret MigrateResult
+		mu  sync.Mutex
+	)
+	for _, bucket := range buckets {
+		srcBucket, err := selectBucket(src, bucket)
+		if err != nil {
+			return nil, err
+		}
+		dstBucket, err := selectBucket(dst, bucket)
+		if err != nil {
+			return nil, err
+		}
+		objects, err := listMigrateObjects(ctx, srcBucket, opt)
+		if err != nil {
+			return &ret, err
+		}
+		concurrency := opt.Concurrency
+		if concurrency <= 0 {
+			concurrency = defaultMigrateConcurrency
+		}
+		var (
+			wg sync.WaitGroup
+			ch = make(chan *common.StorageObjectInfo)
+		)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for obj := range ch {
+					record := migrateObject(ctx, srcBucket, dstBucket, bucket, obj, opt.DryRun, cp)
+					mu.Lock()
+					ret.add(record)
+					mu.Unlock()
+					if opt.Progress != nil {
+						opt.Progress(record)
+					}
+				}
+			}()
+		}
+		for _, obj := range objects {
+			if ctx.Err() != nil {
+				break
+			}
+			ch <- obj
+		}
+		close(ch)
+		wg.Wait()
+		if ctx.Err() != nil {
+			return &ret, errors.System.AddMsg("迁移被取消").AddDetail(ctx.Err())
+		}
+	}
+	return &ret, nil
+}
+
+func (r *MigrateResult) add(record MigrateRecord) {
+	r.Total++
+	switch record.Status {
+	case MigrateStatusCopied:
+		r.Copied++
+		r.Bytes += record.Size
+	case MigrateStatusSkipped:
+		r.Skipped++
+	case MigrateStatusPending:
+		r.Pending++
+		r.Bytes += record.Size
+	default:
+		r.Failed = append(r.Failed, record)
+	}
+}
+
+func selectBucket(h Handle, bucket string) (Handle, error) {
+	switch bucket {
+	case BucketPrivate:
+		return h.PrivateBucket(), nil
+	case BucketPublic:
+		return h.PublicBucket(), nil
+	case BucketTemporary:
+		return h.TemporaryBucket(), nil
+	}
+	return nil, errors.Parameter.AddMsgf("不支持的桶:%s", bucket)
+}
+
+func listMigrateObjects(ctx context.Context, h Handle, opt MigrateOption) (ret []*common.StorageObjectInfo, err error) {
+	prefixes := opt.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	exist := map[string]struct{}{}
+	for _, prefix := range prefixes {
+		objs, err := h.ListObjects(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			if _, ok := exist[obj.FilePath]; ok || !matchMigrateScene(obj.FilePath, opt.Scenes) {
+				continue
+			}
+			exist[obj.FilePath] = struct{}{}
+			ret = append(ret, obj)
+		}
+	}
+	return ret, nil
+}
+
+// 兼容GenFilePath(svr/tenant/app/business/scene/file),GenCommonFilePath(svr/business/scene/file)
+// 及IsCommonFile(svr/common/business/scene/file)的路径
+func matchMigrateScene(filePath string, scenes []MigrateScene) bool {
+	if len(scenes) == 0 {
+		return true
+	}
+	paths := strings.Split(filePath, "/")
+	for _, s := range scenes {
+		for _, i := range []int{1, 2, 3} {
+			if len(paths) > i+2 && paths[i] == s.Business && (s.Scene == "" || paths[i+1] == s.Scene) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func migrateObject(ctx context.Context, src, dst Handle, bucket string, obj *common.StorageObjectInfo, dryRun bool, cp *migrateCheckpoint) MigrateRecord {
+	record := MigrateRecord{Bucket: bucket, FilePath: obj.FilePath, Size: obj.Size}
+	if cp.Done(bucket, obj.FilePath) {
+		record.Status = MigrateStatusSkipped
+		return record
+	}
+	if info, err := dst.GetObjectInfo(ctx, obj.FilePath); err == nil && info.Size == obj.Size && isPlainMd5(info.Md5) {
+		srcMd5 := obj.Md5
+		if !isPlainMd5(srcMd5) { //列举时没有返回md5(如本地存储),单独获取
+			if srcInfo, err := src.GetObjectInfo(ctx, obj.FilePath); err == nil {
+				srcMd5 = srcInfo.Md5
+			}
+		}
+		if strings.EqualFold(info.Md5, srcMd5) {
+			record.Status = MigrateStatusSkipped
+			cp.Add(bucket, obj.FilePath)
+			return record
+		}
+	}
+	if dryRun {
+		record.Status = MigrateStatusPending
+		return record
+	}
+	if _, err := copyObject(ctx, src, dst, obj.FilePath); err != nil {
+		record.Status = MigrateStatusFailed
+		record.Err = err
+		logx.WithContext(ctx).Errorf("oss migrate bucket:%s filePath:%s err:%v", bucket, obj.FilePath, err)
+		return record
+	}
+	record.Status = MigrateStatusCopied
+	cp.Add(bucket, obj.FilePath)
+	return record
+}
+
+// 将文件从src复制到dst并校验md5,返回文件的md5
+func copyObject(ctx context.Context, src, dst Handle, filePath string) (string, error) {
+	tmp, err := os.CreateTemp("", "oss-copy-*")
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err = src.GetObjectLocal(ctx, filePath, tmp.Name()); err != nil {
+		return "", err
+	}
+	sum, size, err := localFileMd5(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	srcInfo, err := src.GetObjectInfo(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	if srcInfo.Size != size || (isPlainMd5(srcInfo.Md5) && !strings.EqualFold(srcInfo.Md5, sum)) {
+		return "", errors.System.AddMsgf("下载的文件校验失败:%s", filePath)
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	defer f.Close()
+	if _, err = dst.Upload(ctx, filePath, f, common.OptionKv{}); err != nil {
+		return "", err
+	}
+	if err = verifyObject(ctx, dst, filePath, sum, size); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// 校验目标中的文件,分片上传的ETag不是md5,需要下载后计算
+func verifyObject(ctx context.Context, h Handle, filePath string, sum string, size int64) error {
+	info, err := h.GetObjectInfo(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size != size {
+		return errors.System.AddMsgf("文件大小校验失败:%s", filePath)
+	}
+	if isPlainMd5(info.Md5) {
+		if !strings.EqualFold(info.Md5, sum) {
+			return errors.System.AddMsgf("文件md5校验失败:%s", filePath)
+		}
+		return nil
+	}
+	tmp, err := os.CreateTemp("", "oss-verify-*")
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err = h.GetObjectLocal(ctx, filePath, tmp.Name()); err != nil {
+		return err
+	}
+	dstSum, _, err := localFileMd5(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if dstSum != sum {
+		return errors.System.AddMsgf("文件md5校验失败:%s", filePath)
+	}
+	return nil
+}
+
+func isPlainMd5(s string) bool {
+	if len(s) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// 断点文件每行记录一个迁移完成的文件:桶/路径
+type migrateCheckpoint struct {
+	mu   sync.Mutex
+	done map[string]struct{}
+	file *os.File
+}
+
+func openMigrateCheckpoint(path string, readOnly bool) (*migrateCheckpoint, error) {
+	cp := &migrateCheckpoint{done: map[string]struct{}{}}
+	if path == "" {
+		return cp, nil
+	}
+	var (
+		f   *os.File
+		err error
+	)
+	if readOnly { //DryRun时只读取已有的断点,不创建文件
+		f, err = os.Open(path)
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+	} else {
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	}
+	if err != nil {
+		return nil, errors.System.AddMsg("打开断点文件失败").AddDetail(err)
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			cp.done[line] = struct{}{}
+		}
+	}
+	if err = scanner.Err(); err != nil && err != io.EOF {
+		f.Close()
+		return nil, errors.System.AddMsg("读取断点文件失败").AddDetail(err)
+	}
+	if readOnly {
+		f.Close()
+		return cp, nil
+	}
+	cp.file = f
+	return cp, nil
+}
+
+func (c *migrateCheckpoint) Done(bucket, filePath string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.done[bucket+"/"+filePath]
+	return ok
+}
+
+func (c *migrateCheckpoint) Add(bucket, filePath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := bucket + "/" + filePath
+	if _, ok := c.done[key]; ok {
+		return
+	}
+	c.done[key] = struct{}{}
+	if c.file != nil {
+		if _, err := c.file.WriteString(key + "\n"); err != nil {
+			logx.Errorf("oss migrate write checkpoint key:%s err:%v", key, err)
+		}
+	}
+}
+
+func (c *migrateCheckpoint) Close() {
+	if c.file != nil {
+		c.file.Close()
+	}
+}
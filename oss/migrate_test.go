@@ -0,0 +1,150 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	backends := testHandleBackends()
+	src := backends[0].newHandle(t)
+	files := map[string]string{
+		"things/common/" + BusinessOta + "/" + SceneFirmware + "/v1.bin":                   strings.Repeat("firmware", 1024),
+		"things/default/core/" + BusinessDeviceManage + "/" + SceneDeviceImg + "/a.png":    "device image",
+		"things/default/core/" + BusinessUserManage + "/" + SceneHeadIng + "/u.png":        "head image",
+		"things/default/core/" + BusinessProductManage + "/" + SceneProductImg + "/p.png":  "product image",
+		"things/default/core/" + BusinessProductManage + "/" + SceneCategoryImg + "/c.png": "category image",
+	}
+	for filePath, content := range files {
+		_, err := src.PrivateBucket().Upload(ctx, filePath, strings.NewReader(content), common.OptionKv{})
+		require.NoError(t, err)
+	}
+	_, err := src.PublicBucket().Upload(ctx, "things/common/"+BusinessApp+"/logo/app.png", strings.NewReader("app"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = src.TemporaryBucket().Upload(ctx, "tmp/x.txt", strings.NewReader("temporary"), common.OptionKv{})
+	require.NoError(t, err)
+
+	for _, b := range backends[1:] {
+		t.Run(b.name, func(t *testing.T) {
+			dst := b.newHandle(t)
+			scenes := []MigrateScene{{Business: BusinessOta}, {Business: BusinessProductManage, Scene: SceneProductImg}}
+			checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+			ret, err := Migrate(ctx, src, dst, MigrateOption{Buckets: []string{BucketPrivate}, Scenes: scenes, DryRun: true, Checkpoint: checkpoint})
+			require.NoError(t, err)
+			assert.Equal(t, 2, ret.Total)
+			assert.Equal(t, 2, ret.Pending)
+			objs, err := dst.PrivateBucket().ListObjects(ctx, "things/")
+			require.NoError(t, err)
+			assert.Empty(t, objs, "dry run不复制文件")
+			_, err = os.Stat(checkpoint)
+			assert.True(t, os.IsNotExist(err), "dry run不创建断点文件")
+
+			ret, err = Migrate(ctx, src, dst, MigrateOption{Buckets: []string{BucketPrivate}, Scenes: scenes, Checkpoint: checkpoint})
+			require.NoError(t, err)
+			assert.Equal(t, 2, ret.Copied)
+			assert.Empty(t, ret.Failed)
+			assertObjectContent(t, dst.PrivateBucket(), "things/common/"+BusinessOta+"/"+SceneFirmware+"/v1.bin", []byte(files["things/common/"+BusinessOta+"/"+SceneFirmware+"/v1.bin"]))
+			_, err = dst.PrivateBucket().GetObjectInfo(ctx, "things/default/core/"+BusinessProductManage+"/"+SceneCategoryImg+"/c.png")
+			assert.Error(t, err, "不在迁移的场景中")
+			cp, err := os.ReadFile(checkpoint)
+			require.NoError(t, err)
+			assert.Len(t, strings.Split(strings.TrimSpace(string(cp)), "\n"), 2)
+
+			//断点中已经完成的文件直接跳过,其余文件继续迁移
+			var records []MigrateRecord
+			ret, err = Migrate(ctx, src, dst, MigrateOption{Checkpoint: checkpoint, Concurrency: 1, Progress: func(r MigrateRecord) {
+				records = append(records, r)
+			}})
+			require.NoError(t, err)
+			assert.Equal(t, 6, ret.Total)
+			assert.Equal(t, 2, ret.Skipped)
+			assert.Equal(t, 4, ret.Copied)
+			assert.Len(t, records, 6)
+			for filePath, content := range files {
+				assertObjectContent(t, dst.PrivateBucket(), filePath, []byte(content))
+			}
+			assertObjectContent(t, dst.PublicBucket(), "things/common/"+BusinessApp+"/logo/app.png", []byte("app"))
+			_, err = dst.TemporaryBucket().GetObjectInfo(ctx, "tmp/x.txt")
+			assert.Error(t, err, "默认不迁移临时桶")
+
+			//目标中已有相同的文件,没有断点也不会重复复制
+			ret, err = Migrate(ctx, src, dst, MigrateOption{Buckets: []string{BucketPublic}})
+			require.NoError(t, err)
+			assert.Equal(t, 1, ret.Total)
+			if b.name == "aliyun" {
+				assert.Equal(t, 1, ret.Skipped)
+			}
+
+			_, err = Migrate(ctx, src, dst, MigrateOption{Buckets: []string{"other"}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMatchMigrateScene(t *testing.T) {
+	scenes := []MigrateScene{{Business: BusinessOta, Scene: SceneFirmware}, {Business: BusinessUserManage}}
+	assert.True(t, matchMigrateScene("things/common/ota/firmware/v1.bin", scenes))
+	assert.True(t, matchMigrateScene("things/t1/core/ota/firmware/v1.bin", scenes))
+	assert.True(t, matchMigrateScene("things/t1/core/userManage/headImg/u.png", scenes))
+	assert.False(t, matchMigrateScene("things/t1/core/ota/other/v1.bin", scenes))
+	assert.False(t, matchMigrateScene("things/ota/firmware", scenes))
+	assert.True(t, matchMigrateScene("any/path", nil))
+}
+
+func TestMirror(t *testing.T) {
+	ctx := context.Background()
+	backends := testHandleBackends()
+	primary, secondary := backends[0].newHandle(t), backends[1].newHandle(t)
+	h := &Client{Handle: NewMirror(primary, secondary)}
+	filePath := "things/common/" + BusinessDeviceManage + "/" + SceneDeviceImg + "/a.png"
+
+	u, err := h.PrivateBucket().Upload(ctx, filePath, strings.NewReader("image"), common.OptionKv{})
+	require.NoError(t, err)
+	expect, _ := primary.PrivateBucket().GetUrl(filePath, false)
+	assert.Equal(t, expect, u)
+	assertObjectContent(t, primary.PrivateBucket(), filePath, []byte("image"))
+	assertObjectContent(t, secondary.PrivateBucket(), filePath, []byte("image"))
+
+	//直传到主存储的临时桶,复制到正式桶时同步到备份存储
+	_, err = primary.TemporaryBucket().Upload(ctx, "tmp/b.png", strings.NewReader("temp"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PublicBucket().CopyFromTempBucket("tmp/b.png", "things/b.png")
+	require.NoError(t, err)
+	assertObjectContent(t, secondary.PublicBucket(), "things/b.png", []byte("temp"))
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (MinPartSize+1024)/16)
+	_, err = UploadMultipart(ctx, h.PrivateBucket(), "things/v1.bin", bytes.NewReader(content), int64(len(content)), MultipartOption{PartSize: MinPartSize})
+	require.NoError(t, err)
+	assertObjectContent(t, secondary.PrivateBucket(), "things/v1.bin", content)
+
+	require.NoError(t, h.PrivateBucket().Delete(ctx, filePath, common.OptionKv{}))
+	_, err = primary.PrivateBucket().GetObjectInfo(ctx, filePath)
+	assert.Error(t, err)
+	_, err = secondary.PrivateBucket().GetObjectInfo(ctx, filePath)
+	assert.Error(t, err)
+}
+
+func TestNewOssHandle(t *testing.T) {
+	c := testOssConf()
+	c.OssType = "local"
+	c.StorePath = t.TempDir()
+	h1, err := NewOssHandle(c)
+	require.NoError(t, err)
+	c.StorePath = t.TempDir()
+	h2, err := NewOssHandle(c)
+	require.NoError(t, err)
+	assert.NotSame(t, h1, h2)
+
+	c.OssType = "other"
+	_, err = NewOssHandle(c)
+	assert.Error(t, err)
+}
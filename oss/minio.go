@@ -2,16 +2,21 @@ package oss
 
 import (
 	"context"
+	"fmt"
 	"github.com/zeromicro/go-zero/core/logx"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
 	"gitee.com/unitedrhino/share/oss/common"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
 )
 
 type Minio struct {
@@ -38,26 +43,32 @@ func newMinio(conf conf.MinioConf) (*Minio, error) {
 		return nil, err
 	}
 	minioC := &Minio{
-		setting: conf.OssConf,
-		client:  minioClient,
-		core:    core,
+		setting:           conf.OssConf,
+		client:            minioClient,
+		core:              core,
+		currentBucketName: conf.PrivateBucketName, //未选择桶时使用私有桶
 	}
 	logx.Must(minioC.initPrivatePolicy())   //私有桶
 	logx.Must(minioC.initPublicPolicy())    //公共读桶
 	logx.Must(minioC.initTemporaryPolicy()) //临时桶
 	return minioC, nil
 }
+
+// 返回绑定到指定桶的副本,不修改共享的实例,并发安全
+func (m *Minio) withBucket(bucketName string) *Minio {
+	view := *m
+	view.currentBucketName = bucketName
+	return &view
+}
+
 func (m *Minio) PrivateBucket() Handle {
-	m.currentBucketName = m.setting.PrivateBucketName
-	return m
+	return m.withBucket(m.setting.PrivateBucketName)
 }
 func (m *Minio) PublicBucket() Handle {
-	m.currentBucketName = m.setting.PublicBucketName
-	return m
+	return m.withBucket(m.setting.PublicBucketName)
 }
 func (m *Minio) TemporaryBucket() Handle {
-	m.currentBucketName = m.setting.TemporaryBucketName
-	return m
+	return m.withBucket(m.setting.TemporaryBucketName)
 }
 
 // 获取put上传url
@@ -74,6 +85,13 @@ func (m *Minio) SignedPutUrl(ctx context.Context, fileDir string, expiredSec int
 
 // 获取get下载url
 func (m *Minio) SignedGetUrl(ctx context.Context, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	if process, ok := opKv.CheckAndGetMinioProcess(); ok { //minio不支持图片处理,处理后缓存到桶中
+		derivedPath, err := ProcessImage(ctx, m, filePath, fmt.Sprint(process))
+		if err != nil {
+			return "", err
+		}
+		filePath = derivedPath
+	}
 	url, err := m.client.PresignedGetObject(ctx, m.currentBucketName, filePath, time.Duration(expiredSec*int64(time.Second)), opKv.ToMinioReqParams())
 	if err != nil {
 		return "", err
@@ -114,9 +132,11 @@ func (m *Minio) IsObjectExist(ctx context.Context, filePath string, opKv common.
 	return false, err
 }
 func (m *Minio) Upload(ctx context.Context, filePath string, reader io.Reader, opKv common.OptionKv) (string, error) {
-	uploadInfo, err := m.client.PutObject(ctx, m.currentBucketName, filePath, reader, -1, minio.PutObjectOptions{ContentType: common.GetFilePathMineType(filePath), PartSize: 1024 * 1024 * 16})
-	uri, _ := url.Parse(uploadInfo.Location)
-	return m.setting.CustomPath + uri.RequestURI(), err
+	_, err := m.client.PutObject(ctx, m.currentBucketName, filePath, reader, -1, minio.PutObjectOptions{ContentType: common.GetFilePathMineType(filePath), PartSize: 1024 * 1024 * 16})
+	if err != nil {
+		return "", err
+	}
+	return m.GetUrl(filePath, false)
 }
 
 func (m *Minio) GetObjectLocal(ctx context.Context, filePath string, localPath string) error {
@@ -138,8 +158,12 @@ func (m *Minio) GetObjectInfo(ctx context.Context, filePath string) (*common.Sto
 }
 
 func (m *Minio) ListObjects(ctx context.Context, prefix string) (ret []*common.StorageObjectInfo, err error) {
-	objs := m.client.ListObjects(ctx, m.currentBucketName, minio.ListObjectsOptions{Prefix: prefix})
+	//不设置Recursive时只返回第一级的目录
+	objs := m.client.ListObjects(ctx, m.currentBucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
 	for obj := range objs {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
 		ret = append(ret, &common.StorageObjectInfo{
 			FilePath: obj.Key,
 			Size:     obj.Size,
@@ -202,31 +226,6 @@ func (m *Minio) initPublicPolicy() error {
 	return err
 }
 func (m *Minio) initTemporaryPolicy() error {
-	// TODO: 临时桶的自动过期删除文件的策略还没有实现
-	// rule := `{
-	// 	"Rules": [
-	// 		{
-	// 			"Expiration": {
-	// 				"Date": "2020-04-07T02:00:00.000Z"
-	// 			},
-	// 			"ID": "Delete very old messenger pictures",
-	// 			"Filter": {
-	// 				"Prefix": "uploads/2015/"
-	// 			},
-	// 			"Msg": "Enabled"
-	// 		},
-	// 		{
-	// 			"Expiration": {
-	// 				"Days": 7
-	// 			},
-	// 			"ID": "Delete temporary uploads",
-	// 			"Filter": {
-	// 				"Prefix": "temporary-uploads/"
-	// 			},
-	// 			"Msg": "Enabled"
-	// 		}
-	// 	]
-	// }`
 	if exists, err := m.client.BucketExists(context.Background(), m.setting.TemporaryBucketName); err != nil {
 		return err
 	} else if !exists {
@@ -264,11 +263,41 @@ func (m *Minio) initTemporaryPolicy() error {
 		]
 	  }`
 		err := m.client.SetBucketPolicy(context.Background(), m.setting.TemporaryBucketName, publicProcyString)
-		return err
+		if err != nil {
+			return err
+		}
+	}
+	if err := m.initTemporaryLifecycle(); err != nil {
+		//没有配置生命周期的权限时不影响使用
+		logx.Errorf("minio set temporary bucket lifecycle err:%v", err)
 	}
 	return nil
 }
 
+// 临时桶的文件到期自动删除,只新增或更新自己的规则,保留桶上已有的其他规则
+func (m *Minio) initTemporaryLifecycle() error {
+	ctx := context.Background()
+	config, err := m.client.GetBucketLifecycle(ctx, m.setting.TemporaryBucketName)
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode != http.StatusNotFound { //404表示还没有配置生命周期
+			return err
+		}
+		config = lifecycle.NewConfiguration()
+	}
+	rules := config.Rules[:0]
+	for _, r := range config.Rules {
+		if r.ID != temporaryLifecycleID {
+			rules = append(rules, r)
+		}
+	}
+	config.Rules = append(rules, lifecycle.Rule{
+		ID:         temporaryLifecycleID,
+		Status:     "Enabled",
+		Expiration: lifecycle.Expiration{Days: temporaryExpireDays},
+	})
+	return m.client.SetBucketLifecycle(ctx, m.setting.TemporaryBucketName, config)
+}
+
 func (m *Minio) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
 	src := minio.CopySrcOptions{
 		Bucket: m.setting.TemporaryBucketName,
@@ -288,11 +317,76 @@ func (m *Minio) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
 
 // 获取完整链接
 func (m *Minio) GetUrl(path string, withHost bool) (string, error) {
-	if path[0] == '/' {
-		path = path[1:]
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", errors.Parameter.AddDetail("oss path is empty")
 	}
 	if withHost {
 		return m.setting.CustomHost + "/" + m.currentBucketName + "/" + path, nil
 	}
 	return m.setting.CustomPath + "/" + m.currentBucketName + "/" + path, nil
 }
+
+func (m *Minio) InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (string, error) {
+	if err := m.checkForbidOverwrite(ctx, filePath, opKv); err != nil {
+		return "", err
+	}
+	return m.core.NewMultipartUpload(ctx, m.currentBucketName, filePath, minio.PutObjectOptions{ContentType: common.GetFilePathMineType(filePath)})
+}
+
+func (m *Minio) UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error) {
+	part, err := m.core.PutObjectPart(ctx, m.currentBucketName, filePath, uploadID, partNumber, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &common.MultipartPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (m *Minio) ListParts(ctx context.Context, filePath string, uploadID string) (ret []*common.MultipartPart, err error) {
+	marker := 0
+	for {
+		result, err := m.core.ListObjectParts(ctx, m.currentBucketName, filePath, uploadID, marker, MaxPartCount)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.ObjectParts {
+			ret = append(ret, &common.MultipartPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size})
+		}
+		if !result.IsTruncated {
+			return ret, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// 获取分片的put上传url
+func (m *Minio) SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(partNumber))
+	params.Set("uploadId", uploadID)
+	u, err := m.client.Presign(ctx, http.MethodPut, m.currentBucketName, filePath, time.Duration(expiredSec)*time.Second, params)
+	if err != nil {
+		return "", err
+	}
+	return m.setting.CustomPath + u.RequestURI(), nil
+}
+
+func (m *Minio) CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error) {
+	parts, err := sortParts(parts)
+	if err != nil {
+		return "", err
+	}
+	var completeParts []minio.CompletePart
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	_, err = m.core.CompleteMultipartUpload(ctx, m.currentBucketName, filePath, uploadID, completeParts, minio.PutObjectOptions{})
+	if err != nil {
+		return "", err
+	}
+	return m.GetUrl(filePath, false)
+}
+
+func (m *Minio) AbortMultipart(ctx context.Context, filePath string, uploadID string) error {
+	return m.core.AbortMultipartUpload(ctx, m.currentBucketName, filePath, uploadID)
+}
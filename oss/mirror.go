@@ -0,0 +1,181 @@
+package oss
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Mirror 双写存储,用于切换存储期间保持新旧存储一致.读操作只访问主存储,写操作同时写入备份存储,
+// 备份存储写入失败只记录日志,不影响业务,可以之后通过Migrate补齐
+type Mirror struct {
+	primary   Handle
+	secondary Handle
+}
+
+func NewMirror(primary, secondary Handle) *Mirror {
+	return &Mirror{primary: unwrapHandle(primary), secondary: unwrapHandle(secondary)}
+}
+
+func (m *Mirror) Primary() Handle {
+	return m.primary
+}
+
+func (m *Mirror) Secondary() Handle {
+	return m.secondary
+}
+
+func (m *Mirror) PrivateBucket() Handle {
+	return &Mirror{primary: m.primary.PrivateBucket(), secondary: m.secondary.PrivateBucket()}
+}
+
+func (m *Mirror) PublicBucket() Handle {
+	return &Mirror{primary: m.primary.PublicBucket(), secondary: m.secondary.PublicBucket()}
+}
+
+func (m *Mirror) TemporaryBucket() Handle {
+	return &Mirror{primary: m.primary.TemporaryBucket(), secondary: m.secondary.TemporaryBucket()}
+}
+
+// SignedPutUrl 直传只上传到主存储,从临时桶复制到正式桶时再同步到备份存储
+func (m *Mirror) SignedPutUrl(ctx context.Context, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	return m.primary.SignedPutUrl(ctx, filePath, expiredSec, opKv)
+}
+
+func (m *Mirror) SignedGetUrl(ctx context.Context, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	return m.primary.SignedGetUrl(ctx, filePath, expiredSec, opKv)
+}
+
+func (m *Mirror) Delete(ctx context.Context, filePath string, opKv common.OptionKv) error {
+	if err := m.primary.Delete(ctx, filePath, opKv); err != nil {
+		return err
+	}
+	if err := m.secondary.Delete(ctx, filePath, opKv); err != nil {
+		logx.WithContext(ctx).Errorf("oss mirror delete secondary filePath:%s err:%v", filePath, err)
+	}
+	return nil
+}
+
+// Upload 数据先缓存到临时文件,再分别上传到两个存储
+func (m *Mirror) Upload(ctx context.Context, filePath string, reader io.Reader, opKv common.OptionKv) (string, error) {
+	tmp, err := os.CreateTemp("", "oss-mirror-*")
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if _, err = io.Copy(tmp, reader); err != nil {
+		return "", errors.System.AddMsg("读取上传的数据失败").AddDetail(err)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	ret, err := m.primary.Upload(ctx, filePath, tmp, opKv)
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err == nil {
+		_, err = m.secondary.Upload(ctx, filePath, tmp, common.OptionKv{})
+	}
+	if err != nil {
+		logx.WithContext(ctx).Errorf("oss mirror upload secondary filePath:%s err:%v", filePath, err)
+	}
+	return ret, nil
+}
+
+func (m *Mirror) GetObjectInfo(ctx context.Context, filePath string) (*common.StorageObjectInfo, error) {
+	return m.primary.GetObjectInfo(ctx, filePath)
+}
+
+func (m *Mirror) GetObjectLocal(ctx context.Context, filePath string, localPath string) error {
+	return m.primary.GetObjectLocal(ctx, filePath, localPath)
+}
+
+func (m *Mirror) ListObjects(ctx context.Context, prefix string) ([]*common.StorageObjectInfo, error) {
+	return m.primary.ListObjects(ctx, prefix)
+}
+
+// CopyFromTempBucket 备份存储的临时桶中没有直传的文件,从主存储复制过去
+func (m *Mirror) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
+	ret, err := m.primary.CopyFromTempBucket(tempPath, dstPath)
+	if err != nil {
+		return "", err
+	}
+	m.syncSecondary(context.Background(), dstPath)
+	return ret, nil
+}
+
+func (m *Mirror) GetUrl(path string, withHost bool) (string, error) {
+	return m.primary.GetUrl(path, withHost)
+}
+
+func (m *Mirror) syncSecondary(ctx context.Context, filePath string) {
+	if _, err := copyObject(ctx, m.primary, m.secondary, filePath); err != nil {
+		logx.WithContext(ctx).Errorf("oss mirror sync secondary filePath:%s err:%v", filePath, err)
+	}
+}
+
+func (m *Mirror) multipart() (MultipartHandle, error) {
+	return GetMultipartHandle(m.primary)
+}
+
+// 分片上传在主存储上进行,合并后再同步到备份存储
+
+func (m *Mirror) InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (string, error) {
+	mh, err := m.multipart()
+	if err != nil {
+		return "", err
+	}
+	return mh.InitiateMultipart(ctx, filePath, opKv)
+}
+
+func (m *Mirror) UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error) {
+	mh, err := m.multipart()
+	if err != nil {
+		return nil, err
+	}
+	return mh.UploadPart(ctx, filePath, uploadID, partNumber, reader, size)
+}
+
+func (m *Mirror) ListParts(ctx context.Context, filePath string, uploadID string) ([]*common.MultipartPart, error) {
+	mh, err := m.multipart()
+	if err != nil {
+		return nil, err
+	}
+	return mh.ListParts(ctx, filePath, uploadID)
+}
+
+func (m *Mirror) SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error) {
+	mh, err := m.multipart()
+	if err != nil {
+		return "", err
+	}
+	return mh.SignedPartUrl(ctx, filePath, uploadID, partNumber, expiredSec)
+}
+
+func (m *Mirror) CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error) {
+	mh, err := m.multipart()
+	if err != nil {
+		return "", err
+	}
+	ret, err := mh.CompleteMultipart(ctx, filePath, uploadID, parts)
+	if err != nil {
+		return "", err
+	}
+	m.syncSecondary(ctx, filePath)
+	return ret, nil
+}
+
+func (m *Mirror) AbortMultipart(ctx context.Context, filePath string, uploadID string) error {
+	mh, err := m.multipart()
+	if err != nil {
+		return err
+	}
+	return mh.AbortMultipart(ctx, filePath, uploadID)
+}
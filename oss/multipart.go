@@ -0,0 +1,182 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	DefaultPartSize = 16 * 1024 * 1024 //默认的分片大小
+	MinPartSize     = 5 * 1024 * 1024  //除最后一个分片外,分片不能小于5M(s3的限制)
+	MaxPartCount    = 10000            //分片数量上限
+)
+
+// MultipartHandle 分片上传,用于固件及录像等大文件,所有存储后端都实现了该接口
+type MultipartHandle interface {
+	//初始化分片上传,返回上传id
+	InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (uploadID string, err error)
+	//上传一个分片,partNumber从1开始
+	UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error)
+	//列出已经上传的分片,用于断点续传
+	ListParts(ctx context.Context, filePath string, uploadID string) ([]*common.MultipartPart, error)
+	//提供带签名的分片上传url,浏览器直传分片后通过ETag完成上传
+	SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error)
+	//按分片号合并分片,返回文件的url
+	CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error)
+	//取消上传并删除已上传的分片
+	AbortMultipart(ctx context.Context, filePath string, uploadID string) error
+}
+
+// ProgressFunc 上传进度回调,uploaded为已上传的字节数,total未知时为-1
+type ProgressFunc func(uploaded int64, total int64)
+
+type MultipartOption struct {
+	PartSize int64           //分片大小,默认16M
+	UploadID string          //续传时传入上次的上传id,已上传的分片会跳过
+	Progress ProgressFunc    //上传进度回调
+	OpKv     common.OptionKv //初始化上传时的参数
+}
+
+type MultipartResult struct {
+	UploadID string //上传出错时可以用该id续传
+	Url      string
+}
+
+// GetMultipartHandle 获取handle的分片上传接口
+func GetMultipartHandle(h Handle) (MultipartHandle, error) {
+	mh, ok := unwrapHandle(h).(MultipartHandle)
+	if !ok {
+		return nil, errors.NotRealize.AddMsg("该存储不支持分片上传")
+	}
+	return mh, nil
+}
+
+// UploadMultipart 分片上传大小已知的文件,出错时返回的结果中带有UploadID,可以通过MultipartOption.UploadID续传
+func UploadMultipart(ctx context.Context, h Handle, filePath string, reader io.ReaderAt, size int64, opt MultipartOption) (*MultipartResult, error) {
+	mh, err := GetMultipartHandle(h)
+	if err != nil {
+		return nil, err
+	}
+	partSize := getPartSize(size, opt.PartSize)
+	ret := MultipartResult{UploadID: opt.UploadID}
+	uploaded := map[int]*common.MultipartPart{}
+	if ret.UploadID == "" {
+		ret.UploadID, err = mh.InitiateMultipart(ctx, filePath, opt.OpKv)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		parts, err := mh.ListParts(ctx, filePath, ret.UploadID)
+		if err != nil {
+			return &ret, err
+		}
+		for _, p := range parts {
+			uploaded[p.PartNumber] = p
+		}
+	}
+	var (
+		parts []*common.MultipartPart
+		done  int64
+	)
+	for partNumber, offset := 1, int64(0); offset < size || partNumber == 1; partNumber, offset = partNumber+1, offset+partSize {
+		length := min(partSize, size-offset)
+		part := uploaded[partNumber]
+		if part == nil || part.Size != length { //大小不一致说明分片大小变了,需要重新上传
+			part, err = mh.UploadPart(ctx, filePath, ret.UploadID, partNumber, io.NewSectionReader(reader, offset, length), length)
+			if err != nil {
+				return &ret, err
+			}
+		}
+		parts = append(parts, part)
+		done += length
+		if opt.Progress != nil {
+			opt.Progress(done, size)
+		}
+	}
+	ret.Url, err = mh.CompleteMultipart(ctx, filePath, ret.UploadID, parts)
+	return &ret, err
+}
+
+// UploadStream 分片上传大小未知的流,如录像,每次读取一个分片上传,不支持续传
+func UploadStream(ctx context.Context, h Handle, filePath string, reader io.Reader, opt MultipartOption) (*MultipartResult, error) {
+	mh, err := GetMultipartHandle(h)
+	if err != nil {
+		return nil, err
+	}
+	partSize := getPartSize(-1, opt.PartSize)
+	ret := MultipartResult{}
+	ret.UploadID, err = mh.InitiateMultipart(ctx, filePath, opt.OpKv)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		parts []*common.MultipartPart
+		done  int64
+		buf   = make([]byte, partSize)
+	)
+	for partNumber := 1; ; partNumber++ {
+		n, rerr := io.ReadFull(reader, buf)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			abortMultipart(ctx, mh, filePath, ret.UploadID)
+			return nil, errors.System.AddMsg("读取上传的数据失败").AddDetail(rerr)
+		}
+		if n > 0 || partNumber == 1 {
+			part, err := mh.UploadPart(ctx, filePath, ret.UploadID, partNumber, bytes.NewReader(buf[:n]), int64(n))
+			if err != nil {
+				abortMultipart(ctx, mh, filePath, ret.UploadID)
+				return nil, err
+			}
+			parts = append(parts, part)
+			done += int64(n)
+			if opt.Progress != nil {
+				opt.Progress(done, -1)
+			}
+		}
+		if rerr != nil {
+			break
+		}
+	}
+	ret.Url, err = mh.CompleteMultipart(ctx, filePath, ret.UploadID, parts)
+	return &ret, err
+}
+
+func abortMultipart(ctx context.Context, mh MultipartHandle, filePath string, uploadID string) {
+	if err := mh.AbortMultipart(ctx, filePath, uploadID); err != nil {
+		logx.WithContext(ctx).Errorf("oss abort multipart upload filePath:%s uploadID:%s err:%v", filePath, uploadID, err)
+	}
+}
+
+// 分片数量不能超过上限,文件很大时需要调大分片
+func getPartSize(size int64, partSize int64) int64 {
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < MinPartSize {
+		partSize = MinPartSize
+	}
+	if size > 0 && (size+partSize-1)/partSize > MaxPartCount {
+		partSize = (size + MaxPartCount - 1) / MaxPartCount
+	}
+	return partSize
+}
+
+// 合并前按分片号排序,分片号不能重复
+func sortParts(parts []*common.MultipartPart) ([]*common.MultipartPart, error) {
+	if len(parts) == 0 {
+		return nil, errors.Parameter.AddMsg("没有上传的分片")
+	}
+	ret := append([]*common.MultipartPart{}, parts...)
+	sort.Slice(ret, func(i, j int) bool { return ret[i].PartNumber < ret[j].PartNumber })
+	for i, p := range ret {
+		if p.PartNumber <= 0 || (i > 0 && p.PartNumber == ret[i-1].PartNumber) {
+			return nil, errors.Parameter.AddMsgf("分片号错误:%d", p.PartNumber)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,100 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789abcdef"), (MinPartSize*2+1024)/16)
+	for _, b := range testHandleBackends() {
+		t.Run(b.name, func(t *testing.T) {
+			h := b.newHandle(t).PrivateBucket()
+			mh, err := GetMultipartHandle(&Client{Handle: h})
+			require.NoError(t, err)
+			filePath := BusinessOta + "/" + SceneFirmware + "/v1.0.0.bin"
+
+			//先上传第一个分片,模拟中断后续传
+			uploadID, err := mh.InitiateMultipart(ctx, filePath, common.OptionKv{})
+			require.NoError(t, err)
+			_, err = mh.UploadPart(ctx, filePath, uploadID, 1, bytes.NewReader(content[:MinPartSize]), MinPartSize)
+			require.NoError(t, err)
+			parts, err := mh.ListParts(ctx, filePath, uploadID)
+			require.NoError(t, err)
+			require.Len(t, parts, 1)
+			assert.Equal(t, int64(MinPartSize), parts[0].Size)
+
+			signed, err := mh.SignedPartUrl(ctx, filePath, uploadID, 2, 60)
+			require.NoError(t, err)
+			assert.Contains(t, signed, "uploadId="+uploadID)
+			assert.Contains(t, signed, "partNumber=2")
+
+			var progress []int64
+			ret, err := UploadMultipart(ctx, h, filePath, bytes.NewReader(content), int64(len(content)), MultipartOption{
+				PartSize: MinPartSize,
+				UploadID: uploadID,
+				Progress: func(uploaded int64, total int64) {
+					assert.Equal(t, int64(len(content)), total)
+					progress = append(progress, uploaded)
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, uploadID, ret.UploadID)
+			assert.Equal(t, []int64{MinPartSize, MinPartSize * 2, int64(len(content))}, progress)
+			assertObjectContent(t, h, filePath, content)
+
+			//大小未知的流
+			ret, err = UploadStream(ctx, h, filePath, bytes.NewReader(content), MultipartOption{PartSize: MinPartSize})
+			require.NoError(t, err)
+			assert.NotEmpty(t, ret.Url)
+			assertObjectContent(t, h, filePath, content)
+			ret, err = UploadStream(ctx, h, "empty.bin", strings.NewReader(""), MultipartOption{})
+			require.NoError(t, err)
+			assertObjectContent(t, h, "empty.bin", []byte{})
+
+			uploadID, err = mh.InitiateMultipart(ctx, filePath, common.OptionKv{})
+			require.NoError(t, err)
+			require.NoError(t, mh.AbortMultipart(ctx, filePath, uploadID))
+			_, err = mh.ListParts(ctx, filePath, uploadID)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLocalMultipartCheck(t *testing.T) {
+	ctx := context.Background()
+	c := testOssConf()
+	c.StorePath = t.TempDir()
+	l, err := newLocal(c)
+	require.NoError(t, err)
+	uploadID, err := l.InitiateMultipart(ctx, "a.bin", common.OptionKv{})
+	require.NoError(t, err)
+	_, err = l.PublicBucket().(*Local).UploadPart(ctx, "a.bin", uploadID, 1, strings.NewReader("a"), 1)
+	assert.Error(t, err, "上传id不属于该桶")
+	_, err = l.UploadPart(ctx, "a.bin", "../../etc", 1, strings.NewReader("a"), 1)
+	assert.Error(t, err)
+	part, err := l.UploadPart(ctx, "a.bin", uploadID, 1, strings.NewReader("a"), 1)
+	require.NoError(t, err)
+	part.ETag = "bad"
+	_, err = l.CompleteMultipart(ctx, "a.bin", uploadID, []*common.MultipartPart{part})
+	assert.Error(t, err)
+	_, err = l.CompleteMultipart(ctx, "a.bin", uploadID, nil)
+	assert.Error(t, err)
+}
+
+func assertObjectContent(t *testing.T, h Handle, filePath string, content []byte) {
+	localPath := filepath.Join(t.TempDir(), filepath.Base(filePath))
+	require.NoError(t, h.GetObjectLocal(context.Background(), filePath, localPath))
+	data, err := os.ReadFile(localPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, data), "文件内容不一致")
+}
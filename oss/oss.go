@@ -22,7 +22,7 @@ type Handle interface {
 	GetObjectLocal(ctx context.Context, filePath string, localPath string) error
 	//列出符合前缀的文件列表
 	ListObjects(ctx context.Context, prefix string) (ret []*common.StorageObjectInfo, err error)
-	//获取私有桶
+	//获取私有桶,以下三个函数返回绑定到对应桶的新Handle,不会修改当前Handle,可以并发使用
 	PrivateBucket() Handle
 	//获取公开桶
 	PublicBucket() Handle
@@ -33,3 +33,8 @@ type Handle interface {
 	//不带过期时间的获取文件url
 	GetUrl(path string, withHost bool) (string, error)
 }
+
+const (
+	temporaryLifecycleID = "temporary-expire" //临时桶生命周期规则的id
+	temporaryExpireDays  = 1                  //临时桶文件的保存天数,对象存储的生命周期最小粒度为天
+)
@@ -0,0 +1,173 @@
+package oss
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"gitee.com/unitedrhino/share/errors"
+	_ "golang.org/x/image/webp"
+)
+
+// UploadPolicy 场景的上传策略,文件类型按文件内容检测,不信任文件名及请求头中的类型
+type UploadPolicy struct {
+	MaxSize    int64    //文件大小上限,0为不限制
+	MimeTypes  []string //允许的文件类型,支持image/*的写法,为空不限制
+	Exts       []string //允许的后缀名,如.png,为空不限制
+	MaxWidth   int      //图片的宽高上限,0为不限制,设置后文件必须是可以解析的图片
+	MaxHeight  int
+	MaxNameLen int //文件名长度上限,0为不限制
+}
+
+var (
+	imagePolicy = UploadPolicy{
+		MaxSize:    10 * 1024 * 1024,
+		MimeTypes:  []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+		Exts:       []string{".jpg", ".jpeg", ".png", ".gif", ".webp"},
+		MaxWidth:   8192,
+		MaxHeight:  8192,
+		MaxNameLen: 255,
+	}
+	firmwarePolicy = UploadPolicy{
+		MaxSize:    1024 * 1024 * 1024,
+		MaxNameLen: 255,
+	}
+	uploadPolicies = map[string]UploadPolicy{
+		"/" + SceneDeviceImg:              imagePolicy,
+		"/" + SceneProductImg:             imagePolicy,
+		"/" + SceneCategoryImg:            imagePolicy,
+		"/" + SceneHeadIng:                imagePolicy,
+		"/" + SceneBackgroundImg:          imagePolicy,
+		"/" + SceneLogoImg:                imagePolicy,
+		BusinessOta + "/" + SceneFirmware: firmwarePolicy,
+	}
+	uploadPolicyMutex sync.RWMutex
+
+	// 文件名中不允许出现的字符
+	fileNameSpcChar = strings.Join([]string{`,`, `?`, `*`, `|`, `{`, `}`, `\`, `$`, `、`, `·`, "`", `'`, `"`}, "")
+)
+
+// RegisterUploadPolicy 注册或覆盖场景的上传策略,business为空时对所有业务的该场景生效
+func RegisterUploadPolicy(business, scene string, policy UploadPolicy) {
+	uploadPolicyMutex.Lock()
+	defer uploadPolicyMutex.Unlock()
+	uploadPolicies[business+"/"+scene] = policy
+}
+
+// GetUploadPolicy 获取场景的上传策略,优先使用指定业务的策略
+func GetUploadPolicy(business, scene string) (UploadPolicy, bool) {
+	uploadPolicyMutex.RLock()
+	defer uploadPolicyMutex.RUnlock()
+	if p, ok := uploadPolicies[business+"/"+scene]; ok {
+		return p, true
+	}
+	p, ok := uploadPolicies["/"+scene]
+	return p, ok
+}
+
+// FindUploadPolicy 从文件路径中找到场景的上传策略,兼容GetSceneInfo,GenFilePath及GenCommonFilePath的路径
+func FindUploadPolicy(filePath string) (UploadPolicy, bool) {
+	paths := strings.Split(strings.TrimPrefix(filePath, "/"), "/")
+	for i := 0; i <= 3 && i+2 < len(paths); i++ {
+		if p, ok := GetUploadPolicy(paths[i], paths[i+1]); ok {
+			return p, true
+		}
+	}
+	return UploadPolicy{}, false
+}
+
+// CheckFileName 检查文件名,不能包含特殊字符,控制字符及路径
+func CheckFileName(fileName string) error {
+	if fileName == "" || fileName == "." || fileName == ".." || strings.ContainsAny(fileName, "/") {
+		return errors.FileNameError.AddMsgf("文件名不合法:%s", fileName)
+	}
+	if strings.ContainsAny(fileName, fileNameSpcChar) {
+		return errors.FileNameError.AddMsg("包含特殊字符")
+	}
+	if !utf8.ValidString(fileName) || strings.IndexFunc(fileName, unicode.IsControl) >= 0 {
+		return errors.FileNameError.AddMsg("包含控制字符")
+	}
+	return nil
+}
+
+// Check 按策略检查文件,返回按内容检测到的文件类型
+func (p UploadPolicy) Check(fileName string, reader io.ReaderAt, size int64) (string, error) {
+	if err := CheckFileName(fileName); err != nil {
+		return "", err
+	}
+	if p.MaxNameLen > 0 && utf8.RuneCountInString(fileName) > p.MaxNameLen {
+		return "", errors.FileNameError.AddMsgf("文件名不能超过%d个字符", p.MaxNameLen)
+	}
+	ext := strings.ToLower(path.Ext(fileName))
+	if len(p.Exts) > 0 && !containsFold(p.Exts, ext) {
+		return "", errors.FileType.AddMsgf("不支持的文件后缀:%s", ext)
+	}
+	if p.MaxSize > 0 && size > p.MaxSize {
+		return "", errors.FileTooLarge.AddMsgf("文件不能超过%d字节", p.MaxSize)
+	}
+	head := make([]byte, 512)
+	n, err := reader.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", errors.System.AddDetail(err)
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	if len(p.MimeTypes) > 0 && !matchMimeType(p.MimeTypes, mimeType) {
+		return "", errors.FileType.AddMsgf("不支持的文件类型:%s", mimeType)
+	}
+	if p.MaxWidth > 0 || p.MaxHeight > 0 {
+		conf, _, err := image.DecodeConfig(io.NewSectionReader(reader, 0, size))
+		if err != nil {
+			return "", errors.FileType.AddMsg("无法解析的图片").AddDetail(err)
+		}
+		if (p.MaxWidth > 0 && conf.Width > p.MaxWidth) || (p.MaxHeight > 0 && conf.Height > p.MaxHeight) {
+			return "", errors.FileTooLarge.AddMsgf("图片宽高不能超过%dx%d", p.MaxWidth, p.MaxHeight)
+		}
+	}
+	return mimeType, nil
+}
+
+// CheckFileHeader 在接收上传的文件时按场景的策略检查,没有配置策略的场景只检查文件名
+func CheckFileHeader(business, scene string, fh *multipart.FileHeader) error {
+	p, ok := GetUploadPolicy(business, scene)
+	if !ok {
+		return CheckFileName(fh.Filename)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	defer f.Close()
+	_, err = p.Check(fh.Filename, f, fh.Size)
+	return err
+}
+
+func matchMimeType(allowed []string, mimeType string) bool {
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok {
+			if strings.HasPrefix(mimeType, prefix+"/") {
+				return true
+			}
+		} else if strings.EqualFold(a, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package oss
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testEicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func TestUploadPolicy(t *testing.T) {
+	pngData := testPng(t, 200, 100)
+	p, ok := GetUploadPolicy(BusinessDeviceManage, SceneDeviceImg)
+	require.True(t, ok)
+	mimeType, err := p.Check("a.png", bytes.NewReader(pngData), int64(len(pngData)))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", mimeType)
+
+	cases := []struct {
+		name   string
+		data   []byte
+		policy UploadPolicy
+		code   *errors.CodeError
+	}{
+		{"a.exe", pngData, p, errors.FileType},
+		{"a.png", []byte("<html><script>alert(1)</script></html>"), p, errors.FileType},
+		{"a.png", pngData, UploadPolicy{MaxSize: 10}, errors.FileTooLarge},
+		{"a.png", pngData, UploadPolicy{MaxWidth: 100}, errors.FileTooLarge},
+		{"a.png", []byte("not image"), UploadPolicy{MaxWidth: 100}, errors.FileType},
+		{"a,b.png", pngData, p, errors.FileNameError},
+		{"a\x00.png", pngData, p, errors.FileNameError},
+		{"../a.png", pngData, p, errors.FileNameError},
+		{strings.Repeat("a", 300) + ".png", pngData, p, errors.FileNameError},
+	}
+	for _, c := range cases {
+		_, err := c.policy.Check(c.name, bytes.NewReader(c.data), int64(len(c.data)))
+		require.Error(t, err, c.name)
+		assert.Equal(t, c.code.GetCode(), errors.Fmt(err).GetCode(), c.name)
+	}
+
+	_, ok = FindUploadPolicy("things/t1/core/" + BusinessUserManage + "/" + SceneHeadIng + "/u.png")
+	assert.True(t, ok)
+	_, ok = FindUploadPolicy(BusinessOta + "/" + SceneFirmware + "/v1.bin")
+	assert.True(t, ok)
+	_, ok = FindUploadPolicy("things/other/" + SceneFirmware + "/v1.bin")
+	assert.False(t, ok, "固件的策略只对ota业务生效")
+
+	RegisterUploadPolicy("test", "doc", UploadPolicy{MimeTypes: []string{"text/*"}})
+	p, ok = FindUploadPolicy("test/doc/a.txt")
+	require.True(t, ok)
+	_, err = p.Check("a.txt", strings.NewReader("hello"), 5)
+	assert.NoError(t, err)
+}
+
+func TestCheckFileHeader(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fw, err := w.CreateFormFile("file", "a.png")
+	require.NoError(t, err)
+	fw.Write([]byte("fake image"))
+	fw, err = w.CreateFormFile("file", "a,b.txt")
+	require.NoError(t, err)
+	fw.Write([]byte("text"))
+	require.NoError(t, w.Close())
+	r := httptest.NewRequest("POST", "/upload", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	require.NoError(t, r.ParseMultipartForm(1024*1024))
+	files := r.MultipartForm.File["file"]
+
+	assert.Error(t, CheckFileHeader(BusinessDeviceManage, SceneDeviceImg, files[0]))
+	assert.NoError(t, CheckFileHeader(BusinessDeviceManage, SceneFile, files[0]))
+	assert.Error(t, CheckFileHeader(BusinessDeviceManage, SceneFile, files[1]))
+}
+
+type testScanner struct {
+	err error
+}
+
+func (s testScanner) Scan(ctx context.Context, reader io.Reader) (*ScanResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	data, _ := io.ReadAll(reader)
+	if bytes.Contains(data, []byte("EICAR")) {
+		return &ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return &ScanResult{}, nil
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	inner := testHandleBackends()[0].newHandle(t)
+	h := &Client{Handle: NewGuard(inner, GuardOption{Scanner: testScanner{}, QuarantinePrefix: defaultQuarantinePrefix})}
+	imgPath := "things/t1/core/" + BusinessDeviceManage + "/" + SceneDeviceImg + "/a.png"
+
+	_, err := h.PrivateBucket().Upload(ctx, imgPath, bytes.NewReader(testPng(t, 20, 20)), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PrivateBucket().Upload(ctx, imgPath, strings.NewReader("<html></html>"), common.OptionKv{})
+	assert.Equal(t, errors.FileType.GetCode(), errors.Fmt(err).GetCode())
+	assertObjectContent(t, inner.PrivateBucket(), imgPath, testPng(t, 20, 20))
+
+	//命中扫描的文件被隔离
+	_, err = h.PublicBucket().Upload(ctx, "things/other/a.txt", strings.NewReader(testEicar), common.OptionKv{})
+	assert.Equal(t, errors.FileInfected.GetCode(), errors.Fmt(err).GetCode())
+	_, err = inner.PublicBucket().GetObjectInfo(ctx, "things/other/a.txt")
+	assert.Error(t, err)
+	objs, err := inner.PrivateBucket().ListObjects(ctx, defaultQuarantinePrefix+"/")
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+	assert.True(t, strings.HasSuffix(objs[0].FilePath, "/things/other/a.txt"))
+
+	//直传到临时桶的文件在复制时检查
+	_, err = inner.TemporaryBucket().Upload(ctx, "tmp/a.png", strings.NewReader("not image"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PrivateBucket().CopyFromTempBucket("tmp/a.png", imgPath)
+	assert.Error(t, err)
+	_, err = inner.TemporaryBucket().GetObjectInfo(ctx, "tmp/a.png")
+	assert.Error(t, err, "未通过检查的临时文件被删除")
+
+	//分片上传合并后检查
+	content := []byte(testEicar)
+	_, err = UploadMultipart(ctx, h.PrivateBucket(), "ota/firmware/v1.bin", bytes.NewReader(content), int64(len(content)), MultipartOption{})
+	assert.Equal(t, errors.FileInfected.GetCode(), errors.Fmt(err).GetCode())
+	_, err = inner.PrivateBucket().GetObjectInfo(ctx, "ota/firmware/v1.bin")
+	assert.Error(t, err)
+
+	//扫描服务不可用
+	h = &Client{Handle: NewGuard(inner, GuardOption{Scanner: testScanner{err: io.ErrUnexpectedEOF}})}
+	_, err = h.Upload(ctx, "things/other/b.txt", strings.NewReader("b"), common.OptionKv{})
+	assert.Error(t, err)
+	h = &Client{Handle: NewGuard(inner, GuardOption{Scanner: testScanner{err: io.ErrUnexpectedEOF}, FailOpen: true})}
+	_, err = h.Upload(ctx, "things/other/b.txt", strings.NewReader("b"), common.OptionKv{})
+	assert.NoError(t, err)
+}
+
+// 模拟clamd的INSTREAM命令
+func serveFakeClamd(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			cmd, err := reader.ReadString(0)
+			if err != nil || cmd != "zINSTREAM\x00" {
+				conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				return
+			}
+			var data []byte
+			for {
+				var size uint32
+				if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+					return
+				}
+				if size == 0 {
+					break
+				}
+				chunk := make([]byte, size)
+				if _, err := io.ReadFull(reader, chunk); err != nil {
+					return
+				}
+				data = append(data, chunk...)
+			}
+			if bytes.Contains(data, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+				conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+				return
+			}
+			conn.Write([]byte("stream: OK\x00"))
+		}()
+	}
+}
+
+func TestClamdScanner(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "clamd.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer l.Close()
+	go serveFakeClamd(l)
+
+	s, err := NewClamdScanner("unix://"+sock, 0)
+	require.NoError(t, err)
+	ret, err := s.Scan(context.Background(), bytes.NewReader(bytes.Repeat([]byte("clean"), clamdChunkSize)))
+	require.NoError(t, err)
+	assert.False(t, ret.Infected)
+	ret, err = s.Scan(context.Background(), strings.NewReader(testEicar))
+	require.NoError(t, err)
+	assert.True(t, ret.Infected)
+	assert.Equal(t, "Eicar-Signature", ret.Signature)
+
+	_, err = NewClamdScanner("http://127.0.0.1:3310", 0)
+	assert.Error(t, err)
+	s, err = NewClamdScanner("tcp://127.0.0.1:1", 0)
+	require.NoError(t, err)
+	_, err = s.Scan(context.Background(), strings.NewReader("a"))
+	assert.Error(t, err)
+
+	_, err = parseClamdResp("INSTREAM size limit exceeded. ERROR")
+	assert.Error(t, err)
+}
@@ -0,0 +1,433 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gitee.com/unitedrhino/share/caches"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/spf13/cast"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"github.com/zeromicro/go-zero/core/threading"
+)
+
+const (
+	usageTenantsKey   = "oss:usage:tenants"   //记录有用量的租户
+	usageReconcileKey = "oss:usage:reconcile" //多个实例只有一个执行重新统计
+	usageTotalField   = "total"
+	usageSizePrefix   = "size:"
+	usageCountPrefix  = "count:"
+)
+
+// 增加用量,有配额时检查,超出配额不增加
+// KEYS[1] 租户的用量key ARGV[1] 场景 ARGV[2] 增加的字节数 ARGV[3] 增加的文件数 ARGV[4] 配额,0为不限制
+// 返回 {是否成功, 当前的总用量}
+const usageAddScript = `local key = KEYS[1]
+local delta = tonumber(ARGV[2])
+local quota = tonumber(ARGV[4])
+local total = tonumber(redis.call('HGET', key, 'total') or '0')
+if quota > 0 and delta > 0 and total + delta > quota then
+  return {0, total}
+end
+redis.call('HINCRBY', key, 'size:' .. ARGV[1], delta)
+redis.call('HINCRBY', key, 'count:' .. ARGV[1], ARGV[3])
+total = redis.call('HINCRBY', key, 'total', delta)
+return {1, total}`
+
+// 重新统计后覆盖租户的用量
+// KEYS[1] 租户的用量key ARGV 字段和值
+const usageResetScript = `redis.call('DEL', KEYS[1])
+if #ARGV > 0 then
+  redis.call('HSET', KEYS[1], unpack(ARGV))
+end
+return 1`
+
+type SceneUsage struct {
+	Business string
+	Scene    string
+	Size     int64
+	Count    int64
+}
+
+type TenantUsage struct {
+	TenantCode string
+	Total      int64         //已使用的字节数
+	Quota      int64         //配额,0为不限制
+	Scenes     []*SceneUsage //按业务和场景统计
+}
+
+// Quota 租户存储配额,按GenFilePath生成的路径(svr/tenant/app/business/scene/file)统计私有桶和公开桶的用量,
+// 临时桶及不符合路径格式的文件不统计.超出配额时上传返回errors.QuotaExceeded
+type Quota struct {
+	Handle
+	conf      conf.OssQuota
+	store     kv.Store
+	temporary bool
+}
+
+func NewQuota(h Handle, c conf.OssQuota, store kv.Store) (*Quota, error) {
+	if store == nil {
+		return nil, errors.Parameter.AddMsg("存储配额需要redis")
+	}
+	return &Quota{Handle: h, conf: c, store: store}, nil
+}
+
+// 按配置开启配额
+func newQuotaWithConf(c conf.OssConf, h Handle) (Handle, error) {
+	if !c.Quota.Enable {
+		return h, nil
+	}
+	q, err := NewQuota(h, c.Quota, caches.GetStore())
+	if err != nil {
+		return nil, err
+	}
+	if c.Quota.ReconcileInterval > 0 {
+		q.StartReconcile(time.Duration(c.Quota.ReconcileInterval) * time.Second)
+	}
+	return q, nil
+}
+
+func (q *Quota) PrivateBucket() Handle {
+	return &Quota{Handle: q.Handle.PrivateBucket(), conf: q.conf, store: q.store}
+}
+
+func (q *Quota) PublicBucket() Handle {
+	return &Quota{Handle: q.Handle.PublicBucket(), conf: q.conf, store: q.store}
+}
+
+func (q *Quota) TemporaryBucket() Handle {
+	return &Quota{Handle: q.Handle.TemporaryBucket(), conf: q.conf, store: q.store, temporary: true}
+}
+
+// GetTenantQuota 获取租户的配额,0为不限制
+func (q *Quota) GetTenantQuota(tenantCode string) int64 {
+	if v, ok := q.conf.Tenants[tenantCode]; ok {
+		return v
+	}
+	return q.conf.Default
+}
+
+// 从路径中解析出租户,业务及场景,路径格式见GenFilePath,隔离区中的文件不统计
+func parseUsagePath(filePath string) (tenantCode, scene string, ok bool) {
+	paths := strings.Split(strings.TrimPrefix(filePath, "/"), "/")
+	if len(paths) < 6 || paths[0] == defaultQuarantinePrefix || paths[1] == "" || paths[1] == "common" || paths[3] == "" || paths[4] == "" {
+		return "", "", false
+	}
+	return paths[1], paths[3] + "/" + paths[4], true
+}
+
+func genUsageKey(tenantCode string) string {
+	return fmt.Sprintf("oss:usage:%s", tenantCode)
+}
+
+// 增加用量,delta为负时减少,check为true时检查配额
+func (q *Quota) addUsage(ctx context.Context, filePath string, delta int64, count int64, check bool) error {
+	if q.temporary || (delta == 0 && count == 0) {
+		return nil
+	}
+	tenantCode, scene, ok := parseUsagePath(filePath)
+	if !ok {
+		return nil
+	}
+	var quota int64
+	if check {
+		quota = q.GetTenantQuota(tenantCode)
+	}
+	resp, err := q.store.EvalCtx(ctx, usageAddScript, genUsageKey(tenantCode), scene, delta, count, quota)
+	if err != nil {
+		return errors.Database.AddDetail(err)
+	}
+	vals, ok := resp.([]any)
+	if !ok || len(vals) != 2 {
+		return errors.System.AddDetailf("usage script return:%v", resp)
+	}
+	if cast.ToInt64(vals[0]) != 1 {
+		return errors.QuotaExceeded.AddMsgf("已使用%d字节,配额%d字节", cast.ToInt64(vals[1]), quota)
+	}
+	if _, err = q.store.SaddCtx(ctx, usageTenantsKey, tenantCode); err != nil {
+		logx.WithContext(ctx).Errorf("oss quota add tenant:%s err:%v", tenantCode, err)
+	}
+	return nil
+}
+
+// 存储中已有文件的大小,覆盖上传时只统计差值
+func (q *Quota) existSize(ctx context.Context, filePath string) (size int64, count int64) {
+	info, err := q.Handle.GetObjectInfo(ctx, filePath)
+	if err != nil {
+		return 0, 0
+	}
+	return info.Size, 1
+}
+
+// 预占用量,写入存储失败时调用返回的函数回滚
+func (q *Quota) reserve(ctx context.Context, filePath string, size int64) (rollback func(), err error) {
+	if q.temporary {
+		return func() {}, nil
+	}
+	old, count := q.existSize(ctx, filePath)
+	if err = q.addUsage(ctx, filePath, size-old, 1-count, true); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := q.addUsage(ctx, filePath, old-size, count-1, false); err != nil {
+			logx.WithContext(ctx).Errorf("oss quota rollback filePath:%s err:%v", filePath, err)
+		}
+	}, nil
+}
+
+func (q *Quota) Upload(ctx context.Context, filePath string, reader io.Reader, opKv common.OptionKv) (string, error) {
+	if _, _, ok := parseUsagePath(filePath); !ok || q.temporary {
+		return q.Handle.Upload(ctx, filePath, reader, opKv)
+	}
+	tmp, err := os.CreateTemp("", "oss-quota-*")
+	if err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return "", errors.System.AddMsg("读取上传的数据失败").AddDetail(err)
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return "", errors.System.AddDetail(err)
+	}
+	rollback, err := q.reserve(ctx, filePath, size)
+	if err != nil {
+		return "", err
+	}
+	ret, err := q.Handle.Upload(ctx, filePath, tmp, opKv)
+	if err != nil {
+		rollback()
+		return "", err
+	}
+	return ret, nil
+}
+
+func (q *Quota) SignedGetUrl(ctx context.Context, filePath string, expiredSec int64, opKv common.OptionKv) (string, error) {
+	return signedGetUrlWithProcess(ctx, q, q.Handle, filePath, expiredSec, opKv)
+}
+
+func (q *Quota) Delete(ctx context.Context, filePath string, opKv common.OptionKv) error {
+	size, count := q.existSize(ctx, filePath)
+	if err := q.Handle.Delete(ctx, filePath, opKv); err != nil {
+		return err
+	}
+	if err := q.addUsage(ctx, filePath, -size, -count, false); err != nil {
+		logx.WithContext(ctx).Errorf("oss quota delete filePath:%s err:%v", filePath, err)
+	}
+	return nil
+}
+
+func (q *Quota) CopyFromTempBucket(tempPath, dstPath string) (string, error) {
+	ctx := context.Background()
+	info, err := q.Handle.TemporaryBucket().GetObjectInfo(ctx, tempPath)
+	if err != nil {
+		return "", err
+	}
+	rollback, err := q.reserve(ctx, dstPath, info.Size)
+	if err != nil {
+		return "", err
+	}
+	ret, err := q.Handle.CopyFromTempBucket(tempPath, dstPath)
+	if err != nil {
+		rollback()
+		return "", err
+	}
+	return ret, nil
+}
+
+// GetUsage 获取租户的用量
+func (q *Quota) GetUsage(ctx context.Context, tenantCode string) (*TenantUsage, error) {
+	vals, err := q.store.HgetallCtx(ctx, genUsageKey(tenantCode))
+	if err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	ret := TenantUsage{TenantCode: tenantCode, Quota: q.GetTenantQuota(tenantCode), Total: cast.ToInt64(vals[usageTotalField])}
+	for k, v := range vals {
+		scene, ok := strings.CutPrefix(k, usageSizePrefix)
+		if !ok {
+			continue
+		}
+		business, sceneName, _ := strings.Cut(scene, "/")
+		ret.Scenes = append(ret.Scenes, &SceneUsage{
+			Business: business,
+			Scene:    sceneName,
+			Size:     cast.ToInt64(v),
+			Count:    cast.ToInt64(vals[usageCountPrefix+scene]),
+		})
+	}
+	sort.Slice(ret.Scenes, func(i, j int) bool {
+		return ret.Scenes[i].Business+"/"+ret.Scenes[i].Scene < ret.Scenes[j].Business+"/"+ret.Scenes[j].Scene
+	})
+	return &ret, nil
+}
+
+// Reconcile 按私有桶和公开桶的文件列表重新统计所有租户的用量,用于修正统计过程中的误差.
+// 统计期间的上传及删除可能被覆盖,需要在低峰期执行
+func (q *Quota) Reconcile(ctx context.Context) (map[string]*TenantUsage, error) {
+	usages := map[string]map[string]*SceneUsage{}
+	for _, h := range []Handle{q.Handle.PrivateBucket(), q.Handle.PublicBucket()} {
+		objs, err := h.ListObjects(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			tenantCode, scene, ok := parseUsagePath(obj.FilePath)
+			if !ok {
+				continue
+			}
+			if usages[tenantCode] == nil {
+				usages[tenantCode] = map[string]*SceneUsage{}
+			}
+			s := usages[tenantCode][scene]
+			if s == nil {
+				s = &SceneUsage{}
+				s.Business, s.Scene, _ = strings.Cut(scene, "/")
+				usages[tenantCode][scene] = s
+			}
+			s.Size += obj.Size
+			s.Count++
+		}
+	}
+	tenants, err := q.store.SmembersCtx(ctx, usageTenantsKey)
+	if err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	for _, tenantCode := range tenants {
+		if _, ok := usages[tenantCode]; !ok {
+			usages[tenantCode] = nil
+		}
+	}
+	ret := map[string]*TenantUsage{}
+	for tenantCode, scenes := range usages {
+		u := TenantUsage{TenantCode: tenantCode, Quota: q.GetTenantQuota(tenantCode)}
+		var args []any
+		for scene, s := range scenes {
+			u.Total += s.Size
+			u.Scenes = append(u.Scenes, s)
+			args = append(args, usageSizePrefix+scene, s.Size, usageCountPrefix+scene, s.Count)
+		}
+		if len(args) > 0 {
+			args = append(args, usageTotalField, u.Total)
+		}
+		if _, err := q.store.EvalCtx(ctx, usageResetScript, genUsageKey(tenantCode), args...); err != nil {
+			return nil, errors.Database.AddDetail(err)
+		}
+		if len(args) == 0 {
+			q.store.SremCtx(ctx, usageTenantsKey, tenantCode)
+			continue
+		}
+		if _, err := q.store.SaddCtx(ctx, usageTenantsKey, tenantCode); err != nil {
+			return nil, errors.Database.AddDetail(err)
+		}
+		sort.Slice(u.Scenes, func(i, j int) bool {
+			return u.Scenes[i].Business+"/"+u.Scenes[i].Scene < u.Scenes[j].Business+"/"+u.Scenes[j].Scene
+		})
+		ret[tenantCode] = &u
+	}
+	return ret, nil
+}
+
+// StartReconcile 定时重新统计用量,多个实例通过redis锁保证同一周期只有一个实例执行
+func (q *Quota) StartReconcile(interval time.Duration) {
+	threading.GoSafe(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx := context.Background()
+			ok, err := q.store.SetnxExCtx(ctx, usageReconcileKey, "1", max(1, int(interval.Seconds())/2))
+			if err != nil || !ok {
+				continue
+			}
+			if _, err = q.Reconcile(ctx); err != nil {
+				logx.WithContext(ctx).Errorf("oss quota reconcile err:%v", err)
+			}
+		}
+	})
+}
+
+func (q *Quota) multipart() (MultipartHandle, error) {
+	return GetMultipartHandle(q.Handle)
+}
+
+func (q *Quota) InitiateMultipart(ctx context.Context, filePath string, opKv common.OptionKv) (string, error) {
+	mh, err := q.multipart()
+	if err != nil {
+		return "", err
+	}
+	return mh.InitiateMultipart(ctx, filePath, opKv)
+}
+
+func (q *Quota) UploadPart(ctx context.Context, filePath string, uploadID string, partNumber int, reader io.Reader, size int64) (*common.MultipartPart, error) {
+	mh, err := q.multipart()
+	if err != nil {
+		return nil, err
+	}
+	return mh.UploadPart(ctx, filePath, uploadID, partNumber, reader, size)
+}
+
+func (q *Quota) ListParts(ctx context.Context, filePath string, uploadID string) ([]*common.MultipartPart, error) {
+	mh, err := q.multipart()
+	if err != nil {
+		return nil, err
+	}
+	return mh.ListParts(ctx, filePath, uploadID)
+}
+
+func (q *Quota) SignedPartUrl(ctx context.Context, filePath string, uploadID string, partNumber int, expiredSec int64) (string, error) {
+	mh, err := q.multipart()
+	if err != nil {
+		return "", err
+	}
+	return mh.SignedPartUrl(ctx, filePath, uploadID, partNumber, expiredSec)
+}
+
+// CompleteMultipart 合并前按已上传分片的大小检查配额,超出配额时取消上传
+func (q *Quota) CompleteMultipart(ctx context.Context, filePath string, uploadID string, parts []*common.MultipartPart) (string, error) {
+	mh, err := q.multipart()
+	if err != nil {
+		return "", err
+	}
+	uploaded, err := mh.ListParts(ctx, filePath, uploadID)
+	if err != nil {
+		return "", err
+	}
+	sizes := map[int]int64{}
+	for _, p := range uploaded {
+		sizes[p.PartNumber] = p.Size
+	}
+	var size int64
+	for _, p := range parts {
+		size += sizes[p.PartNumber]
+	}
+	rollback, err := q.reserve(ctx, filePath, size)
+	if err != nil {
+		abortMultipart(ctx, mh, filePath, uploadID)
+		return "", err
+	}
+	ret, err := mh.CompleteMultipart(ctx, filePath, uploadID, parts)
+	if err != nil {
+		rollback()
+		return "", err
+	}
+	return ret, nil
+}
+
+func (q *Quota) AbortMultipart(ctx context.Context, filePath string, uploadID string) error {
+	mh, err := q.multipart()
+	if err != nil {
+		return err
+	}
+	return mh.AbortMultipart(ctx, filePath, uploadID)
+}
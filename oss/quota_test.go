@@ -0,0 +1,199 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/oss/common"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func newTestQuota(t *testing.T, c conf.OssQuota) (*Quota, Handle) {
+	return newTestQuotaWith(t, testHandleBackends()[0], c)
+}
+
+func newTestQuotaWith(t *testing.T, b handleBackend, c conf.OssQuota) (*Quota, Handle) {
+	mr := miniredis.RunT(t)
+	store := kv.NewStore(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	inner := b.newHandle(t)
+	q, err := NewQuota(inner, c, store)
+	require.NoError(t, err)
+	return q, inner
+}
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	q, inner := newTestQuota(t, conf.OssQuota{Default: 100, Tenants: map[string]int64{"big": 0}})
+	h := &Client{Handle: q}
+	imgPath := "things/t1/core/" + BusinessDeviceManage + "/" + SceneDeviceImg + "/a.png"
+	headPath := "things/t1/core/" + BusinessUserManage + "/" + SceneHeadIng + "/u.png"
+
+	_, err := h.PrivateBucket().Upload(ctx, imgPath, strings.NewReader(strings.Repeat("a", 40)), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PublicBucket().Upload(ctx, headPath, strings.NewReader(strings.Repeat("b", 30)), common.OptionKv{})
+	require.NoError(t, err)
+	usage, err := q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(70), usage.Total)
+	assert.Equal(t, int64(100), usage.Quota)
+	assert.Equal(t, []*SceneUsage{
+		{Business: BusinessDeviceManage, Scene: SceneDeviceImg, Size: 40, Count: 1},
+		{Business: BusinessUserManage, Scene: SceneHeadIng, Size: 30, Count: 1},
+	}, usage.Scenes)
+
+	//覆盖上传只统计差值
+	_, err = h.PrivateBucket().Upload(ctx, imgPath, strings.NewReader(strings.Repeat("a", 60)), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PrivateBucket().Upload(ctx, "things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/b.png", strings.NewReader(strings.Repeat("c", 20)), common.OptionKv{})
+	assert.Equal(t, errors.QuotaExceeded.GetCode(), errors.Fmt(err).GetCode())
+	_, err = inner.PrivateBucket().GetObjectInfo(ctx, "things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/b.png")
+	assert.Error(t, err, "超出配额的文件不写入")
+
+	//不限制配额的租户及不符合路径的文件
+	_, err = h.PrivateBucket().Upload(ctx, "things/big/core/"+BusinessOta+"/"+SceneFirmware+"/v1.bin", strings.NewReader(strings.Repeat("d", 200)), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PrivateBucket().Upload(ctx, "things/common/"+BusinessOta+"/"+SceneFirmware+"/v1.bin", strings.NewReader(strings.Repeat("d", 200)), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.TemporaryBucket().Upload(ctx, "things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/c.png", strings.NewReader(strings.Repeat("e", 200)), common.OptionKv{})
+	require.NoError(t, err)
+
+	require.NoError(t, h.PrivateBucket().Delete(ctx, imgPath, common.OptionKv{}))
+	usage, err = q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), usage.Total)
+
+	//从临时桶复制时检查配额
+	_, err = h.PrivateBucket().CopyFromTempBucket("things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/c.png", imgPath)
+	assert.Equal(t, errors.QuotaExceeded.GetCode(), errors.Fmt(err).GetCode())
+	_, err = inner.TemporaryBucket().Upload(ctx, "tmp/d.png", strings.NewReader(strings.Repeat("f", 50)), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = h.PrivateBucket().CopyFromTempBucket("tmp/d.png", imgPath)
+	require.NoError(t, err)
+	usage, err = q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(80), usage.Total)
+
+	//分片上传在合并前检查
+	content := bytes.Repeat([]byte("g"), 30)
+	_, err = UploadMultipart(ctx, h.PublicBucket(), "things/t1/core/"+BusinessOta+"/"+SceneFirmware+"/v2.bin", bytes.NewReader(content), int64(len(content)), MultipartOption{})
+	assert.Equal(t, errors.QuotaExceeded.GetCode(), errors.Fmt(err).GetCode())
+	_, err = UploadMultipart(ctx, h.PublicBucket(), "things/t1/core/"+BusinessOta+"/"+SceneFirmware+"/v2.bin", bytes.NewReader(content[:20]), 20, MultipartOption{})
+	require.NoError(t, err)
+	usage, err = q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), usage.Total)
+}
+
+func TestQuotaReconcile(t *testing.T) {
+	ctx := context.Background()
+	q, inner := newTestQuota(t, conf.OssQuota{})
+	imgPath := "things/t1/core/" + BusinessDeviceManage + "/" + SceneDeviceImg + "/a.png"
+	_, err := q.PrivateBucket().Upload(ctx, imgPath, strings.NewReader("abc"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = q.PrivateBucket().Upload(ctx, "things/t2/core/"+BusinessOta+"/"+SceneFirmware+"/v1.bin", strings.NewReader("abc"), common.OptionKv{})
+	require.NoError(t, err)
+
+	//绕过统计直接写入及删除存储
+	_, err = inner.PublicBucket().Upload(ctx, "things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/b.png", strings.NewReader("12345"), common.OptionKv{})
+	require.NoError(t, err)
+	require.NoError(t, inner.PrivateBucket().Delete(ctx, "things/t2/core/"+BusinessOta+"/"+SceneFirmware+"/v1.bin", common.OptionKv{}))
+
+	ret, err := q.Reconcile(ctx)
+	require.NoError(t, err)
+	require.Contains(t, ret, "t1")
+	assert.Equal(t, int64(8), ret["t1"].Total)
+	assert.NotContains(t, ret, "t2")
+
+	usage, err := q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), usage.Total)
+	assert.Equal(t, []*SceneUsage{{Business: BusinessDeviceManage, Scene: SceneDeviceImg, Size: 8, Count: 2}}, usage.Scenes)
+	usage, err = q.GetUsage(ctx, "t2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.Total)
+	assert.Empty(t, usage.Scenes)
+
+	_, err = NewQuota(inner, conf.OssQuota{}, nil)
+	assert.Error(t, err)
+}
+
+func TestQuotaImageProcess(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQuotaWith(t, testHandleBackends()[1], conf.OssQuota{Default: 1 << 20}) //本地存储的签名依赖全局的redis
+	h := &Client{Handle: q}
+	imgPath := "things/t1/core/" + BusinessDeviceManage + "/" + SceneDeviceImg + "/a.png"
+	_, err := h.PublicBucket().Upload(ctx, imgPath, bytes.NewReader(testPng(t, 200, 100)), common.OptionKv{})
+	require.NoError(t, err)
+
+	//处理后的图片经过配额写入
+	opKv := common.OptionKv{}
+	WithImageProcess("image/resize,w_50/format,jpeg")(&opKv)
+	signed, err := h.PublicBucket().SignedGetUrl(ctx, imgPath, 60, opKv)
+	require.NoError(t, err)
+	assert.Contains(t, signed, imageProcessDir)
+	usage, err := q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	require.Len(t, usage.Scenes, 1)
+	assert.Equal(t, int64(2), usage.Scenes[0].Count)
+
+	//配额不足时不写入处理后的图片
+	q.conf.Default = usage.Total
+	opKv = common.OptionKv{}
+	WithImageProcess("image/resize,w_60/format,jpeg")(&opKv)
+	_, err = h.PublicBucket().SignedGetUrl(ctx, imgPath, 60, opKv)
+	assert.Equal(t, errors.QuotaExceeded.GetCode(), errors.Fmt(err).GetCode())
+}
+
+func TestQuotaReconcileMinio(t *testing.T) {
+	ctx := context.Background()
+	q, inner := newTestQuotaWith(t, testHandleBackends()[1], conf.OssQuota{})
+	_, err := q.PrivateBucket().Upload(ctx, "things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/a.png", strings.NewReader("abc"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = q.PublicBucket().Upload(ctx, "things/t2/core/"+BusinessUserManage+"/"+SceneHeadIng+"/u.png", strings.NewReader("12345"), common.OptionKv{})
+	require.NoError(t, err)
+	//隔离区中的文件不属于任何租户
+	_, err = inner.PrivateBucket().Upload(ctx, defaultQuarantinePrefix+"/20250101/things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/x.png", strings.NewReader("virus"), common.OptionKv{})
+	require.NoError(t, err)
+
+	ret, err := q.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Len(t, ret, 2)
+	for tenantCode, want := range map[string]int64{"t1": 3, "t2": 5} {
+		usage, err := q.GetUsage(ctx, tenantCode)
+		require.NoError(t, err)
+		assert.Equal(t, want, usage.Total, tenantCode)
+	}
+}
+
+// 列举文件失败的存储
+type errListHandle struct {
+	Handle
+}
+
+func (h errListHandle) PrivateBucket() Handle { return errListHandle{h.Handle.PrivateBucket()} }
+func (h errListHandle) PublicBucket() Handle  { return errListHandle{h.Handle.PublicBucket()} }
+func (h errListHandle) ListObjects(ctx context.Context, prefix string) ([]*common.StorageObjectInfo, error) {
+	return nil, errors.System.AddDetail("list failed")
+}
+
+func TestQuotaReconcileListError(t *testing.T) {
+	ctx := context.Background()
+	q, _ := newTestQuota(t, conf.OssQuota{})
+	q.Handle = errListHandle{q.Handle}
+	_, err := q.PrivateBucket().Upload(ctx, "things/t1/core/"+BusinessDeviceManage+"/"+SceneDeviceImg+"/a.png", strings.NewReader("abc"), common.OptionKv{})
+	require.NoError(t, err)
+	_, err = q.Reconcile(ctx)
+	assert.Error(t, err)
+	usage, err := q.GetUsage(ctx, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), usage.Total, "列举失败时不修改已有的统计")
+}
@@ -0,0 +1,113 @@
+package oss
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+)
+
+// Scanner 上传文件的安全扫描,如病毒扫描
+type Scanner interface {
+	Scan(ctx context.Context, reader io.Reader) (*ScanResult, error)
+}
+
+type ScanResult struct {
+	Infected  bool
+	Signature string //命中的特征名
+}
+
+const (
+	clamdChunkSize      = 32 * 1024
+	clamdDefaultTimeout = 60 * time.Second
+)
+
+// ClamdScanner 通过clamd的INSTREAM命令扫描文件
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner addr的格式为 unix:///var/run/clamav/clamd.ctl 或 tcp://127.0.0.1:3310
+func NewClamdScanner(addr string, timeout time.Duration) (*ClamdScanner, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Parameter.AddMsgf("clamd地址错误:%s", addr).AddDetail(err)
+	}
+	s := ClamdScanner{network: u.Scheme, timeout: timeout}
+	switch u.Scheme {
+	case "unix":
+		s.address = u.Path
+	case "tcp":
+		s.address = u.Host
+	default:
+		return nil, errors.Parameter.AddMsgf("clamd地址错误:%s", addr)
+	}
+	if s.timeout <= 0 {
+		s.timeout = clamdDefaultTimeout
+	}
+	return &s, nil
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, reader io.Reader) (*ScanResult, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, errors.System.AddMsg("连接clamd失败").AddDetail(err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(s.timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, errors.System.AddMsg("发送数据到clamd失败").AddDetail(err)
+	}
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, rerr := reader.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err = conn.Write(buf[:4+n]); err != nil {
+				//超过clamd的StreamMaxLength时clamd会直接返回错误并关闭连接
+				break
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return nil, errors.System.AddMsg("读取扫描的数据失败").AddDetail(rerr)
+		}
+	}
+	if err == nil {
+		if _, err = conn.Write([]byte{0, 0, 0, 0}); err != nil {
+			return nil, errors.System.AddMsg("发送数据到clamd失败").AddDetail(err)
+		}
+	}
+	resp, rerr := bufio.NewReader(conn).ReadString(0)
+	if rerr != nil && resp == "" {
+		return nil, errors.System.AddMsg("读取clamd结果失败").AddDetail(rerr)
+	}
+	return parseClamdResp(strings.TrimRight(resp, "\x00\n"))
+}
+
+// 返回的格式为 stream: OK, stream: Eicar-Signature FOUND 或 INSTREAM size limit exceeded. ERROR
+func parseClamdResp(resp string) (*ScanResult, error) {
+	_, result, _ := strings.Cut(resp, ": ")
+	switch {
+	case result == "OK":
+		return &ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &ScanResult{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	}
+	return nil, errors.System.AddMsgf("clamd扫描失败:%s", resp)
+}
@@ -136,8 +136,7 @@ func SceneToNewPath(ctx context.Context, ossClient *Client, business, scene, fil
 
 func GetFilePath2(ctx context.Context, fh *multipart.FileHeader) (string, error) {
 	fileName := fh.Filename
-	spcChar := []string{`,`, `?`, `*`, `|`, `{`, `}`, `\`, `$`, `、`, `·`, "`", `'`, `"`}
-	if strings.ContainsAny(fileName, strings.Join(spcChar, "")) {
+	if strings.ContainsAny(fileName, fileNameSpcChar) {
 		return "", errors.Parameter.WithMsg("包含特殊字符")
 	}
 	uc := ctxs.GetUserCtx(ctx)
@@ -158,8 +157,7 @@ func GetFilePath(scene *SceneInfo, rename bool) (string, error) {
 		uuid := uuid.NewString()
 		scene.FilePath = uuid + ext
 	} else {
-		spcChar := []string{`,`, `?`, `*`, `|`, `{`, `}`, `\`, `$`, `、`, `·`, "`", `'`, `"`}
-		if strings.ContainsAny(scene.FilePath, strings.Join(spcChar, "")) {
+		if strings.ContainsAny(scene.FilePath, fileNameSpcChar) {
 			return "", errors.Parameter.WithMsg("包含特殊字符")
 		}
 	}
@@ -0,0 +1,266 @@
+package result
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/def"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const defaultSseHeartbeat = 15 * time.Second
+
+type SseOption struct {
+	Event     string          //普通消息的事件名,默认为message
+	Heartbeat time.Duration   //心跳注释的间隔,默认15秒,小于0不发送
+	Retry     time.Duration   //客户端断开后重连的间隔,0使用浏览器默认值
+	Replay    SseReplayBuffer //不为nil时记录发送的事件,客户端带Last-Event-ID重连时补发
+}
+
+// SseReplayBuffer 保存一个流发送过的事件,用于客户端断线重连后补发
+type SseReplayBuffer interface {
+	// Append 保存事件,事件没有ID时分配一个递增的ID
+	Append(ctx context.Context, event *utils.SseEvent) error
+	// Since 返回lastEventID之后的事件,lastEventID已经不在缓存中时返回缓存中所有的事件
+	Since(ctx context.Context, lastEventID string) ([]*utils.SseEvent, error)
+}
+
+// SseMemReplay 内存中保存最近的size个事件
+type SseMemReplay struct {
+	mutex  sync.Mutex
+	size   int
+	seq    int64
+	events []*utils.SseEvent
+}
+
+func NewSseMemReplay(size int) *SseMemReplay {
+	if size <= 0 {
+		size = 100
+	}
+	return &SseMemReplay{size: size}
+}
+
+func (m *SseMemReplay) Append(ctx context.Context, event *utils.SseEvent) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.seq++
+	if event.ID == "" {
+		event.ID = strconv.FormatInt(m.seq, 10)
+	}
+	m.events = append(m.events, event)
+	if len(m.events) > m.size {
+		m.events = append(m.events[:0:0], m.events[len(m.events)-m.size:]...)
+	}
+	return nil
+}
+
+func (m *SseMemReplay) Since(ctx context.Context, lastEventID string) ([]*utils.SseEvent, error) {
+	if lastEventID == "" {
+		return nil, nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, e := range m.events {
+		if e.ID == lastEventID {
+			return append([]*utils.SseEvent(nil), m.events[i+1:]...), nil
+		}
+	}
+	return append([]*utils.SseEvent(nil), m.events...), nil
+}
+
+// SseWriter Server-Sent Events的写入,并发安全
+type SseWriter struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	rc      *http.ResponseController
+	opt     SseOption
+	mutex   sync.Mutex
+	closed  bool
+	done    chan struct{}
+	noFlush bool //不支持Flush时只记录一次日志
+}
+
+// NewSseWriter 写入事件流的头,补发客户端重连前没有收到的事件并开始发送心跳,用完需要Close
+func NewSseWriter(w http.ResponseWriter, r *http.Request, opt SseOption) *SseWriter {
+	if opt.Heartbeat == 0 {
+		opt.Heartbeat = defaultSseHeartbeat
+	}
+	s := &SseWriter{w: w, r: r, rc: http.NewResponseController(w), opt: opt, done: make(chan struct{})}
+	h := w.Header()
+	h.Set(def.ContentType, def.ContentTypeEventStream+"; charset=utf-8")
+	h.Set(def.CacheControl, def.CacheControlNoCache)
+	h.Set(def.Connection, def.ConnectionKeepAlive)
+	h.Set("X-Accel-Buffering", "no") //关闭nginx的缓冲
+	s.rc.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	if opt.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", opt.Retry.Milliseconds())
+	}
+	s.flush()
+	if opt.Replay != nil {
+		s.replay()
+	}
+	if opt.Heartbeat > 0 {
+		utils.Go(r.Context(), s.heartbeat)
+	}
+	return s
+}
+
+// Send 发送事件,设置了Replay时会先记录事件(错误事件除外)
+func (s *SseWriter) Send(event *utils.SseEvent) error {
+	if s.opt.Replay != nil && event.Event != utils.SseEventError {
+		if err := s.opt.Replay.Append(s.r.Context(), event); err != nil {
+			logx.WithContext(s.r.Context()).Errorf("sse replay append err:%v", err)
+		}
+	}
+	return s.write(event)
+}
+
+// SendJson 以json发送数据,event为空时使用SseOption中的事件名
+func (s *SseWriter) SendJson(event string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return errors.System.AddDetail(err)
+	}
+	if event == "" {
+		event = s.opt.Event
+	}
+	return s.Send(&utils.SseEvent{Event: event, Data: string(body)})
+}
+
+// SendError 流开始后出现的错误以error事件发送,错误事件不会记录到Replay中
+func (s *SseWriter) SendError(err error) error {
+	logx.WithContext(s.r.Context()).Errorf("【http sse err】router:%v err: %v", s.r.URL.Path, err)
+	return s.Send(SseError(s.r, err))
+}
+
+// Close 停止心跳,不会关闭连接
+func (s *SseWriter) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+func (s *SseWriter) write(event *utils.SseEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return errors.System.AddMsg("sse已关闭")
+	}
+	if err := event.Encode(s.w); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *SseWriter) flush() {
+	if s.noFlush {
+		return
+	}
+	if err := s.rc.Flush(); err != nil {
+		s.noFlush = true
+		logx.WithContext(s.r.Context()).Debugf("sse flush err:%v", err)
+	}
+}
+
+func (s *SseWriter) replay() {
+	lastID := s.r.Header.Get("Last-Event-ID")
+	if lastID == "" { //不能设置请求头的客户端通过参数传递
+		lastID = s.r.URL.Query().Get("lastEventId")
+	}
+	events, err := s.opt.Replay.Since(s.r.Context(), lastID)
+	if err != nil {
+		logx.WithContext(s.r.Context()).Errorf("sse replay since:%v err:%v", lastID, err)
+		return
+	}
+	for _, e := range events {
+		if err := s.write(e); err != nil {
+			return
+		}
+	}
+}
+
+func (s *SseWriter) heartbeat() {
+	ticker := time.NewTicker(s.opt.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			if s.closed {
+				s.mutex.Unlock()
+				return
+			}
+			_, err := s.w.Write([]byte(": ping\n\n"))
+			if err == nil {
+				s.flush()
+			}
+			s.mutex.Unlock()
+			if err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		case <-s.r.Context().Done():
+			return
+		}
+	}
+}
+
+// SseError 将错误转换成error事件,data和http接口返回的错误格式相同
+func SseError(r *http.Request, err error) *utils.SseEvent {
+	er := errors.Fmt(err)
+	msg := er.GetI18nMsg(ctxs.GetUserCtxNoNil(r.Context()).AcceptLanguage)
+	data, _ := json.Marshal(Error(er.Code, msg))
+	return &utils.SseEvent{Event: utils.SseEventError, Data: string(data)}
+}
+
+// HttpSse 将resp中的消息以事件流发送,消息为*utils.SseEvent时原样发送(可以指定事件名,ID或者发送SseError)
+func HttpSse[respT any](w http.ResponseWriter, r *http.Request, resp chan *respT, err error) {
+	HttpSseWithOption(w, r, resp, err, SseOption{})
+}
+
+func HttpSseWithOption[respT any](w http.ResponseWriter, r *http.Request, resp chan *respT, err error, opt SseOption) {
+	if err != nil {
+		HttpErr(w, r, http.StatusBadRequest, err)
+		return
+	}
+	s := NewSseWriter(w, r, opt)
+	defer s.Close()
+	for {
+		select {
+		case msg, ok := <-resp:
+			if !ok {
+				return
+			}
+			event, ok := any(msg).(*utils.SseEvent)
+			if !ok {
+				data, err := json.Marshal(msg)
+				if err != nil {
+					logx.WithContext(r.Context()).Error(err.Error())
+					continue
+				}
+				event = &utils.SseEvent{Event: opt.Event, Data: string(data)}
+			}
+			if err := s.Send(event); err != nil { //写入失败,客户端已经断开
+				logx.WithContext(r.Context()).Infof("sse send err:%v", err)
+				return
+			}
+		case <-r.Context().Done():
+			// 客户端断开连接
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package result
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSseMsg struct {
+	Answer string `json:"answer"`
+}
+
+func readSse(t *testing.T, body io.Reader) []*utils.SseEvent {
+	r := utils.NewSseReader(body)
+	var ret []*utils.SseEvent
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return ret
+		}
+		require.NoError(t, err)
+		ret = append(ret, e)
+	}
+}
+
+func TestHttpSse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := make(chan *testSseMsg, 2)
+		c <- &testSseMsg{Answer: "a"}
+		c <- &testSseMsg{Answer: "b"}
+		close(c)
+		HttpSseWithOption(w, r, c, nil, SseOption{Event: "answer", Retry: time.Second})
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	events := readSse(t, resp.Body)
+	require.Len(t, events, 2)
+	assert.Equal(t, "answer", events[1].Event)
+	assert.Equal(t, `{"answer":"b"}`, events[1].Data)
+	assert.Equal(t, 1000, events[1].Retry)
+
+	//开始前的错误以json返回
+	rec := httptest.NewRecorder()
+	HttpSse[testSseMsg](rec, httptest.NewRequest("GET", "/", nil), nil, errors.Parameter)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), fmt.Sprintf(`"code":%d`, errors.Parameter.Code))
+}
+
+// 不支持Flush的ResponseWriter
+type noFlushWriter struct {
+	header http.Header
+	body   strings.Builder
+}
+
+func (w *noFlushWriter) Header() http.Header         { return w.header }
+func (w *noFlushWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *noFlushWriter) WriteHeader(int)             {}
+
+func TestSseWriter(t *testing.T) {
+	w := &noFlushWriter{header: http.Header{}}
+	r := httptest.NewRequest("GET", "/", nil)
+	s := NewSseWriter(w, r, SseOption{Heartbeat: 10 * time.Millisecond})
+	require.NoError(t, s.SendJson("log", map[string]any{"a": 1}))
+	require.NoError(t, s.Send(&utils.SseEvent{ID: "x", Event: "log", Data: "line1\nline2"}))
+	require.NoError(t, s.SendError(errors.Database.AddDetail("conn reset")))
+	time.Sleep(50 * time.Millisecond)
+	s.Close()
+	assert.Error(t, s.Send(&utils.SseEvent{Data: "closed"}))
+
+	body := w.body.String()
+	assert.Contains(t, body, ": ping\n\n")
+	events := readSse(t, strings.NewReader(body))
+	require.Len(t, events, 3)
+	assert.Equal(t, "line1\nline2", events[1].Data)
+	assert.Equal(t, "x", events[1].ID)
+	assert.Equal(t, utils.SseEventError, events[2].Event)
+	assert.Equal(t, errors.Database.Code, errors.Fmt(events[2].Err()).Code)
+}
+
+func TestSseReplay(t *testing.T) {
+	replay := NewSseMemReplay(3)
+	ctx := context.Background()
+	for _, d := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, replay.Append(ctx, &utils.SseEvent{Data: d}))
+	}
+	events, err := replay.Since(ctx, "2")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "3", events[0].ID)
+	events, _ = replay.Since(ctx, "1")
+	assert.Len(t, events, 3, "已经过期的ID补发缓存中所有的事件")
+	events, _ = replay.Since(ctx, "")
+	assert.Empty(t, events)
+
+	//客户端带Last-Event-ID重连后先补发
+	w := &noFlushWriter{header: http.Header{}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Last-Event-ID", "3")
+	s := NewSseWriter(w, r, SseOption{Heartbeat: -1, Replay: replay})
+	require.NoError(t, s.SendJson("", "5"))
+	require.NoError(t, s.SendError(errors.System))
+	s.Close()
+	events = readSse(t, strings.NewReader(w.body.String()))
+	require.Len(t, events, 3)
+	assert.Equal(t, []string{"4", "5"}, []string{events[0].ID, events[1].ID})
+	assert.Equal(t, utils.SseEventError, events[2].Event)
+	events, _ = replay.Since(ctx, "4")
+	assert.Len(t, events, 1, "错误事件不记录")
+}
@@ -11,13 +11,13 @@ func ErrFmt(err error) error {
 		return nil
 	}
 	if err.Error() == "redis: nil" {
-		return errors.NotFind
+		return errors.Wrap(err, errors.NotFind)
 	}
 	if _, ok := err.(*errors.CodeError); ok {
 		return err
 	}
-	if err == gorm.ErrRecordNotFound {
-		return errors.NotFind.WithStack(1)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.Wrap(err, errors.NotFind)
 	}
 	if strings.Contains(err.Error(), "Duplicate entry") || strings.Contains(err.Error(), "duplicate key") {
 		return errors.Duplicate.AddDetail(err)
@@ -2,21 +2,65 @@ package tools
 
 import (
 	"context"
-	"fmt"
-	"github.com/gogf/gf/v2/encoding/gcharset"
-	"github.com/gogf/gf/v2/encoding/gjson"
-	"github.com/gogf/gf/v2/frame/g"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
 	"github.com/maypok86/otter"
 	"github.com/zeromicro/go-zero/core/logx"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
 	"time"
 )
 
-var cityIpCache otter.Cache[string, string]
+const IpPrivate = "内网IP"
+
+// IpLocation ip的归属地信息
+type IpLocation struct {
+	Ip        string `json:"ip"`
+	Country   string `json:"country,omitempty"`
+	Province  string `json:"province,omitempty"`
+	City      string `json:"city,omitempty"`
+	Isp       string `json:"isp,omitempty"`
+	IsPrivate bool   `json:"isPrivate,omitempty"` //是否是内网(保留地址)ip
+}
+
+// String 返回 省 市 格式,内网ip返回 内网IP
+func (l *IpLocation) String() string {
+	if l == nil {
+		return ""
+	}
+	if l.IsPrivate {
+		return IpPrivate
+	}
+	var parts []string
+	for _, v := range []string{l.Province, l.City} {
+		if v != "" && !utils.SliceIn(v, parts...) {
+			parts = append(parts, v)
+		}
+	}
+	if len(parts) == 0 {
+		return l.Country
+	}
+	return strings.Join(parts, " ")
+}
+
+// IpLocator ip归属地数据源,查不到时返回nil
+type IpLocator interface {
+	Lookup(ctx context.Context, ip netip.Addr) (*IpLocation, error)
+}
+
+var (
+	cityIpCache otter.Cache[string, *IpLocation]
+	ipMutex     sync.RWMutex
+	ipLocators  []IpLocator
+)
 
 func init() {
-	cache, err := otter.MustBuilder[string, string](10_000).
+	cache, err := otter.MustBuilder[string, *IpLocation](10_000).
 		CollectStats().
-		Cost(func(key string, value string) uint32 {
+		Cost(func(key string, value *IpLocation) uint32 {
 			return 1
 		}).
 		WithTTL(time.Hour * 24).
@@ -25,32 +69,116 @@ func init() {
 	cityIpCache = cache
 }
 
-// GetCityByIp 获取ip所属城市
-func GetCityByIp(ip string) string {
-	if ip == "" {
-		return ""
+// InitIpGeo 初始化ip归属地查询,按 离线库 > 在线接口 的顺序查询,未初始化时只识别内网ip
+func InitIpGeo(c conf.IpGeoConf) error {
+	var locators []IpLocator
+	if c.DbFile != "" {
+		var (
+			l   IpLocator
+			err error
+		)
+		switch c.DbType {
+		case conf.IpGeoMmdb:
+			l, err = NewMmdbIpLocator(c.DbFile, c.Language)
+		case conf.IpGeoXdb, "":
+			l, err = NewXdbIpLocator(c.DbFile)
+		default:
+			err = errors.Parameter.AddMsgf("不支持的ip库类型:%v", c.DbType)
+		}
+		if err != nil {
+			return err
+		}
+		locators = append(locators, l)
 	}
-	if ip == "[::1]" || ip == "127.0.0.1" {
-		return "内网IP"
+	if c.UseHttp {
+		locators = append(locators, HttpIpLocator{})
 	}
-	v, ok := cityIpCache.Get(ip)
-	if ok {
-		return v
+	SetIpLocators(locators...)
+	return nil
+}
+
+func SetIpLocators(locators ...IpLocator) {
+	ipMutex.Lock()
+	defer ipMutex.Unlock()
+	ipLocators = locators
+	cityIpCache.Clear()
+}
+
+// ParseIp 解析ip,兼容 [::1] 及带端口的格式
+func ParseIp(ip string) (netip.Addr, error) {
+	ip = strings.TrimSpace(ip)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
 	}
-	url := "http://whois.pconline.com.cn/ipJson.jsp?json=true&ip=" + ip
-	bytes := g.Client().GetBytes(context.TODO(), url)
-	src := string(bytes)
-	srcCharset := "GBK"
-	tmp, _ := gcharset.ToUTF8(srcCharset, src)
-	json, err := gjson.DecodeToJson(tmp)
+	ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
+		return addr, errors.Parameter.AddMsgf("ip格式错误:%s", ip)
+	}
+	return addr.Unmap(), nil
+}
+
+var extraPrivatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), //运营商级NAT
+	netip.MustParsePrefix("198.18.0.0/15"), //性能测试
+	netip.MustParsePrefix("192.0.0.0/24"),  //IETF协议分配
+	netip.MustParsePrefix("0.0.0.0/8"),
+}
+
+// IsPrivateIp 是否是内网或保留地址:回环 私有网段 链路本地 运营商NAT ipv6唯一本地地址等
+func IsPrivateIp(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, p := range extraPrivatePrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIpLocation 获取ip的归属地信息,查不到时返回只有ip的结果
+func GetIpLocation(ctx context.Context, ip string) (*IpLocation, error) {
+	addr, err := ParseIp(ip)
+	if err != nil {
+		return nil, err
+	}
+	key := addr.String()
+	if IsPrivateIp(addr) {
+		return &IpLocation{Ip: key, IsPrivate: true}, nil
+	}
+	if v, ok := cityIpCache.Get(key); ok {
+		return v, nil
+	}
+	ipMutex.RLock()
+	locators := ipLocators
+	ipMutex.RUnlock()
+	for _, l := range locators {
+		ret, err := l.Lookup(ctx, addr)
+		if err != nil {
+			logx.WithContext(ctx).Errorf("ip locator %T ip:%v err:%v", l, key, err)
+			continue
+		}
+		if ret != nil {
+			ret.Ip = key
+			cityIpCache.Set(key, ret)
+			return ret, nil
+		}
+	}
+	return &IpLocation{Ip: key}, nil
+}
+
+// GetCityByIp 获取ip所属城市
+func GetCityByIp(ip string) string {
+	if ip == "" {
 		return ""
 	}
-	if json.Get("code").Int() == 0 {
-		city := fmt.Sprintf("%s %s", json.Get("pro").String(), json.Get("city").String())
-		cityIpCache.Set(ip, city)
-		return city
-	} else {
+	ret, err := GetIpLocation(context.Background(), ip)
+	if err != nil {
 		return ""
 	}
+	return ret.String()
 }
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+)
+
+type testXdbSegment struct {
+	start, end string
+	region     string
+}
+
+// 按xdb格式生成测试用的ip库
+func genTestXdb(segments []testXdbSegment) []byte {
+	buf := make([]byte, xdbMinFileLength)
+	type index struct {
+		start, end uint32
+		ptr        int
+	}
+	var indexes []index
+	for _, s := range segments {
+		indexes = append(indexes, index{
+			start: binary.BigEndian.Uint32(netip.MustParseAddr(s.start).AsSlice()),
+			end:   binary.BigEndian.Uint32(netip.MustParseAddr(s.end).AsSlice()),
+			ptr:   len(buf),
+		})
+		buf = append(buf, s.region...)
+	}
+	vector := map[uint32][2]int{}
+	for i, idx := range indexes {
+		p := len(buf)
+		seg := make([]byte, xdbSegmentIndexSize)
+		binary.LittleEndian.PutUint32(seg, idx.start)
+		binary.LittleEndian.PutUint32(seg[4:], idx.end)
+		binary.LittleEndian.PutUint16(seg[8:], uint16(len(segments[i].region)))
+		binary.LittleEndian.PutUint32(seg[10:], uint32(idx.ptr))
+		buf = append(buf, seg...)
+		for ip := idx.start >> 16; ip <= idx.end>>16; ip++ {
+			v, ok := vector[ip]
+			if !ok {
+				v[0] = p
+			}
+			v[1] = p
+			vector[ip] = v
+		}
+	}
+	for ip, v := range vector {
+		off := xdbHeaderLength + int(ip)*xdbVectorIndexSize
+		binary.LittleEndian.PutUint32(buf[off:], uint32(v[0]))
+		binary.LittleEndian.PutUint32(buf[off+4:], uint32(v[1]))
+	}
+	return buf
+}
+
+func TestGetIpLocation(t *testing.T) {
+	ctx := context.Background()
+	xdb, err := NewXdbIpLocatorWithBuffer(genTestXdb([]testXdbSegment{
+		{start: "1.2.3.0", end: "1.2.3.255", region: "中国|0|广东省|深圳市|电信"},
+		{start: "1.2.4.0", end: "1.2.4.255", region: "中国|浙江省|杭州市|移动"},
+	}))
+	assert.NoError(t, err)
+	SetIpLocators(xdb)
+	defer SetIpLocators()
+
+	ret, err := GetIpLocation(ctx, "1.2.3.4:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, &IpLocation{Ip: "1.2.3.4", Country: "中国", Province: "广东省", City: "深圳市", Isp: "电信"}, ret)
+	assert.Equal(t, "浙江省 杭州市", GetCityByIp("1.2.4.1"))
+	assert.Equal(t, "", GetCityByIp("1.2.5.1"))
+
+	for _, ip := range []string{"127.0.0.1", "[::1]", "10.1.2.3", "172.20.0.1", "192.168.1.1",
+		"100.64.1.1", "169.254.1.1", "fd00::1", "fe80::1", "::ffff:192.168.0.1"} {
+		assert.Equal(t, IpPrivate, GetCityByIp(ip), ip)
+	}
+	_, err = GetIpLocation(ctx, "not an ip")
+	assert.Error(t, err)
+}
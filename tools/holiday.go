@@ -2,11 +2,12 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
 	"gitee.com/unitedrhino/share/utils"
-	"github.com/parnurzeal/gorequest"
 	"github.com/zeromicro/go-zero/core/logx"
+	"sync"
 	"time"
 )
 
@@ -18,81 +19,228 @@ const (
 	HolidayFestival = 2 //节日
 )
 
+const holidayDateLayout = "2006-01-02"
+
+// 查找下一个工作日时最多往后找的天数
+const holidayMaxSearchDays = 366
+
 type HolidayInfo struct {
 	Holiday HolidayType `json:"holiday"`
-	Wage    int         `json:"wage"` //薪资倍数
+	Wage    int         `json:"wage"`           //薪资倍数
+	Name    string      `json:"name,omitempty"` //节日名称,如 春节 春节前补班
 }
 
-type holidayDetail struct {
-	Holiday bool   `json:"holiday"`
-	Name    string `json:"name"`
-	Wage    int    `json:"wage"`
-	Date    string `json:"date"`
-	Rest    int    `json:"rest"`
+func (h *HolidayInfo) IsWorkday() bool {
+	return h != nil && h.Holiday == HolidayWorkDay
 }
 
-type holidayResp struct {
-	Code    int                      `json:"code"`
-	Holiday map[string]holidayDetail `json:"holiday"`
+// HolidayProvider 节假日数据源
+type HolidayProvider interface {
+	// Holiday 获取指定日期(已转换到日历时区)的节假日信息,数据源中没有该日期的数据时返回nil
+	Holiday(ctx context.Context, date time.Time) (*HolidayInfo, error)
 }
 
-func GetHoliday(ctx context.Context, t time.Time) (ret *HolidayInfo, err error) {
-	var year, month, day = t.Date()
-	var key = fmt.Sprintf("share:tools:holiday:%04d-%02d-%02d", year, month, day)
-	val, err := store.Get(key)
-	if !(err != nil || val == "") {
-		err := json.Unmarshal([]byte(val), &ret)
-		return ret, err
-	}
-
-	var (
-		holidayMap = initHoliday(year, month)
-		gReq       = gorequest.New().Retry(5, time.Second*1)
-		data       holidayResp
-	)
-	func() {
-		//官网: http://timor.tech/api/holiday
-		_, body, errs := gReq.Get(fmt.Sprintf("http://timor.tech/api/holiday/year/%04d-%02d", year, month)).
-			Set("User-Agent", "iThings").EndStruct(&data) //不加User-Agent会被拦截
-		fmt.Println(string(body))
-		if errs != nil {
-			logx.WithContext(ctx).Error(errs)
-			return
+// HolidayYearProvider 可以判断是否有某年数据的数据源,用于区分普通的工作日和缺少数据的年份
+type HolidayYearProvider interface {
+	HasYear(year int) bool
+}
+
+// HolidayCalendar 按顺序查询各数据源,都没有数据时按周末规则兜底
+type HolidayCalendar struct {
+	Region    string
+	Location  *time.Location
+	Weekends  []time.Weekday
+	providers []HolidayProvider
+	overrides *HolidayOverride
+	missYears sync.Map //没有日历数据的年份,只提示一次
+}
+
+func NewHolidayCalendar(region string, loc *time.Location, providers ...HolidayProvider) *HolidayCalendar {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &HolidayCalendar{
+		Region:    region,
+		Location:  loc,
+		Weekends:  []time.Weekday{time.Sunday, time.Saturday},
+		providers: providers,
+		overrides: NewHolidayOverride(region),
+	}
+}
+
+var (
+	holidayMutex    sync.RWMutex
+	defaultCalendar *HolidayCalendar
+)
+
+// InitHoliday 根据配置初始化默认日历: 管理员覆盖 > 导入的日历文件 > 内置日历 > 在线数据源 > 周末规则
+func InitHoliday(c conf.HolidayConf) (*HolidayCalendar, error) {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, errors.Parameter.AddMsgf("节假日时区配置错误:%v", c.TimeZone).AddDetail(err)
+	}
+	var providers []HolidayProvider
+	for _, f := range c.Files {
+		p, err := LoadHolidayFile(f)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	weekends := []time.Weekday{time.Sunday, time.Saturday}
+	embed, err := NewEmbedHolidayProvider(c.Region)
+	if err == nil {
+		providers = append(providers, embed)
+		weekends = embed.Weekends
+	} else if !errors.Cmp(err, errors.NotFind) {
+		return nil, err
+	}
+	if c.UseHttp {
+		providers = append(providers, NewHttpHolidayProvider(c.HttpUrl, loc))
+	}
+	cal := NewHolidayCalendar(c.Region, loc, providers...)
+	cal.Weekends = weekends
+	SetDefaultHolidayCalendar(cal)
+	return cal, nil
+}
+
+func SetDefaultHolidayCalendar(cal *HolidayCalendar) {
+	holidayMutex.Lock()
+	defer holidayMutex.Unlock()
+	defaultCalendar = cal
+}
+
+// GetHolidayCalendar 获取默认日历,未初始化时使用内置的中国日历
+func GetHolidayCalendar() *HolidayCalendar {
+	holidayMutex.RLock()
+	cal := defaultCalendar
+	holidayMutex.RUnlock()
+	if cal != nil {
+		return cal
+	}
+	cal, err := InitHoliday(conf.HolidayConf{Region: "cn", TimeZone: "Asia/Shanghai"})
+	if err != nil {
+		logx.Error(err)
+		cal = NewHolidayCalendar("cn", time.Local)
+		SetDefaultHolidayCalendar(cal)
+	}
+	return cal
+}
+
+// Overrides 管理员配置的公司自定义休息日及调休上班日
+func (c *HolidayCalendar) Overrides() *HolidayOverride {
+	return c.overrides
+}
+
+func (c *HolidayCalendar) dayOf(t time.Time) time.Time {
+	t = t.In(c.Location)
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.Location)
+}
+
+func (c *HolidayCalendar) GetHoliday(ctx context.Context, t time.Time) (*HolidayInfo, error) {
+	date := c.dayOf(t)
+	ret, err := c.overrides.Holiday(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	if ret != nil {
+		return ret, nil
+	}
+	for _, p := range c.providers {
+		ret, err = p.Holiday(ctx, date)
+		if err != nil {
+			logx.WithContext(ctx).Errorf("holiday provider %T date:%v err:%v", p, date, err)
+			continue
 		}
-		for k, v := range data.Holiday {
-			holiday := HolidayWeekend
-			if v.Holiday {
-				holiday = HolidayFestival
-			}
-			holidayMap[fmt.Sprintf("%4d-%v", year, k)] = &HolidayInfo{
-				Holiday: HolidayType(holiday),
-				Wage:    v.Wage,
-			}
+		if ret != nil {
+			return ret, nil
 		}
-	}()
-	for k, v := range holidayMap {
-		var dayKey = fmt.Sprintf("share:tools:holiday:%s", k)
-		valByte, _ := json.Marshal(v)
-		store.SetexCtx(ctx, dayKey, string(valByte), 60*60*24*100) //保留100天
-		if dayKey == key {
-			ret = v
+		//数据源有该年的数据,没有列出的日期就是普通的工作日或周末,不再查询后面的数据源
+		if yp, ok := p.(HolidayYearProvider); ok && yp.HasYear(date.Year()) {
+			return c.weekendHoliday(date), nil
 		}
 	}
-	return
+	if _, ok := c.missYears.LoadOrStore(date.Year(), struct{}{}); !ok {
+		logx.WithContext(ctx).Errorf("holiday calendar %s has no data for year %d, only weekends are used",
+			c.Region, date.Year())
+	}
+	return c.weekendHoliday(date), nil
+}
+
+func (c *HolidayCalendar) weekendHoliday(date time.Time) *HolidayInfo {
+	info := HolidayInfo{
+		Holiday: HolidayWorkDay,
+		Wage:    1,
+	}
+	if utils.SliceIn(date.Weekday(), c.Weekends...) {
+		info.Holiday = HolidayWeekend
+		info.Wage = 2
+	}
+	return &info
 }
-func initHoliday(year int, month time.Month) map[string]*HolidayInfo {
-	var retMap = map[string]*HolidayInfo{}
-	days := utils.GetMonthDays(year, month)
-	for day := 1; day <= days; day++ {
-		t := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
-		info := HolidayInfo{
-			Holiday: HolidayWorkDay,
-			Wage:    1,
+
+func (c *HolidayCalendar) IsWorkday(ctx context.Context, t time.Time) (bool, error) {
+	info, err := c.GetHoliday(ctx, t)
+	if err != nil {
+		return false, err
+	}
+	return info.IsWorkday(), nil
+}
+
+// NextWorkday 获取t之后(不含t当天)的第一个工作日的零点
+func (c *HolidayCalendar) NextWorkday(ctx context.Context, t time.Time) (time.Time, error) {
+	date := c.dayOf(t)
+	for i := 0; i < holidayMaxSearchDays; i++ {
+		date = date.AddDate(0, 0, 1)
+		ok, err := c.IsWorkday(ctx, date)
+		if err != nil {
+			return time.Time{}, err
 		}
-		if utils.SliceIn(t.Weekday(), time.Sunday, time.Saturday) {
-			info.Holiday = HolidayWeekend
+		if ok {
+			return date, nil
 		}
-		retMap[fmt.Sprintf("%04d-%02d-%02d", year, month, day)] = &info
 	}
-	return retMap
+	return time.Time{}, errors.NotFind.AddMsgf("%d天内没有工作日", holidayMaxSearchDays)
+}
+
+// WorkdaysBetween 统计[start,end]之间(包含首尾两天)的工作日天数
+func (c *HolidayCalendar) WorkdaysBetween(ctx context.Context, start, end time.Time) (int, error) {
+	s, e := c.dayOf(start), c.dayOf(end)
+	if e.Before(s) {
+		return 0, errors.Parameter.AddMsg("结束日期不能早于开始日期")
+	}
+	var count int
+	for d := s; !d.After(e); d = d.AddDate(0, 0, 1) {
+		ok, err := c.IsWorkday(ctx, d)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetHoliday 使用默认日历获取节假日信息
+func GetHoliday(ctx context.Context, t time.Time) (ret *HolidayInfo, err error) {
+	return GetHolidayCalendar().GetHoliday(ctx, t)
+}
+
+func IsWorkday(ctx context.Context, t time.Time) (bool, error) {
+	return GetHolidayCalendar().IsWorkday(ctx, t)
+}
+
+func NextWorkday(ctx context.Context, t time.Time) (time.Time, error) {
+	return GetHolidayCalendar().NextWorkday(ctx, t)
+}
+
+func WorkdaysBetween(ctx context.Context, start, end time.Time) (int, error) {
+	return GetHolidayCalendar().WorkdaysBetween(ctx, start, end)
+}
+
+func holidayDateKey(date time.Time) string {
+	var year, month, day = date.Date()
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day)
 }
@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"gitee.com/unitedrhino/share/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:embed holiday/*.json
+var holidayFS embed.FS
+
+// HolidayFile 日历文件格式,date到end(包含)之间的每一天都使用相同的配置
+//
+//	{"region":"cn","weekends":[0,6],"days":[{"date":"2025-01-28","end":"2025-02-04","name":"春节","holiday":true},{"date":"2025-02-08","name":"春节后补班"}]}
+type HolidayFile struct {
+	Region   string           `json:"region"`
+	TimeZone string           `json:"timeZone,omitempty"`
+	Weekends []time.Weekday   `json:"weekends,omitempty"` //周末是星期几,0为周日,不填默认周六周日
+	Days     []HolidayFileDay `json:"days"`
+}
+
+type HolidayFileDay struct {
+	Date    string `json:"date"`              //yyyy-mm-dd
+	End     string `json:"end,omitempty"`     //连续多天时的最后一天,yyyy-mm-dd
+	Name    string `json:"name,omitempty"`    //名称
+	Holiday bool   `json:"holiday,omitempty"` //true为放假,false为调休上班
+	Wage    int    `json:"wage,omitempty"`    //薪资倍数,不填时放假为2,上班为1
+}
+
+// FileHolidayProvider 从日历文件(json或ics)读取的节假日数据,只覆盖文件中列出的日期
+type FileHolidayProvider struct {
+	Region   string
+	Weekends []time.Weekday
+	days     map[string]*HolidayInfo
+	years    map[int]struct{} //文件中有数据的年份
+}
+
+func (p *FileHolidayProvider) Holiday(ctx context.Context, date time.Time) (*HolidayInfo, error) {
+	ret, ok := p.days[holidayDateKey(date)]
+	if !ok {
+		return nil, nil
+	}
+	info := *ret
+	return &info, nil
+}
+
+// HasYear 文件中是否有该年的数据
+func (p *FileHolidayProvider) HasYear(year int) bool {
+	_, ok := p.years[year]
+	return ok
+}
+
+// NewEmbedHolidayProvider 获取内置的地区日历,如 cn
+func NewEmbedHolidayProvider(region string) (*FileHolidayProvider, error) {
+	data, err := holidayFS.ReadFile("holiday/" + strings.ToLower(region) + ".json")
+	if err != nil {
+		return nil, errors.NotFind.AddMsgf("没有内置的节假日日历:%s", region)
+	}
+	return ParseHolidayJson(data)
+}
+
+// LoadHolidayFile 导入日历文件,根据后缀区分json和ics格式
+func LoadHolidayFile(path string) (*FileHolidayProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.System.AddMsgf("读取节假日日历文件失败:%s", path).AddDetail(err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ics":
+		return ParseHolidayIcs(data)
+	default:
+		return ParseHolidayJson(data)
+	}
+}
+
+func ParseHolidayJson(data []byte) (*FileHolidayProvider, error) {
+	var f HolidayFile
+	err := json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, errors.Parameter.AddMsg("节假日日历文件格式错误").AddDetail(err)
+	}
+	p := FileHolidayProvider{
+		Region:   f.Region,
+		Weekends: f.Weekends,
+		days:     map[string]*HolidayInfo{},
+		years:    map[int]struct{}{},
+	}
+	if len(p.Weekends) == 0 {
+		p.Weekends = []time.Weekday{time.Sunday, time.Saturday}
+	}
+	for _, d := range f.Days {
+		start, err := time.Parse(holidayDateLayout, d.Date)
+		if err != nil {
+			return nil, errors.Parameter.AddMsgf("节假日日期格式错误:%s", d.Date).AddDetail(err)
+		}
+		end := start
+		if d.End != "" {
+			end, err = time.Parse(holidayDateLayout, d.End)
+			if err != nil || end.Before(start) {
+				return nil, errors.Parameter.AddMsgf("节假日结束日期错误:%s", d.End)
+			}
+		}
+		p.addRange(start, end, d.Name, d.Holiday, d.Wage)
+	}
+	return &p, nil
+}
+
+// ParseHolidayIcs 解析ics日历,每个全天VEVENT为一段假期;
+// SUMMARY中包含"补班"或"上班",或者CATEGORIES为WORKDAY的事件视为调休上班日
+func ParseHolidayIcs(data []byte) (*FileHolidayProvider, error) {
+	p := FileHolidayProvider{
+		Weekends: []time.Weekday{time.Sunday, time.Saturday},
+		days:     map[string]*HolidayInfo{},
+		years:    map[int]struct{}{},
+	}
+	var (
+		inEvent    bool
+		start, end time.Time
+		summary    string
+		isWorkday  bool
+	)
+	for _, line := range unfoldIcsLines(data) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		prop, _, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(prop) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				inEvent, start, end, summary, isWorkday = true, time.Time{}, time.Time{}, "", false
+			}
+		case "X-WR-CALNAME":
+			p.Region = value
+		case "DTSTART", "DTEND":
+			if !inEvent {
+				continue
+			}
+			t, err := parseIcsDate(value)
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(prop, "DTSTART") {
+				start = t
+			} else {
+				end = t
+			}
+		case "SUMMARY":
+			summary = value
+			if strings.Contains(value, "补班") || strings.Contains(value, "上班") {
+				isWorkday = true
+			}
+		case "CATEGORIES":
+			if strings.Contains(strings.ToUpper(value), "WORKDAY") {
+				isWorkday = true
+			}
+		case "END":
+			if !inEvent || !strings.EqualFold(value, "VEVENT") {
+				continue
+			}
+			inEvent = false
+			if start.IsZero() {
+				return nil, errors.Parameter.AddMsgf("ics事件缺少DTSTART:%s", summary)
+			}
+			last := start
+			if !end.IsZero() && end.After(start) { //全天事件的DTEND不包含在内
+				last = end.AddDate(0, 0, -1)
+			}
+			p.addRange(start, last, summary, !isWorkday, 0)
+		}
+	}
+	return &p, nil
+}
+
+func (p *FileHolidayProvider) addRange(start, end time.Time, name string, holiday bool, wage int) {
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		info := HolidayInfo{Holiday: HolidayWorkDay, Wage: 1, Name: name}
+		if holiday {
+			info.Holiday = HolidayFestival
+			info.Wage = 2
+		}
+		if wage != 0 {
+			info.Wage = wage
+		}
+		p.days[holidayDateKey(d)] = &info
+		p.years[d.Year()] = struct{}{}
+	}
+}
+
+// ics规定超过75字节的行会折行,以空格或tab开头的行是上一行的延续
+func unfoldIcsLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func parseIcsDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errors.Parameter.AddMsgf("ics日期格式错误:%s", value)
+	}
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, errors.Parameter.AddMsgf("ics日期格式错误:%s", value).AddDetail(err)
+	}
+	return t, nil
+}
@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gitee.com/unitedrhino/share/errors"
+	"gitee.com/unitedrhino/share/utils"
+	"github.com/parnurzeal/gorequest"
+	"strings"
+	"sync"
+	"time"
+)
+
+type holidayDetail struct {
+	Holiday bool   `json:"holiday"`
+	Name    string `json:"name"`
+	Wage    int    `json:"wage"`
+	Date    string `json:"date"`
+	Rest    int    `json:"rest"`
+}
+
+type holidayResp struct {
+	Code    int                      `json:"code"`
+	Holiday map[string]holidayDetail `json:"holiday"`
+}
+
+// HttpHolidayProvider 从 http://timor.tech/api/holiday 获取中国节假日,按月缓存到kv中
+type HttpHolidayProvider struct {
+	Url      string
+	Location *time.Location
+	months   sync.Map //yyyy-mm:*httpHolidayMonth 进程内缓存,没有kv时也不会每次都请求
+}
+
+// 获取失败后多久再重新请求
+const httpHolidayFailRetry = time.Minute
+
+type httpHolidayMonth struct {
+	days     map[string]*HolidayInfo
+	err      error
+	expireAt time.Time //失败的结果只缓存一段时间
+}
+
+func NewHttpHolidayProvider(url string, loc *time.Location) *HttpHolidayProvider {
+	if url == "" {
+		url = "http://timor.tech/api/holiday"
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return &HttpHolidayProvider{Url: strings.TrimSuffix(url, "/"), Location: loc}
+}
+
+func (p *HttpHolidayProvider) genKey(dateKey string) string {
+	return fmt.Sprintf("share:tools:holiday:%s", dateKey)
+}
+
+func (p *HttpHolidayProvider) Holiday(ctx context.Context, date time.Time) (ret *HolidayInfo, err error) {
+	key := p.genKey(holidayDateKey(date))
+	if store != nil {
+		val, err := store.GetCtx(ctx, key)
+		if err == nil && val != "" {
+			err = json.Unmarshal([]byte(val), &ret)
+			return ret, err
+		}
+	}
+	var year, month, _ = date.Date()
+	monthKey := fmt.Sprintf("%04d-%02d", year, month)
+	if v, ok := p.months.Load(monthKey); ok {
+		m := v.(*httpHolidayMonth)
+		if m.err == nil {
+			return copyHolidayInfo(m.days[holidayDateKey(date)]), nil
+		}
+		if time.Now().Before(m.expireAt) {
+			return nil, m.err
+		}
+	}
+	holidayMap, err := p.getMonth(year, month)
+	if err != nil {
+		p.months.Store(monthKey, &httpHolidayMonth{err: err, expireAt: time.Now().Add(httpHolidayFailRetry)})
+		return nil, err
+	}
+	p.months.Store(monthKey, &httpHolidayMonth{days: holidayMap})
+	for k, v := range holidayMap {
+		if store != nil {
+			valByte, _ := json.Marshal(v)
+			store.SetexCtx(ctx, p.genKey(k), string(valByte), 60*60*24*100) //保留100天
+		}
+		if k == holidayDateKey(date) {
+			ret = copyHolidayInfo(v)
+		}
+	}
+	return ret, nil
+}
+
+func copyHolidayInfo(info *HolidayInfo) *HolidayInfo {
+	if info == nil {
+		return nil
+	}
+	ret := *info
+	return &ret
+}
+
+func (p *HttpHolidayProvider) getMonth(year int, month time.Month) (map[string]*HolidayInfo, error) {
+	var (
+		holidayMap = map[string]*HolidayInfo{}
+		gReq       = gorequest.New().Retry(3, time.Second*1)
+		data       holidayResp
+	)
+	_, _, errs := gReq.Get(fmt.Sprintf("%s/year/%04d-%02d", p.Url, year, month)).
+		Set("User-Agent", "iThings").EndStruct(&data) //不加User-Agent会被拦截
+	if len(errs) != 0 {
+		return nil, errors.System.AddMsg("获取节假日数据失败").AddDetail(errs)
+	}
+	if data.Code != 0 {
+		return nil, errors.System.AddMsgf("获取节假日数据失败,code:%v", data.Code)
+	}
+	days := utils.GetMonthDays(year, month)
+	for day := 1; day <= days; day++ {
+		t := time.Date(year, month, day, 0, 0, 0, 0, p.Location)
+		info := HolidayInfo{
+			Holiday: HolidayWorkDay,
+			Wage:    1,
+		}
+		if utils.SliceIn(t.Weekday(), time.Sunday, time.Saturday) {
+			info.Holiday = HolidayWeekend
+			info.Wage = 2
+		}
+		holidayMap[holidayDateKey(t)] = &info
+	}
+	for k, v := range data.Holiday {
+		holiday := HolidayWorkDay
+		if v.Holiday {
+			holiday = HolidayFestival
+		}
+		holidayMap[fmt.Sprintf("%04d-%v", year, k)] = &HolidayInfo{
+			Holiday: HolidayType(holiday),
+			Wage:    v.Wage,
+			Name:    v.Name,
+		}
+	}
+	return holidayMap, nil
+}
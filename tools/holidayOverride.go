@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"sync"
+	"time"
+)
+
+// HolidayOverride 管理员配置的公司自定义休息日和调休上班日,优先级最高.
+// 调用过InitStore时保存在kv中供多个实例共享,否则只保存在内存中
+type HolidayOverride struct {
+	region string
+	mutex  sync.RWMutex
+	days   map[string]*HolidayInfo
+}
+
+func NewHolidayOverride(region string) *HolidayOverride {
+	return &HolidayOverride{region: region, days: map[string]*HolidayInfo{}}
+}
+
+func (o *HolidayOverride) genKey() string {
+	return fmt.Sprintf("share:tools:holiday:override:%s", o.region)
+}
+
+func (o *HolidayOverride) Holiday(ctx context.Context, date time.Time) (*HolidayInfo, error) {
+	dateKey := holidayDateKey(date)
+	if store == nil {
+		o.mutex.RLock()
+		defer o.mutex.RUnlock()
+		if v, ok := o.days[dateKey]; ok {
+			info := *v
+			return &info, nil
+		}
+		return nil, nil
+	}
+	val, err := store.HgetCtx(ctx, o.genKey(), dateKey)
+	if errors.Is(err, redis.Nil) || (err == nil && val == "") { //不存在时redis返回nil错误
+		return nil, nil
+	}
+	if err != nil { //kv出错时不能当作没有配置,否则管理员的配置会被忽略
+		return nil, errors.Database.AddDetail(err)
+	}
+	var ret HolidayInfo
+	err = json.Unmarshal([]byte(val), &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Set 设置某一天为休息日或上班日
+func (o *HolidayOverride) Set(ctx context.Context, date time.Time, info HolidayInfo) error {
+	dateKey := holidayDateKey(date)
+	if info.Wage == 0 {
+		info.Wage = 1
+	}
+	if store == nil {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.days[dateKey] = &info
+		return nil
+	}
+	val, _ := json.Marshal(info)
+	return store.HsetCtx(ctx, o.genKey(), dateKey, string(val))
+}
+
+// Delete 删除某一天的自定义配置,恢复使用日历数据
+func (o *HolidayOverride) Delete(ctx context.Context, date time.Time) error {
+	dateKey := holidayDateKey(date)
+	if store == nil {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		delete(o.days, dateKey)
+		return nil
+	}
+	_, err := store.HdelCtx(ctx, o.genKey(), dateKey)
+	return err
+}
+
+// List 获取所有自定义配置,key为yyyy-mm-dd
+func (o *HolidayOverride) List(ctx context.Context) (map[string]*HolidayInfo, error) {
+	var ret = map[string]*HolidayInfo{}
+	if store == nil {
+		o.mutex.RLock()
+		defer o.mutex.RUnlock()
+		for k, v := range o.days {
+			info := *v
+			ret[k] = &info
+		}
+		return ret, nil
+	}
+	vals, err := store.HgetallCtx(ctx, o.genKey())
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range vals {
+		var info HolidayInfo
+		if err := json.Unmarshal([]byte(v), &info); err != nil {
+			return nil, err
+		}
+		ret[k] = &info
+	}
+	return ret, nil
+}
@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHolidayCalendar(t *testing.T) {
+	ctx := context.Background()
+	cal, err := InitHoliday(conf.HolidayConf{Region: "cn", TimeZone: "Asia/Shanghai"})
+	assert.NoError(t, err)
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(holidayDateLayout, s, cal.Location)
+		return d
+	}
+	tests := []struct {
+		date string
+		want bool
+	}{
+		{date: "2025-01-01", want: false}, //元旦
+		{date: "2025-01-26", want: true},  //周日补班
+		{date: "2025-02-03", want: false}, //春节
+		{date: "2025-03-05", want: true},
+		{date: "2025-03-08", want: false}, //周六
+		{date: "2030-03-09", want: false}, //没有日历数据时按周末处理
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			got, err := cal.IsWorkday(ctx, day(tt.date))
+			assert.NoError(t, err)
+			assert.Equalf(t, tt.want, got, "IsWorkday(%v)", tt.date)
+		})
+	}
+
+	_, miss := cal.missYears.Load(2025)
+	assert.False(t, miss, "内置日历有数据的年份,没有列出的日期是普通的工作日")
+	_, miss = cal.missYears.Load(2030)
+	assert.True(t, miss)
+
+	next, err := cal.NextWorkday(ctx, day("2025-01-27"))
+	assert.NoError(t, err)
+	assert.Equal(t, day("2025-02-05"), next)
+
+	count, err := cal.WorkdaysBetween(ctx, day("2025-10-01"), day("2025-10-12"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count) //9号,10号,11号补班
+
+	err = cal.Overrides().Set(ctx, day("2025-10-09"), HolidayInfo{Holiday: HolidayFestival, Name: "公司年假"})
+	assert.NoError(t, err)
+	count, err = cal.WorkdaysBetween(ctx, day("2025-10-01"), day("2025-10-12"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestParseHolidayIcs(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nX-WR-CALNAME:test\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20250501\r\n" +
+		"DTEND;VALUE=DATE:20250506\r\nSUMMARY:劳动节\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20250427\r\nSUMMARY:劳动节\r\n 补班\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	p, err := ParseHolidayIcs([]byte(ics))
+	assert.NoError(t, err)
+	assert.Equal(t, "test", p.Region)
+	for date, want := range map[string]HolidayType{
+		"2025-05-01": HolidayFestival,
+		"2025-05-05": HolidayFestival,
+		"2025-04-27": HolidayWorkDay,
+	} {
+		d, _ := time.Parse(holidayDateLayout, date)
+		info, err := p.Holiday(context.Background(), d)
+		assert.NoError(t, err)
+		if assert.NotNil(t, info, date) {
+			assert.Equal(t, want, info.Holiday, date)
+		}
+	}
+	d, _ := time.Parse(holidayDateLayout, "2025-05-06")
+	info, _ := p.Holiday(context.Background(), d)
+	assert.Nil(t, info)
+}
+
+func TestHolidayHttpFallback(t *testing.T) {
+	ctx := context.Background()
+	var requests atomic.Int64
+	fail := atomic.Bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if fail.Load() {
+			w.Write([]byte(`{"code":-1}`))
+			return
+		}
+		w.Write([]byte(`{"code":0,"holiday":{"03-08":{"holiday":true,"name":"测试节","wage":3,"date":"2030-03-08"}}}`))
+	}))
+	defer server.Close()
+	embed, err := NewEmbedHolidayProvider("cn")
+	assert.NoError(t, err)
+	cal := NewHolidayCalendar("cn", time.UTC, embed, NewHttpHolidayProvider(server.URL, time.UTC))
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(holidayDateLayout, s, time.UTC)
+		return d
+	}
+
+	//内置日历有数据的年份不请求在线数据源
+	ok, err := cal.IsWorkday(ctx, day("2025-03-05"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), requests.Load())
+
+	//同一个月只请求一次,工作日也会缓存
+	for _, date := range []string{"2030-03-05", "2030-03-06", "2030-03-05"} {
+		ok, err = cal.IsWorkday(ctx, day(date))
+		assert.NoError(t, err)
+		assert.True(t, ok, date)
+	}
+	info, err := cal.GetHoliday(ctx, day("2030-03-08"))
+	assert.NoError(t, err)
+	assert.Equal(t, "测试节", info.Name)
+	assert.Equal(t, int64(1), requests.Load())
+
+	//请求失败的结果缓存一段时间,不会每次都重新请求
+	fail.Store(true)
+	for i := 0; i < 3; i++ {
+		ok, err = cal.IsWorkday(ctx, day("2031-03-05"))
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, int64(2), requests.Load())
+}
+
+func TestHolidayOverrideStore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	old := store
+	store = kv.NewStore(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	t.Cleanup(func() { store = old })
+	cal := NewHolidayCalendar("test", time.UTC)
+	date := time.Date(2030, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	info, err := cal.Overrides().Holiday(ctx, date)
+	assert.NoError(t, err)
+	assert.Nil(t, info, "没有配置")
+	assert.NoError(t, cal.Overrides().Set(ctx, date, HolidayInfo{Holiday: HolidayFestival, Name: "公司年假"}))
+	ok, err := cal.IsWorkday(ctx, date)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	//kv出错时返回错误,不能当作没有配置
+	mr.Close()
+	_, err = cal.Overrides().Holiday(ctx, date)
+	assert.True(t, errors.Cmp(err, errors.Database))
+	_, err = cal.IsWorkday(ctx, date)
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"context"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/gogf/gf/v2/encoding/gcharset"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+	"net/netip"
+)
+
+// HttpIpLocator 调用 whois.pconline.com.cn 在线查询,会把用户ip发送给第三方,只作为离线库的补充
+type HttpIpLocator struct{}
+
+func (HttpIpLocator) Lookup(ctx context.Context, addr netip.Addr) (*IpLocation, error) {
+	url := "http://whois.pconline.com.cn/ipJson.jsp?json=true&ip=" + addr.String()
+	bytes := g.Client().GetBytes(ctx, url)
+	tmp, err := gcharset.ToUTF8("GBK", string(bytes))
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	json, err := gjson.DecodeToJson(tmp)
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	if json.Get("code").Int() != 0 {
+		return nil, nil
+	}
+	return &IpLocation{
+		Province: json.Get("pro").String(),
+		City:     json.Get("city").String(),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/oschwald/maxminddb-golang"
+	"net/netip"
+)
+
+type mmdbNames struct {
+	Names map[string]string `maxminddb:"names"`
+}
+
+// 兼容GeoLite2/GeoIP2 City 及 ISP/ASN 库的字段
+type mmdbRecord struct {
+	Country      mmdbNames   `maxminddb:"country"`
+	Subdivisions []mmdbNames `maxminddb:"subdivisions"`
+	City         mmdbNames   `maxminddb:"city"`
+	Isp          string      `maxminddb:"isp"`
+	AsOrg        string      `maxminddb:"autonomous_system_organization"`
+}
+
+// MmdbIpLocator 基于MaxMind mmdb文件的离线ip库,支持ipv4和ipv6
+type MmdbIpLocator struct {
+	reader   *maxminddb.Reader
+	language string
+}
+
+func NewMmdbIpLocator(file string, language string) (*MmdbIpLocator, error) {
+	reader, err := maxminddb.Open(file)
+	if err != nil {
+		return nil, errors.System.AddMsgf("打开ip库文件失败:%s", file).AddDetail(err)
+	}
+	if language == "" {
+		language = "zh-CN"
+	}
+	return &MmdbIpLocator{reader: reader, language: language}, nil
+}
+
+func (m *MmdbIpLocator) Close() error {
+	return m.reader.Close()
+}
+
+func (m *MmdbIpLocator) Lookup(ctx context.Context, addr netip.Addr) (*IpLocation, error) {
+	var record mmdbRecord
+	_, ok, err := m.reader.LookupNetwork(addr.AsSlice(), &record)
+	if err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	ret := IpLocation{
+		Country: m.name(record.Country),
+		City:    m.name(record.City),
+		Isp:     record.Isp,
+	}
+	if len(record.Subdivisions) > 0 {
+		ret.Province = m.name(record.Subdivisions[0])
+	}
+	if ret.Isp == "" {
+		ret.Isp = record.AsOrg
+	}
+	return &ret, nil
+}
+
+func (m *MmdbIpLocator) name(n mmdbNames) string {
+	if v, ok := n.Names[m.language]; ok {
+		return v
+	}
+	return n.Names["en"]
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/binary"
+	"gitee.com/unitedrhino/share/errors"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ip2region xdb(v2)文件格式:
+// 256字节的头 + 256*256个8字节的向量索引(按ip前两段定位二级索引的起止位置) + 数据区 + 14字节一条的二级索引
+const (
+	xdbHeaderLength       = 256
+	xdbVectorIndexCols    = 256
+	xdbVectorIndexSize    = 8
+	xdbSegmentIndexSize   = 14
+	xdbVectorIndexLength  = xdbVectorIndexCols * xdbVectorIndexCols * xdbVectorIndexSize
+	xdbMinFileLength      = xdbHeaderLength + xdbVectorIndexLength
+	xdbRegionFieldEmpty   = "0"
+	xdbRegionFieldsLegacy = 5 //国家|区域|省份|城市|ISP
+)
+
+// XdbIpLocator 基于ip2region xdb文件的离线ip库,整个文件加载到内存,并发安全
+type XdbIpLocator struct {
+	content []byte
+}
+
+func NewXdbIpLocator(file string) (*XdbIpLocator, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.System.AddMsgf("读取ip库文件失败:%s", file).AddDetail(err)
+	}
+	return NewXdbIpLocatorWithBuffer(content)
+}
+
+func NewXdbIpLocatorWithBuffer(content []byte) (*XdbIpLocator, error) {
+	if len(content) < xdbMinFileLength {
+		return nil, errors.Parameter.AddMsg("ip2region xdb文件格式错误")
+	}
+	return &XdbIpLocator{content: content}, nil
+}
+
+func (x *XdbIpLocator) Lookup(ctx context.Context, addr netip.Addr) (*IpLocation, error) {
+	if !addr.Is4() { //xdb v2只有ipv4的数据
+		return nil, nil
+	}
+	region, err := x.search(binary.BigEndian.Uint32(addr.AsSlice()))
+	if err != nil || region == "" {
+		return nil, err
+	}
+	return parseXdbRegion(region), nil
+}
+
+func (x *XdbIpLocator) search(ip uint32) (string, error) {
+	il0, il1 := ip>>24&0xFF, ip>>16&0xFF
+	idx := xdbHeaderLength + int(il0*xdbVectorIndexCols*xdbVectorIndexSize+il1*xdbVectorIndexSize)
+	sPtr := int(binary.LittleEndian.Uint32(x.content[idx:]))
+	ePtr := int(binary.LittleEndian.Uint32(x.content[idx+4:]))
+	if sPtr == 0 || ePtr < sPtr || ePtr+xdbSegmentIndexSize > len(x.content) {
+		return "", nil
+	}
+	l, h := 0, (ePtr-sPtr)/xdbSegmentIndexSize
+	for l <= h {
+		m := (l + h) >> 1
+		p := sPtr + m*xdbSegmentIndexSize
+		buf := x.content[p : p+xdbSegmentIndexSize]
+		if ip < binary.LittleEndian.Uint32(buf) {
+			h = m - 1
+		} else if ip > binary.LittleEndian.Uint32(buf[4:]) {
+			l = m + 1
+		} else {
+			dataLen := int(binary.LittleEndian.Uint16(buf[8:]))
+			dataPtr := int(binary.LittleEndian.Uint32(buf[10:]))
+			if dataPtr+dataLen > len(x.content) {
+				return "", errors.System.AddMsg("ip2region xdb文件已损坏")
+			}
+			return string(x.content[dataPtr : dataPtr+dataLen]), nil
+		}
+	}
+	return "", nil
+}
+
+// 兼容 国家|区域|省份|城市|ISP 及 国家|省份|城市|ISP 两种格式,0表示空
+func parseXdbRegion(region string) *IpLocation {
+	fields := strings.Split(region, "|")
+	for i, v := range fields {
+		if v == xdbRegionFieldEmpty {
+			fields[i] = ""
+		}
+	}
+	if len(fields) >= xdbRegionFieldsLegacy {
+		fields = append(fields[:1], fields[2:]...)
+	}
+	for len(fields) < 4 {
+		fields = append(fields, "")
+	}
+	ret := IpLocation{
+		Country:  fields[0],
+		Province: fields[1],
+		City:     fields[2],
+		Isp:      fields[3],
+	}
+	if ret.Isp == IpPrivate || ret.City == IpPrivate {
+		ret.IsPrivate = true
+	}
+	return &ret
+}
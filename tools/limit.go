@@ -58,39 +58,79 @@ func (l Limit) CleanLimit(ctx context.Context, key string) error {
 	return err
 }
 
+// 计数加一并重置过期时间,保证并发请求时计数准确
+const limitIncrScript = `local count = redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return count`
+
 // 错误了之后限制这个操作
 func (l Limit) LimitIt(ctx context.Context, key string) error {
 	for i, v := range l.Conf {
 		cacheKey := l.genCountKey(i, key)
-		ret, err := l.store.GetCtx(ctx, cacheKey)
-		if ret == "" {
-			err = l.store.SetexCtx(ctx, cacheKey, "1", v.Timeout)
-			if err != nil {
-				logx.WithContext(ctx).Error(err)
-				return err
-			}
-			continue
-		}
-		//错误加一次
-		_, err = l.store.Incr(cacheKey)
-		if err != nil {
-			logx.WithContext(ctx).Error(err)
-		}
-		//重置key的过期时间
-		err = l.store.ExpireCtx(ctx, cacheKey, v.Timeout)
+		ret, err := l.store.EvalCtx(ctx, limitIncrScript, cacheKey, v.Timeout)
 		if err != nil {
 			logx.WithContext(ctx).Error(err)
+			return err
 		}
 		//如果达到封禁的次数,则添加封禁
-		if cast.ToInt(ret)+1 >= v.TriggerTime {
+		if cast.ToInt(ret) >= v.TriggerTime {
 			cacheKey := l.genForbiddenKey(key)
 			err = l.store.SetexCtx(ctx, cacheKey, cast.ToString(v.ForbiddenTime), v.ForbiddenTime)
 			if err != nil {
 				logx.WithContext(ctx).Error(err)
 			}
 		}
-		return nil
 	}
-
 	return nil
 }
+
+// 计数加一,第一次计数时设置过期时间,窗口内的计数不会被后续请求延长
+const limitTakeScript = `local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return count`
+
+// 计数存在时减一,过期后不再处理
+const limitReturnScript = `if redis.call('EXISTS', KEYS[1]) == 1 and tonumber(redis.call('GET', KEYS[1])) > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0`
+
+// Take 操作前先占用一次次数,返回false表示已被限制;计数及判断由一次INCR完成,并发请求也不会超过限制
+// 超过次数的请求会添加封禁,操作没有成功时可以调用Return归还
+func (l Limit) Take(ctx context.Context, key string) (bool, error) {
+	if l.CheckLimit(ctx, key) {
+		return false, nil
+	}
+	for i, v := range l.Conf {
+		ret, err := l.store.EvalCtx(ctx, limitTakeScript, l.genCountKey(i, key), v.Timeout)
+		if err != nil {
+			l.returnN(ctx, key, i)
+			return false, err
+		}
+		if cast.ToInt(ret) > v.TriggerTime {
+			l.returnN(ctx, key, i)
+			err = l.store.SetexCtx(ctx, l.genForbiddenKey(key), cast.ToString(v.ForbiddenTime), v.ForbiddenTime)
+			if err != nil {
+				logx.WithContext(ctx).Error(err)
+			}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Return 归还Take占用的次数
+func (l Limit) Return(ctx context.Context, key string) {
+	l.returnN(ctx, key, len(l.Conf))
+}
+
+func (l Limit) returnN(ctx context.Context, key string, n int) {
+	for i := range n {
+		_, err := l.store.EvalCtx(ctx, limitReturnScript, l.genCountKey(i, key))
+		if err != nil {
+			logx.WithContext(ctx).Error(err)
+		}
+	}
+}
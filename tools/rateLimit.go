@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"gitee.com/unitedrhino/share/caches"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/spf13/cast"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"sync/atomic"
+	"time"
+)
+
+// 滑动窗口:用有序集合记录窗口内每次请求的时间
+// KEYS[1] key ARGV[1] 当前毫秒 ARGV[2] 窗口毫秒 ARGV[3] 窗口内最大请求数 ARGV[4] 本次请求数 ARGV[5] 本次请求的唯一标识
+// 返回 {是否允许, 剩余次数, 需要等待的毫秒}
+const slidingWindowScript = `local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+if count + n <= limit then
+  for i = 1, n do
+    redis.call('ZADD', key, now, ARGV[5] .. ':' .. i)
+  end
+  redis.call('PEXPIRE', key, window)
+  return {1, limit - count - n, 0}
+end
+local retry = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+  retry = tonumber(oldest[2]) + window - now
+end
+return {0, limit - count, retry}`
+
+// 令牌桶:用hash记录剩余令牌数及上次更新时间
+// KEYS[1] key ARGV[1] 当前毫秒 ARGV[2] 每秒生成的令牌数 ARGV[3] 桶容量 ARGV[4] 本次需要的令牌数
+// 返回 {是否允许, 剩余令牌, 需要等待的毫秒}
+const tokenBucketScript = `local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local data = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= n then
+  tokens = tokens - n
+  allowed = 1
+else
+  retry = math.ceil((n - tokens) * 1000 / rate)
+end
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', key, math.ceil(capacity * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry}`
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int64         //剩余可用次数
+	RetryAfter time.Duration //被限流时需要等待的时间
+}
+
+// RateLimiter 通用限流器,有redis时使用lua脚本保证原子性,没有redis或redis出错时使用本地内存限流
+type RateLimiter struct {
+	Conf  conf.RateLimit
+	Scene string //使用场景,如 api 短信
+	store kv.Store
+	local *localRateLimiter
+	seq   atomic.Int64
+}
+
+func NewRateLimiter(c conf.RateLimit, scene string) (*RateLimiter, error) {
+	switch c.Algorithm {
+	case conf.RateLimitSlidingWindow, "":
+		c.Algorithm = conf.RateLimitSlidingWindow
+		if c.Window <= 0 || c.Limit <= 0 {
+			return nil, errors.Parameter.AddMsg("滑动窗口限流需要配置Window和Limit")
+		}
+	case conf.RateLimitTokenBucket:
+		if c.Rate <= 0 {
+			return nil, errors.Parameter.AddMsg("令牌桶限流需要配置Rate")
+		}
+		if c.Burst <= 0 {
+			c.Burst = int64(c.Rate)
+		}
+		if c.Burst <= 0 {
+			c.Burst = 1
+		}
+	default:
+		return nil, errors.Parameter.AddMsgf("不支持的限流算法:%v", c.Algorithm)
+	}
+	return &RateLimiter{
+		Conf:  c,
+		Scene: scene,
+		store: caches.GetStore(),
+		local: newLocalRateLimiter(c),
+	}, nil
+}
+
+func (l *RateLimiter) genKey(key string) string {
+	return fmt.Sprintf("limit:%s:%s:%s", l.Scene, l.Conf.Algorithm, key)
+}
+
+// Take 获取一次请求的许可,实现了ctxs.RateLimitChecker
+func (l *RateLimiter) Take(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error) {
+	ret, err := l.TakeN(ctx, key, 1)
+	if err != nil {
+		return false, 0, err
+	}
+	return ret.Allowed, ret.RetryAfter, nil
+}
+
+// TakeCtx 按配置的KeyBy从UserCtx中组合key获取许可
+func (l *RateLimiter) TakeCtx(ctx context.Context) (*RateLimitResult, error) {
+	return l.TakeN(ctx, ctxs.GetUserCtxNoNil(ctx).GenRateLimitKey(l.Conf.KeyBy...), 1)
+}
+
+// Check 获取一次许可,被限流时返回带重试时间的errors.TooManyRequests
+func (l *RateLimiter) Check(ctx context.Context, key string) error {
+	ret, err := l.TakeN(ctx, key, 1)
+	if err != nil {
+		return err
+	}
+	if !ret.Allowed {
+		return errors.TooManyRequests.AddDetailf("retry after %v", ret.RetryAfter)
+	}
+	return nil
+}
+
+func (l *RateLimiter) TakeN(ctx context.Context, key string, n int64) (*RateLimitResult, error) {
+	if n <= 0 {
+		return nil, errors.Parameter.AddMsg("请求数需要大于0")
+	}
+	now := time.Now()
+	if l.store == nil {
+		return l.local.take(l.genKey(key), now, n), nil
+	}
+	var (
+		resp any
+		err  error
+	)
+	switch l.Conf.Algorithm {
+	case conf.RateLimitTokenBucket:
+		resp, err = l.store.EvalCtx(ctx, tokenBucketScript, l.genKey(key),
+			now.UnixMilli(), l.Conf.Rate, l.Conf.Burst, n)
+	default:
+		resp, err = l.store.EvalCtx(ctx, slidingWindowScript, l.genKey(key),
+			now.UnixMilli(), int64(l.Conf.Window)*1000, l.Conf.Limit, n,
+			fmt.Sprintf("%d-%d", now.UnixNano(), l.seq.Add(1)))
+	}
+	if err != nil {
+		logx.WithContext(ctx).Errorf("RateLimiter.TakeN redis err,use local limiter. key:%v err:%v", key, err)
+		return l.local.take(l.genKey(key), now, n), nil
+	}
+	vals, ok := resp.([]any)
+	if !ok || len(vals) != 3 {
+		return nil, errors.System.AddDetailf("rate limit script return:%v", resp)
+	}
+	return &RateLimitResult{
+		Allowed:    cast.ToInt64(vals[0]) == 1,
+		Remaining:  cast.ToInt64(vals[1]),
+		RetryAfter: time.Duration(cast.ToInt64(vals[2])) * time.Millisecond,
+	}, nil
+}
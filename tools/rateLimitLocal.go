@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"gitee.com/unitedrhino/share/conf"
+	"github.com/maypok86/otter"
+	"github.com/zeromicro/go-zero/core/logx"
+	"math"
+	"sync"
+	"time"
+)
+
+// 本地内存限流,只对当前实例生效
+type localRateLimiter struct {
+	conf  conf.RateLimit
+	mutex sync.Mutex
+	cache otter.Cache[string, *localRateState]
+}
+
+type localRateState struct {
+	times  []time.Time //滑动窗口内的请求时间
+	tokens float64     //令牌桶剩余令牌
+	last   time.Time   //令牌桶上次更新时间
+}
+
+func newLocalRateLimiter(c conf.RateLimit) *localRateLimiter {
+	ttl := time.Duration(c.Window) * time.Second
+	if c.Algorithm == conf.RateLimitTokenBucket {
+		ttl = time.Duration(float64(c.Burst)/c.Rate*float64(time.Second)) + time.Second
+	}
+	cache, err := otter.MustBuilder[string, *localRateState](10_000).
+		Cost(func(key string, value *localRateState) uint32 {
+			return 1
+		}).
+		WithTTL(ttl).
+		Build()
+	logx.Must(err)
+	return &localRateLimiter{conf: c, cache: cache}
+}
+
+func (l *localRateLimiter) take(key string, now time.Time, n int64) *RateLimitResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	state, ok := l.cache.Get(key)
+	if !ok {
+		state = &localRateState{tokens: float64(l.conf.Burst), last: now}
+	}
+	var ret *RateLimitResult
+	if l.conf.Algorithm == conf.RateLimitTokenBucket {
+		ret = l.tokenBucket(state, now, n)
+	} else {
+		ret = l.slidingWindow(state, now, n)
+	}
+	l.cache.Set(key, state)
+	return ret
+}
+
+func (l *localRateLimiter) slidingWindow(state *localRateState, now time.Time, n int64) *RateLimitResult {
+	window := time.Duration(l.conf.Window) * time.Second
+	var i int
+	for i < len(state.times) && !state.times[i].After(now.Add(-window)) {
+		i++
+	}
+	state.times = state.times[i:]
+	count := int64(len(state.times))
+	if count+n <= l.conf.Limit {
+		for j := int64(0); j < n; j++ {
+			state.times = append(state.times, now)
+		}
+		return &RateLimitResult{Allowed: true, Remaining: l.conf.Limit - count - n}
+	}
+	retry := window
+	if len(state.times) > 0 {
+		retry = state.times[0].Add(window).Sub(now)
+	}
+	return &RateLimitResult{Remaining: l.conf.Limit - count, RetryAfter: retry}
+}
+
+func (l *localRateLimiter) tokenBucket(state *localRateState, now time.Time, n int64) *RateLimitResult {
+	if elapsed := now.Sub(state.last); elapsed > 0 {
+		state.tokens = math.Min(float64(l.conf.Burst), state.tokens+elapsed.Seconds()*l.conf.Rate)
+	}
+	state.last = now
+	if state.tokens >= float64(n) {
+		state.tokens -= float64(n)
+		return &RateLimitResult{Allowed: true, Remaining: int64(state.tokens)}
+	}
+	retry := time.Duration(math.Ceil((float64(n) - state.tokens) / l.conf.Rate * float64(time.Second)))
+	return &RateLimitResult{Remaining: int64(state.tokens), RetryAfter: retry}
+}
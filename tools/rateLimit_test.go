@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"context"
+	"gitee.com/unitedrhino/share/conf"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"testing"
+	"time"
+)
+
+func newTestRateLimiters(t *testing.T, c conf.RateLimit) map[string]*RateLimiter {
+	mr := miniredis.RunT(t)
+	local, err := NewRateLimiter(c, "test")
+	assert.NoError(t, err)
+	remote, err := NewRateLimiter(c, "test")
+	assert.NoError(t, err)
+	remote.store = kv.NewStore(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	return map[string]*RateLimiter{"local": local, "redis": remote}
+}
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	for name, l := range newTestRateLimiters(t, conf.RateLimit{Window: 60, Limit: 3}) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				ret, err := l.TakeN(ctx, "user:1", 1)
+				assert.NoError(t, err)
+				assert.True(t, ret.Allowed)
+				assert.Equal(t, int64(2-i), ret.Remaining)
+			}
+			allowed, retry, err := l.Take(ctx, "user:1")
+			assert.NoError(t, err)
+			assert.False(t, allowed)
+			assert.True(t, retry > 0 && retry <= time.Minute, retry)
+			allowed, _, err = l.Take(ctx, "user:2")
+			assert.NoError(t, err)
+			assert.True(t, allowed)
+		})
+	}
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	for name, l := range newTestRateLimiters(t, conf.RateLimit{Algorithm: conf.RateLimitTokenBucket, Rate: 1, Burst: 2}) {
+		t.Run(name, func(t *testing.T) {
+			ret, err := l.TakeN(ctx, "ip:127.0.0.1", 2)
+			assert.NoError(t, err)
+			assert.True(t, ret.Allowed)
+			ret, err = l.TakeN(ctx, "ip:127.0.0.1", 1)
+			assert.NoError(t, err)
+			assert.False(t, ret.Allowed)
+			assert.True(t, ret.RetryAfter > 0 && ret.RetryAfter <= time.Second, ret.RetryAfter)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package users
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK RFC7517 的公钥,只导出签名用的非对称密钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   //RSA
+	E   string `json:"e,omitempty"`   //RSA
+	Crv string `json:"crv,omitempty"` //EC及OKP
+	X   string `json:"x,omitempty"`   //EC及OKP
+	Y   string `json:"y,omitempty"`   //EC
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// JWKS 生成公钥文档,提供给其他服务及网关验证token,HS256的密钥不会导出
+func (r *KeyRing) JWKS() *JWKS {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	ret := JWKS{Keys: []JWK{}}
+	for _, k := range r.keys {
+		jwk := JWK{Kid: k.Kid, Use: "sig", Alg: k.Alg}
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty, jwk.N, jwk.E = "RSA", b64.EncodeToString(pub.N.Bytes()), b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			ep, err := pub.ECDH()
+			if err != nil {
+				continue
+			}
+			data := ep.Bytes() //0x04 || X || Y
+			size := (len(data) - 1) / 2
+			jwk.Kty, jwk.Crv, jwk.X, jwk.Y = "EC", "P-256", b64.EncodeToString(data[1:1+size]), b64.EncodeToString(data[1+size:])
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", b64.EncodeToString(pub)
+		default:
+			continue
+		}
+		ret.Keys = append(ret.Keys, jwk)
+	}
+	return &ret
+}
+
+// NewKeyRingByJWKS 根据公钥文档创建只用于验证的KeyRing,不支持的密钥类型会被忽略
+func NewKeyRingByJWKS(data []byte) (*KeyRing, error) {
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, errors.Parameter.AddDetail(err)
+	}
+	var keys []*Key
+	for _, jwk := range jwks.Keys {
+		k, err := jwk.toKey()
+		if err != nil {
+			return nil, errors.Parameter.AddDetailf("jwk %s err:%v", jwk.Kid, err)
+		}
+		if k != nil {
+			keys = append(keys, k)
+		}
+	}
+	return NewKeyRing(keys...), nil
+}
+
+func (j JWK) toKey() (*Key, error) {
+	k := Key{Kid: j.Kid}
+	switch {
+	case j.Kty == "RSA":
+		n, err := b64.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		k.Alg, k.method = conf.JwtRS256, jwt.SigningMethodRS256
+		k.verify = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, err := b64.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64.DecodeString(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		//检查点是否在曲线上
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		k.Alg, k.method = conf.JwtES256, jwt.SigningMethodES256
+		k.verify = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := b64.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.Parameter.AddDetail("ed25519 public key size")
+		}
+		k.Alg, k.method = conf.JwtEdDSA, jwt.SigningMethodEdDSA
+		k.verify = ed25519.PublicKey(x)
+	default:
+		return nil, nil
+	}
+	if j.Alg != "" && j.Alg != k.Alg {
+		return nil, errors.Parameter.AddDetailf("alg %s not match kty %s", j.Alg, j.Kty)
+	}
+	if k.Kid == "" {
+		k.Kid = k.thumbprint()
+	}
+	return &k, nil
+}
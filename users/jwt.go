@@ -11,8 +11,8 @@ func CreateToken(secretKey string, claims jwt.Claims) (string, error) {
 	return token.SignedString([]byte(secretKey))
 }
 
-func ParseTokenWithFunc(claim jwt.Claims, tokenString string, f jwt.Keyfunc) error {
-	token, err := jwt.ParseWithClaims(tokenString, claim, f)
+func ParseTokenWithFunc(claim jwt.Claims, tokenString string, f jwt.Keyfunc, opts ...jwt.ParserOption) error {
+	token, err := jwt.ParseWithClaims(tokenString, claim, f, opts...)
 	if err != nil {
 		switch {
 		case errors.Is(err, jwt.ErrTokenExpired):
@@ -26,6 +26,10 @@ func ParseTokenWithFunc(claim jwt.Claims, tokenString string, f jwt.Keyfunc) err
 		}
 	}
 	if token != nil {
+		//refresh token和access token使用相同的密钥签名,只能用RefreshClaims解析
+		if _, ok := claim.(*RefreshClaims); !ok && token.Header["typ"] == refreshTokenTyp {
+			return errors.TokenInvalid.WithMsg("登录失效,请退出重新登录")
+		}
 		if token.Valid {
 			return nil
 		}
@@ -36,6 +40,16 @@ func ParseTokenWithFunc(claim jwt.Claims, tokenString string, f jwt.Keyfunc) err
 	}
 }
 
+// CreateTokenWithKeyRing 使用KeyRing的当前密钥创建token
+func CreateTokenWithKeyRing(ring *KeyRing, claims jwt.Claims) (string, error) {
+	return ring.Sign(claims)
+}
+
+// ParseTokenWithKeyRing 根据token的kid选择KeyRing中的密钥验证
+func ParseTokenWithKeyRing(claim jwt.Claims, tokenString string, ring *KeyRing) error {
+	return ring.Parse(claim, tokenString)
+}
+
 // 解析 token
 func ParseToken(claim jwt.Claims, tokenString string, secretKey string) error {
 	return ParseTokenWithFunc(claim, tokenString, func(token *jwt.Token) (interface{}, error) {
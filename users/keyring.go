@@ -0,0 +1,281 @@
+package users
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"sync"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key jwt的签名及验证密钥,只有公钥时只能用于验证
+type Key struct {
+	Kid    string
+	Alg    conf.JwtAlg
+	method jwt.SigningMethod
+	sign   any //HS256为[]byte,其他为私钥
+	verify any //HS256为[]byte,其他为公钥
+}
+
+func NewKey(c conf.JwtKey) (*Key, error) {
+	k := Key{Kid: c.Kid, Alg: c.Alg}
+	var err error
+	switch c.Alg {
+	case conf.JwtHS256, "":
+		if c.Secret == "" {
+			return nil, errors.Parameter.AddDetail("jwt HS256 key need secret")
+		}
+		k.Alg, k.method = conf.JwtHS256, jwt.SigningMethodHS256
+		k.sign, k.verify = []byte(c.Secret), []byte(c.Secret)
+	case conf.JwtRS256:
+		k.method = jwt.SigningMethodRS256
+		if c.PrivateKey != "" {
+			var pri *rsa.PrivateKey
+			if pri, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(c.PrivateKey)); err == nil {
+				k.sign, k.verify = pri, &pri.PublicKey
+			}
+		} else {
+			k.verify, err = jwt.ParseRSAPublicKeyFromPEM([]byte(c.PublicKey))
+		}
+	case conf.JwtES256:
+		k.method = jwt.SigningMethodES256
+		var pub *ecdsa.PublicKey
+		if c.PrivateKey != "" {
+			var pri *ecdsa.PrivateKey
+			if pri, err = jwt.ParseECPrivateKeyFromPEM([]byte(c.PrivateKey)); err == nil {
+				k.sign, pub = pri, &pri.PublicKey
+			}
+		} else {
+			pub, err = jwt.ParseECPublicKeyFromPEM([]byte(c.PublicKey))
+		}
+		if err == nil && pub.Curve != elliptic.P256() {
+			err = errors.Parameter.AddDetail("ES256 need P-256 curve")
+		}
+		k.verify = pub
+	case conf.JwtEdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		if c.PrivateKey != "" {
+			var pri crypto.PrivateKey
+			if pri, err = jwt.ParseEdPrivateKeyFromPEM([]byte(c.PrivateKey)); err == nil {
+				k.sign, k.verify = pri, pri.(ed25519.PrivateKey).Public()
+			}
+		} else {
+			k.verify, err = jwt.ParseEdPublicKeyFromPEM([]byte(c.PublicKey))
+		}
+	default:
+		return nil, errors.Parameter.AddDetailf("jwt alg %s not support", c.Alg)
+	}
+	if err != nil {
+		return nil, errors.Parameter.AddDetailf("jwt key %s alg %s err:%v", c.Kid, c.Alg, err)
+	}
+	if k.Kid == "" {
+		k.Kid = k.thumbprint()
+	}
+	return &k, nil
+}
+
+// GenerateKey 生成新的密钥,用于密钥轮换
+func GenerateKey(alg conf.JwtAlg, kid string) (*Key, error) {
+	k := Key{Kid: kid, Alg: alg}
+	switch alg {
+	case conf.JwtHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, errors.System.AddDetail(err)
+		}
+		k.method, k.sign, k.verify = jwt.SigningMethodHS256, []byte(hex.EncodeToString(secret)), []byte(hex.EncodeToString(secret))
+	case conf.JwtRS256:
+		pri, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, errors.System.AddDetail(err)
+		}
+		k.method, k.sign, k.verify = jwt.SigningMethodRS256, pri, &pri.PublicKey
+	case conf.JwtES256:
+		pri, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, errors.System.AddDetail(err)
+		}
+		k.method, k.sign, k.verify = jwt.SigningMethodES256, pri, &pri.PublicKey
+	case conf.JwtEdDSA:
+		pub, pri, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.System.AddDetail(err)
+		}
+		k.method, k.sign, k.verify = jwt.SigningMethodEdDSA, pri, pub
+	default:
+		return nil, errors.Parameter.AddDetailf("jwt alg %s not support", alg)
+	}
+	if k.Kid == "" {
+		k.Kid = k.thumbprint()
+	}
+	return &k, nil
+}
+
+// CanSign 是否有私钥或密钥可以签名
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// ToConf 导出为配置,私钥以PKCS8 PEM格式导出,用于保存生成的密钥
+func (k *Key) ToConf() (conf.JwtKey, error) {
+	c := conf.JwtKey{Kid: k.Kid, Alg: k.Alg}
+	if k.Alg == conf.JwtHS256 {
+		c.Secret = string(k.verify.([]byte))
+		return c, nil
+	}
+	pub, err := x509.MarshalPKIXPublicKey(k.verify)
+	if err != nil {
+		return c, errors.System.AddDetail(err)
+	}
+	c.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	if k.sign != nil {
+		pri, err := x509.MarshalPKCS8PrivateKey(k.sign)
+		if err != nil {
+			return c, errors.System.AddDetail(err)
+		}
+		c.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pri}))
+	}
+	return c, nil
+}
+
+func (k *Key) thumbprint() string {
+	var data []byte
+	if k.Alg == conf.JwtHS256 {
+		data = k.verify.([]byte)
+	} else {
+		data, _ = x509.MarshalPKIXPublicKey(k.verify)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyRing 第一个密钥用于签名,其余的用于验证轮换前签发的token
+type KeyRing struct {
+	mutex sync.RWMutex
+	keys  []*Key
+}
+
+func NewKeyRing(keys ...*Key) *KeyRing {
+	return &KeyRing{keys: keys}
+}
+
+func NewKeyRingByConf(c conf.JwtConf) (*KeyRing, error) {
+	var keys []*Key
+	for _, kc := range c.Keys {
+		k, err := NewKey(kc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return NewKeyRing(keys...), nil
+}
+
+// Current 当前用于签名的密钥
+func (r *KeyRing) Current() *Key {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if len(r.keys) == 0 {
+		return nil
+	}
+	return r.keys[0]
+}
+
+// Key 根据kid获取密钥
+func (r *KeyRing) Key(kid string) *Key {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, k := range r.keys {
+		if k.Kid == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// Rotate 使用新的密钥签名,保留最近的keep个旧密钥用于验证
+func (r *KeyRing) Rotate(k *Key, keep int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	keys := []*Key{k}
+	for _, old := range r.keys {
+		if len(keys) > keep {
+			break
+		}
+		if old.Kid != k.Kid {
+			keys = append(keys, old)
+		}
+	}
+	r.keys = keys
+}
+
+// Sign 使用当前密钥签名,header中带上kid
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	return r.sign(claims, "")
+}
+
+// typ不为空时替换header中默认的JWT
+func (r *KeyRing) sign(claims jwt.Claims, typ string) (string, error) {
+	k := r.Current()
+	if k == nil || !k.CanSign() {
+		return "", errors.System.AddDetail("jwt key ring has no sign key")
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.Kid
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	return token.SignedString(k.sign)
+}
+
+// Keyfunc 根据token的kid选择验证密钥,没有kid的旧token使用所有同算法的密钥尝试
+func (r *KeyRing) Keyfunc(token *jwt.Token) (any, error) {
+	alg := token.Method.Alg()
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		k := r.Key(kid)
+		if k == nil {
+			return nil, errors.TokenInvalid.AddDetailf("jwt kid %s not found", kid)
+		}
+		if k.method.Alg() != alg { //防止用公钥作为HS256密钥伪造token
+			return nil, errors.TokenInvalid.AddDetailf("jwt kid %s alg %s not match %s", kid, k.Alg, alg)
+		}
+		return k.verify, nil
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var set jwt.VerificationKeySet
+	for _, k := range r.keys {
+		if k.method.Alg() == alg {
+			set.Keys = append(set.Keys, k.verify)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.TokenInvalid.AddDetailf("jwt alg %s not found", alg)
+	}
+	return set, nil
+}
+
+// Parse 解析并验证token
+func (r *KeyRing) Parse(claim jwt.Claims, tokenString string) error {
+	return ParseTokenWithFunc(claim, tokenString, r.Keyfunc, jwt.WithValidMethods(r.algs()))
+}
+
+func (r *KeyRing) algs() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var algs []string
+	for _, k := range r.keys {
+		algs = append(algs, k.method.Alg())
+	}
+	return algs
+}
@@ -0,0 +1,114 @@
+package users
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRingAlgs(t *testing.T) {
+	for _, alg := range []conf.JwtAlg{conf.JwtHS256, conf.JwtRS256, conf.JwtES256, conf.JwtEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			k, err := GenerateKey(alg, "")
+			require.NoError(t, err)
+			//导出为配置后重新加载
+			c, err := k.ToConf()
+			require.NoError(t, err)
+			k2, err := NewKey(c)
+			require.NoError(t, err)
+			assert.Equal(t, k.Kid, k2.Kid)
+			ring := NewKeyRing(k2)
+			token, err := GetLoginJwtTokenWithKeyRing(ring, time.Now(), 60, 1, "core", "t1")
+			require.NoError(t, err)
+			var claims LoginClaims
+			require.NoError(t, ParseTokenWithKeyRing(&claims, token, ring))
+			assert.Equal(t, int64(1), claims.UserID)
+			assert.Equal(t, "t1", claims.ID)
+
+			if alg == conf.JwtHS256 {
+				assert.Empty(t, ring.JWKS().Keys, "共享密钥不能导出")
+				return
+			}
+			//其他服务只用公钥文档验证
+			data, err := json.Marshal(ring.JWKS())
+			require.NoError(t, err)
+			verifier, err := NewKeyRingByJWKS(data)
+			require.NoError(t, err)
+			claims = LoginClaims{}
+			require.NoError(t, verifier.Parse(&claims, token))
+			assert.Equal(t, "core", claims.AppCode)
+			_, err = verifier.Sign(claims)
+			assert.Error(t, err, "只有公钥不能签名")
+		})
+	}
+}
+
+func TestKeyRingRotate(t *testing.T) {
+	k1, err := GenerateKey(conf.JwtES256, "k1")
+	require.NoError(t, err)
+	ring := NewKeyRing(k1)
+	old, err := CreateTokenWithKeyRing(ring, jwt.RegisteredClaims{Subject: "old"})
+	require.NoError(t, err)
+
+	k2, err := GenerateKey(conf.JwtRS256, "k2")
+	require.NoError(t, err)
+	ring.Rotate(k2, 1)
+	assert.Equal(t, "k2", ring.Current().Kid)
+	var claims jwt.RegisteredClaims
+	require.NoError(t, ring.Parse(&claims, old), "轮换后旧token仍然可以验证")
+
+	token, err := GetLoginJwtTokenWithKeyRing(NewKeyRing(k1), time.Now(), 60, 1, "core", "t1")
+	require.NoError(t, err)
+	refreshed, err := RefreshLoginTokenWithKeyRing(token, ring, 60)
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(refreshed, &LoginClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "k2", parsed.Header["kid"], "刷新后使用新密钥")
+
+	k3, err := GenerateKey(conf.JwtEdDSA, "k3")
+	require.NoError(t, err)
+	ring.Rotate(k3, 1)
+	assert.Nil(t, ring.Key("k1"))
+	err = ring.Parse(&claims, old)
+	assert.True(t, errors.Cmp(err, errors.TokenInvalid))
+}
+
+func TestKeyRingAlgConfusion(t *testing.T) {
+	k, err := GenerateKey(conf.JwtRS256, "rs")
+	require.NoError(t, err)
+	ring := NewKeyRing(k)
+	c, err := k.ToConf()
+	require.NoError(t, err)
+	//用公钥作为HS256的密钥伪造token
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "admin"})
+	forged.Header["kid"] = "rs"
+	token, err := forged.SignedString([]byte(c.PublicKey))
+	require.NoError(t, err)
+	var claims jwt.RegisteredClaims
+	assert.Error(t, ring.Parse(&claims, token))
+	delete(forged.Header, "kid")
+	token, err = forged.SignedString([]byte(c.PublicKey))
+	require.NoError(t, err)
+	assert.Error(t, ring.Parse(&claims, token))
+
+	//没有kid的旧HS256 token
+	legacy, err := GetLoginJwtToken("secret", time.Now(), 60, 1, "core", "t1")
+	require.NoError(t, err)
+	hs, err := NewKey(conf.JwtKey{Alg: conf.JwtHS256, Secret: "secret"})
+	require.NoError(t, err)
+	ring.Rotate(hs, 1)
+	require.NoError(t, ring.Parse(&LoginClaims{}, legacy))
+
+	_, err = NewKey(conf.JwtKey{Alg: conf.JwtES256, PublicKey: "bad"})
+	assert.Error(t, err)
+	_, err = NewKeyRingByJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AA","y":"AA"}]}`))
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(c.PublicKey, "-----BEGIN PUBLIC KEY-----"))
+}
@@ -11,6 +11,8 @@ type LoginClaims struct {
 	UserID   int64 `json:",string"`
 	AppCode  string
 	DeviceID string `json:""`
+	//SessionStore签发的token才有,没有的token不做会话吊销检查
+	SessionID string `json:",omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -25,22 +27,29 @@ type UserInfo struct {
 	IsAllData   int64
 }
 
-func GetLoginJwtToken(secretKey string, t time.Time, seconds int64, userID int64, appCode string, id string) (string, error) {
-	IssuedAt := jwt.NewNumericDate(t)
-	claims := LoginClaims{
+func newLoginClaims(t time.Time, seconds int64, userID int64, appCode string, id string) LoginClaims {
+	return LoginClaims{
 		UserID:  userID,
 		AppCode: appCode,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(t.Add(time.Duration(seconds) * time.Second)),
-			IssuedAt:  IssuedAt,
+			IssuedAt:  jwt.NewNumericDate(t),
 			ID:        id,
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+}
+
+func GetLoginJwtToken(secretKey string, t time.Time, seconds int64, userID int64, appCode string, id string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newLoginClaims(t, seconds, userID, appCode, id))
 	return token.SignedString([]byte(secretKey))
 }
 
-// 更新token
+// GetLoginJwtTokenWithKeyRing 使用KeyRing的当前密钥签发登录token
+func GetLoginJwtTokenWithKeyRing(ring *KeyRing, t time.Time, seconds int64, userID int64, appCode string, id string) (string, error) {
+	return ring.Sign(newLoginClaims(t, seconds, userID, appCode, id))
+}
+
+// 更新token,不校验会话,需要吊销及refresh token轮换时使用SessionStore
 func RefreshLoginToken(tokenString string, secretKey string, AccessExpire int64) (string, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &LoginClaims{}, func(token *jwt.Token) (any, error) {
 		return []byte(secretKey), nil
@@ -54,3 +63,13 @@ func RefreshLoginToken(tokenString string, secretKey string, AccessExpire int64)
 	}
 	return "", errors.TokenInvalid
 }
+
+// RefreshLoginTokenWithKeyRing 更新token,使用当前密钥重新签名,轮换前签发的token刷新后改用新密钥
+func RefreshLoginTokenWithKeyRing(tokenString string, ring *KeyRing, AccessExpire int64) (string, error) {
+	var claims LoginClaims
+	if err := ring.Parse(&claims, tokenString); err != nil {
+		return "", err
+	}
+	claims.RegisteredClaims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Duration(AccessExpire) * time.Second))
+	return ring.Sign(claims)
+}
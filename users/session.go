@@ -0,0 +1,342 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"gitee.com/unitedrhino/share/caches"
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/spf13/cast"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+)
+
+// Session 登录会话,一次登录对应一个会话,刷新token不会改变会话
+type Session struct {
+	ID          string `json:"id"` //会话ID,也是access token的jti
+	UserID      int64  `json:"userID,string"`
+	AppCode     string `json:"appCode"`
+	DeviceID    string `json:"deviceID"`
+	IP          string `json:"ip"`
+	Os          string `json:"os"`
+	CreatedTime int64  `json:"createdTime"` //登录时间,unix毫秒
+	RefreshTime int64  `json:"refreshTime"` //最后刷新时间,unix毫秒
+}
+
+const RefreshTokenType = "refresh"
+
+// refresh token的header中的typ,解析access token时拒绝该类型的token
+const refreshTokenTyp = "refresh+jwt"
+
+// RefreshClaims refresh token,ID为refresh token的jti,每次刷新都会变化
+type RefreshClaims struct {
+	UserID    int64 `json:",string"`
+	SessionID string
+	TokenType string
+	jwt.RegisteredClaims
+}
+
+type TokenPair struct {
+	SessionID     string `json:"sessionID"`
+	AccessToken   string `json:"accessToken"`
+	AccessExpire  int64  `json:"accessExpire"` //过期时间,unix秒
+	RefreshToken  string `json:"refreshToken"`
+	RefreshExpire int64  `json:"refreshExpire"`
+}
+
+type RevokeReason = string
+
+const (
+	RevokeReasonLogout RevokeReason = "logout" //主动退出或被管理员下线
+	RevokeReasonKicked RevokeReason = "kicked" //同设备重新登录或超出最大会话数被顶出
+	RevokeReasonReuse  RevokeReason = "reuse"  //refresh token被重复使用,可能已泄露
+)
+
+// 刷新时校验refresh token的jti并替换为新的
+// KEYS[1] 会话key ARGV[1] 旧jti ARGV[2] 新jti ARGV[3] 过期毫秒
+// 返回 -1:会话不存在 0:jti不一致(重复使用) 1:成功
+const refreshScript = `if redis.call('EXISTS', KEYS[1]) == 0 then
+  return -1
+end
+if redis.call('HGET', KEYS[1], 'refresh') ~= ARGV[1] then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'refresh', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1`
+
+// SessionStore 记录每个用户的活跃会话,支持吊销及refresh token轮换,实现了ctxs.SessionChecker
+type SessionStore struct {
+	c     conf.SessionConf
+	ring  *KeyRing
+	store kv.Store
+}
+
+func NewSessionStore(c conf.SessionConf, ring *KeyRing) *SessionStore {
+	if c.AccessExpire <= 0 {
+		c.AccessExpire = 7200
+	}
+	if c.RefreshExpire <= 0 {
+		c.RefreshExpire = 30 * 24 * 3600
+	}
+	return &SessionStore{c: c, ring: ring, store: caches.GetStore()}
+}
+
+func genSessionKey(id string) string {
+	return "session:info:" + id
+}
+
+func genUserSessionKey(userID int64) string {
+	return fmt.Sprintf("session:user:%d", userID)
+}
+
+func genRevokedKey(id string) string {
+	return "session:revoked:" + id
+}
+
+// Create 登录时创建会话并签发token,同一设备的旧会话及超出最大会话数的最早的会话会被顶出
+func (s *SessionStore) Create(ctx context.Context, in *Session) (*TokenPair, error) {
+	now := time.Now()
+	se := *in
+	se.ID, se.CreatedTime, se.RefreshTime = uuid.NewString(), now.UnixMilli(), now.UnixMilli()
+	sessions, err := s.List(ctx, se.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var same []*Session
+	for _, v := range sessions {
+		if v.AppCode != se.AppCode {
+			continue
+		}
+		if se.DeviceID != "" && v.DeviceID == se.DeviceID {
+			if err := s.revoke(ctx, v.UserID, v.ID, RevokeReasonKicked); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		same = append(same, v)
+	}
+	if limit := s.maxSessions(se.AppCode); limit > 0 && len(same) >= limit {
+		for _, v := range same[:len(same)-limit+1] { //List已按登录时间排序
+			if err := s.revoke(ctx, v.UserID, v.ID, RevokeReasonKicked); err != nil {
+				return nil, err
+			}
+		}
+	}
+	refreshID := uuid.NewString()
+	info, _ := json.Marshal(se)
+	key := genSessionKey(se.ID)
+	if err := s.store.HmsetCtx(ctx, key, map[string]string{"info": string(info), "refresh": refreshID}); err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	if err := s.store.ExpireCtx(ctx, key, int(s.c.RefreshExpire)); err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	userKey := genUserSessionKey(se.UserID)
+	if err := s.store.HsetCtx(ctx, userKey, se.ID, se.AppCode); err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	if err := s.store.ExpireCtx(ctx, userKey, int(s.c.RefreshExpire)); err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	return s.sign(&se, refreshID, now)
+}
+
+// Refresh 使用refresh token换取新的token对,旧的refresh token失效;
+// 已经使用过的refresh token再次使用时认为已泄露,吊销整个会话
+func (s *SessionStore) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	var claims RefreshClaims
+	if err := s.ring.Parse(&claims, refreshToken); err != nil {
+		return nil, err
+	}
+	if claims.TokenType != RefreshTokenType || claims.SessionID == "" {
+		return nil, errors.TokenInvalid.WithMsg("登录失效,请退出重新登录")
+	}
+	key := genSessionKey(claims.SessionID)
+	refreshID := uuid.NewString()
+	ret, err := s.store.EvalCtx(ctx, refreshScript, key, claims.ID, refreshID, s.c.RefreshExpire*1000)
+	if err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	switch cast.ToInt64(ret) {
+	case -1:
+		return nil, s.revokedErr(ctx, claims.SessionID)
+	case 0:
+		logx.WithContext(ctx).Errorf("SessionStore.Refresh refresh token reused userID:%v sessionID:%v",
+			claims.UserID, claims.SessionID)
+		if err := s.revoke(ctx, claims.UserID, claims.SessionID, RevokeReasonReuse); err != nil {
+			return nil, err
+		}
+		return nil, errors.TokenInvalid.WithMsg("登录失效,请退出重新登录").AddDetail("refresh token reused")
+	}
+	info, err := s.store.HgetCtx(ctx, key, "info")
+	if err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	var se Session
+	if err := json.Unmarshal([]byte(info), &se); err != nil {
+		return nil, errors.System.AddDetail(err)
+	}
+	now := time.Now()
+	se.RefreshTime = now.UnixMilli()
+	info2, _ := json.Marshal(se)
+	if err := s.store.HsetCtx(ctx, key, "info", string(info2)); err != nil {
+		logx.WithContext(ctx).Errorf("SessionStore.Refresh update info sessionID:%v err:%v", se.ID, err)
+	}
+	if err := s.store.ExpireCtx(ctx, genUserSessionKey(se.UserID), int(s.c.RefreshExpire)); err != nil {
+		logx.WithContext(ctx).Errorf("SessionStore.Refresh expire userID:%v err:%v", se.UserID, err)
+	}
+	return s.sign(&se, refreshID, now)
+}
+
+func (s *SessionStore) sign(se *Session, refreshID string, now time.Time) (*TokenPair, error) {
+	ret := TokenPair{
+		SessionID:     se.ID,
+		AccessExpire:  now.Unix() + s.c.AccessExpire,
+		RefreshExpire: now.Unix() + s.c.RefreshExpire,
+	}
+	access := newLoginClaims(now, s.c.AccessExpire, se.UserID, se.AppCode, se.ID)
+	access.DeviceID, access.SessionID = se.DeviceID, se.ID
+	var err error
+	ret.AccessToken, err = s.ring.Sign(access)
+	if err != nil {
+		return nil, err
+	}
+	ret.RefreshToken, err = s.ring.sign(RefreshClaims{
+		UserID:    se.UserID,
+		SessionID: se.ID,
+		TokenType: RefreshTokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Unix(ret.RefreshExpire, 0)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        refreshID,
+		},
+	}, refreshTokenTyp)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Check 检查会话是否有效,被吊销时返回对应的错误
+func (s *SessionStore) Check(ctx context.Context, sessionID string) error {
+	ok, err := s.store.ExistsCtx(ctx, genSessionKey(sessionID))
+	if err != nil {
+		return errors.Database.AddDetail(err)
+	}
+	if !ok {
+		return s.revokedErr(ctx, sessionID)
+	}
+	return nil
+}
+
+// CheckToken 检查access token的会话是否被吊销,用于http中间件及websocket连接;
+// 只做吊销检查,token的签名由鉴权负责校验,kv存储出错时不拦截
+func (s *SessionStore) CheckToken(ctx context.Context, token string) error {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return errors.TokenMalformed.WithMsg("登录失效,请退出重新登录")
+	}
+	if cast.ToString(claims["TokenType"]) == RefreshTokenType {
+		return errors.TokenInvalid.WithMsg("登录失效,请退出重新登录")
+	}
+	sessionID := cast.ToString(claims["SessionID"])
+	if sessionID == "" { //不是SessionStore签发的旧token
+		return nil
+	}
+	err := s.Check(ctx, sessionID)
+	if errors.Cmp(err, errors.Database) {
+		logx.WithContext(ctx).Errorf("SessionStore.CheckToken sessionID:%v err:%v", sessionID, err)
+		return nil
+	}
+	return err
+}
+
+func (s *SessionStore) revokedErr(ctx context.Context, sessionID string) error {
+	reason, _ := s.store.GetCtx(ctx, genRevokedKey(sessionID))
+	if reason == RevokeReasonKicked {
+		return errors.AccountKickedOut
+	}
+	return errors.TokenInvalid.WithMsg("登录失效,请退出重新登录")
+}
+
+// List 获取用户的活跃会话,按登录时间排序
+func (s *SessionStore) List(ctx context.Context, userID int64) ([]*Session, error) {
+	userKey := genUserSessionKey(userID)
+	ids, err := s.store.HgetallCtx(ctx, userKey)
+	if err != nil {
+		return nil, errors.Database.AddDetail(err)
+	}
+	var ret []*Session
+	for id := range ids {
+		info, err := s.store.HgetCtx(ctx, genSessionKey(id), "info")
+		if err != nil || info == "" { //会话已过期
+			s.store.HdelCtx(ctx, userKey, id)
+			continue
+		}
+		var se Session
+		if err := json.Unmarshal([]byte(info), &se); err != nil {
+			continue
+		}
+		ret = append(ret, &se)
+	}
+	slices.SortFunc(ret, func(a, b *Session) int { return int(a.CreatedTime - b.CreatedTime) })
+	return ret, nil
+}
+
+// Revoke 吊销用户的一个会话,access token及refresh token都会失效
+func (s *SessionStore) Revoke(ctx context.Context, userID int64, sessionID string) error {
+	return s.revoke(ctx, userID, sessionID, RevokeReasonLogout)
+}
+
+// RevokeAll 吊销用户的所有会话
+func (s *SessionStore) RevokeAll(ctx context.Context, userID int64) error {
+	return s.RevokeOthers(ctx, userID, "")
+}
+
+// RevokeOthers 吊销用户除keepID外的所有会话,如修改密码后下线其他设备
+func (s *SessionStore) RevokeOthers(ctx context.Context, userID int64, keepID string) error {
+	ids, err := s.store.HgetallCtx(ctx, genUserSessionKey(userID))
+	if err != nil {
+		return errors.Database.AddDetail(err)
+	}
+	for id := range ids {
+		if id == keepID {
+			continue
+		}
+		if err := s.revoke(ctx, userID, id, RevokeReasonLogout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionStore) revoke(ctx context.Context, userID int64, sessionID string, reason RevokeReason) error {
+	//记录吊销原因,保留到access token过期
+	if err := s.store.SetexCtx(ctx, genRevokedKey(sessionID), reason, int(s.c.AccessExpire)); err != nil {
+		return errors.Database.AddDetail(err)
+	}
+	if _, err := s.store.DelCtx(ctx, genSessionKey(sessionID)); err != nil {
+		return errors.Database.AddDetail(err)
+	}
+	if _, err := s.store.HdelCtx(ctx, genUserSessionKey(userID), sessionID); err != nil {
+		return errors.Database.AddDetail(err)
+	}
+	logx.WithContext(ctx).Infof("SessionStore.revoke userID:%v sessionID:%v reason:%v", userID, sessionID, reason)
+	return nil
+}
+
+func (s *SessionStore) maxSessions(appCode string) int {
+	for _, v := range s.c.AppMaxSessions {
+		if v.AppCode == appCode {
+			return v.Max
+		}
+	}
+	return s.c.MaxSessions
+}
@@ -0,0 +1,100 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/conf"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/kv"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func newTestSessionStore(t *testing.T, c conf.SessionConf) *SessionStore {
+	mr := miniredis.RunT(t)
+	k, err := GenerateKey(conf.JwtES256, "k1")
+	require.NoError(t, err)
+	s := NewSessionStore(c, NewKeyRing(k))
+	s.store = kv.NewStore(cache.ClusterConf{{RedisConf: redis.RedisConf{Host: mr.Addr(), Type: redis.NodeType}, Weight: 100}})
+	return s
+}
+
+func TestSessionRefresh(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSessionStore(t, conf.SessionConf{})
+	tp, err := s.Create(ctx, &Session{UserID: 1, AppCode: "core", DeviceID: "d1"})
+	require.NoError(t, err)
+	require.NoError(t, s.CheckToken(ctx, tp.AccessToken))
+	var claims LoginClaims
+	require.NoError(t, s.ring.Parse(&claims, tp.AccessToken))
+	assert.Equal(t, tp.SessionID, claims.ID)
+	assert.Equal(t, "d1", claims.DeviceID)
+	assert.Equal(t, tp.SessionID, claims.SessionID)
+	assert.Error(t, s.CheckToken(ctx, tp.RefreshToken), "refresh token不能当access token使用")
+	var refreshAsAccess LoginClaims
+	assert.True(t, errors.Cmp(s.ring.Parse(&refreshAsAccess, tp.RefreshToken), errors.TokenInvalid), "没有会话检查的服务也不能把refresh token当access token使用")
+	_, err = RefreshLoginTokenWithKeyRing(tp.RefreshToken, s.ring, 60)
+	assert.Error(t, err)
+
+	tp2, err := s.Refresh(ctx, tp.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, tp.SessionID, tp2.SessionID)
+	_, err = s.Refresh(ctx, tp.AccessToken)
+	assert.True(t, errors.Cmp(err, errors.TokenInvalid))
+
+	//旧的refresh token重复使用,整个会话被吊销
+	_, err = s.Refresh(ctx, tp.RefreshToken)
+	assert.True(t, errors.Cmp(err, errors.TokenInvalid))
+	assert.True(t, errors.Cmp(s.CheckToken(ctx, tp2.AccessToken), errors.TokenInvalid))
+	_, err = s.Refresh(ctx, tp2.RefreshToken)
+	assert.Error(t, err)
+	ss, err := s.List(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, ss)
+}
+
+func TestSessionLimit(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSessionStore(t, conf.SessionConf{MaxSessions: 2, AppMaxSessions: []conf.SessionLimit{{AppCode: "app", Max: 1}}})
+	create := func(app, device string) *TokenPair {
+		time.Sleep(2 * time.Millisecond) //保证登录时间不同
+		tp, err := s.Create(ctx, &Session{UserID: 1, AppCode: app, DeviceID: device})
+		require.NoError(t, err)
+		return tp
+	}
+	a := create("core", "d1")
+	//同一设备重新登录,旧会话被顶出
+	b := create("core", "d1")
+	assert.True(t, errors.Cmp(s.CheckToken(ctx, a.AccessToken), errors.AccountKickedOut))
+	c := create("core", "d2")
+	d := create("core", "d3")
+	assert.True(t, errors.Cmp(s.Check(ctx, b.SessionID), errors.AccountKickedOut), "超出最大会话数踢掉最早的会话")
+	require.NoError(t, s.Check(ctx, c.SessionID))
+	require.NoError(t, s.Check(ctx, d.SessionID))
+	e := create("app", "d1")
+	f := create("app", "d2")
+	assert.Error(t, s.Check(ctx, e.SessionID))
+	require.NoError(t, s.Check(ctx, f.SessionID))
+
+	require.NoError(t, s.RevokeOthers(ctx, 1, d.SessionID))
+	ss, err := s.List(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, ss, 1)
+	assert.Equal(t, d.SessionID, ss[0].ID)
+	assert.True(t, errors.Cmp(s.Check(ctx, c.SessionID), errors.TokenInvalid))
+
+	require.NoError(t, s.RevokeAll(ctx, 1))
+	assert.Error(t, s.CheckToken(ctx, d.AccessToken))
+	//SessionStore之前签发的旧token有jti但没有会话,不受会话管理
+	legacy, err := GetLoginJwtTokenWithKeyRing(s.ring, time.Now(), 60, 1, "core", "t1")
+	require.NoError(t, err)
+	assert.NoError(t, s.CheckToken(ctx, legacy))
+	legacy, err = GetLoginJwtToken("secret", time.Now(), 60, 1, "core", d.SessionID)
+	require.NoError(t, err)
+	assert.NoError(t, s.CheckToken(ctx, legacy))
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// HttpRetry http请求的重试策略:
+// 429及建立连接前的网络错误任何请求都可以重试;其他网络错误及502/503/504只重试幂等的请求,
+// 避免POST等已经到达服务端的请求被重复执行
+type HttpRetry struct {
+	MaxRetry int           //重试次数,0不重试
+	Wait     time.Duration //第一次重试的等待时间,之后每次翻倍
+	MaxWait  time.Duration //单次等待的上限,0不限制
+}
+
+// HttpErrParser 将非2xx的应答转换为错误
+type HttpErrParser func(status int, body []byte) error
+
+// Do 发送请求并按策略重试,newReq每次重试都会调用以重新生成请求体,非2xx的应答由parseErr转换为错误
+func (r HttpRetry) Do(ctx context.Context, client *http.Client, newReq func(ctx context.Context) (*http.Request, error),
+	parseErr HttpErrParser) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var connected bool
+		traceCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(httptrace.GotConnInfo) { connected = true },
+		})
+		req, err := newReq(traceCtx)
+		if err != nil {
+			return nil, errors.Parameter.AddDetail(err)
+		}
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode < http.StatusMultipleChoices {
+			return resp, nil
+		}
+		var (
+			wait  time.Duration
+			retry bool
+		)
+		if err != nil {
+			retry = !connected || HttpIdempotent(req.Method)
+			err = errors.Fmt(err)
+		} else {
+			data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+			resp.Body.Close()
+			retry = HttpRetryStatus(req.Method, resp.StatusCode)
+			err = parseErr(resp.StatusCode, data)
+			wait = HttpRetryAfter(resp.Header)
+		}
+		if !retry || attempt >= r.MaxRetry || ctx.Err() != nil {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = r.Wait << attempt
+			if r.MaxWait > 0 {
+				wait = min(wait, r.MaxWait)
+			}
+		}
+		logx.WithContext(ctx).Infof("http request retry method:%s url:%s attempt:%d wait:%v err:%v",
+			req.Method, req.URL.Redacted(), attempt+1, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// HttpIdempotent 重复执行不会产生副作用的请求方法
+func HttpIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// HttpRetryStatus 应答状态码是否可以重试,429表示请求没有被处理,网关错误只有幂等的请求可以重试
+func HttpRetryStatus(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return HttpIdempotent(method)
+	}
+	return false
+}
+
+// HttpRetryAfter 解析Retry-After中的秒数,没有时返回0
+func HttpRetryAfter(h http.Header) time.Duration {
+	if sec, err := strconv.Atoi(h.Get("Retry-After")); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return 0
+}
+
+// HttpStatusErr http状态码对应的错误码
+func HttpStatusErr(status int) *errors.CodeError {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return errors.Parameter
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Permissions
+	case http.StatusNotFound:
+		return errors.NotFind
+	case http.StatusTooManyRequests:
+		return errors.TooManyRequests
+	}
+	return errors.System
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	retry := HttpRetry{MaxRetry: 2, Wait: time.Millisecond}
+	parse := func(status int, body []byte) error { return HttpStatusErr(status).AddDetail(string(body)) }
+	do := func(method string, url string) error {
+		_, err := retry.Do(context.Background(), http.DefaultClient, func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, method, url, nil)
+		}, parse)
+		return err
+	}
+	assert.Error(t, do(http.MethodGet, srv.URL))
+	assert.Equal(t, int32(3), calls.Load(), "幂等请求重试")
+	calls.Store(0)
+	assert.Error(t, do(http.MethodPost, srv.URL))
+	assert.Equal(t, int32(1), calls.Load(), "POST不重试网关错误")
+
+	//连接建立前失败,请求没有发出去,POST也可以重试
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	var attempts atomic.Int32
+	retry.Wait = 0
+	_, err = retry.Do(context.Background(), http.DefaultClient, func(ctx context.Context) (*http.Request, error) {
+		attempts.Add(1)
+		return http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr, nil)
+	}, parse)
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	assert.Equal(t, errors.Permissions, HttpStatusErr(http.StatusUnauthorized))
+	assert.Equal(t, errors.System, HttpStatusErr(http.StatusInternalServerError))
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gitee.com/unitedrhino/share/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	SseEventMessage = "message" //没有指定事件名时的默认事件
+	SseEventError   = "error"   //流开始后出现的错误,data为{"code":xx,"msg":"xx"}
+)
+
+// SseEvent 一个Server-Sent Events事件
+type SseEvent struct {
+	ID    string
+	Event string
+	Data  string //多行的data以\n连接
+	Retry int    //客户端重连的间隔,单位毫秒
+}
+
+// Encode 按事件流的格式写入
+func (e *SseEvent) Encode(w io.Writer) error {
+	var buf bytes.Buffer
+	if e.ID != "" {
+		buf.WriteString("id: " + strings.NewReplacer("\r", "", "\n", "", "\x00", "").Replace(e.ID) + "\n")
+	}
+	if e.Event != "" && e.Event != SseEventMessage {
+		buf.WriteString("event: " + strings.NewReplacer("\r", "", "\n", "").Replace(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.Itoa(e.Retry) + "\n")
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Err error事件转换成错误,其他事件返回nil
+func (e *SseEvent) Err() error {
+	if e.Event != SseEventError {
+		return nil
+	}
+	var ret struct {
+		Code int64  `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal([]byte(e.Data), &ret); err != nil || ret.Code == 0 {
+		return errors.System.AddMsg(e.Data)
+	}
+	return &errors.CodeError{Code: ret.Code, Msg: []errors.I18nImpl{errors.String(ret.Msg)}, MsgStr: ret.Msg}
+}
+
+// SseReader 按规范解析事件流,注释及没有data的事件会被忽略
+type SseReader struct {
+	scanner     *bufio.Scanner
+	lastEventID string
+	retry       int
+	started     bool
+}
+
+// NewSseReader 单行最大1M
+func NewSseReader(r io.Reader) *SseReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	scanner.Split(scanSseLines)
+	return &SseReader{scanner: scanner}
+}
+
+// LastEventID 最后收到的事件ID,重连时放在Last-Event-ID头中
+func (s *SseReader) LastEventID() string {
+	return s.lastEventID
+}
+
+// Retry 服务端要求的重连间隔,单位毫秒
+func (s *SseReader) Retry() int {
+	return s.retry
+}
+
+// Next 读取下一个事件,流结束时返回io.EOF,最后没有空行结束的事件会被丢弃
+func (s *SseReader) Next() (*SseEvent, error) {
+	var (
+		data    strings.Builder
+		event   string
+		hasData bool
+	)
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if !s.started {
+			s.started = true
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if line == "" { //空行分发事件
+			if !hasData {
+				event = ""
+				continue
+			}
+			ret := &SseEvent{ID: s.lastEventID, Event: event, Data: strings.TrimSuffix(data.String(), "\n"), Retry: s.retry}
+			if ret.Event == "" {
+				ret.Event = SseEventMessage
+			}
+			return ret, nil
+		}
+		if strings.HasPrefix(line, ":") { //注释,一般是心跳
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			hasData = true
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				s.lastEventID = value
+			}
+		case "retry":
+			if retry, err := strconv.Atoi(value); err == nil && retry >= 0 {
+				s.retry = retry
+			}
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read sse: %w", err)
+	}
+	return nil, io.EOF
+}
+
+// 行以\r\n,\n或\r结尾
+func scanSseLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if !atEOF { //需要下一个字符判断是不是\r\n
+			return 0, nil, nil
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
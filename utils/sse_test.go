@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllSse(t *testing.T, r *SseReader) []*SseEvent {
+	var ret []*SseEvent
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return ret
+		}
+		require.NoError(t, err)
+		ret = append(ret, e)
+	}
+}
+
+func TestSseReader(t *testing.T) {
+	stream := "\uFEFF: ping\n" +
+		"retry: 3000\n" +
+		"data: {\"a\":1}\n\n" +
+		"event: add\r\nid: 7\r\ndata: line1\r\ndata:line2\r\n\r\n" +
+		"event: skip\n\n" + //没有data的事件不分发
+		"data\rdata: x\r\r" +
+		"id\nevent: end\ndata: ok\n\n" +
+		"data: 没有空行结束的事件被丢弃"
+	r := NewSseReader(strings.NewReader(stream))
+	events := readAllSse(t, r)
+	assert.Equal(t, []*SseEvent{
+		{Event: SseEventMessage, Data: `{"a":1}`, Retry: 3000},
+		{ID: "7", Event: "add", Data: "line1\nline2", Retry: 3000},
+		{ID: "7", Event: SseEventMessage, Data: "\nx", Retry: 3000},
+		{Event: "end", Data: "ok", Retry: 3000},
+	}, events)
+	assert.Equal(t, "", r.LastEventID())
+	assert.Equal(t, 3000, r.Retry())
+}
+
+func TestSseEncode(t *testing.T) {
+	events := []*SseEvent{
+		{ID: "1", Event: "log", Data: "a\nb\r\nc"},
+		{ID: "2\n", Data: ""},
+		{Event: SseEventError, Data: `{"code":100004,"msg":"数据库错误"}`, Retry: 100},
+	}
+	var buf bytes.Buffer
+	for _, e := range events {
+		require.NoError(t, e.Encode(&buf))
+	}
+	assert.True(t, strings.HasPrefix(buf.String(), "id: 1\nevent: log\ndata: a\ndata: b\ndata: c\n\n"))
+
+	back := readAllSse(t, NewSseReader(&buf))
+	require.Len(t, back, 3)
+	assert.Equal(t, "a\nb\nc", back[0].Data)
+	assert.Equal(t, "2", back[1].ID)
+	assert.Equal(t, SseEventMessage, back[1].Event)
+	assert.Nil(t, back[1].Err())
+	err := back[2].Err()
+	assert.Equal(t, int64(100004), errors.Fmt(err).GetCode())
+	assert.Equal(t, "数据库错误", errors.Fmt(err).GetMsg())
+	assert.Equal(t, errors.System.GetCode(), errors.Fmt((&SseEvent{Event: SseEventError, Data: "oops"}).Err()).GetCode())
+}
@@ -31,12 +31,13 @@ var (
 	nodeID          int64
 	checkSubscribe  func(ctx context.Context, in *SubscribeInfo) error
 	checkSubscribe2 func(ctx context.Context, in *SubscribeInfo) ([]map[string]any, error)
+	sessionChecker  ctxs.SessionChecker
 	connectID       atomic.Int64
+	interval        = 10 * time.Second //心跳间隔
 )
 
 const (
 	errorCount    = 5                     //错误次数
-	interval      = 10 * time.Second      //心跳间隔
 	keepAliveType = websocket.PingMessage //心跳类型
 )
 
@@ -52,6 +53,8 @@ type connection struct {
 	closed             bool        //ws连接已关闭
 	send               chan []byte //发送信息管道
 	pingErr            atomic.Int64
+	ctx                context.Context //连接的生命周期,http请求的ctx在升级完成后就会取消
+	cancel             context.CancelFunc
 }
 
 // ws调度器
@@ -142,6 +145,19 @@ func RegisterSubscribeCheck2(f func(ctx context.Context, in *SubscribeInfo) ([]m
 	checkSubscribe2 = f
 }
 
+// RegisterSessionCheck 注册会话检查,建立连接及每次心跳时检查,会话被吊销时断开连接
+func RegisterSessionCheck(c ctxs.SessionChecker) {
+	sessionChecker = c
+}
+
+// 检查连接的会话是否被吊销
+func (c *connection) checkSession(ctx context.Context) error {
+	if sessionChecker == nil || c.uc == nil || c.uc.Token == "" {
+		return nil
+	}
+	return sessionChecker.CheckToken(ctx, c.uc.Token)
+}
+
 // 创建ws调度器
 func newDp(s2cGzip bool) *dispatcher {
 	d := &dispatcher{
@@ -226,6 +242,14 @@ func NewConn(ctx context.Context, userID int64, server *Server, r *http.Request,
 		connectID:     connectID.Add(1),
 		send:          make(chan []byte, 10000),
 	}
+	conn.ctx, conn.cancel = context.WithCancel(ctxs.SetUserCtx(context.Background(), conn.uc))
+	if err := conn.checkSession(ctx); err != nil { //会话已吊销,返回错误后断开
+		e := errors.Fmt(err)
+		message, _ := json.Marshal(WsResp{Code: e.GetCode(), Msg: e.GetI18nMsg(conn.uc.AcceptLanguage)})
+		conn.writeMessage(websocket.TextMessage, message)
+		conn.Close("session revoked")
+		return conn
+	}
 	AddConnPool(userID, conn)
 	logx.Infof("websocket 创建连接成功 RemoteAddr::%s userID:%v connectID:%v uc:%v",
 		wsConn.RemoteAddr().String(), userID, conn.connectID, utils.Fmt(conn.uc))
@@ -416,6 +440,11 @@ func (c *connection) StartWrite() {
 				c.Close("connection timeout")
 				return
 			}
+			if err := c.checkSession(c.ctx); err != nil {
+				logx.Infof("websocket session revoked userID:%v connectID:%v err:%v", c.userID, c.connectID, err)
+				c.Close("session revoked")
+				return
+			}
 		//发送信息
 		case message := <-c.send:
 			if c.closed {
@@ -439,6 +468,7 @@ func (c *connection) Close(msg string) {
 	_, ok := dp.connPool[c.userID]
 	if ok || !c.closed {
 		c.closed = true
+		c.cancel()
 		func() {
 			defer func() {
 				recover()
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitee.com/unitedrhino/share/ctxs"
+	"gitee.com/unitedrhino/share/errors"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// 和users.SessionStore一样,检查出错(如ctx已取消)时不拦截
+type fakeSessionChecker struct {
+	revoked atomic.Bool
+}
+
+func (f *fakeSessionChecker) CheckToken(ctx context.Context, token string) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	if f.revoked.Load() {
+		return errors.TokenInvalid
+	}
+	return nil
+}
+
+func TestConnSessionRevoked(t *testing.T) {
+	if dp == nil {
+		dp = newDp(false)
+	}
+	oldInterval, oldChecker := interval, sessionChecker
+	t.Cleanup(func() { interval, sessionChecker = oldInterval, oldChecker })
+	interval = 20 * time.Millisecond
+	checker := &fakeSessionChecker{}
+	RegisterSessionCheck(checker)
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ctx := ctxs.SetUserCtx(r.Context(), &ctxs.UserCtx{UserID: 1, Token: "token"})
+		conn := NewConn(ctx, 1, nil, r, ws)
+		go conn.StartRead()
+		go conn.StartWrite()
+		//处理函数返回后r.Context()被取消,连接继续使用
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer client.Close()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(5 * interval)
+	select {
+	case <-closed:
+		t.Fatal("会话有效时不能断开连接")
+	default:
+	}
+	checker.revoked.Store(true)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("会话吊销后没有断开连接")
+	}
+}